@@ -1,8 +1,19 @@
 package ai
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
 
 	"rulerefinery/internal/config"
 )
@@ -12,8 +23,23 @@ type Client interface {
 	// Chat 发送聊天请求并返回响应
 	Chat(ctx context.Context, prompt string) (string, error)
 
+	// ChatWithOptions 发送聊天请求，使用 opts 覆盖客户端默认参数
+	ChatWithOptions(ctx context.Context, prompt string, opts ChatOptions) (string, error)
+
 	// GetProviderName 获取提供商名称
 	GetProviderName() string
+
+	// GetUsage 获取累计 token 使用情况
+	GetUsage() Usage
+}
+
+// ChatOptions 单次请求参数（未设置的字段使用客户端默认配置）
+type ChatOptions struct {
+	Temperature *float64 // 温度参数覆盖（nil 表示使用客户端默认值）
+
+	// RequestLogFile 非空时将完整的 HTTP 请求（URL、请求头、请求体，密钥已脱敏）和原始响应体追加到该文件
+	// （重试和备用提供商的每次请求依次记录，不会覆盖失败的请求；由调用方清理上次运行的文件）
+	RequestLogFile string
 }
 
 // BaseClient 基础客户端实现
@@ -21,6 +47,9 @@ type BaseClient struct {
 	Config     config.ProviderConfig
 	HTTPClient *http.Client
 	Provider   string
+
+	usage   Usage      // 累计 token 使用情况
+	usageMu sync.Mutex // 保护 usage
 }
 
 // GetProviderName 实现 Client 接口
@@ -28,12 +57,140 @@ func (c *BaseClient) GetProviderName() string {
 	return c.Provider
 }
 
+// GetUsage 实现 Client 接口
+func (c *BaseClient) GetUsage() Usage {
+	c.usageMu.Lock()
+	defer c.usageMu.Unlock()
+	return c.usage
+}
+
+// addUsage 累加单次请求的 token 使用情况
+func (c *BaseClient) addUsage(u Usage) {
+	c.usageMu.Lock()
+	defer c.usageMu.Unlock()
+	c.usage.Add(u)
+}
+
+// resolveTemperature 计算本次请求使用的温度参数
+func (c *BaseClient) resolveTemperature(opts ChatOptions) *float64 {
+	if opts.Temperature != nil {
+		t := *opts.Temperature
+		return &t
+	}
+	t := c.Config.Temperature
+	return &t
+}
+
+// redacted 脱敏后的占位内容
+const redacted = "[REDACTED]"
+
+// sensitiveHeaders 需要脱敏的请求头
+var sensitiveHeaders = map[string]bool{
+	"Authorization":  true,
+	"X-Api-Key":      true,
+	"X-Goog-Api-Key": true,
+	"Api-Key":        true,
+}
+
+// send 发送请求并读取完整响应体
+// opts.RequestLogFile 非空时记录请求和响应（记录失败只警告，不影响请求结果）
+func (c *BaseClient) send(req *http.Request, body []byte, opts ChatOptions) (int, []byte, error) {
+	start := time.Now()
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		c.logExchange(opts.RequestLogFile, req, body, 0, nil, err, time.Since(start))
+		return 0, nil, fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	c.logExchange(opts.RequestLogFile, req, body, resp.StatusCode, respBody, err, time.Since(start))
+	if err != nil {
+		return resp.StatusCode, nil, fmt.Errorf("read response: %w", err)
+	}
+	return resp.StatusCode, respBody, nil
+}
+
+// logExchange 将一次请求和响应写入日志文件，API 密钥在 URL、请求头和内容中都会被替换
+func (c *BaseClient) logExchange(path string, req *http.Request, body []byte, status int, respBody []byte, respErr error, elapsed time.Duration) {
+	if path == "" {
+		return
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "=== 请求 (%s) ===\n", time.Now().Format(time.RFC3339))
+	fmt.Fprintf(&buf, "%s %s\n", req.Method, c.redact(redactURL(req.URL.String())))
+	names := make([]string, 0, len(req.Header))
+	for name := range req.Header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := strings.Join(req.Header[name], ", ")
+		if sensitiveHeaders[http.CanonicalHeaderKey(name)] {
+			value = redacted
+		}
+		fmt.Fprintf(&buf, "%s: %s\n", name, c.redact(value))
+	}
+	buf.WriteString("\n")
+	var pretty bytes.Buffer
+	if json.Indent(&pretty, body, "", "  ") == nil {
+		body = pretty.Bytes()
+	}
+	buf.WriteString(c.redact(string(body)))
+
+	fmt.Fprintf(&buf, "\n\n=== 响应 (耗时 %s) ===\n", elapsed.Round(time.Millisecond))
+	if status > 0 {
+		fmt.Fprintf(&buf, "状态码: %d\n\n", status)
+	}
+	if respErr != nil {
+		fmt.Fprintf(&buf, "错误: %s\n", c.redact(respErr.Error()))
+	}
+	buf.WriteString(c.redact(string(respBody)))
+	buf.WriteString("\n")
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		log.Warn().Msgf("保存 AI 请求日志失败: %v", err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		log.Warn().Msgf("保存 AI 请求日志失败: %v", err)
+	}
+}
+
+// redact 替换内容中出现的 API 密钥
+func (c *BaseClient) redact(s string) string {
+	if c.Config.APIKey == "" {
+		return s
+	}
+	return strings.ReplaceAll(s, c.Config.APIKey, redacted)
+}
+
+// redactURL 替换 URL 查询参数中的密钥（如 Gemini 的 ?key=）
+func redactURL(rawURL string) string {
+	base, query, ok := strings.Cut(rawURL, "?")
+	if !ok {
+		return rawURL
+	}
+	params := strings.Split(query, "&")
+	for i, param := range params {
+		name, _, _ := strings.Cut(param, "=")
+		switch strings.ToLower(name) {
+		case "key", "api_key", "apikey", "access_token", "token":
+			params[i] = name + "=" + redacted
+		}
+	}
+	return base + "?" + strings.Join(params, "&")
+}
+
 // ChatRequest 通用聊天请求结构
 type ChatRequest struct {
 	Model       string    `json:"model"`
 	Messages    []Message `json:"messages"`
 	MaxTokens   int       `json:"max_tokens,omitempty"`
-	Temperature float64   `json:"temperature,omitempty"`
+	Temperature *float64  `json:"temperature,omitempty"` // 指针类型，确保 0 也会被发送
 	Stream      bool      `json:"stream"`
 }
 
@@ -66,3 +223,10 @@ type Usage struct {
 	CompletionTokens int `json:"completion_tokens"`
 	TotalTokens      int `json:"total_tokens"`
 }
+
+// Add 累加 token 使用情况
+func (u *Usage) Add(other Usage) {
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+	u.TotalTokens += other.TotalTokens
+}
@@ -0,0 +1,40 @@
+package ai
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"rulerefinery/internal/config"
+)
+
+func TestLogExchangeAppendsRetries(t *testing.T) {
+	c := &BaseClient{Config: config.ProviderConfig{APIKey: "secret-key"}}
+	path := filepath.Join(t.TempDir(), "batch_1_request.log")
+	req, err := http.NewRequest(http.MethodPost, "https://api.example.com/v1/chat", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer secret-key")
+
+	c.logExchange(path, req, []byte(`{"attempt":1}`), http.StatusInternalServerError, []byte("upstream error"), nil, time.Second)
+	c.logExchange(path, req, []byte(`{"attempt":2}`), http.StatusOK, []byte("ok"), nil, time.Second)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := string(data)
+	if got := strings.Count(content, "=== 请求"); got != 2 {
+		t.Errorf("request log has %d requests, want 2 (failed attempt kept)", got)
+	}
+	if !strings.Contains(content, "upstream error") || !strings.Contains(content, `"attempt": 2`) {
+		t.Errorf("request log missing an attempt:\n%s", content)
+	}
+	if strings.Contains(content, "secret-key") {
+		t.Error("request log contains the API key")
+	}
+}
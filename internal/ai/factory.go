@@ -3,10 +3,50 @@ package ai
 import (
 	"fmt"
 	"net/http"
+	"strings"
 
 	"rulerefinery/internal/config"
 )
 
+// ProviderDefaults 提供商的默认参数（config.yaml 中未设置对应字段时使用）
+type ProviderDefaults struct {
+	BaseURL string // API 基础 URL
+	Model   string // 模型名称
+}
+
+// 通用默认参数（所有提供商相同）
+const (
+	defaultMaxTokens   = 1000
+	defaultTemperature = 0.7
+)
+
+// providerDefaults 各提供商的默认 API 地址和模型
+// 提供商下线或更名模型时只需更新这里；config.yaml 中的 ai.base_url/ai.model 始终优先
+var providerDefaults = map[string]ProviderDefaults{
+	"openai":   {BaseURL: "https://api.openai.com/v1", Model: "gpt-4o-mini"},
+	"grok":     {BaseURL: "https://api.x.ai/v1", Model: "grok-3-mini"},
+	"gemini":   {BaseURL: "https://generativelanguage.googleapis.com/v1beta", Model: "gemini-2.5-flash"},
+	"deepseek": {BaseURL: "https://api.deepseek.com/v1", Model: "deepseek-chat"},
+}
+
+// withProviderDefaults 为未设置的字段填充提供商默认值
+func withProviderDefaults(provider string, cfg config.ProviderConfig) config.ProviderConfig {
+	defaults := providerDefaults[provider]
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = defaults.BaseURL
+	}
+	if cfg.Model == "" {
+		cfg.Model = defaults.Model
+	}
+	if cfg.MaxTokens == 0 {
+		cfg.MaxTokens = defaultMaxTokens
+	}
+	if cfg.Temperature == 0 {
+		cfg.Temperature = defaultTemperature
+	}
+	return cfg
+}
+
 // NewClient 创建 AI 客户端
 func NewClient(aiConfig config.AIConfig, httpClient *http.Client) (Client, error) {
 	if !aiConfig.IsAIEnabled() {
@@ -28,6 +68,13 @@ func NewClient(aiConfig config.AIConfig, httpClient *http.Client) (Client, error
 		Temperature: aiConfig.Temperature,
 	}
 
+	if _, ok := providerDefaults[aiConfig.Provider]; !ok {
+		return nil, fmt.Errorf("unsupported AI provider: %s", aiConfig.Provider)
+	}
+	if model := withProviderDefaults(aiConfig.Provider, providerCfg).Model; strings.TrimSpace(model) == "" {
+		return nil, fmt.Errorf("AI model is empty for provider %s: set ai.model in config.yaml", aiConfig.Provider)
+	}
+
 	switch aiConfig.Provider {
 	case "openai":
 		return NewOpenAIClient(providerCfg, httpClient), nil
@@ -41,3 +88,20 @@ func NewClient(aiConfig config.AIConfig, httpClient *http.Client) (Client, error
 		return nil, fmt.Errorf("unsupported AI provider: %s", aiConfig.Provider)
 	}
 }
+
+// NewClients 创建主 AI 客户端，配置了 ai.fallback 时同时创建备用客户端（否则 fallback 为 nil）
+// newHTTPClient 为每个提供商创建 HTTP 客户端（两者的请求超时可能不同）
+func NewClients(aiConfig config.AIConfig, newHTTPClient func(config.AIConfig) *http.Client) (primary Client, fallback Client, err error) {
+	primary, err = NewClient(aiConfig, newHTTPClient(aiConfig))
+	if err != nil {
+		return nil, nil, err
+	}
+	if aiConfig.Fallback == nil {
+		return primary, nil, nil
+	}
+	fallback, err = NewClient(*aiConfig.Fallback, newHTTPClient(*aiConfig.Fallback))
+	if err != nil {
+		return nil, nil, fmt.Errorf("fallback: %w", err)
+	}
+	return primary, fallback, nil
+}
@@ -5,7 +5,6 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 
 	"rulerefinery/internal/config"
@@ -18,18 +17,7 @@ type GeminiClient struct {
 
 // NewGeminiClient 创建 Gemini 客户端
 func NewGeminiClient(cfg config.ProviderConfig, httpClient *http.Client) *GeminiClient {
-	if cfg.BaseURL == "" {
-		cfg.BaseURL = "https://generativelanguage.googleapis.com/v1beta"
-	}
-	if cfg.Model == "" {
-		cfg.Model = "gemini-pro"
-	}
-	if cfg.MaxTokens == 0 {
-		cfg.MaxTokens = 1000
-	}
-	if cfg.Temperature == 0 {
-		cfg.Temperature = 0.7
-	}
+	cfg = withProviderDefaults("gemini", cfg)
 
 	return &GeminiClient{
 		BaseClient: BaseClient{
@@ -65,13 +53,21 @@ type GeminiSystemInstruction struct {
 
 // GeminiGenerationConfig 生成配置
 type GeminiGenerationConfig struct {
-	Temperature     float64 `json:"temperature,omitempty"`
-	MaxOutputTokens int     `json:"maxOutputTokens,omitempty"`
+	Temperature     *float64 `json:"temperature,omitempty"`
+	MaxOutputTokens int      `json:"maxOutputTokens,omitempty"`
 }
 
 // GeminiResponse Gemini 响应结构
 type GeminiResponse struct {
-	Candidates []GeminiCandidate `json:"candidates"`
+	Candidates    []GeminiCandidate   `json:"candidates"`
+	UsageMetadata GeminiUsageMetadata `json:"usageMetadata"`
+}
+
+// GeminiUsageMetadata token 使用情况
+type GeminiUsageMetadata struct {
+	PromptTokenCount     int `json:"promptTokenCount"`
+	CandidatesTokenCount int `json:"candidatesTokenCount"`
+	TotalTokenCount      int `json:"totalTokenCount"`
 }
 
 // GeminiCandidate 候选项
@@ -82,6 +78,11 @@ type GeminiCandidate struct {
 
 // Chat 发送聊天请求
 func (c *GeminiClient) Chat(ctx context.Context, prompt string) (string, error) {
+	return c.ChatWithOptions(ctx, prompt, ChatOptions{})
+}
+
+// ChatWithOptions 发送聊天请求（支持覆盖请求参数）
+func (c *GeminiClient) ChatWithOptions(ctx context.Context, prompt string, opts ChatOptions) (string, error) {
 	reqBody := GeminiRequest{
 		Contents: []GeminiContent{
 			{
@@ -91,7 +92,7 @@ func (c *GeminiClient) Chat(ctx context.Context, prompt string) (string, error)
 			},
 		},
 		GenerationConfig: GeminiGenerationConfig{
-			Temperature:     c.Config.Temperature,
+			Temperature:     c.resolveTemperature(opts),
 			MaxOutputTokens: c.Config.MaxTokens,
 		},
 	}
@@ -121,22 +122,25 @@ func (c *GeminiClient) Chat(ctx context.Context, prompt string) (string, error)
 
 	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := c.HTTPClient.Do(req)
+	status, respBody, err := c.send(req, bodyBytes, opts)
 	if err != nil {
-		return "", fmt.Errorf("send request: %w", err)
+		return "", err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+	if status != http.StatusOK {
+		return "", fmt.Errorf("API error (status %d): %s", status, string(respBody))
 	}
 
 	var geminiResp GeminiResponse
-	if err := json.NewDecoder(resp.Body).Decode(&geminiResp); err != nil {
+	if err := json.Unmarshal(respBody, &geminiResp); err != nil {
 		return "", fmt.Errorf("decode response: %w", err)
 	}
 
+	c.addUsage(Usage{
+		PromptTokens:     geminiResp.UsageMetadata.PromptTokenCount,
+		CompletionTokens: geminiResp.UsageMetadata.CandidatesTokenCount,
+		TotalTokens:      geminiResp.UsageMetadata.TotalTokenCount,
+	})
+
 	if len(geminiResp.Candidates) == 0 || len(geminiResp.Candidates[0].Content.Parts) == 0 {
 		return "", fmt.Errorf("no content in response")
 	}
@@ -5,7 +5,6 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 
 	"rulerefinery/internal/config"
@@ -18,18 +17,7 @@ type GrokClient struct {
 
 // NewGrokClient 创建 Grok 客户端
 func NewGrokClient(cfg config.ProviderConfig, httpClient *http.Client) *GrokClient {
-	if cfg.BaseURL == "" {
-		cfg.BaseURL = "https://api.x.ai/v1"
-	}
-	if cfg.Model == "" {
-		cfg.Model = "grok-beta"
-	}
-	if cfg.MaxTokens == 0 {
-		cfg.MaxTokens = 1000
-	}
-	if cfg.Temperature == 0 {
-		cfg.Temperature = 0.7
-	}
+	cfg = withProviderDefaults("grok", cfg)
 
 	return &GrokClient{
 		BaseClient: BaseClient{
@@ -42,6 +30,11 @@ func NewGrokClient(cfg config.ProviderConfig, httpClient *http.Client) *GrokClie
 
 // Chat 发送聊天请求
 func (c *GrokClient) Chat(ctx context.Context, prompt string) (string, error) {
+	return c.ChatWithOptions(ctx, prompt, ChatOptions{})
+}
+
+// ChatWithOptions 发送聊天请求（支持覆盖请求参数）
+func (c *GrokClient) ChatWithOptions(ctx context.Context, prompt string, opts ChatOptions) (string, error) {
 	messages := []Message{
 		{
 			Role:    "user",
@@ -63,7 +56,7 @@ func (c *GrokClient) Chat(ctx context.Context, prompt string) (string, error) {
 		Model:       c.Config.Model,
 		Messages:    messages,
 		MaxTokens:   c.Config.MaxTokens,
-		Temperature: c.Config.Temperature,
+		Temperature: c.resolveTemperature(opts),
 		Stream:      false,
 	}
 
@@ -80,22 +73,21 @@ func (c *GrokClient) Chat(ctx context.Context, prompt string) (string, error) {
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+c.Config.APIKey)
 
-	resp, err := c.HTTPClient.Do(req)
+	status, respBody, err := c.send(req, bodyBytes, opts)
 	if err != nil {
-		return "", fmt.Errorf("send request: %w", err)
+		return "", err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+	if status != http.StatusOK {
+		return "", fmt.Errorf("API error (status %d): %s", status, string(respBody))
 	}
 
 	var chatResp ChatResponse
-	if err := json.NewDecoder(resp.Body).Decode(&chatResp); err != nil {
+	if err := json.Unmarshal(respBody, &chatResp); err != nil {
 		return "", fmt.Errorf("decode response: %w", err)
 	}
 
+	c.addUsage(chatResp.Usage)
+
 	if len(chatResp.Choices) == 0 {
 		return "", fmt.Errorf("no choices in response")
 	}
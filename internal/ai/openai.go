@@ -5,7 +5,6 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 
 	"rulerefinery/internal/config"
@@ -18,18 +17,7 @@ type OpenAIClient struct {
 
 // NewOpenAIClient 创建 OpenAI 客户端
 func NewOpenAIClient(cfg config.ProviderConfig, httpClient *http.Client) *OpenAIClient {
-	if cfg.BaseURL == "" {
-		cfg.BaseURL = "https://api.openai.com/v1"
-	}
-	if cfg.Model == "" {
-		cfg.Model = "gpt-4o-mini"
-	}
-	if cfg.MaxTokens == 0 {
-		cfg.MaxTokens = 1000
-	}
-	if cfg.Temperature == 0 {
-		cfg.Temperature = 0.7
-	}
+	cfg = withProviderDefaults("openai", cfg)
 
 	return &OpenAIClient{
 		BaseClient: BaseClient{
@@ -42,6 +30,11 @@ func NewOpenAIClient(cfg config.ProviderConfig, httpClient *http.Client) *OpenAI
 
 // Chat 发送聊天请求
 func (c *OpenAIClient) Chat(ctx context.Context, prompt string) (string, error) {
+	return c.ChatWithOptions(ctx, prompt, ChatOptions{})
+}
+
+// ChatWithOptions 发送聊天请求（支持覆盖请求参数）
+func (c *OpenAIClient) ChatWithOptions(ctx context.Context, prompt string, opts ChatOptions) (string, error) {
 	messages := []Message{
 		{
 			Role:    "user",
@@ -63,7 +56,7 @@ func (c *OpenAIClient) Chat(ctx context.Context, prompt string) (string, error)
 		Model:       c.Config.Model,
 		Messages:    messages,
 		MaxTokens:   c.Config.MaxTokens,
-		Temperature: c.Config.Temperature,
+		Temperature: c.resolveTemperature(opts),
 		Stream:      false,
 	}
 
@@ -80,22 +73,21 @@ func (c *OpenAIClient) Chat(ctx context.Context, prompt string) (string, error)
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+c.Config.APIKey)
 
-	resp, err := c.HTTPClient.Do(req)
+	status, respBody, err := c.send(req, bodyBytes, opts)
 	if err != nil {
-		return "", fmt.Errorf("send request: %w", err)
+		return "", err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+	if status != http.StatusOK {
+		return "", fmt.Errorf("API error (status %d): %s", status, string(respBody))
 	}
 
 	var chatResp ChatResponse
-	if err := json.NewDecoder(resp.Body).Decode(&chatResp); err != nil {
+	if err := json.Unmarshal(respBody, &chatResp); err != nil {
 		return "", fmt.Errorf("decode response: %w", err)
 	}
 
+	c.addUsage(chatResp.Usage)
+
 	if len(chatResp.Choices) == 0 {
 		return "", fmt.Errorf("no choices in response")
 	}
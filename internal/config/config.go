@@ -3,18 +3,25 @@ package config
 import (
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
+	"github.com/bmatcuk/doublestar/v4"
 	"gopkg.in/yaml.v3"
 )
 
 // Config 主配置结构
 type Config struct {
 	Proxy           ProxyConfig            `yaml:"proxy"`
+	HTTP            HTTPConfig             `yaml:"http"`
 	AI              AIConfig               `yaml:"ai"`
 	RuleSources     RuleSetsGenConfig      `yaml:"rule-sources"`
 	AIClassifyRules AIClassifyRulesConfig  `yaml:"ai_classify_rules"`
 	GenerateRules   GenerateRulesetsConfig `yaml:"generate_rules"`
 	Logging         LoggingConfig          `yaml:"logging"`
+
+	// RunTimeout 整个运行的超时时间（如 30m、1h），超时后取消所有下载和 AI 请求并退出；0 表示不限制
+	RunTimeout time.Duration `yaml:"run_timeout"`
 }
 
 // LoggingConfig 日志配置
@@ -28,8 +35,43 @@ type LoggingConfig struct {
 
 // ProxyConfig 代理配置
 type ProxyConfig struct {
-	Enabled bool     `yaml:"enabled"`
-	URLs    []string `yaml:"urls"` // 支持 socks5://、socks4://、http://、https://
+	Enabled  bool         `yaml:"enabled"`
+	URLs     []ProxyEntry `yaml:"urls"`     // 支持 socks5://、socks5h://、http://、https://（不支持 socks4://）
+	Strategy string       `yaml:"strategy"` // 代理选择策略: priority（按协议优先级，默认）/weighted（按权重随机）
+}
+
+// HTTPConfig HTTP 下载配置
+type HTTPConfig struct {
+	DoHURL string `yaml:"doh_url"` // DNS-over-HTTPS 解析地址（可选），如 https://1.1.1.1/dns-query，用于 DNS 污染环境
+}
+
+// ProxyEntry 代理条目
+// 支持两种写法：
+//   - 字符串: "socks5://127.0.0.1:1080"
+//   - 结构体: {url: "socks5://127.0.0.1:1080", weight: 3}
+type ProxyEntry struct {
+	URL    string `yaml:"url"`
+	Weight int    `yaml:"weight"` // 权重（weighted 策略使用，默认 1）
+}
+
+// UnmarshalYAML 支持字符串和结构体两种写法
+func (e *ProxyEntry) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		e.URL = value.Value
+		e.Weight = 1
+		return nil
+	}
+
+	type rawEntry ProxyEntry
+	var raw rawEntry
+	if err := value.Decode(&raw); err != nil {
+		return err
+	}
+	*e = ProxyEntry(raw)
+	if e.Weight <= 0 {
+		e.Weight = 1
+	}
+	return nil
 }
 
 // GitHubConfig GitHub 配置
@@ -40,6 +82,12 @@ type GitHubConfig struct {
 	OrganizeByRepo    bool               `yaml:"organize_by_repo"`    // true=按owner/repo/branch组织目录, false=扁平化
 	DownloadThreads   int                `yaml:"download_threads"`    // 并发下载线程数，默认10
 	OverwriteRuleFile bool               `yaml:"overwrite_rule_file"` // true=覆盖已有规则文件, false=跳过已存在的文件（默认false）
+	IgnoreFile        string             `yaml:"ignore_file"`         // .gitignore 风格的全局忽略文件，模式应用于所有仓库（默认 .refineryignore，不存在时忽略）
+
+	// MaxConcurrentRepos 同时处理的仓库数量上限（默认 5），每个仓库各有 download_threads 个下载线程
+	MaxConcurrentRepos int `yaml:"max_concurrent_repos"`
+	// RateLimitMaxWaitSeconds 触发 GitHub API 速率限制时最多等待到重置时间的秒数（默认 600），需要等待更久时直接失败
+	RateLimitMaxWaitSeconds int `yaml:"rate_limit_max_wait_seconds"`
 }
 
 // RepositoryConfig GitHub 仓库配置
@@ -47,9 +95,45 @@ type RepositoryConfig struct {
 	Owner    string       `yaml:"owner"`
 	Repo     string       `yaml:"repo"`
 	Branch   string       `yaml:"branch"`
+	Branches []string     `yaml:"branches"` // 多个分支（可选，与 branch 合并）
 	Path     string       `yaml:"path"`     // 仓库内路径
+	Paths    []string     `yaml:"paths"`    // 多个仓库内路径（可选，与 path 合并，在同一次目录树遍历中匹配）
 	Filters  []FilterRule `yaml:"filters"`  // 过滤规则列表
 	Excludes []string     `yaml:"excludes"` // 排除模式列表（支持 glob 模式，如 *_ipv6.list）
+
+	// License 仓库规则的许可证（如 MIT、GPL-3.0，可选）。任一仓库配置后，每个规则集额外输出来源许可证文件
+	License string `yaml:"license,omitempty"`
+}
+
+// BranchList 返回需要获取的分支：branch 与 branches 合并去重（branch 在前）
+func (r RepositoryConfig) BranchList() []string {
+	branches := mergeUniqueStrings(nonEmptyStrings(r.Branch), nonEmptyStrings(r.Branches...))
+	if len(branches) == 0 {
+		return []string{r.Branch}
+	}
+	return branches
+}
+
+// PathList 返回仓库内路径：path 与 paths 合并去重，为空时表示整个仓库
+// paths 中包含空字符串（根目录）时同样表示整个仓库
+func (r RepositoryConfig) PathList() []string {
+	for _, p := range r.Paths {
+		if p == "" {
+			return nil
+		}
+	}
+	return mergeUniqueStrings(nonEmptyStrings(r.Path), r.Paths)
+}
+
+// nonEmptyStrings 返回非空的字符串
+func nonEmptyStrings(values ...string) []string {
+	var result []string
+	for _, v := range values {
+		if v != "" {
+			result = append(result, v)
+		}
+	}
+	return result
 }
 
 // FilterRule 过滤规则
@@ -63,17 +147,119 @@ type AIClassifyRulesConfig struct {
 	Enabled                    bool   `yaml:"enabled"`                       // 是否启用
 	ClassifiedRulesFile        string `yaml:"classified_rules_file"`         // 规则分类文件路径
 	AIGeneratedClassifiedRules string `yaml:"ai_generated_classified_rules"` // AI 生成规则分类文件输出路径
+
+	// SimilarityThreshold 新规则文件与已有规则集（合并后的规则内容）的 Jaccard 相似度达到该值时直接归入该规则集，
+	// 不再交给 AI 分类（0-1，0 表示不启用）
+	SimilarityThreshold float64 `yaml:"similarity_threshold"`
+
+	// PathClassifiers 按规则文件路径预分类：glob 模式（doublestar 语法，匹配 owner/repo/路径 或本地路径）-> 规则集名称，
+	// 匹配的文件直接归入该规则集，不再交给 AI；多个模式匹配时最长的模式优先
+	PathClassifiers map[string]string `yaml:"path_classifiers"`
 }
 
 // GenerateRulesetsConfig 规则集生成配置
 type GenerateRulesetsConfig struct {
-	Enabled         bool   `yaml:"enabled"`           // 是否启用
-	OutputRulesPath string `yaml:"output_rules_path"` // 规则集输出目录
+	Enabled               bool   `yaml:"enabled"`                 // 是否启用
+	OutputRulesPath       string `yaml:"output_rules_path"`       // 规则集输出目录
+	GuardrailMode         string `yaml:"guardrail_mode"`          // 规则数量超出 min_rules/max_rules 时的处理: warn/fail/off（默认 warn）
+	PruneStale            bool   `yaml:"prune_stale"`             // 导出后删除已不在规则分类文件中的规则集目录（仅限本工具生成的目录）
+	Autofix               bool   `yaml:"autofix"`                 // 加载时自动修正安全、无歧义的上游错误（如 DOMAIN,*.x → DOMAIN-SUFFIX,x）
+	GeoSiteDB             string `yaml:"geosite_db"`              // geosite.dat 路径（可选），设置后 GEOSITE 规则展开为对应的域名规则
+	WildcardAsRegex       bool   `yaml:"wildcard_as_regex"`       // 导出 classical 时将 DOMAIN-WILDCARD 转换为等价的 DOMAIN-REGEX（用于不支持通配符的客户端）
+	DomainIncludeWildcard bool   `yaml:"domain_include_wildcard"` // 导出 domain 时包含可以用 domain behavior 语法表示的 DOMAIN-WILDCARD（依赖较新版本的 Mihomo）
+	SuffixMode            string `yaml:"suffix_mode"`             // 导出 domain 时 DOMAIN-SUFFIX 的写法: plus/dot/preserve（默认 plus）
+	CollapseSubdomains    bool   `yaml:"collapse_subdomains"`     // 去重时移除已被同一规则集中上级 DOMAIN-SUFFIX 覆盖的 DOMAIN/DOMAIN-SUFFIX
+	MergeCIDRs            *bool  `yaml:"merge_cidrs"`             // 去重时移除被更大网段包含的 IP 网段，并将相邻的同级网段合并为上级网段（默认 true）
+	MergePorts            bool   `yaml:"merge_ports"`             // 去重时将连续或重叠的 DST-PORT/SRC-PORT/IN-PORT 端口合并为范围（如 80、81 → 80-81）
+	CheckMetadata         bool   `yaml:"check_metadata"`          // 解析规则文件头部的元数据注释（如 # TOTAL: 1234），与实际解析数量不一致时警告
+	ListExtension         string `yaml:"list_extension"`          // 纯文本格式规则文件的扩展名（默认 .list）
+	YAMLExtension         string `yaml:"yaml_extension"`          // YAML 格式规则文件的扩展名（默认 .yaml）
+	EmitProviderConfig    bool   `yaml:"emit_provider_config"`    // 在输出目录生成 rule-providers.yaml 配置片段（声明各规则集的 rule-provider）
+	ProviderFormat        string `yaml:"provider_format"`         // 配置片段引用的文件格式: yaml/text（默认 yaml）
+	EmitSingbox           bool   `yaml:"emit_singbox"`            // 每个规则集额外导出 sing-box source 格式规则集（{name}_singbox.json）
+	EmitInvalidReport     bool   `yaml:"emit_invalid_report"`     // 为加载时丢弃了无效规则的规则集生成报告（{name}_invalid.txt）
+	EmitChangelog         bool   `yaml:"emit_changelog"`          // 与上次运行的导出结果比较，在输出目录的 CHANGELOG.md 中追加各规则集的新增/移除
+	ExcludePrivateIPs     bool   `yaml:"exclude_private_ips"`     // 导出时移除私有/保留地址段内的 IP-CIDR/IP-CIDR6 规则（规则集可用 exclude_private_ips 单独设置）
+	Layout                string `yaml:"layout"`                  // 输出目录结构: by_ruleset（每个规则集一个目录）/by_behavior（每个导出类型一个目录），默认 by_ruleset
+	StrictFilters         bool   `yaml:"strict_filters"`          // filters 没有匹配任何规则或过滤后规则集为空时返回错误（默认只警告）
+	ConflictMode          string `yaml:"conflict_mode"`           // 同一规则内容出现在多个规则集中时的处理: warn（写入 conflicts.txt 并警告）/fail/off（默认 warn）
+
+	// KnownOptions 识别为规则参数的字段（默认 no-resolve、src），payload 之后的其他字段视为策略（如 Proxy、DIRECT）
+	KnownOptions []string `yaml:"known_options"`
+	// AppendPolicy classical 输出中保留规则行中的策略（默认移除，rule-provider 中的规则不能带策略）
+	AppendPolicy bool `yaml:"append_policy"`
+
+	// SkipInvalidRulesets 规则分类文件中部分规则集未通过验证时跳过这些规则集，继续生成其余规则集（默认整体失败）
+	SkipInvalidRulesets bool `yaml:"skip_invalid_rulesets"`
+
+	// RulesetPriority 规则集优先级（从高到低）：同一规则出现在多个规则集中时只保留在优先级最高的规则集中，
+	// 未列出的规则集优先级最低（按规则分类文件中的顺序）；为空时不处理重叠
+	RulesetPriority []string `yaml:"ruleset_priority"`
+
+	LowMemory            bool `yaml:"low_memory"`             // 逐个规则集完成加载、去重、导出后再处理下一个，降低内存峰值
+	LowMemoryConcurrency int  `yaml:"low_memory_concurrency"` // low_memory 模式下同时处理的规则集数量（默认 2）
+}
+
+// rule-provider 配置片段引用的文件格式（对应 Mihomo rule-provider 的 format 字段）
+const (
+	ProviderFormatYAML = "yaml" // 引用 .yaml 文件
+	ProviderFormatText = "text" // 引用 .list 文件
+)
+
+// 规则文件扩展名默认值
+const (
+	DefaultListExtension = ".list"
+	DefaultYAMLExtension = ".yaml"
+)
+
+// DefaultLowMemoryConcurrency low_memory 模式默认同时处理的规则集数量
+const DefaultLowMemoryConcurrency = 2
+
+// 导出 domain 格式时 DOMAIN-SUFFIX 的写法
+const (
+	SuffixModePlus     = "plus"     // 统一为 +.domain（匹配主域名和所有子域名）
+	SuffixModeDot      = "dot"      // 统一为 .domain（只匹配子域名）
+	SuffixModePreserve = "preserve" // 保留输入的写法，没有前缀时使用 +.
+)
+
+// 输出目录结构（generate_rules.layout）
+const (
+	LayoutByRuleset  = "by_ruleset"  // {name}/{name}_{type}.{ext}
+	LayoutByBehavior = "by_behavior" // {type}/{name}.{ext}
+)
+
+// 规则数量检查模式
+const (
+	GuardrailModeWarn = "warn" // 仅记录警告
+	GuardrailModeFail = "fail" // 返回错误，不导出规则集
+	GuardrailModeOff  = "off"  // 不检查
+)
+
+// 跨规则集冲突检查模式（generate_rules.conflict_mode）
+const (
+	ConflictModeWarn = "warn" // 写入 conflicts.txt 并记录警告
+	ConflictModeFail = "fail" // 返回错误，不导出规则集
+	ConflictModeOff  = "off"  // 不检查
+)
+
+// MergeCIDRsEnabled 去重时是否合并 IP 网段（未设置时为 true）
+func (c GenerateRulesetsConfig) MergeCIDRsEnabled() bool {
+	return c.MergeCIDRs == nil || *c.MergeCIDRs
 }
 
 // RuleSetsGenConfig 规则集生成配置
 type RuleSetsGenConfig struct {
-	GitHub GitHubConfig `yaml:"github"` // GitHub 配置
+	GitHub          GitHubConfig `yaml:"github"`           // GitHub 配置
+	DownloadTimeout int          `yaml:"download_timeout"` // 单个规则文件下载的超时时间（秒，默认 30），用于 GitHub 规则文件和规则集 URL 来源
+	APITimeout      int          `yaml:"api_timeout"`      // GitHub API 请求的超时时间（秒，默认 30）
+
+	// Revalidate 复用已下载的 URL 来源前用 ETag/Last-Modified 发送条件请求，确认远端没有更新（默认 true）
+	Revalidate *bool `yaml:"revalidate"`
+}
+
+// RevalidateEnabled 是否校验已下载的 URL 来源（未设置时为 true）
+func (c RuleSetsGenConfig) RevalidateEnabled() bool {
+	return c.Revalidate == nil || *c.Revalidate
 }
 
 // AIConfig AI 配置
@@ -88,8 +274,34 @@ type AIConfig struct {
 	RuleBatchSize    int            `yaml:"rule_batch_size"`    // 每批次分析的规则文件数量（默认 10）
 	BatchConcurrency int            `yaml:"batch_concurrency"`  // 并发批次数量（默认 10）
 	Prompts          AIPromptConfig `yaml:"prompts"`            // AI 提示词配置
+
+	// ClassificationTemperature 规则分类任务专用温度参数（可选，默认 0，覆盖 temperature）
+	ClassificationTemperature *float64 `yaml:"classification_temperature"`
+
+	FailOnUnmatched bool `yaml:"fail_on_unmatched"` // 分类结束后仍有未分类规则时返回错误（默认 false）
+
+	// MaxConsecutiveFailures 连续失败的批次达到该数量时中止剩余批次并返回错误（如 API 密钥错误、服务不可用），0 表示不限制
+	MaxConsecutiveFailures int `yaml:"max_consecutive_failures"`
+
+	ExampleStrategy  string `yaml:"example_strategy"`   // 规则示例采样方式: head/random/spread（默认 head）
+	MaxTotalExamples int    `yaml:"max_total_examples"` // 每个批次提示词中规则示例的总数上限，超出时按比例减少每个文件的示例（文件多于上限时规则最多的文件不提供示例），0 表示不限制
+
+	// Fallback 备用 AI 提供商（可选）：批次在主提供商上失败时改用备用提供商重试一次
+	// 只使用其中的 provider/api_key/base_url/model/max_tokens/temperature/ai_request_timeout，提示词等其余配置沿用主配置
+	Fallback *AIConfig `yaml:"fallback"`
+
+	// LogRequests 将每个批次发送给 AI 提供商的完整请求（含 model、temperature、max_tokens，API 密钥已脱敏）
+	// 和原始响应体写入日志目录，用于排查分类结果异常
+	LogRequests bool `yaml:"log_requests"`
 }
 
+// 规则示例采样方式
+const (
+	ExampleStrategyHead   = "head"   // 取文件开头的 N 条规则
+	ExampleStrategyRandom = "random" // 随机抽取 N 条规则（保持文件中的顺序）
+	ExampleStrategySpread = "spread" // 在整个文件中等间距抽取 N 条规则
+)
+
 // AIPromptConfig AI 提示词配置
 type AIPromptConfig struct {
 	RuleClassification string `yaml:"rule_classification"` // 规则分类提示词
@@ -118,6 +330,10 @@ func LoadConfig(path string) (*Config, error) {
 		return nil, err
 	}
 
+	if cfg.RunTimeout < 0 {
+		return nil, fmt.Errorf("run_timeout 不能为负数: %s", cfg.RunTimeout)
+	}
+
 	// 设置 AI 规则批次大小默认值
 	if cfg.AI.RuleBatchSize <= 0 {
 		cfg.AI.RuleBatchSize = 10
@@ -128,6 +344,126 @@ func LoadConfig(path string) (*Config, error) {
 		cfg.AI.BatchConcurrency = 10
 	}
 
+	// 设置分类温度默认值（分类需要确定性输出）
+	if cfg.AI.ClassificationTemperature == nil {
+		defaultTemperature := 0.0
+		cfg.AI.ClassificationTemperature = &defaultTemperature
+	}
+
+	// 备用 AI 提供商：未设置 provider 时视为未配置
+	if cfg.AI.Fallback != nil {
+		switch {
+		case cfg.AI.Fallback.Provider == "":
+			cfg.AI.Fallback = nil
+		case cfg.AI.Fallback.APIKey == "":
+			return nil, fmt.Errorf("ai.fallback 缺少 api_key")
+		case cfg.AI.Fallback.Fallback != nil:
+			return nil, fmt.Errorf("ai.fallback 不支持再嵌套 fallback")
+		}
+	}
+
+	if t := cfg.AIClassifyRules.SimilarityThreshold; t < 0 || t > 1 {
+		return nil, fmt.Errorf("ai_classify_rules.similarity_threshold 必须在 0-1 之间: %g", t)
+	}
+	for pattern, name := range cfg.AIClassifyRules.PathClassifiers {
+		if !doublestar.ValidatePattern(pattern) {
+			return nil, fmt.Errorf("ai_classify_rules.path_classifiers 模式无效: %s", pattern)
+		}
+		if NormalizeRulesetName(name) == "" {
+			return nil, fmt.Errorf("ai_classify_rules.path_classifiers 模式 %s 的规则集名称为空", pattern)
+		}
+	}
+
+	// 设置规则示例采样方式默认值
+	cfg.AI.ExampleStrategy = strings.ToLower(strings.TrimSpace(cfg.AI.ExampleStrategy))
+	switch cfg.AI.ExampleStrategy {
+	case "":
+		cfg.AI.ExampleStrategy = ExampleStrategyHead
+	case ExampleStrategyHead, ExampleStrategyRandom, ExampleStrategySpread:
+	default:
+		return nil, fmt.Errorf("ai.example_strategy 无效: %s（可选: head/random/spread）", cfg.AI.ExampleStrategy)
+	}
+	if cfg.AI.MaxTotalExamples < 0 {
+		return nil, fmt.Errorf("ai.max_total_examples 不能为负数: %d", cfg.AI.MaxTotalExamples)
+	}
+
+	// 设置规则数量检查模式默认值
+	cfg.GenerateRules.GuardrailMode = strings.ToLower(strings.TrimSpace(cfg.GenerateRules.GuardrailMode))
+	switch cfg.GenerateRules.GuardrailMode {
+	case "":
+		cfg.GenerateRules.GuardrailMode = GuardrailModeWarn
+	case GuardrailModeWarn, GuardrailModeFail, GuardrailModeOff:
+	default:
+		return nil, fmt.Errorf("generate_rules.guardrail_mode 无效: %s（可选: warn/fail/off）", cfg.GenerateRules.GuardrailMode)
+	}
+
+	// 设置跨规则集冲突检查模式默认值
+	cfg.GenerateRules.ConflictMode = strings.ToLower(strings.TrimSpace(cfg.GenerateRules.ConflictMode))
+	switch cfg.GenerateRules.ConflictMode {
+	case "":
+		cfg.GenerateRules.ConflictMode = ConflictModeWarn
+	case ConflictModeWarn, ConflictModeFail, ConflictModeOff:
+	default:
+		return nil, fmt.Errorf("generate_rules.conflict_mode 无效: %s（可选: warn/fail/off）", cfg.GenerateRules.ConflictMode)
+	}
+
+	// 设置规则文件扩展名默认值
+	if cfg.GenerateRules.ListExtension == "" {
+		cfg.GenerateRules.ListExtension = DefaultListExtension
+	}
+	if cfg.GenerateRules.YAMLExtension == "" {
+		cfg.GenerateRules.YAMLExtension = DefaultYAMLExtension
+	}
+	if err := validateExtension("generate_rules.list_extension", cfg.GenerateRules.ListExtension); err != nil {
+		return nil, err
+	}
+	if err := validateExtension("generate_rules.yaml_extension", cfg.GenerateRules.YAMLExtension); err != nil {
+		return nil, err
+	}
+	if cfg.GenerateRules.ListExtension == cfg.GenerateRules.YAMLExtension {
+		return nil, fmt.Errorf("generate_rules.list_extension 与 yaml_extension 不能相同: %s", cfg.GenerateRules.ListExtension)
+	}
+
+	// 规则集优先级中的名称与规则集名称一样统一小写
+	for i, name := range cfg.GenerateRules.RulesetPriority {
+		cfg.GenerateRules.RulesetPriority[i] = NormalizeRulesetName(name)
+	}
+
+	// 设置低内存模式并发数默认值
+	if cfg.GenerateRules.LowMemoryConcurrency <= 0 {
+		cfg.GenerateRules.LowMemoryConcurrency = DefaultLowMemoryConcurrency
+	}
+
+	// 设置 rule-provider 配置片段格式默认值
+	cfg.GenerateRules.ProviderFormat = strings.ToLower(strings.TrimSpace(cfg.GenerateRules.ProviderFormat))
+	switch cfg.GenerateRules.ProviderFormat {
+	case "":
+		cfg.GenerateRules.ProviderFormat = ProviderFormatYAML
+	case ProviderFormatYAML, ProviderFormatText:
+	default:
+		return nil, fmt.Errorf("generate_rules.provider_format 无效: %s（可选: yaml/text）", cfg.GenerateRules.ProviderFormat)
+	}
+
+	// 设置 DOMAIN-SUFFIX 导出写法默认值
+	cfg.GenerateRules.SuffixMode = strings.ToLower(strings.TrimSpace(cfg.GenerateRules.SuffixMode))
+	switch cfg.GenerateRules.SuffixMode {
+	case "":
+		cfg.GenerateRules.SuffixMode = SuffixModePlus
+	case SuffixModePlus, SuffixModeDot, SuffixModePreserve:
+	default:
+		return nil, fmt.Errorf("generate_rules.suffix_mode 无效: %s（可选: plus/dot/preserve）", cfg.GenerateRules.SuffixMode)
+	}
+
+	// 设置输出目录结构默认值
+	cfg.GenerateRules.Layout = strings.ToLower(strings.TrimSpace(cfg.GenerateRules.Layout))
+	switch cfg.GenerateRules.Layout {
+	case "":
+		cfg.GenerateRules.Layout = LayoutByRuleset
+	case LayoutByRuleset, LayoutByBehavior:
+	default:
+		return nil, fmt.Errorf("generate_rules.layout 无效: %s（可选: by_ruleset/by_behavior）", cfg.GenerateRules.Layout)
+	}
+
 	// 设置 GitHub 下载路径默认值
 	if cfg.RuleSources.GitHub.DownloadPath == "" {
 		cfg.RuleSources.GitHub.DownloadPath = "./rule_sources/github/rules"
@@ -138,6 +474,14 @@ func LoadConfig(path string) (*Config, error) {
 		cfg.RuleSources.GitHub.DownloadThreads = 10
 	}
 
+	// 设置下载和 GitHub API 超时时间默认值（秒）
+	if cfg.RuleSources.DownloadTimeout <= 0 {
+		cfg.RuleSources.DownloadTimeout = 30
+	}
+	if cfg.RuleSources.APITimeout <= 0 {
+		cfg.RuleSources.APITimeout = 30
+	}
+
 	// OverwriteRuleFile 默认为 false（不覆盖已有文件）
 	// 注意：YAML 的 bool 零值就是 false，这里仅作说明
 
@@ -156,6 +500,14 @@ func LoadConfig(path string) (*Config, error) {
 	return &cfg, nil
 }
 
+// validateExtension 检查文件扩展名：必须以 . 开头，且只包含一个 .、不包含路径分隔符
+func validateExtension(field, ext string) error {
+	if len(ext) < 2 || !strings.HasPrefix(ext, ".") || strings.Count(ext, ".") != 1 || strings.ContainsAny(ext, "/\\ ") {
+		return fmt.Errorf("%s 无效: %q（必须以 . 开头，如 .txt）", field, ext)
+	}
+	return nil
+}
+
 // IsAIEnabled 检查 AI 是否已启用
 func (c *AIConfig) IsAIEnabled() bool {
 	return c.Provider != "" && c.APIKey != ""
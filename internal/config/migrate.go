@@ -0,0 +1,220 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Migration 配置迁移：对配置文件的 YAML 节点树做一次字段变换
+// Apply 直接修改 root（顶层映射节点），返回每项变更的说明，没有变更时返回 nil
+type Migration struct {
+	Name  string
+	Apply func(root *yaml.Node) []string
+}
+
+// Migrations 已知的配置迁移，按顺序执行（新的迁移追加到末尾）
+var Migrations = []Migration{
+	{Name: "generate_rulesets", Apply: migrateGenerateRulesets},
+	{Name: "ai_provider_block", Apply: migrateAIProviderBlock},
+	{Name: "ai_prompt", Apply: migrateAIPrompt},
+	{Name: "run_timeout_seconds", Apply: migrateRunTimeoutSeconds},
+}
+
+// MigrationChange 一项配置迁移变更
+type MigrationChange struct {
+	Migration string // 迁移名称
+	Detail    string // 变更说明
+}
+
+// MigrateConfigData 对配置文件内容依次执行所有迁移，返回迁移后的内容和变更列表
+// 没有任何变更时返回 nil 内容；注释会尽量保留，但缩进统一为 2 个空格
+func MigrateConfigData(data []byte) ([]byte, []MigrationChange, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, nil, fmt.Errorf("解析配置文件失败: %w", err)
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, nil, fmt.Errorf("配置文件顶层不是映射")
+	}
+	root := doc.Content[0]
+
+	var changes []MigrationChange
+	for _, migration := range Migrations {
+		for _, detail := range migration.Apply(root) {
+			changes = append(changes, MigrationChange{Migration: migration.Name, Detail: detail})
+		}
+	}
+	if len(changes) == 0 {
+		return nil, nil, nil
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return nil, nil, fmt.Errorf("生成迁移后的配置失败: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, nil, fmt.Errorf("生成迁移后的配置失败: %w", err)
+	}
+
+	// 确认迁移结果仍能被解析为配置
+	var cfg Config
+	if err := yaml.Unmarshal(buf.Bytes(), &cfg); err != nil {
+		return nil, nil, fmt.Errorf("迁移后的配置无法解析: %w", err)
+	}
+	return buf.Bytes(), changes, nil
+}
+
+// migrateGenerateRulesets generate_rulesets → generate_rules
+func migrateGenerateRulesets(root *yaml.Node) []string {
+	return renameKey(root, "generate_rulesets", "generate_rules")
+}
+
+// migrateAIProviderBlock 旧版按提供商分块的 AI 配置（ai.deepseek: {enabled, api_key, ...}）
+// → ai.provider + ai.api_key/base_url/model/...；只迁移 enabled: true 的提供商，其余分块保留不动
+func migrateAIProviderBlock(root *yaml.Node) []string {
+	ai := mappingValue(root, "ai")
+	if ai == nil || ai.Kind != yaml.MappingNode {
+		return nil
+	}
+	if provider := mappingValue(ai, "provider"); provider != nil && provider.Value != "" {
+		return nil
+	}
+
+	for _, name := range []string{"deepseek", "openai", "gemini", "grok"} {
+		block := mappingValue(ai, name)
+		if block == nil || block.Kind != yaml.MappingNode {
+			continue
+		}
+		if enabled := mappingValue(block, "enabled"); enabled == nil || enabled.Value != "true" {
+			continue
+		}
+
+		changes := []string{fmt.Sprintf("ai.%s.enabled → ai.provider: %s", name, name)}
+		setScalar(ai, "provider", name)
+		for _, field := range []string{"api_key", "base_url", "model", "max_tokens", "temperature"} {
+			value := mappingValue(block, field)
+			if value == nil || value.Value == "" {
+				continue
+			}
+			if existing := mappingValue(ai, field); existing != nil && existing.Value != "" {
+				changes = append(changes, fmt.Sprintf("ai.%s.%s 与 ai.%s 同时存在，保留 ai.%s", name, field, field, field))
+				continue
+			}
+			setValue(ai, field, value)
+			changes = append(changes, fmt.Sprintf("ai.%s.%s → ai.%s", name, field, field))
+		}
+		if prompt := mappingValue(block, "prompt"); prompt != nil && prompt.Value != "" {
+			setValue(ai, "prompt", prompt)
+			changes = append(changes, fmt.Sprintf("ai.%s.prompt → ai.prompt", name))
+		}
+		removeKey(ai, name)
+		return changes
+	}
+	return nil
+}
+
+// migrateAIPrompt ai.prompt → ai.prompts.rule_classification
+func migrateAIPrompt(root *yaml.Node) []string {
+	ai := mappingValue(root, "ai")
+	if ai == nil || ai.Kind != yaml.MappingNode {
+		return nil
+	}
+	prompt := mappingValue(ai, "prompt")
+	if prompt == nil {
+		return nil
+	}
+
+	prompts := mappingValue(ai, "prompts")
+	if prompts == nil {
+		prompts = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		setValue(ai, "prompts", prompts)
+	}
+	if existing := mappingValue(prompts, "rule_classification"); existing != nil && existing.Value != "" {
+		removeKey(ai, "prompt")
+		return []string{"ai.prompt 与 ai.prompts.rule_classification 同时存在，删除 ai.prompt"}
+	}
+	setValue(prompts, "rule_classification", prompt)
+	removeKey(ai, "prompt")
+	return []string{"ai.prompt → ai.prompts.rule_classification"}
+}
+
+// migrateRunTimeoutSeconds run_timeout 写成整数（秒）时转换为带单位的时长
+func migrateRunTimeoutSeconds(root *yaml.Node) []string {
+	value := mappingValue(root, "run_timeout")
+	if value == nil || value.Kind != yaml.ScalarNode || value.Tag != "!!int" {
+		return nil
+	}
+	seconds, err := strconv.Atoi(value.Value)
+	if err != nil {
+		return nil
+	}
+	old := value.Value
+	value.Value = fmt.Sprintf("%ds", seconds)
+	value.Tag = "!!str"
+	return []string{fmt.Sprintf("run_timeout: %s → %s（时长必须带单位）", old, value.Value)}
+}
+
+// renameKey 重命名映射中的键，新键已存在时保留新键并删除旧键
+func renameKey(mapping *yaml.Node, oldKey, newKey string) []string {
+	keyNode := mappingKey(mapping, oldKey)
+	if keyNode == nil {
+		return nil
+	}
+	if mappingKey(mapping, newKey) != nil {
+		removeKey(mapping, oldKey)
+		return []string{fmt.Sprintf("%s 与 %s 同时存在，删除 %s", oldKey, newKey, oldKey)}
+	}
+	keyNode.Value = newKey
+	return []string{fmt.Sprintf("%s → %s", oldKey, newKey)}
+}
+
+// mappingKey 返回映射中指定键的键节点
+func mappingKey(mapping *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i]
+		}
+	}
+	return nil
+}
+
+// mappingValue 返回映射中指定键的值节点
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// setValue 设置映射中指定键的值，键不存在时追加到末尾
+func setValue(mapping *yaml.Node, key string, value *yaml.Node) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			mapping.Content[i+1] = value
+			return
+		}
+	}
+	mapping.Content = append(mapping.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, value)
+}
+
+// setScalar 设置映射中指定键的字符串值
+func setScalar(mapping *yaml.Node, key, value string) {
+	setValue(mapping, key, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value})
+}
+
+// removeKey 删除映射中的键
+func removeKey(mapping *yaml.Node, key string) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			mapping.Content = append(mapping.Content[:i], mapping.Content[i+2:]...)
+			return
+		}
+	}
+}
@@ -3,15 +3,35 @@ package config
 import (
 	"fmt"
 	"os"
+	"sort"
+	"strings"
 
+	"github.com/rs/zerolog/log"
 	"gopkg.in/yaml.v3"
 )
 
 // RuleSetsConfig 规则集配置
 type RuleSetsConfig struct {
 	ClassifiedRules map[string]RulesetConfig `yaml:"classified_rules"`
+	RuleBlocks      map[string][]string      `yaml:"rule_blocks,omitempty"` // 可复用的规则块（名称 -> 规则列表），通过 include_blocks 引用
+
+	order []string // 规则集在配置文件中的顺序（规范化后的名称）
 }
 
+// 规则集导出格式（output_formats）
+const (
+	OutputFormatMihomo      = "mihomo"      // {name}_{type}.yaml/.list（总会导出）
+	OutputFormatSurge       = "surge"       // {name}_surge.conf
+	OutputFormatSingbox     = "singbox"     // {name}_singbox.json
+	OutputFormatQuantumultX = "quantumultx" // {name}_quanx.list
+)
+
+// OutputFormats 支持的导出格式
+var OutputFormats = []string{OutputFormatMihomo, OutputFormatSurge, OutputFormatSingbox, OutputFormatQuantumultX}
+
+// DefaultQuantumultXPolicy Quantumult X 导出中规则的默认策略
+const DefaultQuantumultXPolicy = "PROXY"
+
 // RulesetConfig 规则集配置
 type RulesetConfig struct {
 	Description    string   `yaml:"description"`               // 规则集描述（可选）
@@ -21,10 +41,61 @@ type RulesetConfig struct {
 	ExcludeSources []string `yaml:"exclude_sources,omitempty"` // 排除的规则 URL 或本地路径（可选）
 	Filters        []string `yaml:"filters,omitempty"`         // 规则内容过滤器（glob 模式，白名单）
 	Excludes       []string `yaml:"excludes,omitempty"`        // 排除的规则内容（glob 模式，黑名单）
+	MinRules       int      `yaml:"min_rules,omitempty"`       // 去重后规则数量下限（可选，0 表示不检查）
+	MaxRules       int      `yaml:"max_rules,omitempty"`       // 去重后规则数量上限（可选，0 表示不检查）
+	IncludeBlocks  []string `yaml:"include_blocks,omitempty"`  // 引用的规则块名称（rule_blocks 中定义，可选）
+
+	ArchiveInclude   []string `yaml:"archive_include,omitempty"`   // 从 .zip/.tar.gz 来源中提取的文件（glob 模式，默认 **/*.list、**/*.txt、**/*.yaml、**/*.yml）
+	SubtractRulesets []string `yaml:"subtract_rulesets,omitempty"` // 去重后移除已出现在这些规则集中的规则（可选，如 proxy 排除 direct）
+	OutputFormats    []string `yaml:"output_formats,omitempty"`    // 导出格式: mihomo/surge/singbox/quantumultx（可选，mihomo 格式总会导出）
+	Policy           string   `yaml:"policy,omitempty"`            // Quantumult X 导出中规则使用的策略（可选，默认 PROXY）
+	AllowTLDs        []string `yaml:"allow_tlds,omitempty"`        // 域名类规则只保留以这些顶级域名/域名结尾的规则（如 cn、com.cn，在 filters 之前应用）
+
+	// ExcludePrivateIPs 导出时移除私有/保留地址段内的 IP-CIDR/IP-CIDR6 规则（未设置时使用 generate_rules.exclude_private_ips）
+	ExcludePrivateIPs *bool `yaml:"exclude_private_ips,omitempty"`
+}
+
+// ExcludesPrivateIPs 返回规则集是否移除私有/保留地址段内的 IP 网段，未设置时返回全局默认值
+func (r RulesetConfig) ExcludesPrivateIPs(defaultValue bool) bool {
+	if r.ExcludePrivateIPs != nil {
+		return *r.ExcludePrivateIPs
+	}
+	return defaultValue
+}
+
+// InvalidRuleset 未通过验证而被跳过的规则集
+type InvalidRuleset struct {
+	Name string
+	Err  error
 }
 
 // LoadRuleSetsConfig 加载规则集配置文件
 func LoadRuleSetsConfig(filePath string) (*RuleSetsConfig, error) {
+	cfg, err := parseRuleSetsConfig(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	// 验证配置
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("规则配置验证失败: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// LoadRuleSetsConfigLenient 加载规则集配置文件，跳过未通过验证的规则集而不是整体失败
+// 返回被跳过的规则集（按名称排序）；文件无法读取或解析时仍然返回错误
+func LoadRuleSetsConfigLenient(filePath string) (*RuleSetsConfig, []InvalidRuleset, error) {
+	cfg, err := parseRuleSetsConfig(filePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cfg, cfg.RemoveInvalidRulesets(), nil
+}
+
+// parseRuleSetsConfig 读取并解析规则集配置文件（不验证）
+func parseRuleSetsConfig(filePath string) (*RuleSetsConfig, error) {
 	data, err := os.ReadFile(filePath)
 	if err != nil {
 		return nil, fmt.Errorf("读取规则配置文件失败: %w", err)
@@ -34,41 +105,132 @@ func LoadRuleSetsConfig(filePath string) (*RuleSetsConfig, error) {
 	if err := yaml.Unmarshal(data, &cfg); err != nil {
 		return nil, fmt.Errorf("解析规则配置文件失败: %w", err)
 	}
+	cfg.order = classifiedRulesOrder(data)
 
-	// 验证配置
-	if err := cfg.Validate(); err != nil {
-		return nil, fmt.Errorf("规则配置验证失败: %w", err)
-	}
+	// 规则集名称统一小写，合并仅大小写不同的重复规则集
+	cfg.NormalizeNames()
 
 	return &cfg, nil
 }
 
-// Validate 验证规则配置
+// Validate 验证规则配置（按规则集名称顺序检查，返回第一个错误）
 func (c *RuleSetsConfig) Validate() error {
-	// 验证规则集配置
-	for name, ruleset := range c.ClassifiedRules {
-		if len(ruleset.URLs) == 0 && len(ruleset.Files) == 0 && len(ruleset.Rules) == 0 {
-			return fmt.Errorf("规则集 '%s' 没有配置 URL、本地文件或手工规则", name)
+	names := c.GetAllRulesets()
+	sort.Strings(names)
+	for _, name := range names {
+		if err := c.validateRuleset(name, c.ClassifiedRules[name]); err != nil {
+			return err
 		}
+	}
+	return nil
+}
+
+// RemoveInvalidRulesets 移除所有未通过验证的规则集，返回被移除的规则集（按名称排序）
+// 通过 subtract_rulesets 引用了被移除规则集的规则集也会被移除（否则排除结果会静默改变）
+func (c *RuleSetsConfig) RemoveInvalidRulesets() []InvalidRuleset {
+	var invalid []InvalidRuleset
+	for {
+		names := c.GetAllRulesets()
+		sort.Strings(names)
 
-		// 验证 URL 格式
-		for i, url := range ruleset.URLs {
-			if url == "" {
-				return fmt.Errorf("规则集 '%s' 的第 %d 个 URL 为空", name, i+1)
+		var removed []InvalidRuleset
+		for _, name := range names {
+			if err := c.validateRuleset(name, c.ClassifiedRules[name]); err != nil {
+				removed = append(removed, InvalidRuleset{Name: name, Err: err})
 			}
 		}
+		if len(removed) == 0 {
+			break
+		}
+		for _, r := range removed {
+			delete(c.ClassifiedRules, r.Name)
+		}
+		invalid = append(invalid, removed...)
+	}
 
-		// 验证本地文件路径
-		for i, file := range ruleset.Files {
-			if file == "" {
-				return fmt.Errorf("规则集 '%s' 的第 %d 个文件路径为空", name, i+1)
-			}
+	sort.Slice(invalid, func(i, j int) bool { return invalid[i].Name < invalid[j].Name })
+	return invalid
+}
+
+// validateRuleset 验证单个规则集的配置
+func (c *RuleSetsConfig) validateRuleset(name string, ruleset RulesetConfig) error {
+	if len(ruleset.URLs) == 0 && len(ruleset.Files) == 0 && len(ruleset.Rules) == 0 && len(ruleset.IncludeBlocks) == 0 {
+		return fmt.Errorf("规则集 '%s' 没有配置 URL、本地文件、手工规则或规则块", name)
+	}
+
+	// 验证引用的规则块
+	for _, block := range ruleset.IncludeBlocks {
+		if _, ok := c.RuleBlocks[block]; !ok {
+			return fmt.Errorf("规则集 '%s' 引用的规则块 '%s' 不存在", name, block)
+		}
+	}
+
+	// 验证 URL 格式
+	for i, url := range ruleset.URLs {
+		if url == "" {
+			return fmt.Errorf("规则集 '%s' 的第 %d 个 URL 为空", name, i+1)
+		}
+	}
+
+	// 验证本地文件路径
+	for i, file := range ruleset.Files {
+		if file == "" {
+			return fmt.Errorf("规则集 '%s' 的第 %d 个文件路径为空", name, i+1)
+		}
+	}
+
+	// 验证跨规则集排除的引用
+	for _, other := range ruleset.SubtractRulesets {
+		if other == name {
+			return fmt.Errorf("规则集 '%s' 的 subtract_rulesets 不能引用自身", name)
+		}
+		if _, ok := c.ClassifiedRules[other]; !ok {
+			return fmt.Errorf("规则集 '%s' 的 subtract_rulesets 引用的规则集 '%s' 不存在", name, other)
 		}
 	}
 
+	// 验证导出格式
+	for _, format := range ruleset.OutputFormats {
+		if !isOutputFormat(format) {
+			return fmt.Errorf("规则集 '%s' 的 output_formats 无效: %s（可选: %s）", name, format, strings.Join(OutputFormats, "/"))
+		}
+	}
+
+	// 策略写在规则行的逗号分隔字段中，不能包含逗号
+	if strings.Contains(ruleset.Policy, ",") {
+		return fmt.Errorf("规则集 '%s' 的 policy 不能包含逗号: %s", name, ruleset.Policy)
+	}
+
+	// 验证规则数量范围
+	if ruleset.MinRules < 0 || ruleset.MaxRules < 0 {
+		return fmt.Errorf("规则集 '%s' 的 min_rules/max_rules 不能为负数", name)
+	}
+	if ruleset.MaxRules > 0 && ruleset.MinRules > ruleset.MaxRules {
+		return fmt.Errorf("规则集 '%s' 的 min_rules (%d) 大于 max_rules (%d)", name, ruleset.MinRules, ruleset.MaxRules)
+	}
+
 	return nil
 }
 
+// isOutputFormat 判断是否为支持的导出格式
+func isOutputFormat(format string) bool {
+	for _, f := range OutputFormats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// ExpandedRules 返回规则集的手工规则及其引用的规则块展开后的规则（去重，保持顺序）
+func (c *RuleSetsConfig) ExpandedRules(ruleset RulesetConfig) []string {
+	rules := ruleset.Rules
+	for _, block := range ruleset.IncludeBlocks {
+		rules = mergeUniqueStrings(rules, c.RuleBlocks[block])
+	}
+	return rules
+}
+
 // GetAllRulesets 获取所有规则集名称
 func (c *RuleSetsConfig) GetAllRulesets() []string {
 	names := make([]string, 0, len(c.ClassifiedRules))
@@ -78,6 +240,44 @@ func (c *RuleSetsConfig) GetAllRulesets() []string {
 	return names
 }
 
+// OrderedRulesets 按配置文件中的顺序返回所有规则集名称
+// 不是从文件加载的规则集（如合并或代码构造）按名称排序排在最后
+func (c *RuleSetsConfig) OrderedRulesets() []string {
+	names := make([]string, 0, len(c.ClassifiedRules))
+	seen := make(map[string]bool, len(c.ClassifiedRules))
+	for _, name := range c.order {
+		if _, exists := c.ClassifiedRules[name]; exists && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+
+	var rest []string
+	for name := range c.ClassifiedRules {
+		if !seen[name] {
+			rest = append(rest, name)
+		}
+	}
+	sort.Strings(rest)
+	return append(names, rest...)
+}
+
+// classifiedRulesOrder 从 YAML 中读取 classified_rules 的键顺序（规范化后的名称）
+func classifiedRulesOrder(data []byte) []string {
+	var doc struct {
+		ClassifiedRules yaml.Node `yaml:"classified_rules"`
+	}
+	if err := yaml.Unmarshal(data, &doc); err != nil || doc.ClassifiedRules.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	var order []string
+	for i := 0; i+1 < len(doc.ClassifiedRules.Content); i += 2 {
+		order = append(order, NormalizeRulesetName(doc.ClassifiedRules.Content[i].Value))
+	}
+	return order
+}
+
 // GetRulesetConfig 获取指定规则集的配置
 func (c *RuleSetsConfig) GetRulesetConfig(name string) (*RulesetConfig, error) {
 	ruleset, exists := c.ClassifiedRules[name]
@@ -86,3 +286,266 @@ func (c *RuleSetsConfig) GetRulesetConfig(name string) (*RulesetConfig, error) {
 	}
 	return &ruleset, nil
 }
+
+// NormalizeRulesetName 规范化规则集名称（统一小写，去除首尾空白）
+func NormalizeRulesetName(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// NormalizeNames 将所有规则集名称转为小写，仅大小写不同的规则集会被合并
+// 返回被合并的规则集名称（规范化后）
+func (c *RuleSetsConfig) NormalizeNames() []string {
+	if len(c.ClassifiedRules) == 0 {
+		return nil
+	}
+
+	// 按名称排序，保证合并结果稳定
+	names := make([]string, 0, len(c.ClassifiedRules))
+	for name := range c.ClassifiedRules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	normalized := make(map[string]RulesetConfig, len(c.ClassifiedRules))
+	var merged []string
+	for _, name := range names {
+		key := NormalizeRulesetName(name)
+		ruleset := c.ClassifiedRules[name]
+		for i, other := range ruleset.SubtractRulesets {
+			ruleset.SubtractRulesets[i] = NormalizeRulesetName(other)
+		}
+		if existing, ok := normalized[key]; ok {
+			log.Warn().Msgf("检测到仅大小写不同的重复规则集: '%s' 合并到 '%s'", name, key)
+			normalized[key] = MergeRulesetConfig(existing, ruleset)
+			merged = append(merged, key)
+			continue
+		}
+		normalized[key] = ruleset
+	}
+
+	c.ClassifiedRules = normalized
+	return merged
+}
+
+// MergeRulesetConfig 合并两个规则集配置（列表去重，保留 base 的描述）
+func MergeRulesetConfig(base, other RulesetConfig) RulesetConfig {
+	description := base.Description
+	if description == "" {
+		description = other.Description
+	}
+
+	return RulesetConfig{
+		Description:    description,
+		URLs:           mergeUniqueStrings(base.URLs, other.URLs),
+		Files:          mergeUniqueStrings(base.Files, other.Files),
+		Rules:          mergeUniqueStrings(base.Rules, other.Rules),
+		ExcludeSources: mergeUniqueStrings(base.ExcludeSources, other.ExcludeSources),
+		Filters:        mergeUniqueStrings(base.Filters, other.Filters),
+		Excludes:       mergeUniqueStrings(base.Excludes, other.Excludes),
+		MinRules:       firstNonZero(base.MinRules, other.MinRules),
+		MaxRules:       firstNonZero(base.MaxRules, other.MaxRules),
+		IncludeBlocks:  mergeUniqueStrings(base.IncludeBlocks, other.IncludeBlocks),
+
+		ArchiveInclude:   mergeUniqueStrings(base.ArchiveInclude, other.ArchiveInclude),
+		SubtractRulesets: mergeUniqueStrings(base.SubtractRulesets, other.SubtractRulesets),
+		OutputFormats:    mergeUniqueStrings(base.OutputFormats, other.OutputFormats),
+		Policy:           firstNonEmpty(base.Policy, other.Policy),
+		AllowTLDs:        mergeUniqueStrings(base.AllowTLDs, other.AllowTLDs),
+
+		ExcludePrivateIPs: firstNonNilBool(base.ExcludePrivateIPs, other.ExcludePrivateIPs),
+	}
+}
+
+// firstNonNilBool 返回第一个已设置的值
+func firstNonNilBool(a, b *bool) *bool {
+	if a != nil {
+		return a
+	}
+	return b
+}
+
+// mergeUniqueStrings 合并字符串列表并去重（保持原有顺序）
+func mergeUniqueStrings(a, b []string) []string {
+	if len(a) == 0 && len(b) == 0 {
+		return nil
+	}
+
+	seen := make(map[string]bool, len(a)+len(b))
+	result := make([]string, 0, len(a)+len(b))
+	for _, list := range [][]string{a, b} {
+		for _, item := range list {
+			if !seen[item] {
+				seen[item] = true
+				result = append(result, item)
+			}
+		}
+	}
+	return result
+}
+
+// firstNonZero 返回第一个非零值
+func firstNonZero(values ...int) int {
+	for _, v := range values {
+		if v != 0 {
+			return v
+		}
+	}
+	return 0
+}
+
+// firstNonEmpty 返回第一个非空字符串
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// MergeConflict 合并两个规则分类配置时发现的冲突
+type MergeConflict struct {
+	Ruleset string // 冲突所在规则集（来源冲突、规则块冲突时为空）
+	Source  string // 冲突的 URL 或本地路径（规则集字段冲突、规则块冲突时为空）
+	Detail  string // 冲突说明及处理方式
+}
+
+// MergeRuleSetsConfigs 合并两个规则分类配置，返回合并结果和冲突列表
+// 规则集取并集，同名规则集的 URL、文件、规则等列表去重合并；冲突时以 primary 为准：
+//   - 同名规则集描述或 min_rules/max_rules 不同时，保留 primary 的值
+//   - 同一来源在两边被分到不同规则集时，保留 primary 的分类，丢弃 secondary 中的分类
+func MergeRuleSetsConfigs(primary, secondary *RuleSetsConfig) (*RuleSetsConfig, []MergeConflict) {
+	var conflicts []MergeConflict
+
+	// 来源分类冲突：同一来源在两边所属的规则集不同
+	primarySources := sourceRulesets(primary)
+	secondarySources := sourceRulesets(secondary)
+	dropped := make(map[string]map[string]bool) // secondary 规则集 -> 需丢弃的来源
+
+	sources := make([]string, 0, len(secondarySources))
+	for source := range secondarySources {
+		if _, ok := primarySources[source]; ok {
+			sources = append(sources, source)
+		}
+	}
+	sort.Strings(sources)
+
+	for _, source := range sources {
+		primaryNames, secondaryNames := primarySources[source], secondarySources[source]
+		if strings.Join(primaryNames, ",") == strings.Join(secondaryNames, ",") {
+			continue
+		}
+		conflicts = append(conflicts, MergeConflict{
+			Source: source,
+			Detail: fmt.Sprintf("分类不一致: [%s] vs [%s]，保留 [%s]",
+				strings.Join(primaryNames, ", "), strings.Join(secondaryNames, ", "), strings.Join(primaryNames, ", ")),
+		})
+		for _, name := range secondaryNames {
+			if dropped[name] == nil {
+				dropped[name] = make(map[string]bool)
+			}
+			dropped[name][source] = true
+		}
+	}
+
+	merged := &RuleSetsConfig{ClassifiedRules: make(map[string]RulesetConfig)}
+	for name, ruleset := range primary.ClassifiedRules {
+		merged.ClassifiedRules[name] = ruleset
+	}
+
+	// 规则块：同名且内容不同时保留 primary 的定义
+	for name, block := range primary.RuleBlocks {
+		if merged.RuleBlocks == nil {
+			merged.RuleBlocks = make(map[string][]string)
+		}
+		merged.RuleBlocks[name] = block
+	}
+	blockNames := make([]string, 0, len(secondary.RuleBlocks))
+	for name := range secondary.RuleBlocks {
+		blockNames = append(blockNames, name)
+	}
+	sort.Strings(blockNames)
+	for _, name := range blockNames {
+		block := secondary.RuleBlocks[name]
+		if existing, ok := merged.RuleBlocks[name]; ok {
+			if strings.Join(existing, "\n") != strings.Join(block, "\n") {
+				conflicts = append(conflicts, MergeConflict{
+					Detail: fmt.Sprintf("规则块 '%s' 内容不一致，保留前者", name),
+				})
+			}
+			continue
+		}
+		if merged.RuleBlocks == nil {
+			merged.RuleBlocks = make(map[string][]string)
+		}
+		merged.RuleBlocks[name] = block
+	}
+
+	names := secondary.GetAllRulesets()
+	sort.Strings(names)
+	for _, name := range names {
+		ruleset := secondary.ClassifiedRules[name]
+		if drop := dropped[name]; len(drop) > 0 {
+			ruleset.URLs = removeStrings(ruleset.URLs, drop)
+			ruleset.Files = removeStrings(ruleset.Files, drop)
+		}
+
+		existing, ok := merged.ClassifiedRules[name]
+		if !ok {
+			// 丢弃冲突来源后为空的规则集不再添加
+			if len(ruleset.URLs) == 0 && len(ruleset.Files) == 0 && len(ruleset.Rules) == 0 && len(ruleset.IncludeBlocks) == 0 {
+				continue
+			}
+			merged.ClassifiedRules[name] = ruleset
+			continue
+		}
+
+		if existing.Description != "" && ruleset.Description != "" && existing.Description != ruleset.Description {
+			conflicts = append(conflicts, MergeConflict{
+				Ruleset: name,
+				Detail:  fmt.Sprintf("描述不一致: %q vs %q，保留前者", existing.Description, ruleset.Description),
+			})
+		}
+		if existing.MinRules != 0 && ruleset.MinRules != 0 && existing.MinRules != ruleset.MinRules {
+			conflicts = append(conflicts, MergeConflict{
+				Ruleset: name,
+				Detail:  fmt.Sprintf("min_rules 不一致: %d vs %d，保留前者", existing.MinRules, ruleset.MinRules),
+			})
+		}
+		if existing.MaxRules != 0 && ruleset.MaxRules != 0 && existing.MaxRules != ruleset.MaxRules {
+			conflicts = append(conflicts, MergeConflict{
+				Ruleset: name,
+				Detail:  fmt.Sprintf("max_rules 不一致: %d vs %d，保留前者", existing.MaxRules, ruleset.MaxRules),
+			})
+		}
+
+		merged.ClassifiedRules[name] = MergeRulesetConfig(existing, ruleset)
+	}
+
+	return merged, conflicts
+}
+
+// sourceRulesets 返回每个来源（URL 或本地路径）所属的规则集（按名称排序）
+func sourceRulesets(c *RuleSetsConfig) map[string][]string {
+	result := make(map[string][]string)
+	for name, ruleset := range c.ClassifiedRules {
+		for _, source := range mergeUniqueStrings(ruleset.URLs, ruleset.Files) {
+			result[source] = append(result[source], name)
+		}
+	}
+	for _, names := range result {
+		sort.Strings(names)
+	}
+	return result
+}
+
+// removeStrings 返回移除指定元素后的列表
+func removeStrings(list []string, remove map[string]bool) []string {
+	var result []string
+	for _, item := range list {
+		if !remove[item] {
+			result = append(result, item)
+		}
+	}
+	return result
+}
@@ -0,0 +1,95 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeNamesMergesCaseDuplicates(t *testing.T) {
+	c := &RuleSetsConfig{ClassifiedRules: map[string]RulesetConfig{
+		"Ads":    {Description: "广告", URLs: []string{"https://example.com/a.list"}},
+		"ads":    {URLs: []string{"https://example.com/b.list", "https://example.com/a.list"}, Rules: []string{"DOMAIN,ad.com"}},
+		" ADS ":  {Files: []string{"./ads.list"}},
+		"Google": {URLs: []string{"https://example.com/google.list"}},
+	}}
+
+	merged := c.NormalizeNames()
+	if want := []string{"ads", "ads"}; !reflect.DeepEqual(merged, want) {
+		t.Errorf("NormalizeNames() = %v, want %v", merged, want)
+	}
+	if len(c.ClassifiedRules) != 2 {
+		t.Fatalf("rulesets = %v, want ads and google", c.ClassifiedRules)
+	}
+	ads := c.ClassifiedRules["ads"]
+	want := RulesetConfig{
+		Description: "广告",
+		URLs:        []string{"https://example.com/a.list", "https://example.com/b.list"},
+		Files:       []string{"./ads.list"},
+		Rules:       []string{"DOMAIN,ad.com"},
+	}
+	if !reflect.DeepEqual(ads, want) {
+		t.Errorf("ads = %+v, want %+v", ads, want)
+	}
+	if _, ok := c.ClassifiedRules["google"]; !ok {
+		t.Error("google should be keyed by its lowercase name")
+	}
+}
+
+func TestMergeRuleSetsConfigs(t *testing.T) {
+	primary := &RuleSetsConfig{
+		ClassifiedRules: map[string]RulesetConfig{
+			"google": {Description: "Google", URLs: []string{"https://e.com/a.list", "https://e.com/b.list"}, MinRules: 10},
+			"media":  {URLs: []string{"https://e.com/c.list"}},
+		},
+		RuleBlocks: map[string][]string{"lan": {"IP-CIDR,192.168.0.0/16"}},
+	}
+	secondary := &RuleSetsConfig{
+		ClassifiedRules: map[string]RulesetConfig{
+			"google":    {Description: "谷歌", URLs: []string{"https://e.com/b.list", "https://e.com/d.list"}, Rules: []string{"DOMAIN,google.com"}, MinRules: 5},
+			"streaming": {URLs: []string{"https://e.com/c.list"}},
+			"apple":     {Files: []string{"./apple.list"}, IncludeBlocks: []string{"ads"}},
+		},
+		RuleBlocks: map[string][]string{
+			"lan": {"IP-CIDR,10.0.0.0/8"},
+			"ads": {"DOMAIN-SUFFIX,ad.com"},
+		},
+	}
+
+	merged, conflicts := MergeRuleSetsConfigs(primary, secondary)
+
+	wantRulesets := map[string]RulesetConfig{
+		"google": {
+			Description: "Google",
+			URLs:        []string{"https://e.com/a.list", "https://e.com/b.list", "https://e.com/d.list"},
+			Rules:       []string{"DOMAIN,google.com"},
+			MinRules:    10,
+		},
+		"media": {URLs: []string{"https://e.com/c.list"}},
+		"apple": {Files: []string{"./apple.list"}, IncludeBlocks: []string{"ads"}},
+	}
+	if !reflect.DeepEqual(merged.ClassifiedRules, wantRulesets) {
+		t.Errorf("merged rulesets = %+v, want %+v", merged.ClassifiedRules, wantRulesets)
+	}
+	wantBlocks := map[string][]string{
+		"lan": {"IP-CIDR,192.168.0.0/16"},
+		"ads": {"DOMAIN-SUFFIX,ad.com"},
+	}
+	if !reflect.DeepEqual(merged.RuleBlocks, wantBlocks) {
+		t.Errorf("merged rule_blocks = %v, want %v", merged.RuleBlocks, wantBlocks)
+	}
+
+	type conflictKey struct{ ruleset, source string }
+	var got []conflictKey
+	for _, c := range conflicts {
+		got = append(got, conflictKey{c.Ruleset, c.Source})
+	}
+	want := []conflictKey{
+		{"", "https://e.com/c.list"}, // 来源分类不一致，保留 media，streaming 因此为空而不添加
+		{"", ""},                     // 规则块 lan 内容不一致
+		{"google", ""},               // 描述不一致
+		{"google", ""},               // min_rules 不一致
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("conflicts = %+v, want %+v", conflicts, want)
+	}
+}
@@ -42,6 +42,23 @@ func (f *GlobFilter) Match(path string) bool {
 	return matched
 }
 
+// RepoFetcher 仓库规则文件获取接口
+// Client 通过 GitHub API 获取，测试时可注入返回固定结果的实现
+type RepoFetcher interface {
+	// FetchMultipleRepos 获取多个仓库中匹配的规则文件（key 为 owner/repo）
+	FetchMultipleRepos(ctx context.Context, repos []RepoConfig) (map[string][]RuleFile, error)
+}
+
+// DownloadReporter 可以报告最近一次获取的下载统计的 RepoFetcher（可选实现，用于运行汇总报告）
+type DownloadReporter interface {
+	DownloadCounts() loader.DownloadCounts
+}
+
+var (
+	_ RepoFetcher      = (*Client)(nil)
+	_ DownloadReporter = (*Client)(nil)
+)
+
 // Client GitHub 客户端
 type Client struct {
 	client          *github.Client
@@ -53,6 +70,14 @@ type Client struct {
 	maxRetries      int  // 最大重试次数
 	retryDelay      int  // 重试延迟（秒）
 	overwriteFiles  bool // 是否覆盖已有文件
+
+	maxConcurrentRepos int           // FetchMultipleRepos 同时处理的仓库数量上限
+	rateLimitMaxWait   time.Duration // 触发速率限制时最多等待的时间
+
+	ignorePatterns []string // 全局忽略文件中的排除模式（应用于所有仓库）
+	forceRefresh   bool     // 忽略已下载的文件，总是重新下载（不受 overwriteFiles 影响）
+
+	downloads loader.DownloadCounts // 最近一次 FetchMultipleRepos 的下载统计
 }
 
 // FileInfo 文件信息
@@ -66,19 +91,30 @@ type FileInfo struct {
 	Branch      string
 }
 
+// DefaultAPITimeout GitHub API 请求的默认超时时间（秒），可通过 rule-sources.api_timeout 修改
+const DefaultAPITimeout = 30
+
+// DefaultMaxConcurrentRepos FetchMultipleRepos 默认同时处理的仓库数量，可通过 rule-sources.github.max_concurrent_repos 修改
+const DefaultMaxConcurrentRepos = 5
+
 // NewClient 创建 GitHub 客户端
-func NewClient(token string, proxyPool *proxy.Pool, downloadPath string, organizeByRepo bool, downloadThreads int, overwriteFiles bool) (*Client, error) {
+// apiTimeout 为 GitHub API 请求的超时时间，downloadTimeout 为单个规则文件下载的超时时间（秒，0 时使用默认值）
+func NewClient(token string, proxyPool *proxy.Pool, downloadPath string, organizeByRepo bool, downloadThreads int, overwriteFiles bool, apiTimeout, downloadTimeout int) (*Client, error) {
 	var httpClient *http.Client
 	var err error
 
+	if apiTimeout <= 0 {
+		apiTimeout = DefaultAPITimeout
+	}
+
 	// 先获取代理客户端
 	if proxyPool.IsEnabled() {
-		httpClient, err = proxyPool.GetHTTPClient(30) // GitHub API 请求使用 30 秒超时
+		httpClient, err = proxyPool.GetHTTPClient(apiTimeout)
 		if err != nil {
 			return nil, fmt.Errorf("获取代理客户端失败: %w", err)
 		}
 	} else {
-		httpClient = &http.Client{}
+		httpClient = &http.Client{Timeout: time.Duration(apiTimeout) * time.Second}
 	}
 
 	// 如果有 token，包装 OAuth2 Transport
@@ -94,9 +130,12 @@ func NewClient(token string, proxyPool *proxy.Pool, downloadPath string, organiz
 		downloadThreads = 10
 	}
 
+	fileLoader := loader.NewLoader(proxyPool, downloadThreads)
+	fileLoader.SetTimeout(downloadTimeout)
+
 	return &Client{
 		client:          github.NewClient(httpClient),
-		loader:          loader.NewLoader(proxyPool, downloadThreads),
+		loader:          fileLoader,
 		proxyPool:       proxyPool,
 		downloadPath:    downloadPath,
 		organizeByRepo:  organizeByRepo,
@@ -108,17 +147,57 @@ func NewClient(token string, proxyPool *proxy.Pool, downloadPath string, organiz
 }
 
 // FetchRuleFiles 获取规则文件
-func (c *Client) FetchRuleFiles(ctx context.Context, owner, repo, branch, path string, filterRules []FilterRule, excludes []string) ([]RuleFile, error) {
+// paths 为仓库内路径前缀，文件位于任意一个路径下即可（一次目录树遍历），为空时匹配整个仓库
+func (c *Client) FetchRuleFiles(ctx context.Context, owner, repo, branch string, paths []string, filterRules []FilterRule, excludes []string) ([]RuleFile, error) {
 	if excludes == nil {
 		excludes = []string{}
 	}
-	return c.fetchRuleFilesWithRepo(ctx, owner, repo, branch, path, filterRules, excludes)
+	return c.fetchRuleFilesWithRepo(ctx, owner, repo, branch, paths, filterRules, excludes)
+}
+
+// SetForceRefresh 设置是否忽略已下载的文件，总是重新下载
+func (c *Client) SetForceRefresh(enabled bool) {
+	c.forceRefresh = enabled
+}
+
+// DownloadCounts 返回最近一次 FetchMultipleRepos 的下载统计（下载、复用已有文件、失败的数量）
+func (c *Client) DownloadCounts() loader.DownloadCounts {
+	return c.downloads
+}
+
+// SetMaxConcurrentRepos 设置 FetchMultipleRepos 同时处理的仓库数量上限（<= 0 时使用默认值 DefaultMaxConcurrentRepos）
+// 每个仓库另有自己的下载线程，仓库很多时限制同时处理的仓库数量以免触发 GitHub 的二级速率限制
+func (c *Client) SetMaxConcurrentRepos(n int) {
+	if n <= 0 {
+		n = DefaultMaxConcurrentRepos
+	}
+	c.maxConcurrentRepos = n
+}
+
+// SetIgnorePatterns 设置应用于所有仓库的排除模式（来自全局忽略文件，以 ! 开头表示重新包含）
+func (c *Client) SetIgnorePatterns(patterns []string) {
+	c.ignorePatterns = patterns
 }
 
 // fetchRuleFilesWithRepo 获取规则文件（内部使用，携带仓库信息）
-func (c *Client) fetchRuleFilesWithRepo(ctx context.Context, owner, repo, branch, path string, filterRules []FilterRule, excludes []string) ([]RuleFile, error) {
-	// 获取目录树
+func (c *Client) fetchRuleFilesWithRepo(ctx context.Context, owner, repo, branch string, paths []string, filterRules []FilterRule, excludes []string) ([]RuleFile, error) {
+	if len(c.ignorePatterns) > 0 {
+		excludes = append(append([]string{}, c.ignorePatterns...), excludes...)
+	}
+
+	// 获取目录树（触发速率限制时等待重置后重试）
+	target := fmt.Sprintf("%s/%s@%s 的目录树", owner, repo, branch)
 	tree, _, err := c.client.Git.GetTree(ctx, owner, repo, branch, true)
+	for retry := 1; err != nil && retry <= c.maxRetries; retry++ {
+		if _, limited := rateLimitWait(err); !limited {
+			break
+		}
+		if waitErr := c.backoff(ctx, err, target); waitErr != nil {
+			err = waitErr
+			break
+		}
+		tree, _, err = c.client.Git.GetTree(ctx, owner, repo, branch, true)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("获取目录树失败: %w", err)
 	}
@@ -156,7 +235,7 @@ func (c *Client) fetchRuleFilesWithRepo(ctx context.Context, owner, repo, branch
 		}
 
 		// 检查是否在指定路径下
-		if path != "" && !strings.HasPrefix(*entry.Path, path) {
+		if !underPaths(*entry.Path, paths) {
 			continue
 		}
 
@@ -178,29 +257,10 @@ func (c *Client) fetchRuleFilesWithRepo(ctx context.Context, owner, repo, branch
 			continue
 		}
 
-		// 检查是否匹配排除模式
-		excluded := false
-		if len(excludes) > 0 {
-			for _, pattern := range excludes {
-				if pattern == "" {
-					continue
-				}
-				// 使用 doublestar 库支持 ** 递归匹配完整路径
-				matched, err := doublestar.Match(pattern, *entry.Path)
-				if err != nil {
-					log.Warn().Msgf("排除模式匹配失败: %v (pattern: %s, path: %s)", err, pattern, *entry.Path)
-					continue
-				}
-				if matched {
-					excluded = true
-					excludedCount++
-					log.Debug().Msgf("排除文件: %s (匹配模式: %s)", *entry.Path, pattern)
-					break
-				}
-			}
-		}
-
-		if excluded {
+		// 检查是否匹配排除模式（全局忽略文件的模式在前，仓库的 excludes 在后，最后匹配的模式决定结果）
+		if excluded, pattern := isExcluded(*entry.Path, excludes); excluded {
+			excludedCount++
+			log.Debug().Msgf("排除文件: %s (匹配模式: %s)", *entry.Path, pattern)
 			continue
 		}
 
@@ -223,14 +283,32 @@ func (c *Client) fetchRuleFilesWithRepo(ctx context.Context, owner, repo, branch
 	return ruleFiles, nil
 }
 
+// underPaths 判断文件是否位于任意一个路径前缀下（paths 为空时匹配所有文件）
+func underPaths(filePath string, paths []string) bool {
+	if len(paths) == 0 {
+		return true
+	}
+	for _, p := range paths {
+		if strings.HasPrefix(filePath, p) {
+			return true
+		}
+	}
+	return false
+}
+
 // ProcessRuleFiles 处理规则文件（下载到本地）
-func (c *Client) ProcessRuleFiles(ctx context.Context, ruleFiles []RuleFile) ([]RuleFile, error) {
+// progress: 跨仓库共享的下载进度（可选），为 nil 时只统计本次调用的文件
+func (c *Client) ProcessRuleFiles(ctx context.Context, ruleFiles []RuleFile, progress *Progress) ([]RuleFile, error) {
 	// 并发下载文件到本地
 	totalFiles := len(ruleFiles)
 	if totalFiles == 0 {
 		log.Info().Msg("没有找到规则文件")
 		return ruleFiles, nil
 	}
+	if progress == nil {
+		progress = NewProgress()
+	}
+	progress.AddTotal(totalFiles)
 	log.Info().Msgf("开始下载 %d 个规则文件，并发数：%d", totalFiles, c.downloadThreads)
 
 	type downloadTask struct {
@@ -251,8 +329,6 @@ func (c *Client) ProcessRuleFiles(ctx context.Context, ruleFiles []RuleFile) ([]
 	// 进度跟踪
 	downloading := make(map[int]string) // 正在下载的文件
 	var downloadingMutex sync.Mutex
-	completed := 0
-	var completedMutex sync.Mutex
 	failedCount := 0
 	var failedMutex sync.Mutex
 
@@ -276,10 +352,11 @@ func (c *Client) ProcessRuleFiles(ctx context.Context, ruleFiles []RuleFile) ([]
 				filePath := c.buildLocalFilePathFromInfo(task.rf.Owner, task.rf.Repo, task.rf.Branch, task.rf.Path)
 
 				// 检查文件是否已存在（断点续传/跳过已有文件）
-				if _, err := os.Stat(filePath); err == nil {
+				if info, err := os.Stat(filePath); err == nil {
 					// 文件已存在
-					if !c.overwriteFiles {
+					if !c.overwriteFiles && !c.forceRefresh {
 						// 不覆盖模式：跳过下载，直接使用已有文件
+						progress.RecordCached(info.Size())
 						task.rf.URL = filePath
 						results <- downloadResult{
 							index: task.index,
@@ -294,62 +371,15 @@ func (c *Client) ProcessRuleFiles(ctx context.Context, ruleFiles []RuleFile) ([]
 					// 覆盖模式：继续下载，会覆盖已有文件
 				}
 
-				// 带重试的下载
-				var content []byte
-				var err error
-				for retry := 0; retry <= c.maxRetries; retry++ {
-					if retry > 0 {
-						log.Info().Msgf("重试 [%d/%d]: %s", retry, c.maxRetries, fileName)
-						// 使用 time.Sleep 实现延迟
-						time.Sleep(time.Duration(c.retryDelay) * time.Second)
-
-						// 检查是否被取消
-						select {
-						case <-ctx.Done():
-							err = ctx.Err()
-							break
-						default:
-						}
-					}
-
-					// 使用 GitHub API DownloadContents 下载文件（没有大小限制）
-					reader, _, err := c.client.Repositories.DownloadContents(
-						ctx,
-						task.rf.Owner,
-						task.rf.Repo,
-						task.rf.Path,
-						&github.RepositoryContentGetOptions{Ref: task.rf.Branch},
-					)
-
-					if err != nil {
-						if retry == c.maxRetries {
-							break
-						}
-						continue
-					}
-
-					// 读取文件内容
-					if reader == nil {
-						err = fmt.Errorf("文件内容为空")
-						if retry == c.maxRetries {
-							break
-						}
-						continue
-					}
-
-					// 使用 io.ReadAll 读取全部内容
-					content, err = io.ReadAll(reader)
-					reader.Close()
-
-					if err != nil {
-						if retry == c.maxRetries {
-							break
-						}
-						continue
+				// 带重试的下载（触发速率限制时等待重置时间，其他错误等待 retryDelay）
+				content, err := c.downloadContent(ctx, task.rf)
+				for retry := 1; err != nil && retry <= c.maxRetries; retry++ {
+					if waitErr := c.backoff(ctx, err, fileName); waitErr != nil {
+						err = waitErr
+						break
 					}
-
-					// 下载成功
-					break
+					log.Info().Msgf("重试 [%d/%d]: %s", retry, c.maxRetries, fileName)
+					content, err = c.downloadContent(ctx, task.rf)
 				}
 
 				if err != nil {
@@ -369,6 +399,8 @@ func (c *Client) ProcessRuleFiles(ctx context.Context, ruleFiles []RuleFile) ([]
 					continue
 				}
 
+				progress.RecordDownload(int64(len(content)))
+
 				// 保存文件
 				if err := c.saveFile(filePath, []byte(content)); err != nil {
 					failedMutex.Lock()
@@ -418,16 +450,13 @@ func (c *Client) ProcessRuleFiles(ctx context.Context, ruleFiles []RuleFile) ([]
 	var firstError error
 
 	for result := range results {
-		completedMutex.Lock()
-		completed++
-		currentCompleted := completed
-		completedMutex.Unlock()
+		currentCompleted, totalAll := progress.Done(result.err != nil)
 
 		if result.err != nil {
 			if firstError == nil {
 				firstError = result.err
 			}
-			log.Error().Msgf("[%d/%d] 下载失败: %v", currentCompleted, totalFiles, result.err)
+			log.Error().Msgf("[%d/%d] 下载失败: %v", currentCompleted, totalAll, result.err)
 			// 不添加失败的文件到结果中
 		} else {
 			// 只添加成功下载的文件
@@ -443,9 +472,9 @@ func (c *Client) ProcessRuleFiles(ctx context.Context, ruleFiles []RuleFile) ([]
 
 			if len(downloadingList) > 0 {
 				log.Info().Msgf("[%d/%d] 已完成，正在下载: %s",
-					currentCompleted, totalFiles, strings.Join(downloadingList, ", "))
+					currentCompleted, totalAll, strings.Join(downloadingList, ", "))
 			} else {
-				log.Info().Msgf("[%d/%d] 已完成", currentCompleted, totalFiles)
+				log.Info().Msgf("[%d/%d] 已完成", currentCompleted, totalAll)
 			}
 		}
 	}
@@ -479,11 +508,25 @@ func (c *Client) FetchMultipleRepos(ctx context.Context, repos []RepoConfig) (ma
 	}
 
 	results := make(chan repoResult, len(repos))
+	progress := NewProgress() // 所有仓库共享的全局下载进度
+
+	// 限制同时处理的仓库数量
+	limit := c.maxConcurrentRepos
+	if limit <= 0 {
+		limit = DefaultMaxConcurrentRepos
+	}
+	sem := make(chan struct{}, limit)
+	if len(repos) > limit {
+		log.Info().Msgf("共 %d 个仓库，同时处理 %d 个", len(repos), limit)
+	}
 
 	for _, repo := range repos {
 		go func(r RepoConfig) {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
 			// 使用仓库的 filters 列表和排除模式列表
-			files, err := c.FetchRuleFiles(ctx, r.Owner, r.Repo, r.Branch, r.Path, r.Filters, r.Excludes)
+			files, err := c.fetchRepoBranches(ctx, r)
 			if err != nil {
 				results <- repoResult{
 					key: fmt.Sprintf("%s/%s", r.Owner, r.Repo),
@@ -492,7 +535,7 @@ func (c *Client) FetchMultipleRepos(ctx context.Context, repos []RepoConfig) (ma
 				return
 			}
 
-			ruleFiles, err := c.ProcessRuleFiles(ctx, files)
+			ruleFiles, err := c.ProcessRuleFiles(ctx, files, progress)
 			results <- repoResult{
 				key:       fmt.Sprintf("%s/%s", r.Owner, r.Repo),
 				ruleFiles: ruleFiles,
@@ -519,6 +562,10 @@ func (c *Client) FetchMultipleRepos(ctx context.Context, repos []RepoConfig) (ma
 		}
 	}
 
+	completed, failed, total := progress.Snapshot()
+	c.downloads = progress.Counts()
+	log.Info().Msgf("全部仓库下载完成: 共 %d 个文件，完成 %d 个，失败 %d 个（%d 个仓库），%s", total, completed, failed, len(repos), progress.Summary())
+
 	// 如果所有仓库都失败，返回错误
 	if errorCount == len(repos) {
 		return nil, fmt.Errorf("所有仓库处理失败，最后一个错误: %w", lastError)
@@ -532,12 +579,50 @@ func (c *Client) FetchMultipleRepos(ctx context.Context, repos []RepoConfig) (ma
 	return repoResults, nil
 }
 
+// downloadContent 使用 GitHub API DownloadContents 下载文件（没有大小限制）
+func (c *Client) downloadContent(ctx context.Context, rf RuleFile) ([]byte, error) {
+	reader, _, err := c.client.Repositories.DownloadContents(ctx, rf.Owner, rf.Repo, rf.Path,
+		&github.RepositoryContentGetOptions{Ref: rf.Branch})
+	if err != nil {
+		return nil, err
+	}
+	if reader == nil {
+		return nil, fmt.Errorf("文件内容为空")
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+// fetchRepoBranches 获取仓库所有分支的规则文件，部分分支失败时记录警告并使用成功的分支
+func (c *Client) fetchRepoBranches(ctx context.Context, r RepoConfig) ([]RuleFile, error) {
+	var files []RuleFile
+	var lastError error
+	failed := 0
+	for _, branch := range r.Branches {
+		branchFiles, err := c.FetchRuleFiles(ctx, r.Owner, r.Repo, branch, r.Paths, r.Filters, r.Excludes)
+		if err != nil {
+			if len(r.Branches) > 1 {
+				log.Warn().Msgf("获取仓库 %s/%s 分支 %s 失败: %v", r.Owner, r.Repo, branch, err)
+			}
+			failed++
+			lastError = err
+			continue
+		}
+		files = append(files, branchFiles...)
+	}
+
+	if failed == len(r.Branches) && lastError != nil {
+		return nil, lastError
+	}
+	return files, nil
+}
+
 // RepoConfig 仓库配置
 type RepoConfig struct {
 	Owner    string
 	Repo     string
-	Branch   string
-	Path     string
+	Branches []string     // 分支列表（每个分支单独获取目录树）
+	Paths    []string     // 仓库内路径前缀（为空时匹配整个仓库）
 	Filters  []FilterRule // 过滤规则列表
 	Excludes []string     // 排除模式列表（支持 glob 模式）
 }
@@ -565,15 +650,15 @@ func (c *Client) buildLocalFilePathFromInfo(owner, repo, branch, path string) st
 		return fmt.Sprintf("%s/%s/%s/%s/%s", c.downloadPath, owner, repo, branch, path)
 	}
 
-	// 扁平化存储：download_path/repo_file.list
-	// 添加仓库名作为前缀，避免不同仓库的同名文件冲突
+	// 扁平化存储：download_path/repo_branch_file.list
+	// 添加仓库名和分支名作为前缀，避免不同仓库或同一仓库不同分支（branches）的同名文件互相覆盖
 	fileName := filepath.Base(path)
 	fileExt := filepath.Ext(fileName)
 	fileBaseName := strings.TrimSuffix(fileName, fileExt)
 
-	// 使用格式：仓库名_文件名.扩展名
-	// 例如：ACL4SSR_google.list, blackmatrix7_google.list
-	return fmt.Sprintf("%s/%s_%s%s", c.downloadPath, repo, fileBaseName, fileExt)
+	// 使用格式：仓库名_分支名_文件名.扩展名（分支名中的 / 替换为 _）
+	// 例如：ACL4SSR_master_google.list, ios_rule_script_master_google.list
+	return fmt.Sprintf("%s/%s_%s_%s%s", c.downloadPath, repo, strings.ReplaceAll(branch, "/", "_"), fileBaseName, fileExt)
 }
 
 // buildLocalFilePath 构建本地文件路径（保留用于兼容性）
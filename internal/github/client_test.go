@@ -0,0 +1,64 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v58/github"
+)
+
+// newStubClient 创建请求发往 handler 的客户端
+func newStubClient(t *testing.T, handler http.Handler) *Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	gh := github.NewClient(nil)
+	baseURL, err := url.Parse(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gh.BaseURL = baseURL
+	return &Client{
+		client:          gh,
+		downloadPath:    t.TempDir(),
+		downloadThreads: 1,
+	}
+}
+
+func TestFetchMultipleReposLimitsConcurrency(t *testing.T) {
+	const limit = 2
+	var inFlight, maxInFlight atomic.Int32
+	c := newStubClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			peak := maxInFlight.Load()
+			if n <= peak || maxInFlight.CompareAndSwap(peak, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"sha":"0","tree":[],"truncated":false}`)
+	}))
+	c.SetMaxConcurrentRepos(limit)
+
+	repos := make([]RepoConfig, 8)
+	for i := range repos {
+		repos[i] = RepoConfig{Owner: "owner", Repo: fmt.Sprintf("repo%d", i), Branches: []string{"master"}}
+	}
+	if _, err := c.FetchMultipleRepos(context.Background(), repos); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := maxInFlight.Load(); got > limit || got == 0 {
+		t.Errorf("max in-flight repositories = %d, want 1..%d", got, limit)
+	}
+}
@@ -0,0 +1,109 @@
+package github
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultIgnoreFile 默认的全局忽略文件（不存在时不加载）
+const DefaultIgnoreFile = ".refineryignore"
+
+// LoadIgnoreFile 读取 .gitignore 风格的忽略文件，返回转换后的排除模式（doublestar 语法，以 ! 开头表示重新包含）
+// 支持的语法：
+// - 空行和 # 开头的行被忽略，\# 和 \! 表示字面量
+// - ! 开头表示否定（重新包含之前的模式排除的文件）
+// - 不含 / 的模式匹配任意目录下的文件名或目录名（如 README*、*_IPv6.list）
+// - 含 / 的模式相对仓库根目录匹配（开头的 / 可省略），末尾的 / 表示只匹配目录
+func LoadIgnoreFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("打开忽略文件失败: %w", err)
+	}
+	defer file.Close()
+
+	var patterns []string
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		negate := false
+		if strings.HasPrefix(line, "!") {
+			negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\#`) || strings.HasPrefix(line, `\!`) {
+			line = line[1:]
+		}
+
+		globs := ignoreLineToGlobs(line)
+		if globs == nil {
+			continue
+		}
+		for _, glob := range globs {
+			if !doublestar.ValidatePattern(glob) {
+				return nil, fmt.Errorf("%s 第 %d 行: 无效的模式: %s", path, lineNum, line)
+			}
+			if negate {
+				glob = "!" + glob
+			}
+			patterns = append(patterns, glob)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取忽略文件失败: %w", err)
+	}
+	return patterns, nil
+}
+
+// ignoreLineToGlobs 将一行 gitignore 模式转换为匹配文件路径的 doublestar 模式
+// 目录模式转换为匹配目录下所有文件的模式；未限定为目录的模式同时匹配同名文件和目录下的文件
+func ignoreLineToGlobs(line string) []string {
+	dirOnly := strings.HasSuffix(line, "/")
+	line = strings.Trim(line, "/")
+	if line == "" {
+		return nil
+	}
+
+	// 不含 / 的模式可以出现在任意层级
+	if !strings.Contains(line, "/") && !strings.HasPrefix(line, "**") {
+		line = "**/" + line
+	}
+
+	if dirOnly {
+		return []string{line + "/**"}
+	}
+	return []string{line, line + "/**"}
+}
+
+// isExcluded 按顺序应用排除模式，最后一个匹配的模式决定结果（与 .gitignore 相同），以 ! 开头的模式重新包含
+func isExcluded(filePath string, excludes []string) (bool, string) {
+	excluded := false
+	matchedPattern := ""
+	for _, pattern := range excludes {
+		if pattern == "" {
+			continue
+		}
+		negate := strings.HasPrefix(pattern, "!")
+		glob := strings.TrimPrefix(pattern, "!")
+		// 使用 doublestar 库支持 ** 递归匹配完整路径
+		matched, err := doublestar.Match(glob, filePath)
+		if err != nil {
+			log.Warn().Msgf("排除模式匹配失败: %v (pattern: %s, path: %s)", err, pattern, filePath)
+			continue
+		}
+		if matched {
+			excluded = !negate
+			matchedPattern = pattern
+		}
+	}
+	return excluded, matchedPattern
+}
@@ -0,0 +1,40 @@
+package github
+
+import (
+	"sync/atomic"
+
+	"rulerefinery/internal/loader"
+)
+
+// Progress 下载进度聚合器（并发安全）
+// 多个仓库并发下载时共享同一个 Progress，日志中显示跨仓库的全局进度
+// 各仓库列出文件后才会累加总数，因此总数在下载过程中可能增长
+type Progress struct {
+	total     atomic.Int64
+	completed atomic.Int64
+
+	loader.DownloadStats // 下载流量（已存在而跳过下载的文件计入缓存）
+}
+
+// NewProgress 创建下载进度聚合器
+func NewProgress() *Progress {
+	return &Progress{}
+}
+
+// AddTotal 增加待下载文件总数
+func (p *Progress) AddTotal(n int) {
+	p.total.Add(int64(n))
+}
+
+// Done 记录一个文件处理完成，返回更新后的已完成数量和当前总数
+func (p *Progress) Done(failed bool) (completed int64, total int64) {
+	if failed {
+		p.RecordFailure()
+	}
+	return p.completed.Add(1), p.total.Load()
+}
+
+// Snapshot 返回当前的已完成、失败数量和总数
+func (p *Progress) Snapshot() (completed int64, failed int64, total int64) {
+	return p.completed.Load(), p.Counts().FailedFiles, p.total.Load()
+}
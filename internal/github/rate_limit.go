@@ -0,0 +1,76 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/go-github/v58/github"
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultRateLimitMaxWait 触发 GitHub API 速率限制时默认最多等待的时间，可通过 rule-sources.github.rate_limit_max_wait_seconds 修改
+const DefaultRateLimitMaxWait = 10 * time.Minute
+
+// abuseRateLimitWait 二级速率限制没有给出 Retry-After 时的等待时间
+const abuseRateLimitWait = time.Minute
+
+// SetRateLimitMaxWait 设置触发速率限制时最多等待的时间（<= 0 时使用默认值 DefaultRateLimitMaxWait）
+// 需要等待更久（如未配置 token 时每小时 60 次的额度已用完）时直接失败，不再重试
+func (c *Client) SetRateLimitMaxWait(d time.Duration) {
+	if d <= 0 {
+		d = DefaultRateLimitMaxWait
+	}
+	c.rateLimitMaxWait = d
+}
+
+// rateLimitWait 判断错误是否为 GitHub API 速率限制，返回需要等待的时间：
+// 主速率限制（X-RateLimit-Remaining: 0）等待到重置时间，二级速率限制按 Retry-After 等待
+func rateLimitWait(err error) (time.Duration, bool) {
+	var rateErr *github.RateLimitError
+	if errors.As(err, &rateErr) {
+		wait := time.Until(rateErr.Rate.Reset.Time) + time.Second // 多等 1 秒，避免本地时钟略快时刚好早于重置时间
+		if wait < time.Second {
+			wait = time.Second
+		}
+		return wait, true
+	}
+
+	var abuseErr *github.AbuseRateLimitError
+	if errors.As(err, &abuseErr) {
+		if abuseErr.RetryAfter != nil && *abuseErr.RetryAfter > 0 {
+			return *abuseErr.RetryAfter, true
+		}
+		return abuseRateLimitWait, true
+	}
+	return 0, false
+}
+
+// backoff 请求失败后等待再重试：速率限制时等待到重置时间（超过 rate_limit_max_wait_seconds 时返回错误，不再重试），
+// 其他错误等待 retryDelay 秒。返回 nil 表示可以重试，context 取消时返回 ctx.Err()
+func (c *Client) backoff(ctx context.Context, err error, target string) error {
+	delay := time.Duration(c.retryDelay) * time.Second
+	if wait, limited := rateLimitWait(err); limited {
+		maxWait := c.rateLimitMaxWait
+		if maxWait <= 0 {
+			maxWait = DefaultRateLimitMaxWait
+		}
+		if wait > maxWait {
+			log.Warn().Msgf("GitHub API 速率限制: %s 需要等待 %s，超过上限 %s（rule-sources.github.rate_limit_max_wait_seconds），不再重试；请配置或更换 token",
+				target, wait.Round(time.Second), maxWait)
+			return fmt.Errorf("GitHub API 速率限制，需要等待 %s: %w", wait.Round(time.Second), err)
+		}
+		log.Warn().Msgf("GitHub API 速率限制: 等待 %s 后重试 %s", wait.Round(time.Second), target)
+		delay = wait
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
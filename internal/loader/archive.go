@@ -0,0 +1,191 @@
+package loader
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/rs/zerolog/log"
+)
+
+// 压缩包类型
+const (
+	archiveZip   = "zip"
+	archiveTarGz = "tar.gz"
+)
+
+// DefaultArchiveInclude 压缩包来源默认提取的规则文件（archive_include 为空时使用）
+var DefaultArchiveInclude = []string{"**/*.list", "**/*.txt", "**/*.yaml", "**/*.yml"}
+
+// maxArchiveSize 解压后的总大小上限，防止异常压缩包耗尽内存
+const maxArchiveSize = 512 << 20
+
+// archiveEntry 压缩包中的规则文件
+type archiveEntry struct {
+	Name    string // 压缩包内的路径（以 / 分隔）
+	Content []byte
+}
+
+// archiveKind 根据 URL 路径判断压缩包类型（.zip、.tar.gz、.tgz），不是压缩包时返回空字符串
+func archiveKind(urlStr string) string {
+	p := urlStr
+	if parsed, err := url.Parse(urlStr); err == nil {
+		p = parsed.Path
+	}
+	p = strings.ToLower(p)
+	switch {
+	case strings.HasSuffix(p, ".zip"):
+		return archiveZip
+	case strings.HasSuffix(p, ".tar.gz"), strings.HasSuffix(p, ".tgz"):
+		return archiveTarGz
+	}
+	return ""
+}
+
+// extractArchive 在内存中解压压缩包，返回路径匹配 includes（doublestar glob）的普通文件（按路径排序）
+// 跳过目录、链接、隐藏文件（如 __MACOSX/、.DS_Store）
+func extractArchive(data []byte, kind string, includes []string) ([]archiveEntry, error) {
+	var entries []archiveEntry
+	total := 0
+	add := func(name string, r io.Reader) error {
+		name = path.Clean(strings.TrimPrefix(filepath.ToSlash(name), "/"))
+		if !archiveIncluded(name, includes) {
+			return nil
+		}
+		content, err := io.ReadAll(io.LimitReader(r, int64(maxArchiveSize-total)+1))
+		if err != nil {
+			return fmt.Errorf("读取 %s 失败: %w", name, err)
+		}
+		total += len(content)
+		if total > maxArchiveSize {
+			return fmt.Errorf("解压后超过 %d MB", maxArchiveSize>>20)
+		}
+		entries = append(entries, archiveEntry{Name: name, Content: content})
+		return nil
+	}
+
+	switch kind {
+	case archiveZip:
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, fmt.Errorf("解析 zip 失败: %w", err)
+		}
+		for _, f := range zr.File {
+			if !f.Mode().IsRegular() {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return nil, fmt.Errorf("读取 %s 失败: %w", f.Name, err)
+			}
+			err = add(f.Name, rc)
+			rc.Close()
+			if err != nil {
+				return nil, err
+			}
+		}
+	case archiveTarGz:
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("解析 gzip 失败: %w", err)
+		}
+		defer gz.Close()
+		tr := tar.NewReader(gz)
+		for {
+			header, err := tr.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("解析 tar 失败: %w", err)
+			}
+			if header.Typeflag != tar.TypeReg {
+				continue
+			}
+			if err := add(header.Name, tr); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, fmt.Errorf("不支持的压缩包类型: %s", kind)
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return entries, nil
+}
+
+// archiveIncluded 判断压缩包内的路径是否需要提取
+func archiveIncluded(name string, includes []string) bool {
+	if name == "." || strings.HasPrefix(name, "../") {
+		return false
+	}
+	for _, part := range strings.Split(name, "/") {
+		if strings.HasPrefix(part, ".") || part == "__MACOSX" {
+			return false
+		}
+	}
+
+	for _, pattern := range includesOrDefault(includes) {
+		if matched, err := doublestar.Match(pattern, name); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+// loadArchiveSource 下载压缩包并提取其中的规则文件，每个文件如同单独下载的 URL 来源一样保存到临时目录
+// 返回提取的规则文件路径（按压缩包内路径排序）
+func (rl *RulesLoader) loadArchiveSource(ctx context.Context, rulesetName string, urlStr string, kind string, includes []string, index int) ([]string, error) {
+	log.Info().Msgf("  下载压缩包: %s", urlStr)
+	data, err := rl.loader.Load(ctx, urlStr)
+	if err != nil {
+		rl.stats.RecordFailure()
+		return nil, fmt.Errorf("下载失败: %w", err)
+	}
+	rl.stats.RecordDownload(int64(len(data)))
+
+	entries, err := extractArchive(data, kind, includes)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("压缩包中没有匹配 %v 的规则文件", includesOrDefault(includes))
+	}
+
+	// 格式: savePath/rulesetName/archive_{index}/压缩包内路径
+	archiveDir := filepath.Join(rl.savePath, rulesetName, fmt.Sprintf("archive_%d", index))
+	files := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		savePath := filepath.Join(archiveDir, filepath.FromSlash(entry.Name))
+		if err := os.MkdirAll(filepath.Dir(savePath), 0755); err != nil {
+			return nil, fmt.Errorf("创建目录失败: %w", err)
+		}
+		if err := os.WriteFile(savePath, entry.Content, 0644); err != nil {
+			return nil, fmt.Errorf("保存文件失败: %w", err)
+		}
+		files = append(files, savePath)
+	}
+
+	log.Info().Msgf("  压缩包: 提取 %d 个规则文件", len(files))
+	return files, nil
+}
+
+// includesOrDefault 返回实际使用的提取模式
+func includesOrDefault(includes []string) []string {
+	if len(includes) == 0 {
+		return DefaultArchiveInclude
+	}
+	return includes
+}
@@ -1,14 +1,19 @@
 package loader
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"os"
 	"path/filepath"
 	"sync"
 
+	"github.com/rs/zerolog/log"
+
 	"rulerefinery/internal/proxy"
 )
 
@@ -19,10 +24,57 @@ type Result struct {
 	Error   error
 }
 
+// ContentLoader 内容加载器接口
+// Loader 从网络或本地文件加载，MemoryLoader 从内存加载（用于测试或嵌入调用）
+type ContentLoader interface {
+	// Load 加载单个资源（URL 或文件路径）
+	Load(ctx context.Context, source string) ([]byte, error)
+}
+
+var _ ContentLoader = (*Loader)(nil)
+
+// CacheValidators 上次响应中用于条件请求的缓存校验信息
+type CacheValidators struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+// IsZero 是否没有任何校验信息（服务器没有返回 ETag 和 Last-Modified）
+func (v CacheValidators) IsZero() bool {
+	return v.ETag == "" && v.LastModified == ""
+}
+
+// ConditionalResult 条件请求的结果
+type ConditionalResult struct {
+	Content     []byte          // 响应内容（NotModified 时为空）
+	Validators  CacheValidators // 响应中的 ETag/Last-Modified（NotModified 时为服务器返回的值，没有返回时沿用请求中的值）
+	NotModified bool            // 服务器返回 304，缓存的内容仍是最新的
+}
+
+// ConditionalLoader 支持条件请求（If-None-Match/If-Modified-Since）的内容加载器
+// RulesLoader 在内容加载器实现该接口时校验已缓存的 URL 来源是否有更新
+type ConditionalLoader interface {
+	// LoadURLConditional 携带上次的校验信息请求 URL，validators 为空时是普通请求
+	LoadURLConditional(ctx context.Context, urlStr string, validators CacheValidators) (*ConditionalResult, error)
+}
+
+var _ ConditionalLoader = (*Loader)(nil)
+
+// ErrHTMLContent 下载的内容是 HTML 页面（如认证门户、代理的错误页），不是规则文件
+var ErrHTMLContent = errors.New("下载内容是 HTML 页面，不是规则文件")
+
+// defaultMaxRetries 下载失败时切换代理重试的最大次数
+const defaultMaxRetries = 3
+
+// DefaultDownloadTimeout 文件下载的默认超时时间（秒），可通过 rule-sources.download_timeout 修改
+const DefaultDownloadTimeout = 30
+
 // Loader 加载器
 type Loader struct {
 	proxyPool  *proxy.Pool
 	maxWorkers int
+	maxRetries int // 切换代理重试的最大次数（实际不超过代理数量 - 1）
+	timeout    int // 单个文件下载的超时时间（秒）
 }
 
 // isURL 判断字符串是否为 URL
@@ -38,9 +90,19 @@ func NewLoader(proxyPool *proxy.Pool, maxWorkers int) *Loader {
 	return &Loader{
 		proxyPool:  proxyPool,
 		maxWorkers: maxWorkers,
+		maxRetries: defaultMaxRetries,
+		timeout:    DefaultDownloadTimeout,
 	}
 }
 
+// SetTimeout 设置单个文件下载的超时时间（秒），小于等于 0 时使用默认的 30 秒
+func (l *Loader) SetTimeout(seconds int) {
+	if seconds <= 0 {
+		seconds = DefaultDownloadTimeout
+	}
+	l.timeout = seconds
+}
+
 // Load 加载单个资源（自动判断 URL 或文件）
 func (l *Loader) Load(ctx context.Context, source string) ([]byte, error) {
 	if isURL(source) {
@@ -50,15 +112,57 @@ func (l *Loader) Load(ctx context.Context, source string) ([]byte, error) {
 }
 
 // LoadURLWithUA 加载 URL 并支持自定义 User-Agent
+// 配置了多个代理时，经当前代理下载失败（网络错误、5xx、代理返回的错误页等）会切换到下一个代理重试，
+// 最多重试 maxRetries 次；404 等说明资源本身不存在的错误不重试
 func (l *Loader) LoadURLWithUA(ctx context.Context, urlStr string, userAgent string) ([]byte, error) {
-	client, err := l.proxyPool.GetHTTPClient(30) // 文件下载使用 30 秒超时
+	result, err := l.loadURLWithRetry(ctx, urlStr, userAgent, CacheValidators{})
 	if err != nil {
-		return nil, fmt.Errorf("获取 HTTP 客户端失败: %w", err)
+		return nil, err
+	}
+	return result.Content, nil
+}
+
+// LoadURLConditional 携带上次响应的 ETag/Last-Modified 发送条件请求（If-None-Match/If-Modified-Since），
+// 服务器返回 304 时 NotModified 为 true；返回 200 时包含新的内容和校验信息。失败时的代理切换与 LoadURLWithUA 相同
+func (l *Loader) LoadURLConditional(ctx context.Context, urlStr string, validators CacheValidators) (*ConditionalResult, error) {
+	return l.loadURLWithRetry(ctx, urlStr, "", validators)
+}
+
+// loadURLWithRetry 下载 URL，经当前代理失败时切换代理重试
+func (l *Loader) loadURLWithRetry(ctx context.Context, urlStr string, userAgent string, validators CacheValidators) (*ConditionalResult, error) {
+	retries := l.proxyPool.Count() - 1
+	if retries > l.maxRetries {
+		retries = l.maxRetries
+	}
+
+	for attempt := 0; ; attempt++ {
+		client, proxyURL, err := l.proxyPool.GetHTTPClientWithProxy(l.timeout)
+		if err != nil {
+			return nil, fmt.Errorf("获取 HTTP 客户端失败: %w", err)
+		}
+
+		result, retryable, err := fetchURL(ctx, client, urlStr, userAgent, validators)
+		if err == nil {
+			if attempt > 0 {
+				log.Info().Msgf("  重试成功: %s（代理: %s）", urlStr, proxyURL)
+			}
+			return result, nil
+		}
+		if !retryable || attempt >= retries || ctx.Err() != nil {
+			return nil, err
+		}
+
+		l.proxyPool.NextProxyFrom(proxyURL)
+		log.Warn().Msgf("  下载失败（代理: %s）: %v，切换到代理 %s 重试 [%d/%d]: %s",
+			proxyURL, err, l.proxyPool.GetCurrentProxy(), attempt+1, retries, urlStr)
 	}
+}
 
+// fetchURL 使用指定客户端下载 URL，validators 不为空时发送条件请求；返回的 retryable 表示失败可能与代理有关、可以换一个代理重试
+func fetchURL(ctx context.Context, client *http.Client, urlStr string, userAgent string, validators CacheValidators) (*ConditionalResult, bool, error) {
 	req, err := http.NewRequestWithContext(ctx, "GET", urlStr, nil)
 	if err != nil {
-		return nil, fmt.Errorf("创建请求失败: %w", err)
+		return nil, false, fmt.Errorf("创建请求失败: %w", err)
 	}
 
 	// 使用自定义 User-Agent 或默认值
@@ -67,23 +171,73 @@ func (l *Loader) LoadURLWithUA(ctx context.Context, urlStr string, userAgent str
 	}
 	req.Header.Set("User-Agent", userAgent)
 	req.Header.Set("Accept", "*/*")
+	if validators.ETag != "" {
+		req.Header.Set("If-None-Match", validators.ETag)
+	}
+	if validators.LastModified != "" {
+		req.Header.Set("If-Modified-Since", validators.LastModified)
+	}
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("请求失败: %w", err)
+		return nil, true, fmt.Errorf("请求失败: %w", err)
 	}
 	defer resp.Body.Close()
 
+	received := CacheValidators{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}
+	if resp.StatusCode == http.StatusNotModified && !validators.IsZero() {
+		if received.IsZero() {
+			received = validators
+		}
+		return &ConditionalResult{Validators: received, NotModified: true}, false, nil
+	}
+
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("HTTP 状态码错误: %d", resp.StatusCode)
+		// 资源不存在与代理无关，换代理重试没有意义
+		retryable := resp.StatusCode != http.StatusNotFound && resp.StatusCode != http.StatusGone
+		return nil, retryable, fmt.Errorf("HTTP 状态码错误: %d", resp.StatusCode)
 	}
 
 	content, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("读取响应失败: %w", err)
+		return nil, true, fmt.Errorf("读取响应失败: %w", err)
 	}
 
-	return content, nil
+	// 认证门户、代理错误页等常以 200 返回 HTML，不能当作规则文件缓存
+	if err := checkNotHTML(resp.Header.Get("Content-Type"), content); err != nil {
+		return nil, true, err
+	}
+
+	return &ConditionalResult{Content: content, Validators: received}, false, nil
+}
+
+// checkNotHTML 根据 Content-Type 和内容开头判断响应是否为 HTML 页面
+func checkNotHTML(contentType string, content []byte) error {
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		if mediaType == "text/html" || mediaType == "application/xhtml+xml" {
+			return fmt.Errorf("%w（Content-Type: %s）", ErrHTMLContent, mediaType)
+		}
+	}
+
+	// 跳过 UTF-8 BOM 和开头的空白
+	head := bytes.TrimLeft(bytes.TrimPrefix(content, []byte("\xef\xbb\xbf")), " \t\r\n")
+	if len(head) > 64 {
+		head = head[:64]
+	}
+	lower := bytes.ToLower(head)
+	if bytes.HasPrefix(lower, []byte("<!doctype html")) || bytes.HasPrefix(lower, []byte("<html")) {
+		return fmt.Errorf("%w（内容以 %q 开头）", ErrHTMLContent, firstLine(head))
+	}
+	return nil
+}
+
+// firstLine 返回内容的第一行
+func firstLine(content []byte) string {
+	line, _, _ := bytes.Cut(content, []byte("\n"))
+	return string(bytes.TrimSpace(line))
 }
 
 // LoadURLs 并发加载多个 URL
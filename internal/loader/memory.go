@@ -0,0 +1,57 @@
+package loader
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// MemoryLoader 内存内容加载器
+// 按来源（URL 或文件路径）返回预置内容，不访问网络和文件系统，
+// 用于在测试中为规则加载流程注入固定数据
+type MemoryLoader struct {
+	mu      sync.RWMutex
+	sources map[string][]byte
+	loaded  []string // 已加载的来源（按调用顺序）
+}
+
+var _ ContentLoader = (*MemoryLoader)(nil)
+
+// NewMemoryLoader 创建内存加载器，sources 为 来源 -> 内容
+func NewMemoryLoader(sources map[string][]byte) *MemoryLoader {
+	m := &MemoryLoader{sources: make(map[string][]byte, len(sources))}
+	for source, content := range sources {
+		m.sources[source] = content
+	}
+	return m
+}
+
+// Set 设置来源的内容
+func (m *MemoryLoader) Set(source string, content []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sources[source] = content
+}
+
+// Load 返回来源的预置内容，来源不存在时返回错误
+func (m *MemoryLoader) Load(ctx context.Context, source string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	content, ok := m.sources[source]
+	if !ok {
+		return nil, fmt.Errorf("来源不存在: %s", source)
+	}
+	m.loaded = append(m.loaded, source)
+	return append([]byte(nil), content...), nil
+}
+
+// Loaded 返回已加载的来源（按调用顺序）
+func (m *MemoryLoader) Loaded() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]string(nil), m.loaded...)
+}
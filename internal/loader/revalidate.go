@@ -0,0 +1,118 @@
+package loader
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/rs/zerolog/log"
+)
+
+// metaSuffix 缓存校验信息文件的后缀（与下载的规则文件放在一起，如 foo.list.meta）
+const metaSuffix = ".meta"
+
+// SetRevalidate 设置是否在复用已下载的 URL 来源前向服务器确认内容是否有更新（条件请求）
+// 默认开启，与 rule-sources.revalidate 的默认值一致；只在内容加载器实现 ConditionalLoader 时生效
+func (rl *RulesLoader) SetRevalidate(enabled bool) {
+	rl.revalidate = enabled
+}
+
+// readCacheValidators 读取文件的缓存校验信息，ok 表示校验信息文件存在（服务器没有返回校验信息时内容为空）
+func readCacheValidators(filePath string) (CacheValidators, bool) {
+	var validators CacheValidators
+	data, err := os.ReadFile(filePath + metaSuffix)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Warn().Msgf("  读取缓存校验信息失败: %v", err)
+		}
+		return validators, false
+	}
+	if err := json.Unmarshal(data, &validators); err != nil {
+		log.Warn().Msgf("  解析缓存校验信息失败 %s: %v", filePath+metaSuffix, err)
+		return validators, false
+	}
+	return validators, true
+}
+
+// writeCacheValidators 保存文件的缓存校验信息
+func writeCacheValidators(filePath string, validators CacheValidators) error {
+	data, err := json.Marshal(validators)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filePath+metaSuffix, data, 0644)
+}
+
+// downloadURLSource 下载 URL 来源并保存到 savePath
+// 内容加载器支持条件请求时同时保存响应中的 ETag/Last-Modified，供下次复用前校验
+func (rl *RulesLoader) downloadURLSource(ctx context.Context, urlStr, savePath string) error {
+	conditional, ok := rl.loader.(ConditionalLoader)
+	if !ok {
+		content, err := rl.loader.Load(ctx, urlStr)
+		if err != nil {
+			rl.stats.RecordFailure()
+			return fmt.Errorf("下载失败: %w", err)
+		}
+		rl.stats.RecordDownload(int64(len(content)))
+		if err := os.WriteFile(savePath, content, 0644); err != nil {
+			return fmt.Errorf("保存文件失败: %w", err)
+		}
+		return nil
+	}
+
+	result, err := conditional.LoadURLConditional(ctx, urlStr, CacheValidators{})
+	if err != nil {
+		rl.stats.RecordFailure()
+		return fmt.Errorf("下载失败: %w", err)
+	}
+	return rl.saveDownloaded(savePath, result)
+}
+
+// saveDownloaded 保存下载的内容和缓存校验信息
+func (rl *RulesLoader) saveDownloaded(savePath string, result *ConditionalResult) error {
+	rl.stats.RecordDownload(int64(len(result.Content)))
+	if err := os.WriteFile(savePath, result.Content, 0644); err != nil {
+		return fmt.Errorf("保存文件失败: %w", err)
+	}
+	if err := writeCacheValidators(savePath, result.Validators); err != nil {
+		log.Warn().Msgf("  保存缓存校验信息失败 %s: %v", filepath.Base(savePath), err)
+	}
+	return nil
+}
+
+// revalidateCached 校验已缓存的 URL 来源是否有更新：服务器返回 304 时复用缓存，返回 200 时覆盖缓存。
+// 没有校验信息文件（如旧版本下载的文件）时重新下载一次以获取校验信息；服务器不提供 ETag/Last-Modified 时直接复用缓存。
+// 请求失败时记录警告并复用缓存
+func (rl *RulesLoader) revalidateCached(ctx context.Context, conditional ConditionalLoader, urlStr, savePath string, cachedSize int64) {
+	validators, ok := readCacheValidators(savePath)
+	if ok && validators.IsZero() {
+		log.Info().Msgf("  - 使用缓存（服务器不支持校验）: %s", filepath.Base(savePath))
+		rl.stats.RecordCached(cachedSize)
+		return
+	}
+
+	result, err := conditional.LoadURLConditional(ctx, urlStr, validators)
+	if err != nil {
+		log.Warn().Msgf("  - 校验缓存失败，使用缓存: %s: %v", filepath.Base(savePath), err)
+		rl.stats.RecordCached(cachedSize)
+		return
+	}
+	if result.NotModified {
+		log.Info().Msgf("  - 使用缓存（未变化）: %s", filepath.Base(savePath))
+		rl.stats.RecordCached(cachedSize)
+		if result.Validators != validators {
+			if err := writeCacheValidators(savePath, result.Validators); err != nil {
+				log.Warn().Msgf("  保存缓存校验信息失败 %s: %v", filepath.Base(savePath), err)
+			}
+		}
+		return
+	}
+
+	log.Info().Msgf("  - 远端已更新，重新下载: %s", urlStr)
+	if err := rl.saveDownloaded(savePath, result); err != nil {
+		log.Warn().Msgf("  - %v，使用缓存: %s", err, filepath.Base(savePath))
+	}
+}
@@ -20,24 +20,34 @@ import (
 // RulesLoader 规则加载器
 type RulesLoader struct {
 	config          *config.RuleSetsConfig
-	loader          *Loader
-	proxyPool       *proxy.Pool
-	savePath        string          // 规则保存路径
-	excludedSources map[string]bool // 已排除的来源（URL 或路径）
-	mu              sync.RWMutex    // 保护 excludedSources
+	loader          ContentLoader
+	savePath        string            // 规则保存路径
+	excludedSources map[string]bool   // 已排除的来源（URL 或路径）
+	fileSources     map[string]string // 加载的本地文件路径 -> 来源（URL 或配置中的本地文件路径）
+	mu              sync.RWMutex      // 保护 excludedSources 和 fileSources
+	stats           DownloadStats     // URL 来源的下载流量统计
+	forceRefresh    bool              // 忽略已下载的文件，总是重新下载
+	revalidate      bool              // 复用已下载的文件前通过条件请求确认远端没有更新
 }
 
-// NewRulesLoader 创建规则加载器
-func NewRulesLoader(ruleSetsConfig *config.RuleSetsConfig, proxyPool *proxy.Pool, savePath string) *RulesLoader {
+// NewRulesLoader 创建规则加载器，downloadTimeout 为单个 URL 来源的下载超时时间（秒，0 时使用默认值）
+func NewRulesLoader(ruleSetsConfig *config.RuleSetsConfig, proxyPool *proxy.Pool, savePath string, downloadTimeout int) *RulesLoader {
 	// 创建基础加载器（用于下载文件）
-	loader := NewLoader(proxyPool, 10) // 默认 10 个并发下载
+	contentLoader := NewLoader(proxyPool, 10) // 默认 10 个并发下载
+	contentLoader.SetTimeout(downloadTimeout)
+	return NewRulesLoaderWithLoader(ruleSetsConfig, contentLoader, savePath)
+}
 
+// NewRulesLoaderWithLoader 使用指定的内容加载器创建规则加载器
+// URL 来源通过 contentLoader 获取，可传入 MemoryLoader 在不访问网络的情况下运行
+func NewRulesLoaderWithLoader(ruleSetsConfig *config.RuleSetsConfig, contentLoader ContentLoader, savePath string) *RulesLoader {
 	return &RulesLoader{
 		config:          ruleSetsConfig,
-		loader:          loader,
-		proxyPool:       proxyPool,
+		loader:          contentLoader,
 		savePath:        savePath,
 		excludedSources: make(map[string]bool),
+		fileSources:     make(map[string]string),
+		revalidate:      true,
 	}
 }
 
@@ -89,7 +99,7 @@ func (rl *RulesLoader) LoadAllRules(ctx context.Context) (map[string][]string, e
 		}
 	}
 
-	log.Info().Msgf("规则加载完成: 成功 %d 个规则集", len(result))
+	log.Info().Msgf("规则加载完成: 成功 %d 个规则集，%s", len(result), rl.stats.Summary())
 	return result, nil
 }
 
@@ -97,9 +107,12 @@ func (rl *RulesLoader) LoadAllRules(ctx context.Context) (map[string][]string, e
 func (rl *RulesLoader) loadRuleset(ctx context.Context, name string, ruleset config.RulesetConfig) ([]string, error) {
 	var files []string
 
-	totalSources := len(ruleset.URLs) + len(ruleset.Files) + len(ruleset.Rules)
+	// 手工规则包含引用的规则块
+	manualRules := rl.config.ExpandedRules(ruleset)
+
+	totalSources := len(ruleset.URLs) + len(ruleset.Files) + len(manualRules)
 	log.Info().Msgf("加载规则集 '%s' (%s)，来源数: %d (URLs: %d, Files: %d, Rules: %d)",
-		name, ruleset.Description, totalSources, len(ruleset.URLs), len(ruleset.Files), len(ruleset.Rules))
+		name, ruleset.Description, totalSources, len(ruleset.URLs), len(ruleset.Files), len(manualRules))
 
 	// 先加载该规则集的排除规则
 	if len(ruleset.ExcludeSources) > 0 {
@@ -118,6 +131,22 @@ func (rl *RulesLoader) loadRuleset(ctx context.Context, name string, ruleset con
 			continue
 		}
 
+		// 压缩包来源：提取其中的规则文件，每个文件作为单独的来源
+		if kind := archiveKind(url); kind != "" {
+			archiveFiles, err := rl.loadArchiveSource(ctx, name, url, kind, ruleset.ArchiveInclude, i)
+			if err != nil {
+				log.Warn().Msgf("  URL 来源 %d 加载失败: %v", i+1, err)
+				continue
+			}
+			files = append(files, archiveFiles...)
+			for _, archiveFile := range archiveFiles {
+				rl.recordFileSource(archiveFile, url)
+			}
+			rl.markSourceAsExcluded(url)
+			log.Info().Msgf("  URL %d: %s (%d 个文件)", i+1, filepath.Base(url), len(archiveFiles))
+			continue
+		}
+
 		filePath, err := rl.loadURLSource(ctx, name, url, i)
 		if err != nil {
 			log.Warn().Msgf("  URL 来源 %d 加载失败: %v", i+1, err)
@@ -126,6 +155,7 @@ func (rl *RulesLoader) loadRuleset(ctx context.Context, name string, ruleset con
 
 		if filePath != "" {
 			files = append(files, filePath)
+			rl.recordFileSource(filePath, url)
 			// 标记此 URL 已被加载，加入排除列表
 			rl.markSourceAsExcluded(url)
 			log.Info().Msgf("  URL %d: %s", i+1, filepath.Base(filePath))
@@ -148,20 +178,25 @@ func (rl *RulesLoader) loadRuleset(ctx context.Context, name string, ruleset con
 
 		if filePath != "" {
 			files = append(files, filePath)
+			rl.recordFileSource(filePath, file)
 			// 标记此文件已被加载，加入排除列表
 			rl.markSourceAsExcluded(file)
 			log.Info().Msgf("  本地文件 %d: %s", i+1, filepath.Base(filePath))
 		}
 	}
 
-	// 处理手工添加的规则
-	if len(ruleset.Rules) > 0 {
-		filePath, err := rl.loadManualRules(name, ruleset.Rules)
+	// 处理手工添加的规则（包含引用的规则块）
+	if len(manualRules) > 0 {
+		filePath, err := rl.loadManualRules(name, manualRules)
 		if err != nil {
 			log.Warn().Msgf("手工规则加载失败: %v", err)
 		} else if filePath != "" {
 			files = append(files, filePath)
-			log.Info().Msgf("  手工规则: %d 条", len(ruleset.Rules))
+			if len(ruleset.IncludeBlocks) > 0 {
+				log.Info().Msgf("  手工规则: %d 条（含规则块 %s）", len(manualRules), strings.Join(ruleset.IncludeBlocks, ", "))
+			} else {
+				log.Info().Msgf("  手工规则: %d 条", len(manualRules))
+			}
 		}
 	}
 
@@ -217,23 +252,22 @@ func (rl *RulesLoader) loadURLSource(ctx context.Context, rulesetName string, ur
 		savePath = filepath.Join(rulesetDir, fmt.Sprintf("%s_%d%s", base, index, ext))
 	}
 
-	// 检查文件是否已存在
-	if _, err := os.Stat(savePath); err == nil {
-		// 文件已存在，直接返回
+	// 检查文件是否已存在（强制刷新时重新下载并覆盖）
+	if info, err := os.Stat(savePath); err == nil && !rl.forceRefresh {
+		// 文件已存在：启用 revalidate 时先确认远端没有更新，否则直接复用
+		if conditional, ok := rl.loader.(ConditionalLoader); ok && rl.revalidate {
+			rl.revalidateCached(ctx, conditional, urlStr, savePath, info.Size())
+			return savePath, nil
+		}
 		log.Info().Msgf("  - 使用缓存: %s", filepath.Base(savePath))
+		rl.stats.RecordCached(info.Size())
 		return savePath, nil
 	}
 
 	// 下载文件
 	log.Info().Msgf("  下载: %s", urlStr)
-	content, err := rl.loader.Load(ctx, urlStr)
-	if err != nil {
-		return "", fmt.Errorf("下载失败: %w", err)
-	}
-
-	// 保存文件
-	if err := os.WriteFile(savePath, content, 0644); err != nil {
-		return "", fmt.Errorf("保存文件失败: %w", err)
+	if err := rl.downloadURLSource(ctx, urlStr, savePath); err != nil {
+		return "", err
 	}
 
 	return savePath, nil
@@ -292,6 +326,35 @@ func (rl *RulesLoader) GetRulesetFiles(rulesetName string) ([]string, error) {
 	return rl.loadRuleset(context.Background(), rulesetName, *ruleset)
 }
 
+// SetForceRefresh 设置是否忽略已下载的文件，总是重新下载 URL 来源
+func (rl *RulesLoader) SetForceRefresh(enabled bool) {
+	rl.forceRefresh = enabled
+}
+
+// recordFileSource 记录加载的本地文件对应的来源（URL 或配置中的本地文件路径）
+func (rl *RulesLoader) recordFileSource(filePath string, source string) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.fileSources[filePath] = source
+}
+
+// FileSources 返回加载的本地文件路径及对应的来源：URL 来源为下载的 URL，压缩包中提取的文件为压缩包 URL，
+// files 来源为配置中的路径；手工规则不记录
+func (rl *RulesLoader) FileSources() map[string]string {
+	rl.mu.RLock()
+	defer rl.mu.RUnlock()
+	sources := make(map[string]string, len(rl.fileSources))
+	for filePath, url := range rl.fileSources {
+		sources[filePath] = url
+	}
+	return sources
+}
+
+// DownloadStats 返回 URL 来源的下载流量统计
+func (rl *RulesLoader) DownloadStats() *DownloadStats {
+	return &rl.stats
+}
+
 // GetStats 获取统计信息
 func (rl *RulesLoader) GetStats() map[string]interface{} {
 	totalRulesets := len(rl.config.ClassifiedRules)
@@ -302,7 +365,7 @@ func (rl *RulesLoader) GetStats() map[string]interface{} {
 	for _, ruleset := range rl.config.ClassifiedRules {
 		totalURLs += len(ruleset.URLs)
 		totalFiles += len(ruleset.Files)
-		totalRules += len(ruleset.Rules)
+		totalRules += len(rl.config.ExpandedRules(ruleset))
 	}
 
 	return map[string]interface{}{
@@ -0,0 +1,89 @@
+package loader
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// DownloadStats 下载流量统计（并发安全）
+// 分别记录实际下载和复用本地缓存的文件数量与字节数，用于评估经计费代理下载的流量和缓存节省的流量
+type DownloadStats struct {
+	downloadedFiles atomic.Int64
+	downloadedBytes atomic.Int64
+	cachedFiles     atomic.Int64
+	cachedBytes     atomic.Int64
+	failedFiles     atomic.Int64
+}
+
+// DownloadCounts 下载统计的快照（用于运行汇总报告）
+type DownloadCounts struct {
+	DownloadedFiles int64 // 实际下载的文件数量
+	DownloadedBytes int64 // 实际下载的字节数
+	CachedFiles     int64 // 复用本地缓存的文件数量
+	CachedBytes     int64 // 复用本地缓存的字节数
+	FailedFiles     int64 // 下载失败的文件数量
+}
+
+// RecordDownload 记录一个实际下载的文件
+func (s *DownloadStats) RecordDownload(bytes int64) {
+	s.downloadedFiles.Add(1)
+	s.downloadedBytes.Add(bytes)
+}
+
+// RecordCached 记录一个复用本地缓存、没有下载的文件
+func (s *DownloadStats) RecordCached(bytes int64) {
+	s.cachedFiles.Add(1)
+	s.cachedBytes.Add(bytes)
+}
+
+// RecordFailure 记录一个下载失败的文件
+func (s *DownloadStats) RecordFailure() {
+	s.failedFiles.Add(1)
+}
+
+// Counts 返回当前的下载统计快照
+func (s *DownloadStats) Counts() DownloadCounts {
+	return DownloadCounts{
+		DownloadedFiles: s.downloadedFiles.Load(),
+		DownloadedBytes: s.downloadedBytes.Load(),
+		CachedFiles:     s.cachedFiles.Load(),
+		CachedBytes:     s.cachedBytes.Load(),
+		FailedFiles:     s.failedFiles.Load(),
+	}
+}
+
+// Downloaded 返回实际下载的文件数量和字节数
+func (s *DownloadStats) Downloaded() (files int64, bytes int64) {
+	return s.downloadedFiles.Load(), s.downloadedBytes.Load()
+}
+
+// Cached 返回复用缓存的文件数量和字节数
+func (s *DownloadStats) Cached() (files int64, bytes int64) {
+	return s.cachedFiles.Load(), s.cachedBytes.Load()
+}
+
+// Summary 返回下载流量摘要，如 "下载 12.34 MB（56 个文件），缓存节省 1.20 MB（3 个文件）"
+func (s *DownloadStats) Summary() string {
+	files, bytes := s.Downloaded()
+	summary := fmt.Sprintf("下载 %s（%d 个文件）", FormatBytes(bytes), files)
+	if cachedFiles, cachedBytes := s.Cached(); cachedFiles > 0 {
+		summary += fmt.Sprintf("，缓存节省 %s（%d 个文件）", FormatBytes(cachedBytes), cachedFiles)
+	}
+	return summary
+}
+
+// FormatBytes 将字节数格式化为便于阅读的形式（B/KB/MB/GB）
+func FormatBytes(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	value := float64(bytes) / unit
+	for _, suffix := range []string{"KB", "MB"} {
+		if value < unit {
+			return fmt.Sprintf("%.2f %s", value, suffix)
+		}
+		value /= unit
+	}
+	return fmt.Sprintf("%.2f GB", value)
+}
@@ -0,0 +1,218 @@
+package proxy
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dialFunc 拨号函数
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// dohCacheEntry DoH 解析结果缓存
+type dohCacheEntry struct {
+	ips     []net.IP
+	expires time.Time
+}
+
+// DoHResolver 基于 DNS-over-HTTPS（RFC 8484）的域名解析器
+// 用于 DNS 污染环境：在本地通过 DoH 解析目标域名，再用 IP 建立连接
+type DoHResolver struct {
+	url    string
+	client *http.Client
+	cache  map[string]dohCacheEntry
+	mu     sync.Mutex
+}
+
+// NewDoHResolver 创建 DoH 解析器
+// dial: 访问 DoH 服务器使用的底层拨号函数（直连或 SOCKS 代理）
+// proxyFunc: 访问 DoH 服务器使用的 HTTP 代理（可选）
+func NewDoHResolver(dohURL string, dial dialFunc, proxyFunc func(*http.Request) (*url.URL, error)) (*DoHResolver, error) {
+	u, err := url.Parse(dohURL)
+	if err != nil {
+		return nil, fmt.Errorf("解析 DoH 地址失败: %w", err)
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("DoH 地址必须是 https:// 开头的完整 URL: %s", dohURL)
+	}
+
+	transport := &http.Transport{
+		DialContext:         dial,
+		Proxy:               proxyFunc,
+		ForceAttemptHTTP2:   true,
+		MaxIdleConns:        10,
+		IdleConnTimeout:     90 * time.Second,
+		TLSHandshakeTimeout: 10 * time.Second,
+	}
+
+	return &DoHResolver{
+		url: dohURL,
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   10 * time.Second,
+		},
+		cache: make(map[string]dohCacheEntry),
+	}, nil
+}
+
+// LookupIP 通过 DoH 解析域名的 A 和 AAAA 记录（IPv4 优先）
+func (r *DoHResolver) LookupIP(ctx context.Context, host string) ([]net.IP, error) {
+	r.mu.Lock()
+	if entry, ok := r.cache[host]; ok && time.Now().Before(entry.expires) {
+		r.mu.Unlock()
+		return entry.ips, nil
+	}
+	r.mu.Unlock()
+
+	var ips []net.IP
+	minTTL := uint32(300)
+	var lastErr error
+	for _, qtype := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+		answers, ttl, err := r.query(ctx, host, qtype)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		ips = append(ips, answers...)
+		if len(answers) > 0 && ttl < minTTL {
+			minTTL = ttl
+		}
+	}
+
+	if len(ips) == 0 {
+		if lastErr != nil {
+			return nil, fmt.Errorf("DoH 解析 %s 失败: %w", host, lastErr)
+		}
+		return nil, fmt.Errorf("DoH 解析 %s 无结果", host)
+	}
+
+	r.mu.Lock()
+	r.cache[host] = dohCacheEntry{
+		ips:     ips,
+		expires: time.Now().Add(time.Duration(minTTL) * time.Second),
+	}
+	r.mu.Unlock()
+
+	return ips, nil
+}
+
+// query 发送单个 DoH 查询（GET ?dns=base64url）
+func (r *DoHResolver) query(ctx context.Context, host string, qtype dnsmessage.Type) ([]net.IP, uint32, error) {
+	name, err := dnsmessage.NewName(fqdn(host))
+	if err != nil {
+		return nil, 0, fmt.Errorf("无效的域名 %s: %w", host, err)
+	}
+
+	msg := dnsmessage.Message{
+		Header: dnsmessage.Header{RecursionDesired: true},
+		Questions: []dnsmessage.Question{{
+			Name:  name,
+			Type:  qtype,
+			Class: dnsmessage.ClassINET,
+		}},
+	}
+	packed, err := msg.Pack()
+	if err != nil {
+		return nil, 0, fmt.Errorf("构造 DNS 查询失败: %w", err)
+	}
+
+	sep := "?"
+	if strings.Contains(r.url, "?") {
+		sep = "&"
+	}
+	reqURL := r.url + sep + "dns=" + base64.RawURLEncoding.EncodeToString(packed)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Accept", "application/dns-message")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("DoH 服务器返回状态码 %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var answer dnsmessage.Message
+	if err := answer.Unpack(body); err != nil {
+		return nil, 0, fmt.Errorf("解析 DoH 响应失败: %w", err)
+	}
+	if answer.Header.RCode != dnsmessage.RCodeSuccess {
+		return nil, 0, fmt.Errorf("DoH 查询返回错误: %s", answer.Header.RCode)
+	}
+
+	var ips []net.IP
+	ttl := uint32(300)
+	for _, rr := range answer.Answers {
+		switch body := rr.Body.(type) {
+		case *dnsmessage.AResource:
+			ips = append(ips, net.IP(body.A[:]))
+		case *dnsmessage.AAAAResource:
+			ips = append(ips, net.IP(body.AAAA[:]))
+		default:
+			continue
+		}
+		if rr.Header.TTL < ttl {
+			ttl = rr.Header.TTL
+		}
+	}
+
+	return ips, ttl, nil
+}
+
+// fqdn 补全域名末尾的点
+func fqdn(host string) string {
+	if strings.HasSuffix(host, ".") {
+		return host
+	}
+	return host + "."
+}
+
+// DialContext 返回先通过 DoH 解析域名、再使用 base 按 IP 依次拨号的拨号函数
+func (r *DoHResolver) DialContext(base dialFunc) dialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		// 已经是 IP 地址时直接拨号
+		if net.ParseIP(host) != nil {
+			return base(ctx, network, addr)
+		}
+
+		ips, err := r.LookupIP(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+
+		var lastErr error
+		for _, ip := range ips {
+			conn, err := base(ctx, network, net.JoinHostPort(ip.String(), port))
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+		}
+		return nil, lastErr
+	}
+}
@@ -3,6 +3,7 @@ package proxy
 import (
 	"context"
 	"fmt"
+	"math/rand"
 	"net"
 	"net/http"
 	"net/url"
@@ -11,6 +12,8 @@ import (
 	"time"
 
 	"golang.org/x/net/proxy"
+
+	"rulerefinery/internal/config"
 )
 
 // ProxyType 代理类型
@@ -23,25 +26,82 @@ const (
 	ProxyTypeHTTP
 )
 
+// 代理选择策略
+const (
+	StrategyPriority = "priority" // 按协议优先级选择当前代理，失败时 NextProxy 轮换（默认）
+	StrategyWeighted = "weighted" // 每次按权重随机选择代理
+)
+
 // ProxyInfo 代理信息
 type ProxyInfo struct {
-	URL  string
-	Type ProxyType
+	URL    string
+	Type   ProxyType
+	Weight int // 权重（weighted 策略使用）
+}
+
+// Entry 代理条目
+type Entry struct {
+	URL    string
+	Weight int // 权重，<= 0 时视为 1
 }
 
 // Pool 代理池
 type Pool struct {
-	proxies []ProxyInfo
-	enabled bool
-	current int
-	mu      sync.RWMutex
+	proxies     []ProxyInfo
+	enabled     bool
+	current     int
+	strategy    string
+	totalWeight int
+	clients     map[clientKey]*http.Client // 按代理 + 超时时间缓存的客户端
+	dohURL      string                     // DNS-over-HTTPS 解析地址（可选）
+	mu          sync.RWMutex
 }
 
-// NewPool 创建代理池
+// clientKey HTTP 客户端缓存键
+type clientKey struct {
+	proxyURL string // 为空表示直连
+	timeout  int
+}
+
+// NewPool 创建代理池（priority 策略）
 func NewPool(proxyURLs []string, enabled bool) (*Pool, error) {
+	entries := make([]Entry, len(proxyURLs))
+	for i, urlStr := range proxyURLs {
+		entries[i] = Entry{URL: urlStr, Weight: 1}
+	}
+	return NewPoolWithStrategy(entries, enabled, StrategyPriority)
+}
+
+// NewPoolFromConfig 根据代理配置和 HTTP 配置创建代理池
+func NewPoolFromConfig(proxyCfg config.ProxyConfig, httpCfg config.HTTPConfig) (*Pool, error) {
+	entries := make([]Entry, len(proxyCfg.URLs))
+	for i, e := range proxyCfg.URLs {
+		entries[i] = Entry{URL: e.URL, Weight: e.Weight}
+	}
+	pool, err := NewPoolWithStrategy(entries, proxyCfg.Enabled, proxyCfg.Strategy)
+	if err != nil {
+		return nil, err
+	}
+	if err := pool.SetDoHURL(httpCfg.DoHURL); err != nil {
+		return nil, err
+	}
+	return pool, nil
+}
+
+// NewPoolWithStrategy 创建指定选择策略的代理池
+func NewPoolWithStrategy(entries []Entry, enabled bool, strategy string) (*Pool, error) {
+	strategy = strings.ToLower(strings.TrimSpace(strategy))
+	if strategy == "" {
+		strategy = StrategyPriority
+	}
+	if strategy != StrategyPriority && strategy != StrategyWeighted {
+		return nil, fmt.Errorf("不支持的代理选择策略: %s（可选: %s/%s）", strategy, StrategyPriority, StrategyWeighted)
+	}
+
 	pool := &Pool{
-		enabled: enabled,
-		proxies: make([]ProxyInfo, 0, len(proxyURLs)),
+		enabled:  enabled,
+		strategy: strategy,
+		proxies:  make([]ProxyInfo, 0, len(entries)),
 	}
 
 	if !enabled {
@@ -49,7 +109,13 @@ func NewPool(proxyURLs []string, enabled bool) (*Pool, error) {
 	}
 
 	// 按优先级排序: socks5 > socks4 > https > http
-	for _, urlStr := range proxyURLs {
+	for _, entry := range entries {
+		urlStr := entry.URL
+		weight := entry.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+
 		u, err := url.Parse(urlStr)
 		if err != nil {
 			return nil, fmt.Errorf("解析代理 URL 失败 %s: %w", urlStr, err)
@@ -57,22 +123,27 @@ func NewPool(proxyURLs []string, enabled bool) (*Pool, error) {
 
 		var proxyType ProxyType
 		switch strings.ToLower(u.Scheme) {
-		case "socks5":
+		case "socks5", "socks5h":
 			proxyType = ProxyTypeSocks5
-		case "socks4":
+		case "socks4", "socks4a":
 			proxyType = ProxyTypeSocks4
 		case "https":
 			proxyType = ProxyTypeHTTPS
 		case "http":
 			proxyType = ProxyTypeHTTP
 		default:
-			return nil, fmt.Errorf("不支持的代理协议: %s", u.Scheme)
+			return nil, fmt.Errorf("不支持的代理协议: %s（可选: socks5/socks5h/http/https）", u.Scheme)
+		}
+		if err := checkDialable(u, proxyType); err != nil {
+			return nil, err
 		}
 
 		pool.proxies = append(pool.proxies, ProxyInfo{
-			URL:  urlStr,
-			Type: proxyType,
+			URL:    urlStr,
+			Type:   proxyType,
+			Weight: weight,
 		})
+		pool.totalWeight += weight
 	}
 
 	// 按优先级排序
@@ -81,6 +152,18 @@ func NewPool(proxyURLs []string, enabled bool) (*Pool, error) {
 	return pool, nil
 }
 
+// checkDialable 确认代理协议可以实际拨号，避免到下载时才出现难以理解的连接错误
+// SOCKS 代理通过 golang.org/x/net/proxy 拨号，该库只支持 SOCKS5（socks5/socks5h），不支持 SOCKS4
+func checkDialable(u *url.URL, proxyType ProxyType) error {
+	switch proxyType {
+	case ProxyTypeSocks5, ProxyTypeSocks4:
+		if _, err := proxy.FromURL(u, proxy.Direct); err != nil {
+			return fmt.Errorf("代理 %s 无法使用: 不支持 %s 协议（SOCKS 代理只支持 socks5:// 和 socks5h://）: %w", u.Redacted(), u.Scheme, err)
+		}
+	}
+	return nil
+}
+
 // sortProxiesByPriority 按优先级排序代理
 func (p *Pool) sortProxiesByPriority() {
 	// 简单的冒泡排序，按 ProxyType 值排序
@@ -95,63 +178,164 @@ func (p *Pool) sortProxiesByPriority() {
 
 // GetHTTPClient 获取配置了代理的 HTTP 客户端
 // timeout: 超时时间（秒），如果为 0 则使用默认值 30 秒
+// 同一代理 + 超时时间的客户端会被缓存复用，以复用 keep-alive 连接，减少 TLS 握手
 func (p *Pool) GetHTTPClient(timeout int) (*http.Client, error) {
+	client, _, err := p.GetHTTPClientWithProxy(timeout)
+	return client, err
+}
+
+// GetHTTPClientWithProxy 获取配置了代理的 HTTP 客户端，同时返回客户端使用的代理 URL（直连时为空）
+// 请求失败后可将返回的代理 URL 传给 NextProxyFrom 切换代理
+func (p *Pool) GetHTTPClientWithProxy(timeout int) (*http.Client, string, error) {
 	if timeout <= 0 {
 		timeout = 30
 	}
-	timeoutDuration := time.Duration(timeout) * time.Second
 
 	if !p.enabled || len(p.proxies) == 0 {
-		return &http.Client{
-			Timeout: timeoutDuration,
-		}, nil
+		client, err := p.cachedClient(clientKey{timeout: timeout}, func() (*http.Client, error) {
+			return p.newHTTPClient(nil, time.Duration(timeout)*time.Second)
+		})
+		return client, "", err
 	}
 
+	proxyInfo := p.selectProxy()
+	client, err := p.cachedClient(clientKey{proxyURL: proxyInfo.URL, timeout: timeout}, func() (*http.Client, error) {
+		return p.newHTTPClient(&proxyInfo, time.Duration(timeout)*time.Second)
+	})
+	return client, proxyInfo.URL, err
+}
+
+// SetDoHURL 设置 DNS-over-HTTPS 解析地址，为空表示使用系统 DNS
+// 设置后直连和 SOCKS 代理连接会先通过 DoH 解析目标域名，再按 IP 建立连接
+// HTTP/HTTPS 代理通过 CONNECT 传递域名，由代理服务器解析，不受此设置影响
+func (p *Pool) SetDoHURL(dohURL string) error {
+	if dohURL != "" {
+		if _, err := NewDoHResolver(dohURL, nil, nil); err != nil {
+			return err
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.dohURL = dohURL
+	p.clients = nil // 已缓存的客户端需要按新配置重建
+	return nil
+}
+
+// cachedClient 从缓存获取客户端，不存在时调用 build 创建并缓存
+func (p *Pool) cachedClient(key clientKey, build func() (*http.Client, error)) (*http.Client, error) {
 	p.mu.RLock()
-	proxyInfo := p.proxies[p.current%len(p.proxies)]
+	client, ok := p.clients[key]
 	p.mu.RUnlock()
+	if ok {
+		return client, nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// 双重检查，避免并发时重复创建
+	if client, ok := p.clients[key]; ok {
+		return client, nil
+	}
 
-	proxyURL, err := url.Parse(proxyInfo.URL)
+	client, err := build()
 	if err != nil {
 		return nil, err
 	}
+	if p.clients == nil {
+		p.clients = make(map[clientKey]*http.Client)
+	}
+	p.clients[key] = client
+	return client, nil
+}
+
+// newHTTPClient 创建 HTTP 客户端，proxyInfo 为 nil 时直连
+// 调用方需持有 p.mu 写锁
+func (p *Pool) newHTTPClient(proxyInfo *ProxyInfo, timeout time.Duration) (*http.Client, error) {
+	if proxyInfo == nil && p.dohURL == "" {
+		return &http.Client{
+			Timeout: timeout,
+		}, nil
+	}
+
+	baseDial := (&net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}).DialContext
 
 	transport := &http.Transport{
-		DialContext: (&net.Dialer{
-			Timeout:   30 * time.Second,
-			KeepAlive: 30 * time.Second,
-		}).DialContext,
+		DialContext:           baseDial,
 		ForceAttemptHTTP2:     true,
 		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   20, // 批量下载集中在少数主机（如 raw.githubusercontent.com），提高单主机空闲连接数
 		IdleConnTimeout:       90 * time.Second,
 		TLSHandshakeTimeout:   10 * time.Second,
 		ExpectContinueTimeout: 1 * time.Second,
 	}
 
-	switch proxyInfo.Type {
-	case ProxyTypeSocks5, ProxyTypeSocks4:
-		// 使用 SOCKS 代理
-		dialer, err := proxy.FromURL(proxyURL, proxy.Direct)
+	if proxyInfo != nil {
+		proxyURL, err := url.Parse(proxyInfo.URL)
+		if err != nil {
+			return nil, err
+		}
+
+		switch proxyInfo.Type {
+		case ProxyTypeSocks5, ProxyTypeSocks4:
+			// 使用 SOCKS 代理
+			dialer, err := proxy.FromURL(proxyURL, proxy.Direct)
+			if err != nil {
+				return nil, fmt.Errorf("创建 SOCKS 代理失败: %w", err)
+			}
+			transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return dialer.Dial(network, addr)
+			}
+		case ProxyTypeHTTP, ProxyTypeHTTPS:
+			// 使用 HTTP/HTTPS 代理
+			transport.Proxy = http.ProxyURL(proxyURL)
+		}
+	}
+
+	if p.dohURL != "" {
+		// DoH 查询本身走同一条链路（直连或代理），目标连接改为先经 DoH 解析再按 IP 拨号
+		resolver, err := NewDoHResolver(p.dohURL, transport.DialContext, transport.Proxy)
 		if err != nil {
-			return nil, fmt.Errorf("创建 SOCKS 代理失败: %w", err)
+			return nil, err
 		}
-		transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
-			return dialer.Dial(network, addr)
+		if transport.Proxy == nil {
+			transport.DialContext = resolver.DialContext(transport.DialContext)
 		}
-	case ProxyTypeHTTP, ProxyTypeHTTPS:
-		// 使用 HTTP/HTTPS 代理
-		transport.Proxy = http.ProxyURL(proxyURL)
 	}
 
 	return &http.Client{
 		Transport: transport,
-		Timeout:   timeoutDuration,
+		Timeout:   timeout,
 	}, nil
 }
 
-// NextProxy 切换到下一个代理
+// selectProxy 按选择策略选取代理
+func (p *Pool) selectProxy() ProxyInfo {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.strategy == StrategyWeighted && p.totalWeight > 0 {
+		// 累积权重选择：权重 3 的代理被选中的概率是权重 1 的 3 倍
+		pick := rand.Intn(p.totalWeight)
+		for _, info := range p.proxies {
+			pick -= info.Weight
+			if pick < 0 {
+				return info
+			}
+		}
+	}
+
+	return p.proxies[p.current%len(p.proxies)]
+}
+
+// NextProxy 切换到下一个代理（weighted 策略下无效果）
 func (p *Pool) NextProxy() {
-	if !p.enabled || len(p.proxies) == 0 {
+	if !p.enabled || len(p.proxies) == 0 || p.strategy == StrategyWeighted {
 		return
 	}
 
@@ -160,6 +344,20 @@ func (p *Pool) NextProxy() {
 	p.mu.Unlock()
 }
 
+// NextProxyFrom 请求经 failed 代理失败后切换到下一个代理（weighted 策略下无效果）
+// 只有当前代理仍是 failed 时才切换，避免多个并发请求因同一个代理失败而连续跳过可用的代理
+func (p *Pool) NextProxyFrom(failed string) {
+	if !p.enabled || len(p.proxies) == 0 || p.strategy == StrategyWeighted {
+		return
+	}
+
+	p.mu.Lock()
+	if p.proxies[p.current%len(p.proxies)].URL == failed {
+		p.current = (p.current + 1) % len(p.proxies)
+	}
+	p.mu.Unlock()
+}
+
 // GetCurrentProxy 获取当前代理信息
 func (p *Pool) GetCurrentProxy() string {
 	if !p.enabled || len(p.proxies) == 0 {
@@ -169,6 +367,14 @@ func (p *Pool) GetCurrentProxy() string {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
 
+	if p.strategy == StrategyWeighted {
+		parts := make([]string, len(p.proxies))
+		for i, info := range p.proxies {
+			parts[i] = fmt.Sprintf("%s(weight=%d)", info.URL, info.Weight)
+		}
+		return "weighted: " + strings.Join(parts, ", ")
+	}
+
 	return p.proxies[p.current%len(p.proxies)].URL
 }
 
@@ -3,8 +3,12 @@ package rules
 import (
 	"bufio"
 	"fmt"
+	"math/rand"
 	"os"
+	"sort"
 	"strings"
+
+	"rulerefinery/internal/config"
 )
 
 // RuleFileInfo 规则文件信息
@@ -12,16 +16,18 @@ type RuleFileInfo struct {
 	FilePath  string   // 文件路径
 	FileName  string   // 文件名
 	GitHubURL string   // GitHub Raw URL
+	RepoPath  string   // GitHub 规则文件在仓库中的位置（owner/repo/路径），本地文件为空
 	RuleCount int      // 规则总数
-	Examples  []string // 规则示例（前N条）
+	Examples  []string // 规则示例（N 条，按采样方式选取）
 }
 
 // AnalyzeRuleFiles 分析规则文件
-func AnalyzeRuleFiles(filePaths []string, exampleCount int) ([]RuleFileInfo, error) {
+// strategy: 规则示例采样方式（head/random/spread），为空时取文件开头的规则
+func AnalyzeRuleFiles(filePaths []string, exampleCount int, strategy string) ([]RuleFileInfo, error) {
 	var results []RuleFileInfo
 
 	for _, filePath := range filePaths {
-		info, err := analyzeRuleFile(filePath, exampleCount)
+		info, err := analyzeRuleFile(filePath, exampleCount, strategy)
 		if err != nil {
 			// 跳过错误的文件，继续处理其他文件
 			continue
@@ -33,15 +39,16 @@ func AnalyzeRuleFiles(filePaths []string, exampleCount int) ([]RuleFileInfo, err
 }
 
 // analyzeRuleFile 分析单个规则文件
-func analyzeRuleFile(filePath string, exampleCount int) (RuleFileInfo, error) {
+func analyzeRuleFile(filePath string, exampleCount int, strategy string) (RuleFileInfo, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
 		return RuleFileInfo{}, err
 	}
 	defer file.Close()
 
-	var examples []string
+	var lines []string
 	ruleCount := 0
+	keepAll := strategy == config.ExampleStrategyRandom || strategy == config.ExampleStrategySpread
 
 	scanner := bufio.NewScanner(file)
 	for scanner.Scan() {
@@ -54,9 +61,9 @@ func analyzeRuleFile(filePath string, exampleCount int) (RuleFileInfo, error) {
 
 		ruleCount++
 
-		// 收集示例
-		if len(examples) < exampleCount {
-			examples = append(examples, line)
+		// 收集示例候选（head 模式只需保留前 N 条）
+		if keepAll || len(lines) < exampleCount {
+			lines = append(lines, line)
 		}
 	}
 
@@ -68,22 +75,110 @@ func analyzeRuleFile(filePath string, exampleCount int) (RuleFileInfo, error) {
 		FilePath:  filePath,
 		FileName:  extractFileName(filePath),
 		RuleCount: ruleCount,
-		Examples:  examples,
+		Examples:  sampleExamples(lines, exampleCount, strategy),
 	}, nil
 }
 
+// sampleExamples 按采样方式从规则行中选取示例（结果保持文件中的顺序）
+func sampleExamples(lines []string, count int, strategy string) []string {
+	if count <= 0 || len(lines) == 0 {
+		return nil
+	}
+	if len(lines) <= count {
+		return append([]string(nil), lines...)
+	}
+
+	switch strategy {
+	case config.ExampleStrategyRandom:
+		indices := rand.Perm(len(lines))[:count]
+		sort.Ints(indices)
+		examples := make([]string, count)
+		for i, idx := range indices {
+			examples[i] = lines[idx]
+		}
+		return examples
+	case config.ExampleStrategySpread:
+		// 等间距选取：第 i 个示例取第 i*n/count 行，覆盖文件开头到结尾
+		examples := make([]string, count)
+		for i := range examples {
+			examples[i] = lines[i*len(lines)/count]
+		}
+		return examples
+	default:
+		return append([]string(nil), lines[:count]...)
+	}
+}
+
+// limitBatchExamples 限制批次中规则示例的总数（maxTotal <= 0 时不限制），返回的副本不修改原批次
+// 超出时按各文件示例数量的比例缩减，每个文件尽量保留 1 条，保证每个文件都有代表性的上下文；
+// 文件数量多于 maxTotal 时，从规则数量最多的文件开始去掉示例（大文件通常可以从文件名和规则数量判断分类），
+// 保证示例总数不超过 maxTotal。缩减后的示例在原示例中等间距选取，保留采样方式（如 spread）覆盖的范围
+func limitBatchExamples(batch []RuleFileInfo, maxTotal int) []RuleFileInfo {
+	total := 0
+	for _, info := range batch {
+		total += len(info.Examples)
+	}
+	if maxTotal <= 0 || total <= maxTotal {
+		return batch
+	}
+
+	quotas := make([]int, len(batch))
+	sum := 0
+	for i, info := range batch {
+		quotas[i] = min(max(len(info.Examples)*maxTotal/total, 1), len(info.Examples))
+		sum += quotas[i]
+	}
+
+	// 每个文件保留 1 条后仍然超出上限：按规则数量从多到少依次去掉示例
+	if sum > maxTotal {
+		order := make([]int, len(batch))
+		for i := range order {
+			order[i] = i
+		}
+		sort.SliceStable(order, func(a, b int) bool {
+			return batch[order[a]].RuleCount > batch[order[b]].RuleCount
+		})
+		for sum > maxTotal {
+			for _, i := range order {
+				if sum <= maxTotal {
+					break
+				}
+				if quotas[i] > 0 {
+					quotas[i]--
+					sum--
+				}
+			}
+		}
+	}
+
+	limited := make([]RuleFileInfo, len(batch))
+	for i, info := range batch {
+		switch {
+		case quotas[i] == 0:
+			info.Examples = nil
+		case quotas[i] < len(info.Examples):
+			info.Examples = sampleExamples(info.Examples, quotas[i], config.ExampleStrategySpread)
+		}
+		limited[i] = info
+	}
+	return limited
+}
+
 // FormatRuleFilesBatchForAI 格式化规则文件批次用于 AI 分析
-func FormatRuleFilesBatchForAI(batch []RuleFileInfo) string {
+// maxTotalExamples: 整个批次的规则示例总数上限（ai.max_total_examples），0 表示不限制
+func FormatRuleFilesBatchForAI(batch []RuleFileInfo, maxTotalExamples int) string {
 	var builder strings.Builder
 
-	for i, info := range batch {
+	for i, info := range limitBatchExamples(batch, maxTotalExamples) {
 		builder.WriteString(fmt.Sprintf("### 规则文件 %d: %s\n", i+1, extractFileName(info.FilePath)))
 		builder.WriteString(fmt.Sprintf("- 文件路径: %s\n", info.FilePath))
 		if info.GitHubURL != "" {
 			builder.WriteString(fmt.Sprintf("- GitHub URL: %s\n", info.GitHubURL))
 		}
 		builder.WriteString(fmt.Sprintf("- 规则总数: %d 条\n", info.RuleCount))
-		builder.WriteString("- 规则示例:\n")
+		if len(info.Examples) > 0 {
+			builder.WriteString("- 规则示例:\n")
+		}
 
 		for j, example := range info.Examples {
 			builder.WriteString(fmt.Sprintf("  %d. %s\n", j+1, example))
@@ -143,35 +238,98 @@ func loadRulePayloads(filePath string) (map[string]bool, error) {
 	scanner := bufio.NewScanner(file)
 
 	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
+		if payload, ok := rulePayload(scanner.Text()); ok {
+			payloads[payload] = true
+		}
+	}
 
-		// 跳过空行和注释
-		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "//") || strings.HasPrefix(line, ";") {
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return payloads, nil
+}
+
+// rulePayload 提取一行规则的有效载荷（小写），空行和注释返回 false
+// 格式：RULE-TYPE,payload[,options]；不是标准格式时使用整行（domain.list 格式：example.com 或 .example.com）
+func rulePayload(line string) (string, bool) {
+	line = strings.TrimSpace(line)
+
+	// 跳过空行和注释
+	if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "//") || strings.HasPrefix(line, ";") {
+		return "", false
+	}
+
+	parts := strings.Split(line, ",")
+	if len(parts) >= 2 {
+		// 使用第二部分作为 payload（去除前后空格），规范化域名（转小写）
+		return strings.ToLower(strings.TrimSpace(parts[1])), true
+	}
+	return strings.ToLower(line), true
+}
+
+// RulesetPayloads 合并规则集来源的有效载荷（用于与新规则文件比较相似度）
+// 无法读取的文件被跳过
+func RulesetPayloads(filePaths []string, manualRules []string) map[string]bool {
+	payloads := make(map[string]bool)
+	for _, filePath := range filePaths {
+		filePayloads, err := loadRulePayloads(filePath)
+		if err != nil {
 			continue
 		}
-
-		// 提取规则的 payload 部分
-		// 格式：RULE-TYPE,payload[,options]
-		parts := strings.Split(line, ",")
-		if len(parts) >= 2 {
-			// 使用第二部分作为 payload（去除前后空格）
-			payload := strings.TrimSpace(parts[1])
-			// 规范化域名（转小写）
-			payload = strings.ToLower(payload)
+		for payload := range filePayloads {
 			payloads[payload] = true
-		} else {
-			// 如果不是标准格式，使用整行（可能是 domain.list 格式）
-			// domain.list 格式：example.com 或 .example.com
-			payload := strings.ToLower(line)
+		}
+	}
+	for _, rule := range manualRules {
+		if payload, ok := rulePayload(rule); ok {
 			payloads[payload] = true
 		}
 	}
+	return payloads
+}
 
-	if err := scanner.Err(); err != nil {
-		return nil, err
+// SimilarityMatch 规则文件与已有规则集的相似度匹配结果
+type SimilarityMatch struct {
+	File       RuleFileInfo
+	Ruleset    string  // 相似度最高的规则集
+	Similarity float64 // Jaccard 相似度
+}
+
+// MatchRulesetsBySimilarity 将规则文件与已有规则集（合并后的有效载荷）逐一比较 Jaccard 相似度
+// 最高相似度达到 threshold 的文件归入该规则集（相同时按规则集名称），其余文件原样返回
+func MatchRulesetsBySimilarity(ruleFiles []RuleFileInfo, rulesets map[string]map[string]bool, threshold float64) ([]SimilarityMatch, []RuleFileInfo) {
+	names := make([]string, 0, len(rulesets))
+	for name, payloads := range rulesets {
+		if len(payloads) > 0 {
+			names = append(names, name)
+		}
 	}
+	sort.Strings(names)
+
+	var matches []SimilarityMatch
+	var remaining []RuleFileInfo
+	for _, file := range ruleFiles {
+		payloads, err := loadRulePayloads(file.FilePath)
+		if err != nil || len(payloads) == 0 {
+			remaining = append(remaining, file)
+			continue
+		}
 
-	return payloads, nil
+		best := SimilarityMatch{File: file}
+		for _, name := range names {
+			if similarity := calculateJaccardSimilarity(payloads, rulesets[name]); similarity > best.Similarity {
+				best.Ruleset = name
+				best.Similarity = similarity
+			}
+		}
+		if best.Ruleset != "" && best.Similarity >= threshold {
+			matches = append(matches, best)
+		} else {
+			remaining = append(remaining, file)
+		}
+	}
+	return matches, remaining
 }
 
 // calculateJaccardSimilarity 计算 Jaccard 相似度
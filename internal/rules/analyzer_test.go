@@ -0,0 +1,63 @@
+package rules
+
+import (
+	"fmt"
+	"testing"
+)
+
+// testExamples 生成 n 条示例规则
+func testExamples(n int) []string {
+	examples := make([]string, n)
+	for i := range examples {
+		examples[i] = fmt.Sprintf("DOMAIN,host%d.example.com", i)
+	}
+	return examples
+}
+
+func countExamples(batch []RuleFileInfo) int {
+	total := 0
+	for _, info := range batch {
+		total += len(info.Examples)
+	}
+	return total
+}
+
+func TestLimitBatchExamplesProportional(t *testing.T) {
+	batch := []RuleFileInfo{
+		{FilePath: "a.list", RuleCount: 100, Examples: testExamples(5)},
+		{FilePath: "b.list", RuleCount: 10, Examples: testExamples(5)},
+		{FilePath: "c.list", RuleCount: 1, Examples: testExamples(1)},
+	}
+	limited := limitBatchExamples(batch, 6)
+	if got := countExamples(limited); got > 6 {
+		t.Errorf("total examples = %d, want <= 6", got)
+	}
+	for _, info := range limited {
+		if len(info.Examples) == 0 {
+			t.Errorf("file %s has no examples, want at least 1", info.FilePath)
+		}
+	}
+	if len(batch[0].Examples) != 5 {
+		t.Errorf("original batch modified: %d examples, want 5", len(batch[0].Examples))
+	}
+}
+
+func TestLimitBatchExamplesMoreFilesThanCap(t *testing.T) {
+	batch := []RuleFileInfo{
+		{FilePath: "small.list", RuleCount: 3, Examples: testExamples(3)},
+		{FilePath: "huge.list", RuleCount: 5000, Examples: testExamples(5)},
+		{FilePath: "medium.list", RuleCount: 50, Examples: testExamples(5)},
+		{FilePath: "large.list", RuleCount: 800, Examples: testExamples(5)},
+	}
+	limited := limitBatchExamples(batch, 2)
+	if got := countExamples(limited); got != 2 {
+		t.Fatalf("total examples = %d, want 2", got)
+	}
+	// 规则数量最多的文件先去掉示例
+	for _, info := range limited {
+		wantExamples := info.FilePath == "small.list" || info.FilePath == "medium.list"
+		if (len(info.Examples) > 0) != wantExamples {
+			t.Errorf("file %s has %d examples, want examples only for the smallest files", info.FilePath, len(info.Examples))
+		}
+	}
+}
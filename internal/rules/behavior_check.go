@@ -0,0 +1,221 @@
+package rules
+
+import (
+	"bufio"
+	"fmt"
+	"net/netip"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// behaviorCheckMaxReported 导出校验失败时错误信息中最多列出的违规行数
+const behaviorCheckMaxReported = 5
+
+// BehaviorViolation 导出文件中不符合 behavior 约束的一行
+type BehaviorViolation struct {
+	File    string // 导出文件路径
+	Line    int    // 行号（从 1 开始）
+	Content string // 行内容（YAML 为 payload 条目）
+	Problem string // 问题说明
+}
+
+// String 返回违规说明，如 "out/google/google_domain.list:3: DOMAIN,x.com（包含逗号，不是纯域名）"
+func (v BehaviorViolation) String() string {
+	return fmt.Sprintf("%s:%d: %s（%s）", v.File, v.Line, v.Content, v.Problem)
+}
+
+// exportBehavior 返回导出类型对应的 Mihomo behavior
+func exportBehavior(kind string) string {
+	switch kind {
+	case ExportKindDomain:
+		return "domain"
+	case ExportKindIPCIDR:
+		return "ipcidr"
+	default:
+		return "classical"
+	}
+}
+
+// ValidateBehaviorFile 重新读取导出的规则文件，检查每一条规则是否符合 behavior 的约束
+// asYAML 为 true 时按 YAML 解析 payload 列表，否则按行读取（跳过空行和 # 注释）
+// 用于在导出后兜底发现分类（如把非域名规则放进 domain 文件）或转义上的错误
+func ValidateBehaviorFile(path string, behavior string, asYAML bool) ([]BehaviorViolation, error) {
+	var entries []behaviorEntry
+	var err error
+	if asYAML {
+		entries, err = readYAMLPayload(path)
+	} else {
+		entries, err = readListPayload(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var violations []BehaviorViolation
+	for _, entry := range entries {
+		if problem := checkBehaviorEntry(behavior, entry.content); problem != "" {
+			violations = append(violations, BehaviorViolation{File: path, Line: entry.line, Content: entry.content, Problem: problem})
+		}
+	}
+	return violations, nil
+}
+
+// behaviorEntry 导出文件中的一条规则及其行号
+type behaviorEntry struct {
+	line    int
+	content string
+}
+
+// readListPayload 读取纯文本规则文件中的规则行
+func readListPayload(path string) ([]behaviorEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []behaviorEntry
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entries = append(entries, behaviorEntry{line: lineNum, content: line})
+	}
+	return entries, scanner.Err()
+}
+
+// readYAMLPayload 解析 YAML 规则文件的 payload 列表（YAML 本身无法解析也视为错误）
+func readYAMLPayload(path string) ([]behaviorEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("解析 %s 失败: %w", path, err)
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s 不是有效的规则集文件: 缺少 payload", path)
+	}
+
+	root := doc.Content[0]
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value != "payload" {
+			continue
+		}
+		payload := root.Content[i+1]
+		// 空规则集只有注释，payload 为 null
+		if payload.Kind == yaml.ScalarNode && payload.Tag == "!!null" {
+			return nil, nil
+		}
+		if payload.Kind != yaml.SequenceNode {
+			return nil, fmt.Errorf("%s 第 %d 行: payload 不是列表", path, payload.Line)
+		}
+		entries := make([]behaviorEntry, 0, len(payload.Content))
+		for _, item := range payload.Content {
+			entries = append(entries, behaviorEntry{line: item.Line, content: item.Value})
+		}
+		return entries, nil
+	}
+	return nil, fmt.Errorf("%s 不是有效的规则集文件: 缺少 payload", path)
+}
+
+// checkBehaviorEntry 检查单条规则是否符合 behavior 的约束，返回问题说明（符合时为空）
+func checkBehaviorEntry(behavior string, entry string) string {
+	if entry == "" || strings.TrimSpace(entry) != entry || strings.ContainsAny(entry, " \t") {
+		return "为空或包含空白字符"
+	}
+
+	switch behavior {
+	case "domain":
+		return checkDomainEntry(entry)
+	case "ipcidr":
+		if _, err := netip.ParsePrefix(entry); err != nil {
+			return "不是 CIDR"
+		}
+		return ""
+	default:
+		return checkClassicalEntry(entry)
+	}
+}
+
+// checkDomainEntry 检查 domain behavior 的条目：纯域名，可带 +. 或 . 前缀，* 只能作为完整的标签
+func checkDomainEntry(entry string) string {
+	if strings.Contains(entry, ",") {
+		return "包含逗号，不是纯域名"
+	}
+	domain := strings.TrimPrefix(entry, "+.")
+	if domain == entry {
+		domain = strings.TrimPrefix(entry, ".")
+	}
+	if _, err := netip.ParseAddr(domain); err == nil {
+		return "是 IP 地址，不是域名"
+	}
+	if _, err := netip.ParsePrefix(domain); err == nil {
+		return "是 CIDR，不是域名"
+	}
+	for _, label := range strings.Split(domain, ".") {
+		if label == "" {
+			return "包含空的域名标签"
+		}
+		if label != "*" && strings.Contains(label, "*") {
+			return "通配符 * 只能作为完整的域名标签"
+		}
+	}
+	return ""
+}
+
+// checkClassicalEntry 检查 classical behavior 的条目：TYPE,payload[,options]，类型必须是客户端可识别的规则类型
+func checkClassicalEntry(entry string) string {
+	ruleType, rest, ok := strings.Cut(entry, ",")
+	if !ok {
+		return "缺少规则类型"
+	}
+	switch RuleType(ruleType) {
+	case RuleTypeMatch, RuleTypeFinal:
+		return "规则集中不能包含 " + ruleType
+	}
+	if !knownRuleTypes[RuleType(ruleType)] {
+		return "未知的规则类型 " + ruleType
+	}
+	if payload, _, _ := strings.Cut(rest, ","); payload == "" {
+		return "缺少规则内容"
+	}
+	return ""
+}
+
+// validateExportedFiles 导出后重新解析 yaml 和 list 文件，存在不符合 behavior 约束的规则时返回错误
+// Mihomo 加载 rule-provider 时遇到非法条目会直接失败，因此这里宁可让本次运行失败
+func validateExportedFiles(kind string, yamlPath string, listPath string) error {
+	behavior := exportBehavior(kind)
+	var violations []BehaviorViolation
+	for _, file := range []struct {
+		path   string
+		asYAML bool
+	}{{yamlPath, true}, {listPath, false}} {
+		found, err := ValidateBehaviorFile(file.path, behavior, file.asYAML)
+		if err != nil {
+			return fmt.Errorf("校验导出文件失败: %w", err)
+		}
+		violations = append(violations, found...)
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+
+	details := make([]string, 0, behaviorCheckMaxReported)
+	for i, v := range violations {
+		if i == behaviorCheckMaxReported {
+			details = append(details, fmt.Sprintf("... 以及其他 %d 处", len(violations)-i))
+			break
+		}
+		details = append(details, v.String())
+	}
+	return fmt.Errorf("导出文件不符合 behavior: %s 的约束（%d 处）:\n%s", behavior, len(violations), strings.Join(details, "\n"))
+}
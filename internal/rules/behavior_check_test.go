@@ -0,0 +1,49 @@
+package rules
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateExportedFilesRejectsWrongBehavior(t *testing.T) {
+	dir := t.TempDir()
+	yamlPath := filepath.Join(dir, "test_domain.yaml")
+	listPath := filepath.Join(dir, "test_domain.list")
+	if err := os.WriteFile(yamlPath, []byte("payload:\n  - '+.google.com'\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// domain 文件中混入 classical 规则和 CIDR
+	if err := os.WriteFile(listPath, []byte("+.google.com\nDOMAIN,youtube.com\n1.1.1.0/24\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err := validateExportedFiles(ExportKindDomain, yamlPath, listPath)
+	if err == nil {
+		t.Fatal("validateExportedFiles() = nil, want error for wrong-behavior payload")
+	}
+	for _, want := range []string{listPath + ":2: DOMAIN,youtube.com", listPath + ":3: 1.1.1.0/24"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+	if strings.Contains(err.Error(), yamlPath) {
+		t.Errorf("error %q should not report the valid YAML file", err)
+	}
+}
+
+func TestValidateExportedFilesAcceptsValidFiles(t *testing.T) {
+	dir := t.TempDir()
+	yamlPath := filepath.Join(dir, "test_ipcidr.yaml")
+	listPath := filepath.Join(dir, "test_ipcidr.list")
+	if err := os.WriteFile(yamlPath, []byte("payload:\n  - '1.1.1.0/24'\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(listPath, []byte("# comment\n1.1.1.0/24\n2001:db8::/32\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := validateExportedFiles(ExportKindIPCIDR, yamlPath, listPath); err != nil {
+		t.Errorf("validateExportedFiles() = %v, want nil", err)
+	}
+}
@@ -0,0 +1,101 @@
+package rules
+
+import (
+	"net/netip"
+	"sort"
+	"strings"
+)
+
+// SetMergeCIDRs 设置去重时是否合并 IP 网段：移除已被更大网段包含的网段，并将相邻的两个同级网段合并为上级网段
+// 如 192.168.0.0/24 与 192.168.1.0/24 合并为 192.168.0.0/23
+// 默认开启，SetMergeCIDRs(false) 保持与上游完全一致的网段写法；合并只发生在参数相同的规则之间，
+// 因此合并结果带 no-resolve 当且仅当被合并的每条规则都带 no-resolve
+func (o *Optimizer) SetMergeCIDRs(enabled bool) {
+	o.mergeCIDRs = enabled
+}
+
+// isMergeableCIDRType 判断规则类型是否按网段前缀匹配（可以合并）
+// IP-SUFFIX 匹配地址后缀，不能合并
+func isMergeableCIDRType(ruleType RuleType) bool {
+	switch ruleType {
+	case RuleTypeIPCIDR, RuleTypeIPCIDR6, RuleTypeSrcIPCIDR, RuleTypeSrcIPCIDR6:
+		return true
+	}
+	return false
+}
+
+// mergeCIDRs 合并网段规则，返回合并后的规则（未排序）和减少的规则数量
+// 参数（如 no-resolve）不同的规则分别合并，互不覆盖（带与不带 no-resolve 的网段既不合并，也不互相移除）；
+// 无法解析的规则原样保留。
+//
+// 网段按 (起始地址, 掩码长度) 排序后，包含关系只可能发生在相邻的保留网段之间：
+// 网段要么互相嵌套、要么不相交，排在后面的网段如果被某个已保留的网段包含，一定被最后一个保留的网段包含。
+// 同级合并使用栈自底向上进行：栈顶两个网段是同一上级网段的两半时替换为上级网段，并继续尝试与新的栈顶合并。
+// 排序 O(n log n)，包含检测和合并均为线性
+func mergeCIDRs(rules []string) ([]string, int) {
+	groups := make(map[string][]netip.Prefix) // 参数 -> 网段
+	var options []string
+	merged := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		payload, opts, _ := strings.Cut(rule, ",")
+		prefix, err := netip.ParsePrefix(strings.TrimSpace(payload))
+		if err != nil {
+			merged = append(merged, rule)
+			continue
+		}
+		if _, exists := groups[opts]; !exists {
+			options = append(options, opts)
+		}
+		groups[opts] = append(groups[opts], prefix.Masked())
+	}
+
+	for _, opts := range options {
+		for _, prefix := range mergePrefixes(groups[opts]) {
+			rule := prefix.String()
+			if opts != "" {
+				rule += "," + opts
+			}
+			merged = append(merged, rule)
+		}
+	}
+	return merged, len(rules) - len(merged)
+}
+
+// mergePrefixes 移除被包含的网段并合并同级网段，返回按地址排序的结果（会修改输入切片的顺序）
+func mergePrefixes(prefixes []netip.Prefix) []netip.Prefix {
+	sort.Slice(prefixes, func(i, j int) bool {
+		if c := prefixes[i].Addr().Compare(prefixes[j].Addr()); c != 0 {
+			return c < 0
+		}
+		return prefixes[i].Bits() < prefixes[j].Bits()
+	})
+
+	stack := make([]netip.Prefix, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		if n := len(stack); n > 0 && stack[n-1].Bits() <= prefix.Bits() && stack[n-1].Contains(prefix.Addr()) {
+			continue
+		}
+		stack = append(stack, prefix)
+		for len(stack) >= 2 {
+			n := len(stack)
+			parent, ok := siblingParent(stack[n-2], stack[n-1])
+			if !ok {
+				break
+			}
+			stack = append(stack[:n-2], parent)
+		}
+	}
+	return stack
+}
+
+// siblingParent 判断两个网段是否为同一上级网段的前后两半，是则返回上级网段
+func siblingParent(a, b netip.Prefix) (netip.Prefix, bool) {
+	if a.Bits() != b.Bits() || a.Bits() == 0 || a.Addr().Is4() != b.Addr().Is4() {
+		return netip.Prefix{}, false
+	}
+	parent, err := a.Addr().Prefix(a.Bits() - 1)
+	if err != nil || parent.Addr() != a.Addr() || !parent.Contains(b.Addr()) {
+		return netip.Prefix{}, false
+	}
+	return parent, true
+}
@@ -0,0 +1,195 @@
+package rules
+
+import (
+	"fmt"
+	"net/netip"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestMergeCIDRs(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   []string
+		want    []string
+		removed int
+	}{
+		{"siblings", []string{"192.168.0.0/24", "192.168.1.0/24"}, []string{"192.168.0.0/23"}, 1},
+		{"cascade", []string{"10.0.0.0/26", "10.0.0.64/26", "10.0.0.128/25"}, []string{"10.0.0.0/24"}, 2},
+		{"contained", []string{"10.0.0.0/8", "10.1.0.0/16", "10.1.2.3/32"}, []string{"10.0.0.0/8"}, 2},
+		{"not siblings", []string{"192.168.1.0/24", "192.168.2.0/24"}, []string{"192.168.1.0/24", "192.168.2.0/24"}, 0},
+		{"options kept apart", []string{"1.0.0.0/25,no-resolve", "1.0.0.128/25", "1.0.0.0/24"}, []string{"1.0.0.0/25,no-resolve", "1.0.0.0/24"}, 1},
+		{"mixed no-resolve pair", []string{"1.0.0.0/25,no-resolve", "1.0.0.128/25"}, []string{"1.0.0.0/25,no-resolve", "1.0.0.128/25"}, 0},
+		{"all no-resolve", []string{"1.0.0.0/25,no-resolve", "1.0.0.128/25,no-resolve"}, []string{"1.0.0.0/24,no-resolve"}, 1},
+		{"ipv6", []string{"2001:db8::/33", "2001:db8:8000::/33"}, []string{"2001:db8::/32"}, 1},
+		{"unparsable kept", []string{"not-a-cidr", "1.1.1.1/32"}, []string{"not-a-cidr", "1.1.1.1/32"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, removed := mergeCIDRs(tt.rules)
+			if !reflect.DeepEqual(got, tt.want) || removed != tt.removed {
+				t.Errorf("mergeCIDRs(%v) = %v, %d, want %v, %d", tt.rules, got, removed, tt.want, tt.removed)
+			}
+		})
+	}
+}
+
+func TestDeduplicateMergesCIDRsByDefault(t *testing.T) {
+	input := strings.Join([]string{
+		"IP-CIDR,1.0.0.0/25,no-resolve",
+		"IP-CIDR,1.0.0.128/25",
+		"IP-CIDR,2.0.0.0/25,no-resolve",
+		"IP-CIDR,2.0.0.128/25,no-resolve",
+		"IP-CIDR,3.0.0.0/25",
+		"IP-CIDR,3.0.0.128/25",
+	}, "\n")
+	tests := []struct {
+		name     string
+		disabled bool
+		want     []string
+	}{
+		{
+			name: "default",
+			// 只有全部带 no-resolve 的 2.0.0.0/24 保留 no-resolve；1.0.0.0 两半参数不同，既不合并也不互相移除
+			want: []string{"1.0.0.0/25,no-resolve", "1.0.0.128/25", "2.0.0.0/24,no-resolve", "3.0.0.0/24"},
+		},
+		{
+			name:     "disabled",
+			disabled: true,
+			want: []string{
+				"1.0.0.0/25,no-resolve", "1.0.0.128/25", "2.0.0.0/25,no-resolve",
+				"2.0.0.128/25,no-resolve", "3.0.0.0/25", "3.0.0.128/25",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := NewOptimizer()
+			if tt.disabled {
+				o.SetMergeCIDRs(false)
+			}
+			if err := o.LoadRules(strings.NewReader(input), "test", "memory"); err != nil {
+				t.Fatal(err)
+			}
+			o.Deduplicate()
+			got := append([]string(nil), o.ruleSets["test"].Rules[RuleTypeIPCIDR]...)
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("IP-CIDR rules = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// naiveMergeCIDRs 两两比较的参考实现（O(n²)，反复扫描直到没有可以移除或合并的网段），用于校验和对比 mergeCIDRs
+// 只处理可解析的网段，结果按参数分组、组内按 (地址, 掩码长度) 排序，与 mergeCIDRs 的输出顺序一致
+func naiveMergeCIDRs(rules []string) []string {
+	groups := make(map[string][]netip.Prefix)
+	var options []string
+	for _, rule := range rules {
+		payload, opts, _ := strings.Cut(rule, ",")
+		prefix, err := netip.ParsePrefix(payload)
+		if err != nil {
+			continue
+		}
+		if _, exists := groups[opts]; !exists {
+			options = append(options, opts)
+		}
+		groups[opts] = append(groups[opts], prefix.Masked())
+	}
+
+	var merged []string
+	for _, opts := range options {
+		prefixes := groups[opts]
+		for changed := true; changed; {
+			changed = false
+			for i := 0; i < len(prefixes) && !changed; i++ {
+				for j := 0; j < len(prefixes) && !changed; j++ {
+					if i == j {
+						continue
+					}
+					a, b := prefixes[i], prefixes[j]
+					if a.Bits() <= b.Bits() && a.Contains(b.Addr()) {
+						prefixes = append(prefixes[:j], prefixes[j+1:]...)
+						changed = true
+					} else if parent, ok := siblingParent(a, b); ok {
+						prefixes[i] = parent
+						prefixes = append(prefixes[:j], prefixes[j+1:]...)
+						changed = true
+					}
+				}
+			}
+		}
+		sort.Slice(prefixes, func(i, j int) bool {
+			if c := prefixes[i].Addr().Compare(prefixes[j].Addr()); c != 0 {
+				return c < 0
+			}
+			return prefixes[i].Bits() < prefixes[j].Bits()
+		})
+		for _, prefix := range prefixes {
+			rule := prefix.String()
+			if opts != "" {
+				rule += "," + opts
+			}
+			merged = append(merged, rule)
+		}
+	}
+	return merged
+}
+
+// benchmarkCIDRRules 生成 n 条 /24 网段：相邻的同级网段可以逐级合并，每 1000 条另有一个带 no-resolve 的 /16
+func benchmarkCIDRRules(n int) []string {
+	rules := make([]string, 0, n)
+	for i := 0; len(rules) < n; i++ {
+		rules = append(rules, fmt.Sprintf("%d.%d.%d.0/24", 1+i/65536%223, i/256%256, i%256))
+		if i%1000 == 0 && len(rules) < n {
+			rules = append(rules, fmt.Sprintf("%d.%d.0.0/16,no-resolve", 1+i/65536%223, i/256%256))
+		}
+	}
+	return rules
+}
+
+// naiveBenchmarkSize 两种实现对比时的规则数量（参考实现为 O(n²)，更大的输入耗时过长）
+const naiveBenchmarkSize = 2000
+
+func TestMergeCIDRsMatchesNaive(t *testing.T) {
+	inputs := map[string][]string{
+		"generated": benchmarkCIDRRules(naiveBenchmarkSize),
+		"mixed": {
+			"10.0.0.0/25", "10.0.0.128/25", "10.0.1.0/24", "10.0.2.0/24,no-resolve", "10.0.3.0/24,no-resolve",
+			"10.0.0.0/8,no-resolve", "192.168.1.1/32", "192.168.1.0/31", "2001:db8::/33", "2001:db8:8000::/33",
+			"2001:db8::/48", "172.16.0.0/13", "172.24.0.0/13", "172.16.5.0/24",
+		},
+	}
+	for name, rules := range inputs {
+		got, _ := mergeCIDRs(append([]string(nil), rules...))
+		want := naiveMergeCIDRs(rules)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: mergeCIDRs() = %v\nnaive = %v", name, got, want)
+		}
+	}
+}
+
+func BenchmarkMergeCIDRs(b *testing.B) {
+	quietLogs(b)
+	for _, n := range []int{naiveBenchmarkSize, 200000} {
+		rules := benchmarkCIDRRules(n)
+		b.Run(fmt.Sprintf("n=%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				mergeCIDRs(rules)
+			}
+		})
+	}
+}
+
+func BenchmarkMergeCIDRsNaive(b *testing.B) {
+	quietLogs(b)
+	rules := benchmarkCIDRRules(naiveBenchmarkSize)
+	b.Run(fmt.Sprintf("n=%d", naiveBenchmarkSize), func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			naiveMergeCIDRs(rules)
+		}
+	})
+}
@@ -0,0 +1,131 @@
+package rules
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// cidrFamilies IP 网段规则类型要求的地址族（true 为 IPv6）
+var cidrFamilies = map[RuleType]bool{
+	RuleTypeIPCIDR:     false,
+	RuleTypeIPCIDR6:    true,
+	RuleTypeSrcIPCIDR:  false,
+	RuleTypeSrcIPCIDR6: true,
+}
+
+// InvalidRule 加载时丢弃的无效规则（如掩码超出范围的网段），不会出现在任何导出文件中
+type InvalidRule struct {
+	Ruleset string // 规则集名称
+	Source  string // 规则来源（文件路径或 URL）
+	Line    int    // 行号（从 1 开始）
+	Rule    string // 原始规则
+	Problem string // 问题说明
+}
+
+// String 格式化问题说明
+func (r InvalidRule) String() string {
+	return fmt.Sprintf("%s:%d [%s] %s: %s", r.Source, r.Line, r.Ruleset, r.Rule, r.Problem)
+}
+
+// validateCIDR 检查 IP 网段规则的 payload（不含参数）能否被 Mihomo 解析，返回问题说明，合法时为空
+// 没有掩码的地址视为单个地址（去重时补全 /32 或 /128）；地址族必须与类型一致（IP-CIDR 只能是 IPv4，IP-CIDR6 只能是 IPv6）
+func validateCIDR(ruleType RuleType, payload string) string {
+	wantIPv6, ok := cidrFamilies[ruleType]
+	if !ok {
+		return ""
+	}
+
+	var addr netip.Addr
+	if strings.Contains(payload, "/") {
+		prefix, err := netip.ParsePrefix(payload)
+		if err != nil {
+			return "无效的网段"
+		}
+		addr = prefix.Addr()
+	} else {
+		parsed, err := netip.ParseAddr(payload)
+		if err != nil {
+			return "无效的 IP 地址"
+		}
+		addr = parsed
+	}
+
+	switch {
+	case wantIPv6 && addr.Is4():
+		return fmt.Sprintf("%s 中是 IPv4 网段（应使用 %s）", ruleType, strings.TrimSuffix(string(ruleType), "6"))
+	case !wantIPv6 && addr.Is6():
+		return fmt.Sprintf("%s 中是 IPv6 网段（应使用 %s6）", ruleType, ruleType)
+	}
+	return ""
+}
+
+// InvalidRules 返回加载时丢弃的无效规则
+func (o *Optimizer) InvalidRules() []InvalidRule {
+	return o.invalidRules
+}
+
+// SetInvalidReport 设置导出时是否为包含无效规则的规则集生成报告 {name}_invalid.txt
+func (o *Optimizer) SetInvalidReport(enabled bool) {
+	o.invalidReport = enabled
+}
+
+// LogInvalidRules 输出无效规则汇总
+func LogInvalidRules(invalid []InvalidRule) {
+	if len(invalid) == 0 {
+		return
+	}
+	log.Warn().Msgf("加载时丢弃 %d 条无效规则（Mihomo 无法加载，已从输出中排除）:", len(invalid))
+	for _, rule := range invalid {
+		log.Warn().Msgf("  %s", rule)
+	}
+}
+
+// writeInvalidReport 将规则集加载时丢弃的无效规则写入 {name}_invalid.txt（每行 "来源:行号 规则 # 问题"）
+// 本次没有无效规则时删除上次生成的报告
+func (o *Optimizer) writeInvalidReport(ruleSet *RuleSet, outputDir string) error {
+	var invalid []InvalidRule
+	for _, rule := range o.invalidRules {
+		if rule.Ruleset == ruleSet.Name {
+			invalid = append(invalid, rule)
+		}
+	}
+
+	if len(invalid) == 0 {
+		stale := filepath.Join(outputDir, filepath.FromSlash(ExportRelPath(o.layout, ruleSet.Name, exportGroupInvalid, ".txt")))
+		if err := os.Remove(stale); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+
+	path, err := o.exportPath(outputDir, ruleSet.Name, exportGroupInvalid, ".txt")
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	bw := bufio.NewWriter(f)
+	fmt.Fprintf(bw, "# NAME: %s\n", ruleSet.Name)
+	fmt.Fprintf(bw, "# TOTAL: %d\n", len(invalid))
+	fmt.Fprintf(bw, "# 由 RuleRefinery 生成，加载时丢弃的无效规则（不会出现在导出文件中）\n")
+	for _, rule := range invalid {
+		fmt.Fprintf(bw, "%s:%d %s # %s\n", rule.Source, rule.Line, rule.Rule, rule.Problem)
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	log.Info().Msgf("生成文件: %s (%d 条无效规则)", path, len(invalid))
+	return nil
+}
@@ -2,6 +2,7 @@ package rules
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -26,6 +27,9 @@ type RuleCategory struct {
 	Confidence  float64  `yaml:"-"`           // AI 分类置信度（内部使用）
 }
 
+// ErrParseResponse AI 响应无法解析为分类结果（如响应被截断、YAML 格式错误）
+var ErrParseResponse = errors.New("解析 AI 响应失败")
+
 // RuleClassificationResult AI 分类结果
 type RuleClassificationResult struct {
 	Categories map[string]RuleCategory
@@ -33,8 +37,10 @@ type RuleClassificationResult struct {
 }
 
 // ClassifyRulesWithAI 使用 AI 对规则文件进行分类
+// chatOpts: 分类请求参数（如 classification_temperature）
+// maxTotalExamples: 提示词中规则示例的总数上限（ai.max_total_examples），0 表示不限制
 // promptFile: 可选的提示词文件路径，如果指定则将提示词保存到文件
-func ClassifyRulesWithAI(ctx context.Context, ruleFiles []RuleFileInfo, aiClient ai.Client, existingRules *config.RuleSetsConfig, promptTemplate string, promptFile ...string) (*RuleClassificationResult, error) {
+func ClassifyRulesWithAI(ctx context.Context, ruleFiles []RuleFileInfo, aiClient ai.Client, existingRules *config.RuleSetsConfig, promptTemplate string, chatOpts ai.ChatOptions, maxTotalExamples int, promptFile ...string) (*RuleClassificationResult, error) {
 	if len(ruleFiles) == 0 {
 		return &RuleClassificationResult{
 			Categories: make(map[string]RuleCategory),
@@ -53,7 +59,7 @@ func ClassifyRulesWithAI(ctx context.Context, ruleFiles []RuleFileInfo, aiClient
 	log.Info().Msgf("需要 AI 分类的规则文件: %d 个", len(unclassifiedRules))
 
 	// 构建 AI 提示词
-	prompt := buildClassificationPrompt(unclassifiedRules, promptTemplate)
+	prompt := buildClassificationPrompt(unclassifiedRules, promptTemplate, maxTotalExamples)
 
 	// 如果指定了提示词文件路径，则保存到文件
 	if len(promptFile) > 0 && promptFile[0] != "" {
@@ -66,7 +72,7 @@ func ClassifyRulesWithAI(ctx context.Context, ruleFiles []RuleFileInfo, aiClient
 
 	// 调用 AI 进行分类
 	log.Info().Msg("正在使用 AI 分析规则内容...")
-	response, err := aiClient.Chat(ctx, prompt)
+	response, err := aiClient.ChatWithOptions(ctx, prompt, chatOpts)
 	if err != nil {
 		return nil, fmt.Errorf("AI 分类失败: %w", err)
 	}
@@ -98,7 +104,7 @@ func ClassifyRulesWithAI(ctx context.Context, ruleFiles []RuleFileInfo, aiClient
 	// 解析 AI 响应
 	result, err := parseClassificationResponse(response, unclassifiedRules)
 	if err != nil {
-		return nil, fmt.Errorf("解析 AI 响应失败: %w", err)
+		return nil, fmt.Errorf("%w: %w", ErrParseResponse, err)
 	}
 
 	// 合并现有分类
@@ -120,14 +126,14 @@ func filterUnclassifiedRules(ruleFiles []RuleFileInfo, existingRules *config.Rul
 	classifiedURLs := make(map[string]bool)
 	for _, ruleset := range existingRules.ClassifiedRules {
 		for _, url := range ruleset.URLs {
-			classifiedURLs[url] = true
+			classifiedURLs[utils.CanonicalGitHubURL(url)] = true
 		}
 	}
 
 	// 过滤
 	var unclassified []RuleFileInfo
 	for _, rule := range ruleFiles {
-		if !classifiedURLs[rule.GitHubURL] {
+		if !classifiedURLs[utils.CanonicalGitHubURL(rule.GitHubURL)] {
 			unclassified = append(unclassified, rule)
 		}
 	}
@@ -136,11 +142,12 @@ func filterUnclassifiedRules(ruleFiles []RuleFileInfo, existingRules *config.Rul
 }
 
 // buildClassificationPrompt 构建 AI 分类提示词
-func buildClassificationPrompt(ruleFiles []RuleFileInfo, promptTemplate string) string {
+// 规则示例总数超过 maxTotalExamples（大于 0 时）时按比例减少每个文件的示例
+func buildClassificationPrompt(ruleFiles []RuleFileInfo, promptTemplate string, maxTotalExamples int) string {
 	// 构建规则文件信息
 	var ruleFilesContent strings.Builder
 
-	for i, rule := range ruleFiles {
+	for i, rule := range limitBatchExamples(ruleFiles, maxTotalExamples) {
 		ruleFilesContent.WriteString(fmt.Sprintf("### 规则文件 %d\n", i+1))
 		ruleFilesContent.WriteString(fmt.Sprintf("- 文件名: %s\n", rule.FileName))
 
@@ -150,9 +157,16 @@ func buildClassificationPrompt(ruleFiles []RuleFileInfo, promptTemplate string)
 			urlOrPath = rule.FilePath
 		}
 		ruleFilesContent.WriteString(fmt.Sprintf("- URL: %s\n", urlOrPath))
+		if rule.RepoPath != "" {
+			// 仓库中的目录结构通常直接体现分类（如 Clash/Ruleset/Google/Google.list）
+			ruleFilesContent.WriteString(fmt.Sprintf("- 仓库路径: %s\n", rule.RepoPath))
+		}
 
 		ruleFilesContent.WriteString(fmt.Sprintf("- 规则数量: %d\n", rule.RuleCount))
-		ruleFilesContent.WriteString(fmt.Sprintf("- 规则示例:\n```\n%s\n```\n\n", strings.Join(rule.Examples, "\n")))
+		if len(rule.Examples) > 0 {
+			ruleFilesContent.WriteString(fmt.Sprintf("- 规则示例:\n```\n%s\n```\n", strings.Join(rule.Examples, "\n")))
+		}
+		ruleFilesContent.WriteString("\n")
 	}
 
 	// 使用模板替换占位符
@@ -193,24 +207,46 @@ func parseClassificationResponse(response string, ruleFiles []RuleFileInfo) (*Ru
 		urlToFile[file.GitHubURL] = file
 	}
 
+	// 本批次输入的规则文件，AI 返回的其他 URL/文件视为凭空编造，直接丢弃
+	batchSources := batchSourceSet(ruleFiles)
+
 	// 转换分类结果
 	classifiedURLs := make(map[string]bool)
 	classifiedFiles := make(map[string]bool)
-	for name, ruleset := range parsed.ClassifiedRules {
+	for rawName, ruleset := range parsed.ClassifiedRules {
+		// 分类名称统一小写，与 classified_rules_file 的键保持一致
+		name := config.NormalizeRulesetName(rawName)
+		urls := dropStraySources(name, ruleset.URLs, batchSources)
+		files := dropStraySources(name, ruleset.Files, batchSources)
+		if len(urls) == 0 && len(files) == 0 {
+			if len(ruleset.URLs) > 0 || len(ruleset.Files) > 0 {
+				log.Warn().Msgf("AI 响应中的分类 '%s' 只引用了不属于本批次的文件，已忽略该分类", rawName)
+			}
+			continue
+		}
 		category := RuleCategory{
 			Name:        name,
 			Description: ruleset.Description,
-			URLs:        ruleset.URLs,
-			Files:       ruleset.Files,
+			URLs:        urls,
+			Files:       files,
+		}
+		if existing, ok := result.Categories[name]; ok {
+			log.Warn().Msgf("AI 响应中存在仅大小写不同的重复分类: '%s' 合并到 '%s'", rawName, name)
+			category.URLs = append(existing.URLs, category.URLs...)
+			category.Files = append(existing.Files, category.Files...)
+			if existing.Description != "" {
+				category.Description = existing.Description
+			}
 		}
 		result.Categories[name] = category
 
 		// 记录已分类的 URL 和本地文件
-		for _, url := range ruleset.URLs {
-			classifiedURLs[url] = true
+		for _, url := range urls {
+			classifiedURLs[utils.CanonicalGitHubURL(url)] = true
 		}
-		for _, file := range ruleset.Files {
+		for _, file := range files {
 			classifiedFiles[file] = true
+			classifiedFiles[utils.NormalizeLocalPath(file)] = true
 		}
 	}
 
@@ -220,7 +256,7 @@ func parseClassificationResponse(response string, ruleFiles []RuleFileInfo) (*Ru
 		isClassified := false
 
 		// 检查 GitHubURL（如果存在）
-		if file.GitHubURL != "" && classifiedURLs[file.GitHubURL] {
+		if file.GitHubURL != "" && classifiedURLs[utils.CanonicalGitHubURL(file.GitHubURL)] {
 			isClassified = true
 		}
 
@@ -244,6 +280,35 @@ func parseClassificationResponse(response string, ruleFiles []RuleFileInfo) (*Ru
 	return result, nil
 }
 
+// batchSourceSet 返回批次中规则文件的 GitHub URL（规范化）和本地路径（原始及标准化），用于校验 AI 返回的引用
+func batchSourceSet(ruleFiles []RuleFileInfo) map[string]bool {
+	sources := make(map[string]bool, len(ruleFiles)*2)
+	for _, file := range ruleFiles {
+		if file.GitHubURL != "" {
+			sources[utils.CanonicalGitHubURL(file.GitHubURL)] = true
+		}
+		if file.FilePath != "" {
+			sources[file.FilePath] = true
+			sources[utils.NormalizeLocalPath(file.FilePath)] = true
+		}
+	}
+	return sources
+}
+
+// dropStraySources 移除分类中不属于本批次输入的 URL/文件（AI 按印象写出的“常见规则文件”），并记录警告
+// 这些引用不会匹配任何下载的文件，保留只会产生空的规则集
+func dropStraySources(category string, refs []string, sources map[string]bool) []string {
+	kept := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		if sources[ref] || sources[utils.CanonicalGitHubURL(ref)] || sources[utils.NormalizeLocalPath(ref)] {
+			kept = append(kept, ref)
+			continue
+		}
+		log.Warn().Msgf("AI 响应中的分类 '%s' 引用了不属于本批次的文件，已丢弃: %s", category, ref)
+	}
+	return kept
+}
+
 // extractYAMLBlock 提取 YAML 代码块
 func extractYAMLBlock(text string) string {
 	// 查找 ```yaml 或 ``` 代码块
@@ -283,7 +348,8 @@ func extractYAMLBlock(text string) string {
 
 // mergeExistingRules 合并现有分类
 func mergeExistingRules(result *RuleClassificationResult, existingRules *config.RuleSetsConfig) {
-	for name, ruleset := range existingRules.ClassifiedRules {
+	for rawName, ruleset := range existingRules.ClassifiedRules {
+		name := config.NormalizeRulesetName(rawName)
 		if existing, ok := result.Categories[name]; ok {
 			// 合并 URLs（去重）
 			urlSet := make(map[string]bool)
@@ -338,7 +404,8 @@ func convertExistingRules(existingRules *config.RuleSetsConfig) map[string]RuleC
 	}
 
 	categories := make(map[string]RuleCategory)
-	for name, ruleset := range existingRules.ClassifiedRules {
+	for rawName, ruleset := range existingRules.ClassifiedRules {
+		name := config.NormalizeRulesetName(rawName)
 		categories[name] = RuleCategory{
 			Name:        name,
 			Description: ruleset.Description,
@@ -360,12 +427,17 @@ func ExportToClassifiedRulesYAML(result *RuleClassificationResult, outputPath st
 	}
 
 	for name, category := range result.Categories {
-		output.ClassifiedRules[name] = config.RulesetConfig{
+		ruleset := config.RulesetConfig{
 			Description: category.Description,
 			URLs:        category.URLs,
 			Files:       category.Files,
 			Rules:       category.Rules,
 		}
+		key := config.NormalizeRulesetName(name)
+		if existing, ok := output.ClassifiedRules[key]; ok {
+			ruleset = config.MergeRulesetConfig(existing, ruleset)
+		}
+		output.ClassifiedRules[key] = ruleset
 	}
 
 	// 生成 YAML 内容
@@ -429,11 +501,16 @@ func exportUnmatchedRules(unmatched []RuleFileInfo, outputPath string) error {
 
 // ExportClassifiedRulesConfig 导出完整的规则配置（包括现有和新增的）
 func ExportClassifiedRulesConfig(ruleSets *config.RuleSetsConfig, outputPath string) error {
+	// 规则集名称统一小写，避免仅大小写不同的规则集被分别写出
+	ruleSets.NormalizeNames()
+
 	// 构建输出结构
 	output := struct {
 		ClassifiedRules map[string]config.RulesetConfig `yaml:"classified_rules"`
+		RuleBlocks      map[string][]string             `yaml:"rule_blocks,omitempty"`
 	}{
 		ClassifiedRules: ruleSets.ClassifiedRules,
+		RuleBlocks:      ruleSets.RuleBlocks,
 	}
 
 	// 生成 YAML 内容
@@ -0,0 +1,47 @@
+package rules
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"rulerefinery/internal/config"
+)
+
+func TestClassificationMergesMixedCaseNames(t *testing.T) {
+	const (
+		urlA = "https://raw.githubusercontent.com/owner/repo/master/AdA.list"
+		urlB = "https://raw.githubusercontent.com/owner/repo/master/AdB.list"
+		urlC = "https://raw.githubusercontent.com/owner/repo/master/AdC.list"
+	)
+	ruleFiles := []RuleFileInfo{{GitHubURL: urlA}, {GitHubURL: urlB}}
+	response := "```yaml\nclassified_rules:\n  Ads:\n    description: 广告\n    urls:\n      - " + urlA +
+		"\n  ads:\n    urls:\n      - " + urlB + "\n```"
+
+	result, err := parseClassificationResponse(response, ruleFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Categories) != 1 {
+		t.Fatalf("categories = %v, want a single 'ads'", result.Categories)
+	}
+	if got := len(result.Categories["ads"].URLs); got != 2 {
+		t.Errorf("ads URLs = %v, want both files", result.Categories["ads"].URLs)
+	}
+	if len(result.Unmatched) != 0 {
+		t.Errorf("unmatched = %v, want none", result.Unmatched)
+	}
+
+	// 已有的规则分类文件中使用其他大小写写法
+	mergeExistingRules(result, &config.RuleSetsConfig{ClassifiedRules: map[string]config.RulesetConfig{
+		"ADS": {URLs: []string{urlC, urlA}},
+	}})
+	if len(result.Categories) != 1 {
+		t.Fatalf("categories after merge = %v, want a single 'ads'", result.Categories)
+	}
+	urls := append([]string(nil), result.Categories["ads"].URLs...)
+	sort.Strings(urls)
+	if want := []string{urlA, urlB, urlC}; !reflect.DeepEqual(urls, want) {
+		t.Errorf("ads URLs after merge = %v, want %v", urls, want)
+	}
+}
@@ -0,0 +1,110 @@
+package rules
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ConflictReportFile 跨规则集冲突报告文件名（位于输出目录）
+const ConflictReportFile = "conflicts.txt"
+
+// DetectConflicts 检测出现在多个规则集中的规则内容，返回 内容 -> 规则集名称列表（按名称排序）
+// 比较的是各规则集的导出内容（应用 allow_tlds/filters/excludes 之后），必须在 Deduplicate 之后调用。
+// DOMAIN 和 DOMAIN-SUFFIX 按域名比较（小写，去除 +. 或 . 前缀），因此 +.google.com 与 google.com 视为重叠；
+// 其他类型按 "类型,内容"（去除参数）比较
+func (o *Optimizer) DetectConflicts() map[string][]string {
+	owners := make(map[string][]string)
+	for _, name := range o.RulesetNames() {
+		ruleSet := o.ruleSets[name]
+		seen := make(map[string]bool)
+		for ruleType := range ruleSet.Rules {
+			for _, rule := range o.filteredRules(ruleSet, ruleType) {
+				key := conflictKey(ruleType, rule)
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+				owners[key] = append(owners[key], name)
+			}
+		}
+	}
+
+	// RulesetNames 已排序，每个内容的规则集列表按名称有序
+	conflicts := make(map[string][]string)
+	for key, names := range owners {
+		if len(names) > 1 {
+			conflicts[key] = names
+		}
+	}
+	return conflicts
+}
+
+// conflictKey 返回用于跨规则集比较的规则内容
+func conflictKey(ruleType RuleType, rule string) string {
+	payload := subtractPayload(ruleType, rule)
+	switch ruleType {
+	case RuleTypeDomain, RuleTypeDomainSuffix:
+		return strings.TrimPrefix(payload, ".")
+	}
+	return string(ruleType) + "," + payload
+}
+
+// LogConflicts 按规则集组合汇总冲突数量并记录警告
+func LogConflicts(conflicts map[string][]string) {
+	if len(conflicts) == 0 {
+		return
+	}
+	groups := make(map[string]int)
+	for _, names := range conflicts {
+		groups[strings.Join(names, "、")]++
+	}
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if groups[keys[i]] != groups[keys[j]] {
+			return groups[keys[i]] > groups[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+
+	log.Warn().Msgf("跨规则集冲突: %d 条规则内容同时出现在多个规则集中（Mihomo 按规则顺序命中第一个，路由取决于 RULE-SET 的顺序）", len(conflicts))
+	for _, key := range keys {
+		log.Warn().Msgf("  %s: %d 条", key, groups[key])
+	}
+}
+
+// WriteConflictReport 将冲突写入输出目录的 conflicts.txt（每行 "内容: 规则集1, 规则集2"，按内容排序），返回文件路径
+// 没有冲突时也写入（只有头部），避免保留上次运行的过期报告
+func WriteConflictReport(outputDir string, conflicts map[string][]string) (string, error) {
+	keys := make([]string, 0, len(conflicts))
+	for key := range conflicts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	reportPath := filepath.Join(outputDir, ConflictReportFile)
+	f, err := os.Create(reportPath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	bw := bufio.NewWriter(f)
+	fmt.Fprintf(bw, "# 跨规则集冲突报告，由 RuleRefinery 生成\n")
+	fmt.Fprintf(bw, "# 同一规则内容出现在多个规则集中（DOMAIN/DOMAIN-SUFFIX 按域名比较），共 %d 条\n", len(keys))
+	for _, key := range keys {
+		fmt.Fprintf(bw, "%s: %s\n", key, strings.Join(conflicts[key], ", "))
+	}
+	if err := bw.Flush(); err != nil {
+		return "", err
+	}
+	return reportPath, nil
+}
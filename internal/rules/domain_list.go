@@ -0,0 +1,67 @@
+package rules
+
+import (
+	"net/netip"
+	"strings"
+)
+
+// DomainListType 仓库 filters 中表示纯域名列表文件的 type（Mihomo domain behavior 格式，每行一个域名，没有规则类型）
+const DomainListType = "clash-domain"
+
+// parseDomainListLine 解析纯域名列表中的一行（如 google.com、+.youtube.com、- '+.example.com'）
+// +. 前缀推断为 DOMAIN-SUFFIX（payload 去除前缀）；. 前缀推断为 DOMAIN-SUFFIX 并保留 .（只匹配子域名）；
+// *. 等含通配符的写法推断为 DOMAIN-WILDCARD；其余推断为 DOMAIN。不像域名的行返回 nil
+func parseDomainListLine(line string) *Rule {
+	line = strings.TrimSpace(line)
+	if rest, ok := strings.CutPrefix(line, "-"); ok {
+		line = strings.TrimSpace(rest)
+	}
+	line = strings.Trim(line, `'"`)
+
+	switch {
+	case strings.HasPrefix(line, "+."):
+		if domain := line[2:]; looksLikeDomain(domain) {
+			return &Rule{Type: RuleTypeDomainSuffix, Payload: domain}
+		}
+	case strings.HasPrefix(line, "."):
+		if looksLikeDomain(line[1:]) {
+			return &Rule{Type: RuleTypeDomainSuffix, Payload: line}
+		}
+	case strings.Contains(line, "*"):
+		if looksLikeDomain(strings.ReplaceAll(line, "*", "x")) {
+			return &Rule{Type: RuleTypeDomainWildcard, Payload: line}
+		}
+	case looksLikeDomain(line):
+		return &Rule{Type: RuleTypeDomain, Payload: line}
+	}
+	return nil
+}
+
+// looksLikeDomain 判断是否像一个域名：至少两个标签，只包含字母、数字、- 和 _，且不是 IP 地址
+// 用于区分纯域名列表中的域名行与标题、说明等文本
+func looksLikeDomain(s string) bool {
+	if s == "" || len(s) > 253 || !strings.Contains(s, ".") {
+		return false
+	}
+	if _, err := netip.ParseAddr(s); err == nil {
+		return false
+	}
+	for _, label := range strings.Split(s, ".") {
+		if label == "" || len(label) > 63 {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c > 127) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// SetDomainListFiles 设置按纯域名列表解析的文件（本地路径）
+// 这些文件中没有逗号、但像域名的行会推断为 DOMAIN/DOMAIN-SUFFIX，其他文件仍然跳过这类行（避免误解析 Surge 等格式中的文本）
+// 必须在 LoadRuleFile 之前设置
+func (o *Optimizer) SetDomainListFiles(files map[string]bool) {
+	o.domainListFiles = files
+}
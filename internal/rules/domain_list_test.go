@@ -0,0 +1,78 @@
+package rules
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseDomainListLine(t *testing.T) {
+	tests := []struct {
+		line     string
+		wantType RuleType
+		payload  string
+	}{
+		{"google.com", RuleTypeDomain, "google.com"},
+		{"  www.google.com  ", RuleTypeDomain, "www.google.com"},
+		{"+.youtube.com", RuleTypeDomainSuffix, "youtube.com"},
+		{".googlevideo.com", RuleTypeDomainSuffix, ".googlevideo.com"},
+		{"*.ytimg.com", RuleTypeDomainWildcard, "*.ytimg.com"},
+		{"  - '+.gstatic.com'", RuleTypeDomainSuffix, "gstatic.com"},
+		{`- "gmail.com"`, RuleTypeDomain, "gmail.com"},
+		{"localhost", "", ""},
+		{"1.1.1.1", "", ""},
+		{"payload:", "", ""},
+		{"Google Domains", "", ""},
+		{"+.", "", ""},
+		{"", "", ""},
+	}
+	for _, tt := range tests {
+		rule := parseDomainListLine(tt.line)
+		if tt.wantType == "" {
+			if rule != nil {
+				t.Errorf("parseDomainListLine(%q) = %s,%s, want nil", tt.line, rule.Type, rule.Payload)
+			}
+			continue
+		}
+		if rule == nil || rule.Type != tt.wantType || rule.Payload != tt.payload {
+			t.Errorf("parseDomainListLine(%q) = %+v, want %s,%s", tt.line, rule, tt.wantType, tt.payload)
+		}
+	}
+}
+
+func TestDomainListFileMixedLines(t *testing.T) {
+	input := "# Google\npayload:\ngoogle.com\n+.youtube.com\nDOMAIN-SUFFIX,gstatic.com\n.googlevideo.com\n"
+	tests := []struct {
+		name       string
+		domainList bool
+		want       []string
+	}{
+		{
+			name:       "clash-domain file",
+			domainList: true,
+			want:       []string{"DOMAIN,google.com", "DOMAIN-SUFFIX,gstatic.com", "DOMAIN-SUFFIX,youtube.com", "DOMAIN-SUFFIX,.googlevideo.com"},
+		},
+		{
+			name: "other file skips bare lines",
+			want: []string{"DOMAIN-SUFFIX,gstatic.com"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := NewOptimizer()
+			o.SetDomainListFiles(map[string]bool{"memory": tt.domainList})
+			if err := o.LoadRules(strings.NewReader(input), "test", "memory"); err != nil {
+				t.Fatal(err)
+			}
+			o.Deduplicate()
+			dir := t.TempDir()
+			if err := o.Export(dir); err != nil {
+				t.Fatal(err)
+			}
+			if got := readRuleLines(t, filepath.Join(dir, "test", "test_classical_all.list")); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("test_classical_all.list = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
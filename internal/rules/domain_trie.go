@@ -0,0 +1,147 @@
+package rules
+
+import (
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// SetCollapseSubdomains 设置去重时是否移除已被同一规则集中上级 DOMAIN-SUFFIX 覆盖的 DOMAIN/DOMAIN-SUFFIX
+// 如存在 DOMAIN-SUFFIX,example.com 时，DOMAIN,www.example.com 和 DOMAIN-SUFFIX,cdn.example.com 是多余的
+func (o *Optimizer) SetCollapseSubdomains(enabled bool) {
+	o.collapseSubdomains = enabled
+}
+
+// domainTrie 按反转的域名标签存储 DOMAIN-SUFFIX 的前缀树（com → example → cdn）
+// 判断一个域名是否被覆盖只需沿其标签从顶级域向下查找一次，复杂度与域名层级数成正比，
+// 整个规则集的覆盖检查接近线性，不需要两两比较
+type domainTrie struct {
+	root trieNode
+}
+
+// trieNode 前缀树节点，对应一个域名
+type trieNode struct {
+	children map[string]*trieNode
+	apexRule string // 覆盖该域名本身及所有子域名的后缀规则（example.com 或 +.example.com 写法），为空表示没有
+	subOnly  bool   // 存在只覆盖子域名的后缀规则（.example.com 写法）
+}
+
+// suffixScope 解析 DOMAIN-SUFFIX 的 payload，返回域名及是否覆盖域名本身
+// .example.com 只匹配子域名；example.com 与 +.example.com 匹配域名本身及所有子域名
+func suffixScope(payload string) (domain string, apex bool) {
+	payload = strings.ToLower(stripOptions(payload))
+	if strings.HasPrefix(payload, "+.") {
+		return payload[2:], true
+	}
+	if strings.HasPrefix(payload, ".") {
+		return payload[1:], false
+	}
+	return payload, true
+}
+
+// insert 记录一条 DOMAIN-SUFFIX 规则
+func (t *domainTrie) insert(rule string) {
+	domain, apex := suffixScope(rule)
+	if domain == "" {
+		return
+	}
+	node := &t.root
+	labels := strings.Split(domain, ".")
+	for i := len(labels) - 1; i >= 0; i-- {
+		child := node.children[labels[i]]
+		if child == nil {
+			if node.children == nil {
+				node.children = make(map[string]*trieNode)
+			}
+			child = &trieNode{}
+			node.children[labels[i]] = child
+		}
+		node = child
+	}
+	if apex {
+		// 同一域名的多种等价写法（example.com、+.example.com）只保留第一条
+		if node.apexRule == "" {
+			node.apexRule = rule
+		}
+	} else {
+		node.subOnly = true
+	}
+}
+
+// coveredBy 判断规则是否被前缀树中的其他后缀规则覆盖
+// 上级域名上的任意后缀规则都覆盖该域名及其子域名；同一域名上只有覆盖域名本身的后缀规则
+// 才能覆盖 DOMAIN 和 .example.com 写法的后缀规则
+func (t *domainTrie) coveredBy(ruleType RuleType, rule string) bool {
+	var domain string
+	var apex bool
+	if ruleType == RuleTypeDomainSuffix {
+		domain, apex = suffixScope(rule)
+	} else {
+		domain, apex = strings.ToLower(stripOptions(rule)), true
+	}
+	if domain == "" {
+		return false
+	}
+
+	node := &t.root
+	labels := strings.Split(domain, ".")
+	for i := len(labels) - 1; i >= 0; i-- {
+		node = node.children[labels[i]]
+		if node == nil {
+			return false
+		}
+		if i == 0 {
+			break
+		}
+		if node.apexRule != "" || node.subOnly {
+			return true
+		}
+	}
+
+	// 到达域名本身对应的节点
+	if node.apexRule == "" {
+		return false
+	}
+	if ruleType == RuleTypeDomain || !apex {
+		return true
+	}
+	// 覆盖域名本身的后缀规则：只有等价写法中的第一条保留
+	return node.apexRule != rule
+}
+
+// collapseCoveredDomains 移除规则集中已被上级 DOMAIN-SUFFIX 覆盖的 DOMAIN/DOMAIN-SUFFIX 规则
+// 必须在单类型去重之后调用，返回移除的规则数量
+func collapseCoveredDomains(ruleSet *RuleSet) int {
+	suffixes := ruleSet.Rules[RuleTypeDomainSuffix]
+	if len(suffixes) == 0 {
+		return 0
+	}
+
+	var trie domainTrie
+	for _, rule := range suffixes {
+		trie.insert(rule)
+	}
+
+	removed := 0
+	for _, ruleType := range []RuleType{RuleTypeDomain, RuleTypeDomainSuffix} {
+		rules, exists := ruleSet.Rules[ruleType]
+		if !exists {
+			continue
+		}
+		kept := make([]string, 0, len(rules))
+		for _, rule := range rules {
+			if trie.coveredBy(ruleType, rule) {
+				log.Debug().Msgf("规则集 '%s': 移除 %s,%s（已被上级 DOMAIN-SUFFIX 覆盖）", ruleSet.Name, ruleType, rule)
+				removed++
+				continue
+			}
+			kept = append(kept, rule)
+		}
+		ruleSet.Rules[ruleType] = kept
+	}
+	if removed > 0 {
+		ruleSet.filtered = nil
+		log.Info().Msgf("规则集 '%s': 移除 %d 条已被上级 DOMAIN-SUFFIX 覆盖的域名规则", ruleSet.Name, removed)
+	}
+	return removed
+}
@@ -0,0 +1,134 @@
+package rules
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// benchmarkDomainRuleSet 生成 n 条 DOMAIN-SUFFIX 规则，以及同样数量的 DOMAIN 规则（一半被上级后缀覆盖）
+func benchmarkDomainRuleSet(n int) (suffixes, domains []string) {
+	suffixes = make([]string, 0, n)
+	domains = make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		suffixes = append(suffixes, fmt.Sprintf("site%d.example%d.com", i, i%97))
+		if i%2 == 0 {
+			domains = append(domains, fmt.Sprintf("www.site%d.example%d.com", i, i%97))
+		} else {
+			domains = append(domains, fmt.Sprintf("www.other%d.example%d.net", i, i%97))
+		}
+	}
+	return suffixes, domains
+}
+
+// naiveCollapseCoveredDomains 两两比较后缀的参考实现（O(n²)），用于校验和对比 collapseCoveredDomains
+// 规则被覆盖的条件：是某条后缀规则所在域名的子域名；或与覆盖域名本身的后缀规则同一域名，
+// 且是 DOMAIN、.example.com 写法的后缀，或是排在等价写法之后的后缀
+func naiveCollapseCoveredDomains(ruleSet *RuleSet) int {
+	suffixes := ruleSet.Rules[RuleTypeDomainSuffix]
+	covered := func(ruleType RuleType, index int, rule string) bool {
+		domain, apex := strings.ToLower(stripOptions(rule)), true
+		if ruleType == RuleTypeDomainSuffix {
+			domain, apex = suffixScope(rule)
+		}
+		if domain == "" {
+			return false
+		}
+		for j, suffix := range suffixes {
+			suffixDomain, suffixApex := suffixScope(suffix)
+			if suffixDomain == "" || (ruleType == RuleTypeDomainSuffix && j == index) {
+				continue
+			}
+			if strings.HasSuffix(domain, "."+suffixDomain) {
+				return true
+			}
+			if domain == suffixDomain && suffixApex && (ruleType == RuleTypeDomain || !apex || j < index) {
+				return true
+			}
+		}
+		return false
+	}
+
+	removed := 0
+	kept := make(map[RuleType][]string)
+	for _, ruleType := range []RuleType{RuleTypeDomain, RuleTypeDomainSuffix} {
+		rules, exists := ruleSet.Rules[ruleType]
+		if !exists {
+			continue
+		}
+		kept[ruleType] = make([]string, 0, len(rules))
+		for i, rule := range rules {
+			if covered(ruleType, i, rule) {
+				removed++
+				continue
+			}
+			kept[ruleType] = append(kept[ruleType], rule)
+		}
+	}
+	for ruleType, rules := range kept {
+		ruleSet.Rules[ruleType] = rules
+	}
+	return removed
+}
+
+// naiveBenchmarkDomains 两种实现对比时的规则数量（参考实现为 O(n²)）
+const naiveBenchmarkDomains = 2000
+
+func TestCollapseCoveredDomainsMatchesNaive(t *testing.T) {
+	quietLogs(t)
+	suffixes, domains := benchmarkDomainRuleSet(naiveBenchmarkDomains)
+	inputs := map[string][2][]string{
+		"generated": {suffixes, domains},
+		"mixed": {
+			{"example.com", "+.example.com", "cdn.example.com", ".sub.example.org", "sub.example.org", "a.sub.example.org", "Example.NET", "x.example.net,no-resolve"},
+			{"example.com", "www.example.com", "sub.example.org", "b.sub.example.org", "example.net", "other.org"},
+		},
+	}
+	for name, input := range inputs {
+		newRuleSet := func() *RuleSet {
+			return &RuleSet{Name: name, Rules: map[RuleType][]string{
+				RuleTypeDomainSuffix: append([]string(nil), input[0]...),
+				RuleTypeDomain:       append([]string(nil), input[1]...),
+			}}
+		}
+		got, want := newRuleSet(), newRuleSet()
+		gotRemoved, wantRemoved := collapseCoveredDomains(got), naiveCollapseCoveredDomains(want)
+		if gotRemoved != wantRemoved || !reflect.DeepEqual(got.Rules, want.Rules) {
+			t.Errorf("%s: collapseCoveredDomains() removed %d, rules %v\nnaive removed %d, rules %v", name, gotRemoved, got.Rules, wantRemoved, want.Rules)
+		}
+	}
+}
+
+func BenchmarkCollapseCoveredDomains(b *testing.B) {
+	quietLogs(b)
+	for _, n := range []int{naiveBenchmarkDomains, 200000} {
+		b.Run(fmt.Sprintf("n=%d", n), func(b *testing.B) {
+			benchmarkCollapse(b, n, collapseCoveredDomains)
+		})
+	}
+}
+
+func BenchmarkCollapseCoveredDomainsNaive(b *testing.B) {
+	quietLogs(b)
+	b.Run(fmt.Sprintf("n=%d", naiveBenchmarkDomains), func(b *testing.B) {
+		benchmarkCollapse(b, naiveBenchmarkDomains, naiveCollapseCoveredDomains)
+	})
+}
+
+// benchmarkCollapse 对 benchmarkDomainRuleSet(n) 的输入测量 collapse 的耗时（每次使用新的规则集副本）
+func benchmarkCollapse(b *testing.B, n int, collapse func(*RuleSet) int) {
+	suffixes, domains := benchmarkDomainRuleSet(n)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		ruleSet := &RuleSet{Name: "bench", Rules: map[RuleType][]string{
+			RuleTypeDomainSuffix: append([]string(nil), suffixes...),
+			RuleTypeDomain:       append([]string(nil), domains...),
+		}}
+		b.StartTimer()
+		if removed := collapse(ruleSet); removed != len(domains)/2 {
+			b.Fatalf("removed %d rules, want %d", removed, len(domains)/2)
+		}
+	}
+}
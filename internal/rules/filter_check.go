@@ -0,0 +1,89 @@
+package rules
+
+import "fmt"
+
+// FilterIssue 规则集过滤器配置问题
+type FilterIssue struct {
+	Ruleset string // 规则集名称
+	Pattern string // 有问题的过滤模式（规则集整体被清空时为空）
+	Problem string // 问题说明
+}
+
+// String 格式化问题说明
+func (i FilterIssue) String() string {
+	if i.Pattern == "" {
+		return fmt.Sprintf("规则集 '%s': %s", i.Ruleset, i.Problem)
+	}
+	return fmt.Sprintf("规则集 '%s': 过滤模式 '%s' %s", i.Ruleset, i.Pattern, i.Problem)
+}
+
+// CheckRulesetFilters 检查 filters/excludes 是否配置错误（应在 Deduplicate 之后、导出之前调用）
+// 检查项：
+//   - filters 中的肯定模式没有匹配任何规则（通常是类型或通配符写错，如 "DOMAIN,nonexistent*"），
+//     否定模式（!pattern）没有排除任何规则时不报告
+//   - 过滤后（含 allow_tlds、exclude_private_ips）规则集的所有规则都被移除（原本非空）
+//   - 规则集没有被清空，但某个原本有规则的类型被过滤为 0 条
+//
+// 过滤后的数量与导出使用同一份过滤结果。返回的问题按规则集名称排序
+func (o *Optimizer) CheckRulesetFilters() []FilterIssue {
+	var issues []FilterIssue
+	for _, name := range o.RulesetNames() {
+		ruleSet := o.ruleSets[name]
+		if len(ruleSet.Filters) == 0 && len(ruleSet.Excludes) == 0 && len(ruleSet.AllowTLDs) == 0 && !ruleSet.ExcludePrivateIPs {
+			continue
+		}
+
+		filters, _ := ruleSet.compiledFilters()
+		filterMatches := make([]int, len(filters))
+		before, after := 0, 0
+		var emptiedTypes []RuleType // 原本有规则、过滤后为 0 条的类型
+		for _, ruleType := range sortedRuleTypes(ruleSet.Rules) {
+			rules := ruleSet.Rules[ruleType]
+			prefix := string(ruleType) + ","
+			for _, rule := range rules {
+				fullRule := prefix + rule
+				for i, filter := range filters {
+					if filter.Match(fullRule) {
+						filterMatches[i]++
+					}
+				}
+			}
+
+			kept := len(o.filteredRules(ruleSet, ruleType))
+			before += len(rules)
+			after += kept
+			if len(rules) > 0 && kept == 0 {
+				emptiedTypes = append(emptiedTypes, ruleType)
+			}
+		}
+		if before == 0 {
+			continue
+		}
+
+		for i, filter := range filters {
+			// 没有排除任何规则的否定模式（!pattern）与没有匹配的 excludes 一样无害，不报告
+			if filterMatches[i] > 0 || (filter.negate && filter.kind != globInvalid) {
+				continue
+			}
+			problem := "没有匹配任何规则，请检查规则类型和通配符（格式: 类型,内容，如 DOMAIN-SUFFIX,*google*）"
+			if filter.kind == globInvalid {
+				problem = "不是有效的 glob 模式"
+			}
+			issues = append(issues, FilterIssue{Ruleset: name, Pattern: filter.String(), Problem: problem})
+		}
+		if after == 0 {
+			issues = append(issues, FilterIssue{
+				Ruleset: name,
+				Problem: fmt.Sprintf("filters/excludes 移除了全部 %d 条规则，导出结果将为空，过滤器可能配置错误", before),
+			})
+			continue
+		}
+		for _, ruleType := range emptiedTypes {
+			issues = append(issues, FilterIssue{
+				Ruleset: name,
+				Problem: fmt.Sprintf("filters/excludes 移除了全部 %d 条 %s 规则，过滤器可能配置错误", len(ruleSet.Rules[ruleType]), ruleType),
+			})
+		}
+	}
+	return issues
+}
@@ -0,0 +1,129 @@
+package rules
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// FilterPreviewType 单个规则类型应用 filters/excludes 前后的对比
+type FilterPreviewType struct {
+	RuleType RuleType
+	Before   int
+	After    int
+	Kept     []string // 保留的规则示例（完整规则，如 DOMAIN-SUFFIX,google.com）
+	Removed  []string // 移除的规则示例，附带移除原因
+}
+
+// FilterPreview 规则集 filters/excludes 的效果预览（--test-filter）
+type FilterPreview struct {
+	Ruleset   string
+	Filters   []string
+	Excludes  []string
+	AllowTLDs []string
+	Types     []FilterPreviewType // 按规则类型排序
+}
+
+// PreviewFilters 对已加载（去重后）的规则集应用其 filters/excludes，返回各类型前后的数量和保留/移除的规则示例
+// 与导出时使用同一个 applyRuleFilters，sampleSize 为每个类型保留和移除示例的最大数量
+func (o *Optimizer) PreviewFilters(ruleSetName string, sampleSize int) (*FilterPreview, error) {
+	ruleSet, exists := o.ruleSets[ruleSetName]
+	if !exists {
+		return nil, fmt.Errorf("规则集 '%s' 不存在", ruleSetName)
+	}
+
+	preview := &FilterPreview{Ruleset: ruleSetName, Filters: ruleSet.Filters, Excludes: ruleSet.Excludes, AllowTLDs: ruleSet.AllowTLDs}
+	ruleTypes := make([]RuleType, 0, len(ruleSet.Rules))
+	for ruleType, rules := range ruleSet.Rules {
+		if len(rules) > 0 {
+			ruleTypes = append(ruleTypes, ruleType)
+		}
+	}
+	sort.Slice(ruleTypes, func(i, j int) bool { return ruleTypes[i] < ruleTypes[j] })
+
+	filters, excludes := ruleSet.compiledFilters()
+	for _, ruleType := range ruleTypes {
+		rules := ruleSet.Rules[ruleType]
+		kept := o.applyRuleFilters(rules, ruleType, ruleSet)
+		keptSet := make(map[string]bool, len(kept))
+		for _, rule := range kept {
+			keptSet[rule] = true
+		}
+
+		typePreview := FilterPreviewType{RuleType: ruleType, Before: len(rules), After: len(kept)}
+		for _, rule := range rules {
+			fullRule := string(ruleType) + "," + rule
+			if keptSet[rule] {
+				if len(typePreview.Kept) < sampleSize {
+					typePreview.Kept = append(typePreview.Kept, fullRule)
+				}
+				continue
+			}
+			if len(typePreview.Removed) < sampleSize {
+				typePreview.Removed = append(typePreview.Removed, fullRule+"  ("+removalReason(ruleSet, ruleType, rule, filters, excludes)+")")
+			}
+		}
+		preview.Types = append(preview.Types, typePreview)
+	}
+	return preview, nil
+}
+
+// removalReason 说明规则被 allow_tlds/filters/excludes 移除的原因
+func removalReason(ruleSet *RuleSet, ruleType RuleType, rule string, filters, excludes []globMatcher) string {
+	if len(ruleSet.AllowTLDs) > 0 && allowTLDTypes[ruleType] && !matchAllowTLD(ruleSet.AllowTLDs, rule) {
+		return "不在 allow_tlds 中"
+	}
+	fullRule := string(ruleType) + "," + rule
+	if kept, idx := matchFilters(filters, fullRule); !kept {
+		if idx >= 0 {
+			return "匹配否定过滤器 !" + filters[idx].pattern
+		}
+		return "未匹配任何 filters"
+	}
+	if idx := matchAnyGlob(excludes, fullRule); idx >= 0 {
+		return "匹配 exclude " + excludes[idx].pattern
+	}
+	return "已移除"
+}
+
+// WriteReport 输出预览报告：各类型前后数量，以及保留和移除的规则示例
+func (p *FilterPreview) WriteReport(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "规则集: %s\n", p.Ruleset)
+	fmt.Fprintf(bw, "filters: %v\n", p.Filters)
+	fmt.Fprintf(bw, "excludes: %v\n", p.Excludes)
+	if len(p.AllowTLDs) > 0 {
+		fmt.Fprintf(bw, "allow_tlds: %v\n", p.AllowTLDs)
+	}
+
+	before, after := 0, 0
+	// 中文表头按显示宽度（每个汉字占两列）手工对齐
+	fmt.Fprintf(bw, "\n类型%16s   过滤前   过滤后     移除\n", "")
+	for _, t := range p.Types {
+		fmt.Fprintf(bw, "%-20s %8d %8d %8d\n", t.RuleType, t.Before, t.After, t.Before-t.After)
+		before += t.Before
+		after += t.After
+	}
+	fmt.Fprintf(bw, "合计%16s %8d %8d %8d\n", "", before, after, before-after)
+
+	for _, t := range p.Types {
+		if len(t.Kept) == 0 && len(t.Removed) == 0 {
+			continue
+		}
+		fmt.Fprintf(bw, "\n[%s]\n", t.RuleType)
+		if len(t.Kept) > 0 {
+			fmt.Fprintf(bw, "  保留（%d 条中的 %d 条）:\n", t.After, len(t.Kept))
+			for _, rule := range t.Kept {
+				fmt.Fprintf(bw, "    + %s\n", rule)
+			}
+		}
+		if len(t.Removed) > 0 {
+			fmt.Fprintf(bw, "  移除（%d 条中的 %d 条）:\n", t.Before-t.After, len(t.Removed))
+			for _, rule := range t.Removed {
+				fmt.Fprintf(bw, "    - %s\n", rule)
+			}
+		}
+	}
+	return bw.Flush()
+}
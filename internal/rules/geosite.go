@@ -0,0 +1,223 @@
+package rules
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+// GeoSiteDB geosite 数据库（v2ray/mihomo geosite.dat）
+// key 为小写的分类代码（如 google、cn），value 为该分类展开后的域名规则
+type GeoSiteDB map[string][]geoSiteDomain
+
+// geoSiteDomain geosite 中的单个域名条目
+type geoSiteDomain struct {
+	rule  Rule
+	attrs map[string]bool // 属性（如 @cn、@ads）
+}
+
+// geosite.dat 中的域名类型（v2ray routercommon.Domain.Type）
+const (
+	geoSiteTypePlain      = 0 // 关键字匹配
+	geoSiteTypeRegex      = 1 // 正则匹配
+	geoSiteTypeRootDomain = 2 // 域名及其子域名
+	geoSiteTypeFull       = 3 // 完整域名
+)
+
+// LoadGeoSiteDB 加载 geosite.dat 数据库
+// 文件为 protobuf 编码的 GeoSiteList，这里只解析需要的字段，不依赖 protobuf 库
+func LoadGeoSiteDB(path string) (GeoSiteDB, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取 geosite 数据库失败: %w", err)
+	}
+
+	db := make(GeoSiteDB)
+	// GeoSiteList: repeated GeoSite entry = 1
+	err = walkProtoFields(data, func(field int, wireType int, value []byte, _ uint64) error {
+		if field != 1 || wireType != protoWireBytes {
+			return nil
+		}
+		code, domains, err := parseGeoSite(value)
+		if err != nil {
+			return err
+		}
+		db[strings.ToLower(code)] = append(db[strings.ToLower(code)], domains...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("解析 geosite 数据库失败: %w", err)
+	}
+	if len(db) == 0 {
+		return nil, fmt.Errorf("geosite 数据库为空: %s", path)
+	}
+
+	return db, nil
+}
+
+// parseGeoSite 解析 GeoSite { string country_code = 1; repeated Domain domain = 2; }
+func parseGeoSite(data []byte) (string, []geoSiteDomain, error) {
+	var code string
+	var domains []geoSiteDomain
+	err := walkProtoFields(data, func(field int, wireType int, value []byte, _ uint64) error {
+		switch {
+		case field == 1 && wireType == protoWireBytes:
+			code = string(value)
+		case field == 2 && wireType == protoWireBytes:
+			domain, ok, err := parseGeoSiteDomain(value)
+			if err != nil {
+				return err
+			}
+			if ok {
+				domains = append(domains, domain)
+			}
+		}
+		return nil
+	})
+	return code, domains, err
+}
+
+// parseGeoSiteDomain 解析 Domain { Type type = 1; string value = 2; repeated Attribute attribute = 3; }
+func parseGeoSiteDomain(data []byte) (geoSiteDomain, bool, error) {
+	domainType := uint64(geoSiteTypePlain)
+	var value string
+	attrs := make(map[string]bool)
+	err := walkProtoFields(data, func(field int, wireType int, raw []byte, varint uint64) error {
+		switch {
+		case field == 1 && wireType == protoWireVarint:
+			domainType = varint
+		case field == 2 && wireType == protoWireBytes:
+			value = string(raw)
+		case field == 3 && wireType == protoWireBytes:
+			// Attribute { string key = 1; ... }
+			return walkProtoFields(raw, func(field int, wireType int, raw []byte, _ uint64) error {
+				if field == 1 && wireType == protoWireBytes {
+					attrs[strings.ToLower(string(raw))] = true
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	if err != nil || value == "" {
+		return geoSiteDomain{}, false, err
+	}
+
+	var ruleType RuleType
+	switch domainType {
+	case geoSiteTypePlain:
+		ruleType = RuleTypeDomainKeyword
+	case geoSiteTypeRegex:
+		ruleType = RuleTypeDomainRegex
+	case geoSiteTypeRootDomain:
+		ruleType = RuleTypeDomainSuffix
+	case geoSiteTypeFull:
+		ruleType = RuleTypeDomain
+	default:
+		return geoSiteDomain{}, false, nil
+	}
+
+	return geoSiteDomain{rule: Rule{Type: ruleType, Payload: value}, attrs: attrs}, true, nil
+}
+
+// expandGeoSite 将 GEOSITE 引用展开为对应的域名规则
+// 支持属性过滤，如 GEOSITE,google@cn 只展开带 @cn 属性的域名
+// 分类不存在时返回 false
+func (db GeoSiteDB) expandGeoSite(reference string) ([]Rule, bool) {
+	code, attr, _ := strings.Cut(strings.ToLower(strings.TrimSpace(reference)), "@")
+	domains, ok := db[code]
+	if !ok {
+		return nil, false
+	}
+
+	rules := make([]Rule, 0, len(domains))
+	for _, domain := range domains {
+		if attr != "" && !domain.attrs[attr] {
+			continue
+		}
+		rules = append(rules, domain.rule)
+	}
+	return rules, true
+}
+
+// NewGeoSiteTransformer 创建 GEOSITE 展开转换器
+// GEOSITE 规则被替换为数据库中对应的 DOMAIN/DOMAIN-SUFFIX/DOMAIN-KEYWORD/DOMAIN-REGEX 规则，
+// 使导出的规则集不依赖客户端的 geosite 数据库；数据库中不存在的分类保留原 GEOSITE 规则
+func NewGeoSiteTransformer(db GeoSiteDB) RuleTransformer {
+	var warned sync.Map
+	return func(rule Rule) []Rule {
+		if rule.Type != RuleTypeGeoSite {
+			return []Rule{rule}
+		}
+
+		expanded, ok := db.expandGeoSite(rule.Payload)
+		if !ok {
+			if _, loaded := warned.LoadOrStore(strings.ToLower(rule.Payload), true); !loaded {
+				log.Warn().Msgf("geosite 数据库中不存在分类 '%s'，保留 GEOSITE 规则", rule.Payload)
+			}
+			return []Rule{rule}
+		}
+		return expanded
+	}
+}
+
+// protobuf wire 类型
+const (
+	protoWireVarint  = 0
+	protoWireFixed64 = 1
+	protoWireBytes   = 2
+	protoWireFixed32 = 5
+)
+
+// walkProtoFields 遍历 protobuf 消息的字段
+// varint 字段通过 varint 参数传入，length-delimited 字段通过 value 参数传入
+func walkProtoFields(data []byte, fn func(field int, wireType int, value []byte, varint uint64) error) error {
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return errors.New("无效的字段标识")
+		}
+		data = data[n:]
+		field, wireType := int(key>>3), int(key&0x7)
+
+		switch wireType {
+		case protoWireVarint:
+			v, n := binary.Uvarint(data)
+			if n <= 0 {
+				return errors.New("无效的 varint")
+			}
+			data = data[n:]
+			if err := fn(field, wireType, nil, v); err != nil {
+				return err
+			}
+		case protoWireBytes:
+			length, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < length {
+				return errors.New("无效的长度")
+			}
+			value := data[n : n+int(length)]
+			data = data[n+int(length):]
+			if err := fn(field, wireType, value, 0); err != nil {
+				return err
+			}
+		case protoWireFixed64:
+			if len(data) < 8 {
+				return errors.New("数据不完整")
+			}
+			data = data[8:]
+		case protoWireFixed32:
+			if len(data) < 4 {
+				return errors.New("数据不完整")
+			}
+			data = data[4:]
+		default:
+			return fmt.Errorf("不支持的 wire 类型 %d", wireType)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package rules
+
+import (
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/rs/zerolog/log"
+)
+
+// globKind 预编译 glob 模式的匹配方式
+type globKind int
+
+const (
+	globLiteral  globKind = iota // 不含通配符，精确匹配
+	globPrefix                   // "xxx*"
+	globSuffix                   // "*xxx"
+	globContains                 // "*xxx*"
+	globGeneric                  // 其他模式，交给 doublestar.Match
+	globInvalid                  // 无效模式，不匹配任何内容
+)
+
+// globMatcher 预编译的 glob 模式
+// 过滤器在每个规则集的每种导出格式中都会对全部规则匹配一次，常见的简单模式（精确、前缀、后缀、包含）
+// 直接用字符串操作匹配，其余模式使用 doublestar.Match；语义与 doublestar 一致：* 不匹配 "/"
+type globMatcher struct {
+	pattern string
+	kind    globKind
+	literal string // 去掉首尾 * 后的字面量（globLiteral/Prefix/Suffix/Contains）
+	negate  bool   // 否定模式（filters 中以 ! 开头），pattern 不含 !
+}
+
+// compileGlob 预编译 glob 模式
+func compileGlob(pattern string) globMatcher {
+	m := globMatcher{pattern: pattern, kind: globGeneric}
+	if !doublestar.ValidatePattern(pattern) {
+		m.kind = globInvalid
+		return m
+	}
+
+	// 去掉首尾的单个 *（** 有跨目录语义，交给 doublestar）
+	inner := pattern
+	leading := strings.HasPrefix(inner, "*") && !strings.HasPrefix(inner, "**")
+	if leading {
+		inner = inner[1:]
+	}
+	trailing := strings.HasSuffix(inner, "*") && !strings.HasSuffix(inner, "**") && !strings.HasSuffix(inner, `\*`)
+	if trailing {
+		inner = inner[:len(inner)-1]
+	}
+	if strings.ContainsAny(inner, `*?[]{}\`) {
+		return m
+	}
+
+	m.literal = inner
+	switch {
+	case !leading && !trailing:
+		m.kind = globLiteral
+	case !leading && trailing:
+		m.kind = globPrefix
+	case leading && !trailing:
+		m.kind = globSuffix
+	case !strings.Contains(inner, "/"):
+		m.kind = globContains
+	}
+	return m
+}
+
+// compileGlobs 预编译一组 glob 模式，忽略空模式，无效模式记录警告
+func compileGlobs(patterns []string) []globMatcher {
+	matchers := make([]globMatcher, 0, len(patterns))
+	for _, pattern := range patterns {
+		if pattern == "" {
+			continue
+		}
+		m := compileGlob(pattern)
+		if m.kind == globInvalid {
+			log.Warn().Msgf("无效的过滤模式，已忽略: '%s'", pattern)
+		}
+		matchers = append(matchers, m)
+	}
+	return matchers
+}
+
+// compileFilterGlobs 预编译 filters：以 ! 开头的模式为否定模式（规则不能匹配）
+func compileFilterGlobs(patterns []string) []globMatcher {
+	matchers := make([]globMatcher, 0, len(patterns))
+	for _, pattern := range patterns {
+		inner, negate := strings.CutPrefix(pattern, "!")
+		if inner == "" {
+			continue
+		}
+		m := compileGlob(inner)
+		m.negate = negate
+		if m.kind == globInvalid {
+			log.Warn().Msgf("无效的过滤模式，已忽略: '%s'", pattern)
+		}
+		matchers = append(matchers, m)
+	}
+	return matchers
+}
+
+// String 返回配置中的模式写法（否定模式带 !）
+func (m globMatcher) String() string {
+	if m.negate {
+		return "!" + m.pattern
+	}
+	return m.pattern
+}
+
+// Match 判断 s 是否匹配模式
+func (m globMatcher) Match(s string) bool {
+	switch m.kind {
+	case globLiteral:
+		return s == m.literal
+	case globPrefix:
+		return strings.HasPrefix(s, m.literal) && !strings.Contains(s[len(m.literal):], "/")
+	case globSuffix:
+		return strings.HasSuffix(s, m.literal) && !strings.Contains(s[:len(s)-len(m.literal)], "/")
+	case globContains:
+		// 字面量不含 "/"，而 * 不能匹配 "/"，所以 s 中不能出现 "/"
+		return !strings.Contains(s, "/") && strings.Contains(s, m.literal)
+	case globGeneric:
+		matched, err := doublestar.Match(m.pattern, s)
+		return err == nil && matched
+	default:
+		return false
+	}
+}
+
+// matchAnyGlob 判断 s 是否匹配任一模式，返回匹配的模式下标（不匹配时为 -1）
+func matchAnyGlob(matchers []globMatcher, s string) int {
+	for i, m := range matchers {
+		if m.Match(s) {
+			return i
+		}
+	}
+	return -1
+}
+
+// matchFilters 按 filters 的语义判断规则是否保留：
+// 匹配至少一个肯定模式（没有肯定模式时视为全部匹配），且不匹配任何否定模式（! 开头）。
+// 返回是否保留，以及决定结果的模式下标：保留时为第一个匹配的肯定模式，被否定模式排除时为该否定模式，
+// 其余情况（没有肯定模式、没有匹配任何肯定模式）为 -1
+func matchFilters(filters []globMatcher, s string) (bool, int) {
+	positive, hasPositive := -1, false
+	for i, m := range filters {
+		if !m.negate {
+			hasPositive = true
+			if positive < 0 && m.Match(s) {
+				positive = i
+			}
+		}
+	}
+	if hasPositive && positive < 0 {
+		return false, -1
+	}
+	for i, m := range filters {
+		if m.negate && m.Match(s) {
+			return false, i
+		}
+	}
+	return true, positive
+}
+
+// compiledFilters 返回规则集预编译的 filters 和 excludes（首次使用时编译）
+func (rs *RuleSet) compiledFilters() ([]globMatcher, []globMatcher) {
+	if rs.filterMatchers == nil && len(rs.Filters) > 0 {
+		rs.filterMatchers = compileFilterGlobs(rs.Filters)
+	}
+	if rs.excludeMatchers == nil && len(rs.Excludes) > 0 {
+		rs.excludeMatchers = compileGlobs(rs.Excludes)
+	}
+	return rs.filterMatchers, rs.excludeMatchers
+}
@@ -0,0 +1,65 @@
+package rules
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMatchFilters(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		rule     string
+		kept     bool
+		index    int
+	}{
+		{"positive match", []string{"DOMAIN,*", "DOMAIN-SUFFIX,*"}, "DOMAIN-SUFFIX,google.com", true, 1},
+		{"positive no match", []string{"DOMAIN,*"}, "DOMAIN-SUFFIX,google.com", false, -1},
+		{"negative only kept", []string{"!DOMAIN-SUFFIX,*.cn"}, "DOMAIN-SUFFIX,google.com", true, -1},
+		{"negative only excluded", []string{"!DOMAIN-SUFFIX,*.cn"}, "DOMAIN-SUFFIX,baidu.cn", false, 0},
+		{"mixed kept", []string{"DOMAIN-SUFFIX,*", "!DOMAIN-SUFFIX,*.cn"}, "DOMAIN-SUFFIX,google.com", true, 0},
+		{"mixed excluded by negative", []string{"DOMAIN-SUFFIX,*", "!DOMAIN-SUFFIX,*.cn"}, "DOMAIN-SUFFIX,baidu.cn", false, 1},
+		{"mixed no positive match", []string{"DOMAIN,*", "!DOMAIN-SUFFIX,*.cn"}, "DOMAIN-SUFFIX,google.com", false, -1},
+		{"no filters", nil, "DOMAIN,google.com", true, -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kept, index := matchFilters(compileFilterGlobs(tt.patterns), tt.rule)
+			if kept != tt.kept || index != tt.index {
+				t.Errorf("matchFilters(%v, %q) = %v, %d, want %v, %d", tt.patterns, tt.rule, kept, index, tt.kept, tt.index)
+			}
+		})
+	}
+}
+
+func TestCheckRulesetFiltersNegated(t *testing.T) {
+	o := NewOptimizer()
+	if err := o.LoadRules(strings.NewReader("DOMAIN-SUFFIX,google.com\nDOMAIN-SUFFIX,youtube.com\n"), "test", "memory"); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.SetRulesetFilters("test", []string{"DOMAIN-SUFFIX,*", "!DOMAIN-SUFFIX,*.cn", "DOMAIN,nonexistent*"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	o.Deduplicate()
+
+	issues := o.CheckRulesetFilters()
+	if len(issues) != 1 || issues[0].Pattern != "DOMAIN,nonexistent*" {
+		t.Errorf("CheckRulesetFilters() = %v, want only the unmatched positive pattern", issues)
+	}
+}
+
+func TestCheckRulesetFiltersEmptiedType(t *testing.T) {
+	o := NewOptimizer()
+	if err := o.LoadRules(strings.NewReader("DOMAIN-SUFFIX,google.com\nDOMAIN-KEYWORD,ads\n"), "test", "memory"); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.SetRulesetFilters("test", nil, []string{"DOMAIN-KEYWORD,*"}); err != nil {
+		t.Fatal(err)
+	}
+	o.Deduplicate()
+
+	issues := o.CheckRulesetFilters()
+	if len(issues) != 1 || !strings.Contains(issues[0].Problem, "DOMAIN-KEYWORD") {
+		t.Errorf("CheckRulesetFilters() = %v, want one issue for the emptied DOMAIN-KEYWORD type", issues)
+	}
+}
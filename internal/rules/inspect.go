@@ -0,0 +1,214 @@
+package rules
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// knownRuleTypes 已知的规则类型（其他类型的规则可以解析，但客户端通常无法识别）
+var knownRuleTypes = map[RuleType]bool{
+	RuleTypeDomain: true, RuleTypeDomainSuffix: true, RuleTypeDomainKeyword: true, RuleTypeDomainWildcard: true, RuleTypeDomainRegex: true,
+	RuleTypeIPCIDR: true, RuleTypeIPCIDR6: true, RuleTypeSrcIPCIDR: true, RuleTypeSrcIPCIDR6: true, RuleTypeIPSuffix: true, RuleTypeSrcIPSuffix: true,
+	RuleTypeGeoIP: true, RuleTypeSrcGeoIP: true, RuleTypeIPASN: true, RuleTypeSrcIPASN: true,
+	RuleTypeProcessName: true, RuleTypeProcessPath: true, RuleTypeProcessNameRegex: true, RuleTypeProcessPathRegex: true,
+	RuleTypeDstPort: true, RuleTypeSrcPort: true, RuleTypeInPort: true,
+	RuleTypeGeoSite: true, RuleTypeNetwork: true, RuleTypeUid: true, RuleTypeInType: true, RuleTypeInUser: true, RuleTypeInName: true,
+	RuleTypeDSCP: true, RuleTypeRuleSet: true, RuleTypeSubRules: true, RuleTypeMatch: true, RuleTypeFinal: true,
+}
+
+// inspectMaxLines 诊断结果中每类问题最多保留的行数
+const inspectMaxLines = 10
+
+// InspectLine 诊断结果中的一行
+type InspectLine struct {
+	Line    int    // 行号（从 1 开始）
+	Content string // 原始内容
+	Detail  string // 说明（可为空）
+}
+
+// Inspection 单个规则文件的诊断结果（--inspect）
+type Inspection struct {
+	Source    string       // 文件路径或 URL
+	Info      RuleFileInfo // analyzeRuleFile 的分析结果（规则行数、示例）
+	Lines     int          // 总行数
+	Parsed    int          // 解析为规则的行数
+	TypeCount map[RuleType]int
+
+	UnknownTypes  map[RuleType]int // 解析成功但不是已知规则类型
+	Unparsed      []InspectLine    // 不是注释、但没有被解析为规则的行（最多 inspectMaxLines 条）
+	UnparsedCount int
+	ParseErrors   []InspectLine // 解析失败的行（最多 inspectMaxLines 条）
+	LintIssues    []LintIssue   // 可疑规则
+	Metadata      FileMetadata  // 文件头部的元数据注释
+
+	First []string // 前几条解析成功的规则
+	Last  []string // 最后几条解析成功的规则
+}
+
+// InspectRuleFile 诊断单个规则文件：复用 AI 分类的文件分析和规则解析，统计各类型规则数量、
+// 无法解析的行和可疑规则。source 只用于显示（如下载前的 URL），exampleCount 为首尾示例数量
+func InspectRuleFile(filePath string, source string, exampleCount int) (*Inspection, error) {
+	info, err := analyzeRuleFile(filePath, exampleCount, "")
+	if err != nil {
+		return nil, fmt.Errorf("分析规则文件失败: %w", err)
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	inspection := &Inspection{
+		Source:       source,
+		Info:         info,
+		TypeCount:    make(map[RuleType]int),
+		UnknownTypes: make(map[RuleType]int),
+		Metadata:     *newFileMetadata("", source),
+	}
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		inspection.Lines++
+		text := scanner.Text()
+		line := strings.TrimSpace(text)
+
+		rule, err := ParseRule(text)
+		if err != nil {
+			if len(inspection.ParseErrors) < inspectMaxLines {
+				inspection.ParseErrors = append(inspection.ParseErrors, InspectLine{Line: inspection.Lines, Content: line, Detail: err.Error()})
+			}
+			continue
+		}
+		if rule == nil {
+			inspection.Metadata.parseComment(text)
+			// analyzeRuleFile 计为规则、但解析器跳过的行（如纯域名列表、YAML 字段）
+			if line != "" && !strings.HasPrefix(line, "#") && !strings.HasPrefix(line, "//") {
+				inspection.UnparsedCount++
+				if len(inspection.Unparsed) < inspectMaxLines {
+					inspection.Unparsed = append(inspection.Unparsed, InspectLine{Line: inspection.Lines, Content: line})
+				}
+			}
+			continue
+		}
+
+		inspection.Parsed++
+		inspection.TypeCount[rule.Type]++
+		inspection.Metadata.countRule(rule.Type)
+		if !knownRuleTypes[rule.Type] {
+			inspection.UnknownTypes[rule.Type]++
+		}
+		if problem, suggestion := LintRule(*rule); problem != "" {
+			inspection.LintIssues = append(inspection.LintIssues, LintIssue{
+				Source: source, Line: inspection.Lines, Rule: line, Problem: problem, Suggestion: suggestion,
+			})
+		}
+
+		formatted := string(rule.Type) + "," + rule.String()
+		if len(inspection.First) < exampleCount {
+			inspection.First = append(inspection.First, formatted)
+		}
+		inspection.Last = append(inspection.Last, formatted)
+		if len(inspection.Last) > exampleCount {
+			inspection.Last = inspection.Last[1:]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取规则文件失败: %w", err)
+	}
+
+	return inspection, nil
+}
+
+// WriteReport 输出可读的诊断报告
+func (i *Inspection) WriteReport(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "来源: %s\n", i.Source)
+	fmt.Fprintf(bw, "总行数: %d，规则行（非空、非注释）: %d，解析为规则: %d\n", i.Lines, i.Info.RuleCount, i.Parsed)
+
+	if len(i.TypeCount) > 0 {
+		fmt.Fprintln(bw, "\n规则类型:")
+		types := make([]RuleType, 0, len(i.TypeCount))
+		for ruleType := range i.TypeCount {
+			types = append(types, ruleType)
+		}
+		sort.Slice(types, func(a, b int) bool {
+			if i.TypeCount[types[a]] != i.TypeCount[types[b]] {
+				return i.TypeCount[types[a]] > i.TypeCount[types[b]]
+			}
+			return types[a] < types[b]
+		})
+		for _, ruleType := range types {
+			marker := ""
+			if i.UnknownTypes[ruleType] > 0 {
+				marker = "（未知类型）"
+			}
+			fmt.Fprintf(bw, "  %-20s %d%s\n", ruleType, i.TypeCount[ruleType], marker)
+		}
+	}
+
+	writeExamples := func(title string, examples []string) {
+		if len(examples) == 0 {
+			return
+		}
+		fmt.Fprintf(bw, "\n%s:\n", title)
+		for _, example := range examples {
+			fmt.Fprintf(bw, "  %s\n", example)
+		}
+	}
+	writeExamples("开头的规则", i.First)
+	if i.Parsed > len(i.First) {
+		// 规则数量不超过示例数量时首尾示例相同，只输出一次
+		writeExamples("结尾的规则", i.Last)
+	}
+
+	if mismatches := i.Metadata.Mismatches(); len(mismatches) > 0 {
+		fmt.Fprintln(bw, "\n元数据声明的数量与实际不一致:")
+		for _, mismatch := range mismatches {
+			fmt.Fprintf(bw, "  %s: 声明 %d 条，实际解析 %d 条\n", mismatch.Field, mismatch.Declared, mismatch.Parsed)
+		}
+	}
+
+	var warnings int
+	if i.UnparsedCount > 0 {
+		warnings++
+		fmt.Fprintf(bw, "\n警告: %d 行不是注释但没有被解析为规则（规则需要 TYPE,内容 格式），前 %d 行:\n", i.UnparsedCount, len(i.Unparsed))
+		for _, line := range i.Unparsed {
+			fmt.Fprintf(bw, "  %d: %s\n", line.Line, line.Content)
+		}
+	}
+	if len(i.ParseErrors) > 0 {
+		warnings++
+		fmt.Fprintln(bw, "\n警告: 解析失败的行:")
+		for _, line := range i.ParseErrors {
+			fmt.Fprintf(bw, "  %d: %s (%s)\n", line.Line, line.Content, line.Detail)
+		}
+	}
+	if len(i.UnknownTypes) > 0 {
+		warnings++
+		fmt.Fprintf(bw, "\n警告: %d 种未知的规则类型，客户端可能无法识别\n", len(i.UnknownTypes))
+	}
+	if len(i.LintIssues) > 0 {
+		warnings++
+		fmt.Fprintf(bw, "\n警告: %d 条可疑规则:\n", len(i.LintIssues))
+		for _, issue := range i.LintIssues {
+			msg := fmt.Sprintf("  %d: %s: %s", issue.Line, issue.Rule, issue.Problem)
+			if issue.Suggestion != "" {
+				msg += "，建议改为 " + issue.Suggestion
+			}
+			fmt.Fprintln(bw, msg)
+		}
+	}
+	if i.Parsed == 0 {
+		warnings++
+		fmt.Fprintln(bw, "\n警告: 没有解析到任何规则")
+	}
+	if warnings == 0 {
+		fmt.Fprintln(bw, "\n没有发现问题")
+	}
+	return bw.Flush()
+}
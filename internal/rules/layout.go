@@ -0,0 +1,62 @@
+package rules
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+
+	"rulerefinery/internal/config"
+)
+
+// mihomo 以外的导出格式和无效规则报告在 by_behavior 布局中的目录名，也是 by_ruleset 布局中文件名的后缀
+const (
+	exportGroupSurge   = "surge"
+	exportGroupSingbox = "singbox"
+	exportGroupQuanX   = "quanx"
+	exportGroupInvalid = "invalid"
+)
+
+// exportGroupLicenses by_behavior 布局中来源许可证文件的目录名
+const exportGroupLicenses = "licenses"
+
+// ExportGroups 返回 by_behavior 布局下输出目录中可能出现的全部子目录（各导出类型、额外导出格式、无效规则报告和来源许可证）
+func ExportGroups() []string {
+	groups := append([]string(nil), ExportKinds...)
+	return append(groups, exportGroupSurge, exportGroupSingbox, exportGroupQuanX, exportGroupInvalid, exportGroupLicenses)
+}
+
+// SetLayout 设置导出的目录结构：config.LayoutByRuleset（默认，每个规则集一个目录）
+// 或 config.LayoutByBehavior（每个导出类型一个目录，其中每个规则集一个文件）
+func (o *Optimizer) SetLayout(layout string) {
+	o.layout = layout
+}
+
+// ExportRelPath 返回规则集导出文件相对于输出目录的路径（以 / 分隔）
+// group 为导出类型（如 domain）或额外导出格式（如 surge），ext 为扩展名：
+//   - by_ruleset:  {name}/{name}_{group}{ext}
+//   - by_behavior: {group}/{name}{ext}
+func ExportRelPath(layout, name, group, ext string) string {
+	if layout == config.LayoutByBehavior {
+		return path.Join(group, name+ext)
+	}
+	return path.Join(name, name+"_"+group+ext)
+}
+
+// LicensesRelPath 返回规则集来源许可证文件相对于输出目录的路径（以 / 分隔）：
+//   - by_ruleset:  {name}/LICENSES.txt
+//   - by_behavior: licenses/{name}.txt
+func LicensesRelPath(layout, name string) string {
+	if layout == config.LayoutByBehavior {
+		return path.Join(exportGroupLicenses, name+".txt")
+	}
+	return path.Join(name, "LICENSES.txt")
+}
+
+// exportPath 返回规则集导出文件的路径，并创建所在目录
+func (o *Optimizer) exportPath(outputDir, name, group, ext string) (string, error) {
+	filePath := filepath.Join(outputDir, filepath.FromSlash(ExportRelPath(o.layout, name, group, ext)))
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return "", err
+	}
+	return filePath, nil
+}
@@ -0,0 +1,167 @@
+package rules
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// LintIssue 规则检查发现的问题
+// 这类规则语法合法，但在 domain 规则集中不会匹配任何有意义的内容，通常是上游笔误
+type LintIssue struct {
+	Ruleset    string // 规则集名称
+	Source     string // 规则来源（文件路径或 URL）
+	Line       int    // 行号（从 1 开始）
+	Rule       string // 原始规则
+	Problem    string // 问题说明
+	Suggestion string // 建议修正（无法给出时为空）
+}
+
+// String 格式化问题说明
+func (i LintIssue) String() string {
+	msg := fmt.Sprintf("%s:%d [%s] %s: %s", i.Source, i.Line, i.Ruleset, i.Rule, i.Problem)
+	if i.Suggestion != "" {
+		msg += fmt.Sprintf("，建议改为 %s", i.Suggestion)
+	}
+	return msg
+}
+
+// LintRule 检查单条规则
+// 检查项：
+//   - DOMAIN 的 payload 包含 *、/、: 或空格（应为 DOMAIN-SUFFIX/DOMAIN-WILDCARD、URL 或 host:port 写法）
+//   - DOMAIN-SUFFIX 的 payload 包含 *
+//
+// 返回问题说明和建议修正，无问题时 problem 为空
+func LintRule(rule Rule) (problem string, suggestion string) {
+	payload := rule.Payload
+
+	switch rule.Type {
+	case RuleTypeDomain:
+		switch {
+		case strings.ContainsAny(payload, " \t"):
+			fixed := strings.Join(strings.Fields(payload), "")
+			return "DOMAIN 包含空格", formatSuggestion(RuleTypeDomain, fixed, rule.Options)
+		case strings.Contains(payload, "*"):
+			if rest, ok := strings.CutPrefix(payload, "*."); ok && !strings.Contains(rest, "*") {
+				return "DOMAIN 包含通配符 *", formatSuggestion(RuleTypeDomainSuffix, rest, rule.Options)
+			}
+			return "DOMAIN 包含通配符 *", formatSuggestion(RuleTypeDomainWildcard, payload, rule.Options)
+		case strings.Contains(payload, "/"):
+			return "DOMAIN 包含路径（规则只匹配域名，不匹配 URL）", formatSuggestion(RuleTypeDomain, urlHost(payload), rule.Options)
+		case strings.Contains(payload, ":"):
+			if addr, err := netip.ParseAddr(payload); err == nil {
+				ruleType, bits := RuleTypeIPCIDR, 32
+				if addr.Is6() {
+					ruleType, bits = RuleTypeIPCIDR6, 128
+				}
+				return "DOMAIN 的内容是 IP 地址", formatSuggestion(ruleType, fmt.Sprintf("%s/%d", addr, bits), rule.Options)
+			}
+			host := payload[:strings.Index(payload, ":")]
+			return "DOMAIN 包含端口（规则只匹配域名）", formatSuggestion(RuleTypeDomain, host, rule.Options)
+		}
+	case RuleTypeDomainSuffix:
+		if strings.Contains(payload, "*") {
+			rest := strings.TrimPrefix(strings.TrimPrefix(payload, "*"), ".")
+			if rest != "" && !strings.Contains(rest, "*") {
+				return "DOMAIN-SUFFIX 包含通配符 *（后缀匹配已包含所有子域名）", formatSuggestion(RuleTypeDomainSuffix, rest, rule.Options)
+			}
+			return "DOMAIN-SUFFIX 包含通配符 *", formatSuggestion(RuleTypeDomainWildcard, payload, rule.Options)
+		}
+	}
+
+	return "", ""
+}
+
+// AutofixRule 修正安全、无歧义的常见上游错误
+// 修正项：
+//   - DOMAIN,*.x → DOMAIN-SUFFIX,x；DOMAIN-SUFFIX,*.x → DOMAIN-SUFFIX,x
+//   - 域名类规则去除末尾的 "."（FQDN 写法）
+//   - 域名类规则去除 payload 中的空白字符
+//
+// 缺少掩码的 CIDR 已在去重时统一补全，这里不再处理；
+// 有歧义的情况（如 DOMAIN 包含路径、端口或中间的通配符）只由 LintRule 报告，不自动修改。
+// 返回修正后的规则和修正说明，未修正时 fixes 为空
+func AutofixRule(rule Rule) (fixed Rule, fixes []string) {
+	fixed = rule
+
+	switch fixed.Type {
+	case RuleTypeDomain, RuleTypeDomainSuffix, RuleTypeDomainKeyword:
+	default:
+		return fixed, nil
+	}
+
+	if strings.ContainsAny(fixed.Payload, " \t") {
+		fixed.Payload = strings.Join(strings.Fields(fixed.Payload), "")
+		fixes = append(fixes, "去除空白字符")
+	}
+
+	if fixed.Type != RuleTypeDomainKeyword {
+		if trimmed := strings.TrimRight(fixed.Payload, "."); trimmed != fixed.Payload && trimmed != "" {
+			fixed.Payload = trimmed
+			fixes = append(fixes, "去除末尾的 .")
+		}
+
+		if rest, ok := strings.CutPrefix(fixed.Payload, "*."); ok && rest != "" && !strings.Contains(rest, "*") {
+			if fixed.Type == RuleTypeDomain {
+				fixes = append(fixes, "DOMAIN,*.x 改为 DOMAIN-SUFFIX,x")
+			} else {
+				fixes = append(fixes, "DOMAIN-SUFFIX 去除多余的 *.")
+			}
+			fixed.Type = RuleTypeDomainSuffix
+			fixed.Payload = rest
+		}
+	}
+
+	return fixed, fixes
+}
+
+// urlHost 从 URL 或 "域名/路径" 中提取域名
+func urlHost(payload string) string {
+	if idx := strings.Index(payload, "://"); idx != -1 {
+		payload = payload[idx+3:]
+	}
+	if idx := strings.IndexAny(payload, "/?#"); idx != -1 {
+		payload = payload[:idx]
+	}
+	if idx := strings.LastIndex(payload, ":"); idx != -1 && !strings.Contains(payload[:idx], ":") {
+		payload = payload[:idx]
+	}
+	return payload
+}
+
+// formatSuggestion 格式化建议修正的规则
+func formatSuggestion(ruleType RuleType, payload string, options []string) string {
+	if payload == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s,%s", ruleType, Rule{Payload: payload, Options: options}.String())
+}
+
+// LintIssues 返回加载规则时发现的问题（按加载顺序）
+func (o *Optimizer) LintIssues() []LintIssue {
+	return o.lintIssues
+}
+
+// SetAutofix 设置是否在加载时自动修正安全的常见错误（见 AutofixRule）
+// 必须在 LoadRuleFile 之前设置
+func (o *Optimizer) SetAutofix(enabled bool) {
+	o.autofix = enabled
+}
+
+// AutofixCount 返回加载时自动修正的规则数量
+func (o *Optimizer) AutofixCount() int {
+	return o.autofixCount
+}
+
+// LogLintIssues 将规则检查问题输出到日志
+func LogLintIssues(issues []LintIssue) {
+	if len(issues) == 0 {
+		return
+	}
+	log.Warn().Msgf("规则检查发现 %d 条可疑规则（语法合法但不会匹配有意义的内容）:", len(issues))
+	for _, issue := range issues {
+		log.Warn().Msgf("  %s", issue)
+	}
+}
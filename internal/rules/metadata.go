@@ -0,0 +1,151 @@
+package rules
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// metadataTotalKey 声明规则总数的元数据字段
+const metadataTotalKey = "TOTAL"
+
+// FileMetadata 规则文件头部的元数据注释
+// 部分上游规则文件（如 blackmatrix7/ios_rule_script）以注释声明规则数量：
+//
+//	# NAME: Google
+//	# DOMAIN-SUFFIX: 500
+//	# TOTAL: 525
+//
+// 与实际解析数量对比，可以发现下载被截断的文件
+type FileMetadata struct {
+	Ruleset string            // 规则集名称
+	Source  string            // 规则来源（文件路径或 URL）
+	Fields  map[string]string // 元数据字段（key 统一为大写）
+
+	Parsed       int              // 实际解析的规则数量
+	ParsedByType map[RuleType]int // 各类型实际解析的规则数量
+}
+
+// MetadataMismatch 元数据声明的数量与实际解析数量不一致
+type MetadataMismatch struct {
+	Ruleset  string // 规则集名称
+	Source   string // 规则来源
+	Field    string // 元数据字段（TOTAL 或规则类型）
+	Declared int    // 声明的数量
+	Parsed   int    // 实际解析的数量
+}
+
+// String 格式化不一致说明
+func (m MetadataMismatch) String() string {
+	msg := fmt.Sprintf("%s [%s] %s: 声明 %d 条，实际解析 %d 条", m.Source, m.Ruleset, m.Field, m.Declared, m.Parsed)
+	if m.Parsed < m.Declared {
+		msg += "（文件可能被截断）"
+	}
+	return msg
+}
+
+// newFileMetadata 创建文件元数据
+func newFileMetadata(ruleSetName, source string) *FileMetadata {
+	return &FileMetadata{
+		Ruleset:      ruleSetName,
+		Source:       source,
+		Fields:       make(map[string]string),
+		ParsedByType: make(map[RuleType]int),
+	}
+}
+
+// parseComment 解析 "# KEY: value" 格式的元数据注释，其他注释忽略
+// 只接受由字母、数字、- 和 _ 组成的 key，避免把普通注释误认为元数据
+func (m *FileMetadata) parseComment(line string) {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "#") {
+		return
+	}
+	key, value, ok := strings.Cut(strings.TrimSpace(strings.TrimLeft(line, "#")), ":")
+	if !ok {
+		return
+	}
+	key = strings.ToUpper(strings.TrimSpace(key))
+	value = strings.TrimSpace(value)
+	if key == "" || value == "" || strings.IndexFunc(key, func(r rune) bool {
+		return !(r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_')
+	}) != -1 {
+		return
+	}
+	// 同一字段只取第一次出现的值（文件头部）
+	if _, exists := m.Fields[key]; !exists {
+		m.Fields[key] = value
+	}
+}
+
+// countRule 记录一条实际解析的规则
+func (m *FileMetadata) countRule(ruleType RuleType) {
+	m.Parsed++
+	m.ParsedByType[ruleType]++
+}
+
+// Mismatches 对比声明数量与实际解析数量
+// 检查 TOTAL 和各规则类型（如 DOMAIN-SUFFIX）字段；值不是整数的字段忽略
+func (m FileMetadata) Mismatches() []MetadataMismatch {
+	var mismatches []MetadataMismatch
+	check := func(field string, parsed int) {
+		value, ok := m.Fields[field]
+		if !ok {
+			return
+		}
+		declared, err := strconv.Atoi(strings.ReplaceAll(value, ",", ""))
+		if err != nil || declared == parsed {
+			return
+		}
+		mismatches = append(mismatches, MetadataMismatch{
+			Ruleset:  m.Ruleset,
+			Source:   m.Source,
+			Field:    field,
+			Declared: declared,
+			Parsed:   parsed,
+		})
+	}
+
+	check(metadataTotalKey, m.Parsed)
+	for _, ruleType := range classicalTypeOrder {
+		check(string(ruleType), m.ParsedByType[ruleType])
+	}
+	return mismatches
+}
+
+// SetMetadataCheck 设置是否在加载时解析文件头部的元数据注释
+// 必须在 LoadRuleFile 之前设置
+func (o *Optimizer) SetMetadataCheck(enabled bool) {
+	o.checkMetadata = enabled
+}
+
+// FileMetadata 返回已加载文件的元数据（按加载顺序，仅包含声明了元数据的文件）
+func (o *Optimizer) FileMetadata() []FileMetadata {
+	return o.fileMetadata
+}
+
+// MetadataMismatches 返回所有文件中声明数量与实际解析数量不一致的项（按来源排序）
+func (o *Optimizer) MetadataMismatches() []MetadataMismatch {
+	var mismatches []MetadataMismatch
+	for _, metadata := range o.fileMetadata {
+		mismatches = append(mismatches, metadata.Mismatches()...)
+	}
+	sort.SliceStable(mismatches, func(i, j int) bool {
+		return mismatches[i].Source < mismatches[j].Source
+	})
+	return mismatches
+}
+
+// LogMetadataMismatches 将元数据不一致项输出到日志
+func LogMetadataMismatches(mismatches []MetadataMismatch) {
+	if len(mismatches) == 0 {
+		return
+	}
+	log.Warn().Msgf("%d 项规则数量与文件元数据声明不一致:", len(mismatches))
+	for _, mismatch := range mismatches {
+		log.Warn().Msgf("  %s", mismatch)
+	}
+}
@@ -3,14 +3,18 @@ package rules
 import (
 	"bufio"
 	"fmt"
+	"io"
+	"net/netip"
 	"os"
 	"path/filepath"
+	"runtime"
 	"sort"
 	"strings"
+	"sync"
 
 	"github.com/rs/zerolog/log"
 
-	"github.com/bmatcuk/doublestar/v4"
+	"rulerefinery/internal/config"
 )
 
 // RuleType 规则类型（基于 Mihomo）
@@ -65,31 +69,114 @@ const (
 type Rule struct {
 	Type    RuleType
 	Payload string
-	Options string // 可选参数，如 no-resolve
+	Options []string // 可选参数（按原顺序），如 no-resolve、src
+	Policy  string   // 完整规则行中的策略（如 DOMAIN-SUFFIX,example.com,Proxy 中的 Proxy），没有时为空
+}
+
+// String 返回规则的 payload、策略及参数（不含类型），即存储在 RuleSet 中的格式
+// 策略写在参数之前（与 Mihomo 配置中的 rules 写法一致）
+func (r Rule) String() string {
+	parts := []string{r.Payload}
+	if r.Policy != "" {
+		parts = append(parts, r.Policy)
+	}
+	return strings.Join(append(parts, r.Options...), ",")
 }
 
 // RuleSet 规则集
 type RuleSet struct {
 	Name     string                // 规则集名称（如 facebook）
 	Rules    map[RuleType][]string // 按类型分类的规则
-	Filters  []string              // 规则内容过滤器（glob 模式，白名单）
+	Filters  []string              // 规则内容过滤器（glob 模式，白名单；! 开头为否定模式）
 	Excludes []string              // 排除的规则内容（glob 模式，黑名单）
+
+	AllowTLDs         []string // 域名类规则只保留以这些顶级域名/域名结尾的规则（规范化后，在 Filters 之前应用）
+	ExcludePrivateIPs bool     // 移除私有/保留地址段内的 IP-CIDR/IP-CIDR6 规则（在 Filters 之前应用）
+
+	filterMatchers  []globMatcher // 预编译的 Filters（首次使用时编译，所有导出格式复用）
+	excludeMatchers []globMatcher // 预编译的 Excludes
+
+	filtered map[RuleType][]string // 各类型应用 Filters/Excludes 后的规则（导出时缓存，所有导出格式复用，只读）
+
+	dedupRemoved int // Deduplicate 移除的规则数量（多次去重时累计）
+
+	sources     []string           // 提供规则的来源（SetTrackSources 启用时记录，按加载顺序）
+	sourceIndex map[string]int     // 来源 -> sources 中的序号
+	ruleSources map[string][]int   // 规则（sourceKey）-> 提供该规则的来源序号
+	typeSources map[RuleType][]int // 规则类型 -> 提供该类型规则的来源序号
+
+	OutputFormats []string // 额外导出的格式（config.OutputFormat*），为空时按全局设置
+	Policy        string   // Quantumult X 导出中规则使用的策略（为空时为 PROXY）
 }
 
 // Optimizer 规则优化器
 type Optimizer struct {
-	ruleSets map[string]*RuleSet
+	ruleSets     map[string]*RuleSet
+	transformers []RuleTransformer // 规则转换器（加载时按注册顺序执行）
+	lintIssues   []LintIssue       // 加载时发现的可疑规则
+	invalidRules []InvalidRule     // 加载时丢弃的无效规则（如掩码超出范围的网段）
+	autofix      bool              // 加载时自动修正安全的常见错误
+	autofixCount int               // 自动修正的规则数量
+
+	ruleOptions  map[string]bool // 识别为规则参数的字段（小写），payload 之后的其他字段视为策略
+	appendPolicy bool            // classical 输出中保留规则行中的策略
+	policyCount  int             // 加载时识别出策略的规则数量
+
+	domainListFiles map[string]bool // 按纯域名列表解析的文件（没有规则类型的行推断为 DOMAIN/DOMAIN-SUFFIX）
+
+	collapseSubdomains bool // 去重时移除已被同一规则集中上级 DOMAIN-SUFFIX 覆盖的域名规则
+	mergeCIDRs         bool // 去重时合并被包含的网段和相邻的同级网段
+	mergePorts         bool // 去重时合并连续或重叠的端口和端口范围
+
+	traceRule string // 追踪的规则内容（小写，不含类型和参数），过滤时记录该规则与每个 filter/exclude 的匹配结果
+
+	suffixMode            string          // 导出 domain 时 DOMAIN-SUFFIX 的写法：plus（默认）/dot/preserve
+	wildcardAsRegex       bool            // 导出 classical 时将 DOMAIN-WILDCARD 转换为 DOMAIN-REGEX
+	domainIncludeWildcard bool            // 导出 domain 时包含可以用 domain behavior 语法表示的 DOMAIN-WILDCARD
+	exportLogged          map[string]bool // 导出时已记录日志的事项（同一规则集会多次导出，避免重复日志）
+
+	checkMetadata bool           // 加载时解析文件头部的元数据注释（如 # TOTAL: 1234）
+	trackSources  bool           // 加载时记录每条规则来自的来源（ContributingSources）
+	fileMetadata  []FileMetadata // 已加载文件的元数据（仅包含声明了元数据的文件）
+
+	listExt string // 纯文本格式文件扩展名（默认 .list）
+	yamlExt string // YAML 格式文件扩展名（默认 .yaml）
+
+	exportCounts map[string]map[string]int // Export 写入的规则数量：规则集 -> 导出类型 -> 数量
+
+	singboxExport bool   // Export 时额外导出 sing-box source 格式规则集（{name}_singbox.json）
+	invalidReport bool   // Export 时为包含无效规则的规则集生成报告（{name}_invalid.txt）
+	layout        string // 导出的目录结构（config.LayoutByRuleset/LayoutByBehavior，为空时按规则集）
+}
+
+// logOnce 同一 key 只返回一次 true，用于导出阶段避免重复日志
+func (o *Optimizer) logOnce(key string) bool {
+	if o.exportLogged[key] {
+		return false
+	}
+	if o.exportLogged == nil {
+		o.exportLogged = make(map[string]bool)
+	}
+	o.exportLogged[key] = true
+	return true
 }
 
 // NewOptimizer 创建优化器
 func NewOptimizer() *Optimizer {
 	return &Optimizer{
-		ruleSets: make(map[string]*RuleSet),
+		ruleSets:    make(map[string]*RuleSet),
+		ruleOptions: defaultOptionSet,
+		mergeCIDRs:  true,
 	}
 }
 
-// ParseRule 解析单条规则
+// ParseRule 解析单条规则，payload 之后不属于 DefaultRuleOptions 的字段识别为策略
 func ParseRule(line string) (*Rule, error) {
+	return parseRule(line, defaultOptionSet)
+}
+
+// parseRule 解析单条规则，options 为识别为规则参数的字段（小写）
+func parseRule(line string, options map[string]bool) (*Rule, error) {
 	line = strings.TrimSpace(line)
 
 	// 跳过空行
@@ -146,10 +233,20 @@ func ParseRule(line string) (*Rule, error) {
 		Payload: strings.TrimSpace(parts[1]),
 	}
 
-	// 处理可选参数（如 no-resolve）
-	if len(parts) > 2 {
-		rule.Options = strings.TrimSpace(parts[2])
+	// 逻辑规则的 payload 本身包含逗号
+	extra := parts[2:]
+	if payload, rest, ok := splitLogicPayload(strings.TrimSpace(strings.Join(parts[1:], ","))); ok {
+		rule.Payload, extra = payload, rest
+	}
+
+	// 处理策略和可选参数（如 no-resolve、src），保留所有参数及其顺序
+	var fields []string
+	for _, field := range extra {
+		if field = strings.TrimSpace(field); field != "" {
+			fields = append(fields, field)
+		}
 	}
+	rule.Policy, rule.Options = splitPolicy(fields, options)
 
 	return rule, nil
 }
@@ -162,6 +259,12 @@ func (o *Optimizer) LoadRuleFile(filePath string, ruleSetName string) error {
 	}
 	defer file.Close()
 
+	return o.LoadRules(file, ruleSetName, filePath)
+}
+
+// LoadRules 从 io.Reader 加载规则（如 os.Stdin）
+// source 仅用于日志输出
+func (o *Optimizer) LoadRules(r io.Reader, ruleSetName string, source string) error {
 	// 确保规则集存在
 	if o.ruleSets[ruleSetName] == nil {
 		o.ruleSets[ruleSetName] = &RuleSet{
@@ -169,29 +272,111 @@ func (o *Optimizer) LoadRuleFile(filePath string, ruleSetName string) error {
 			Rules: make(map[RuleType][]string),
 		}
 	}
+	o.ruleSets[ruleSetName].filtered = nil
+
+	var metadata *FileMetadata
+	if o.checkMetadata {
+		metadata = newFileMetadata(ruleSetName, source)
+	}
 
-	scanner := bufio.NewScanner(file)
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	policyRules := 0
+	domainList := o.domainListFiles[source]
+	inferredRules := 0
 	for scanner.Scan() {
-		rule, err := ParseRule(scanner.Text())
+		lineNum++
+		rule, err := parseRule(scanner.Text(), o.ruleOptions)
 		if err != nil {
 			// 记录错误但继续处理
-			log.Warn().Msgf("%v (文件: %s)", err, filePath)
+			log.Warn().Msgf("%v (文件: %s)", err, source)
 			continue
 		}
+		if rule == nil && domainList {
+			if rule = parseDomainListLine(scanner.Text()); rule != nil {
+				inferredRules++
+			}
+		}
 		if rule == nil {
+			if metadata != nil {
+				metadata.parseComment(scanner.Text())
+			}
 			continue
 		}
+		if metadata != nil {
+			metadata.countRule(rule.Type)
+		}
+		if rule.Policy != "" {
+			policyRules++
+			if !o.appendPolicy {
+				rule.Policy = ""
+			}
+		}
 
-		// 添加规则到对应类型
+		// 自动修正安全的常见错误
+		if o.autofix {
+			if fixed, fixes := AutofixRule(*rule); len(fixes) > 0 {
+				log.Info().Msgf("自动修正规则 %s:%d: %s → %s (%s)", source, lineNum,
+					strings.TrimSpace(scanner.Text()), formatSuggestion(fixed.Type, fixed.Payload, fixed.Options), strings.Join(fixes, "，"))
+				o.autofixCount++
+				rule = &fixed
+			}
+		}
+
+		// 丢弃 Mihomo 无法解析的网段（如 192.168.0.0/33、10.0.0.0/x），否则整个规则集在运行时加载失败
+		if problem := validateCIDR(rule.Type, rule.Payload); problem != "" {
+			o.invalidRules = append(o.invalidRules, InvalidRule{
+				Ruleset: ruleSetName,
+				Source:  source,
+				Line:    lineNum,
+				Rule:    strings.TrimSpace(scanner.Text()),
+				Problem: problem,
+			})
+			continue
+		}
+
+		// 检查可疑规则（只记录，不修改）
+		if problem, suggestion := LintRule(*rule); problem != "" {
+			o.lintIssues = append(o.lintIssues, LintIssue{
+				Ruleset:    ruleSetName,
+				Source:     source,
+				Line:       lineNum,
+				Rule:       strings.TrimSpace(scanner.Text()),
+				Problem:    problem,
+				Suggestion: suggestion,
+			})
+		}
+
+		// 应用转换器后添加规则到对应类型
 		ruleSet := o.ruleSets[ruleSetName]
-		payload := rule.Payload
-		if rule.Options != "" {
-			payload = fmt.Sprintf("%s,%s", rule.Payload, rule.Options)
+		for _, transformed := range o.applyTransformers(*rule) {
+			content := transformed.String()
+			ruleSet.Rules[transformed.Type] = append(ruleSet.Rules[transformed.Type], content)
+			if o.trackSources {
+				ruleSet.recordSource(source, transformed.Type, content)
+			}
 		}
-		ruleSet.Rules[rule.Type] = append(ruleSet.Rules[rule.Type], payload)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
 	}
 
-	return scanner.Err()
+	if inferredRules > 0 {
+		log.Info().Msgf("规则集 '%s': %s 按纯域名列表解析 %d 条规则", ruleSetName, source, inferredRules)
+	}
+	if policyRules > 0 {
+		o.policyCount += policyRules
+		if o.appendPolicy {
+			log.Info().Msgf("规则集 '%s': %s 中 %d 条规则带有策略，classical 输出中保留", ruleSetName, source, policyRules)
+		} else {
+			log.Info().Msgf("规则集 '%s': %s 中 %d 条规则带有策略，已移除（rule-provider 中的规则不能带策略）", ruleSetName, source, policyRules)
+		}
+	}
+
+	if metadata != nil && len(metadata.Fields) > 0 {
+		o.fileMetadata = append(o.fileMetadata, *metadata)
+	}
+	return nil
 }
 
 // SetRulesetFilters 设置规则集的过滤器和排除规则
@@ -203,6 +388,9 @@ func (o *Optimizer) SetRulesetFilters(ruleSetName string, filters []string, excl
 
 	ruleSet.Filters = filters
 	ruleSet.Excludes = excludes
+	ruleSet.filterMatchers = compileFilterGlobs(filters)
+	ruleSet.excludeMatchers = compileGlobs(excludes)
+	ruleSet.filtered = nil
 
 	if len(filters) > 0 {
 		log.Info().Msgf("规则集 '%s': 已配置 %d 个过滤器", ruleSetName, len(filters))
@@ -214,28 +402,193 @@ func (o *Optimizer) SetRulesetFilters(ruleSetName string, filters []string, excl
 	return nil
 }
 
+// SetTraceRule 设置追踪的规则内容（如 www.example.com，不含类型和参数，不区分大小写）
+// 过滤时该规则与每个 filters/excludes 模式的匹配结果都记录到 info 日志，不受示例数量限制；为空时不追踪
+func (o *Optimizer) SetTraceRule(payload string) {
+	o.traceRule = strings.ToLower(strings.TrimSpace(payload))
+}
+
+// isTraced 判断规则（不含类型）是否为追踪的规则
+func (o *Optimizer) isTraced(rule string) bool {
+	return o.traceRule != "" && strings.ToLower(strings.TrimSpace(stripOptions(rule))) == o.traceRule
+}
+
+// traceGlobs 记录追踪的规则与每个模式的匹配结果
+// kind 为 filter 时按 filters 语义（含 ! 否定模式）判断结果，为 exclude 时匹配任一模式即移除
+func (o *Optimizer) traceGlobs(ruleSetName, kind string, matchers []globMatcher, fullRule string) {
+	for _, m := range matchers {
+		result := "不匹配"
+		if m.Match(fullRule) {
+			result = "匹配"
+		}
+		log.Info().Msgf("[追踪] 规则集 '%s': %s '%s' 对 %s: %s", ruleSetName, kind, m, fullRule, result)
+	}
+
+	if kind == "filter" {
+		kept, idx := matchFilters(matchers, fullRule)
+		switch {
+		case kept && idx >= 0:
+			log.Info().Msgf("[追踪] 规则集 '%s': %s 保留（匹配 filter '%s'）", ruleSetName, fullRule, matchers[idx])
+		case kept:
+			log.Info().Msgf("[追踪] 规则集 '%s': %s 保留（没有匹配任何否定 filter）", ruleSetName, fullRule)
+		case idx >= 0:
+			log.Info().Msgf("[追踪] 规则集 '%s': %s 被移除（匹配否定 filter '%s'）", ruleSetName, fullRule, matchers[idx])
+		default:
+			log.Info().Msgf("[追踪] 规则集 '%s': %s 被移除（没有匹配任何 filter）", ruleSetName, fullRule)
+		}
+		return
+	}
+
+	if idx := matchAnyGlob(matchers, fullRule); idx >= 0 {
+		log.Info().Msgf("[追踪] 规则集 '%s': %s 被移除（匹配 exclude '%s'）", ruleSetName, fullRule, matchers[idx])
+	} else {
+		log.Info().Msgf("[追踪] 规则集 '%s': %s 保留（没有匹配任何 exclude）", ruleSetName, fullRule)
+	}
+}
+
 // Deduplicate 去重并排序
+// 各规则类型互不影响，按 (规则集, 类型) 拆分后由有限数量的 worker 并行处理，
+// 每个任务只写入自己的结果槽位，全部完成后再统一写回规则集。
+// 启用 SetCollapseSubdomains 时，随后移除各规则集中已被上级 DOMAIN-SUFFIX 覆盖的域名规则
 func (o *Optimizer) Deduplicate() {
-	for _, ruleSet := range o.ruleSets {
-		for ruleType, rules := range ruleSet.Rules {
-			// 使用 map 去重
-			uniqueRules := make(map[string]bool)
-			for _, rule := range rules {
-				uniqueRules[rule] = true
+	type dedupTask struct {
+		ruleSet  *RuleSet
+		ruleType RuleType
+		rules    []string
+	}
+
+	var tasks []dedupTask
+	before := make(map[*RuleSet]int, len(o.ruleSets))
+	// 按规则集名称和类型顺序生成任务，去重日志的顺序在多次运行间保持一致
+	for _, name := range o.RulesetNames() {
+		ruleSet := o.ruleSets[name]
+		for _, ruleType := range sortedRuleTypes(ruleSet.Rules) {
+			rules := ruleSet.Rules[ruleType]
+			tasks = append(tasks, dedupTask{ruleSet: ruleSet, ruleType: ruleType, rules: rules})
+			before[ruleSet] += len(rules)
+		}
+	}
+	if len(tasks) == 0 {
+		return
+	}
+
+	workers := runtime.NumCPU()
+	if workers > len(tasks) {
+		workers = len(tasks)
+	}
+
+	results := make([][]string, len(tasks))
+	taskChan := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range taskChan {
+				results[i] = o.dedupRules(tasks[i].ruleSet.Name, tasks[i].ruleType, tasks[i].rules)
 			}
+		}()
+	}
+	for i := range tasks {
+		taskChan <- i
+	}
+	close(taskChan)
+	wg.Wait()
+
+	for i, task := range tasks {
+		task.ruleSet.Rules[task.ruleType] = results[i]
+		task.ruleSet.filtered = nil
+	}
+
+	if o.collapseSubdomains {
+		collapsed := 0
+		for _, name := range o.RulesetNames() {
+			collapsed += collapseCoveredDomains(o.ruleSets[name])
+		}
+		log.Info().Msgf("collapse_subdomains: 共移除 %d 条已被上级 DOMAIN-SUFFIX 覆盖的域名规则", collapsed)
+	}
+
+	for ruleSet, count := range before {
+		for _, rules := range ruleSet.Rules {
+			count -= len(rules)
+		}
+		ruleSet.dedupRemoved += count
+	}
+}
 
-			// 转回切片
-			deduped := make([]string, 0, len(uniqueRules))
-			for rule := range uniqueRules {
-				deduped = append(deduped, rule)
+// dedupRules 对单一类型的规则去重并排序，返回新的切片
+func (o *Optimizer) dedupRules(ruleSetName string, ruleType RuleType, rules []string) []string {
+	// IP 类规则先规范化（补全掩码、IPv6 规范压缩），使等价写法能够合并
+	if isCIDRRuleType(ruleType) {
+		maskedCount := 0
+		// IP-SUFFIX 匹配地址后缀，主机位有意义，不能清除
+		clearHostBits := ruleType != RuleTypeIPSuffix && ruleType != RuleTypeSrcIPSuffix
+		for i := range rules {
+			normalized, masked := normalizeCIDR(rules[i], clearHostBits)
+			if masked {
+				log.Debug().Msgf("清除主机位: %s,%s -> %s", ruleType, rules[i], normalized)
+				maskedCount++
 			}
+			rules[i] = normalized
+		}
+		if maskedCount > 0 {
+			log.Info().Msgf("规则集 '%s': %s 清除 %d 条规则的主机位", ruleSetName, ruleType, maskedCount)
+		}
+	}
 
-			// 按类型智能排序
-			o.sortRulesByType(ruleType, deduped)
+	// 使用 map 去重：带与不带 no-resolve 的同一规则视为重复，保留带 no-resolve 的写法
+	// （导出时各格式会按需添加或移除 no-resolve）；NO-RESOLVE 等大小写写法统一为 no-resolve
+	uniqueRules := make(map[string]string, len(rules))
+	collapsed := 0
+	for _, rule := range rules {
+		key := rule
+		if hasOption(rule, "no-resolve") {
+			key = removeNoResolve(rule)
+			rule = lowercaseNoResolve(rule)
+		}
+		existing, ok := uniqueRules[key]
+		if !ok {
+			uniqueRules[key] = rule
+			continue
+		}
+		if existing == rule {
+			continue
+		}
+		collapsed++
+		// 优先保留带 no-resolve 的写法；都带时取字典序较小者，保证结果稳定
+		existingNoResolve, ruleNoResolve := existing != key, rule != key
+		if (ruleNoResolve && !existingNoResolve) || (ruleNoResolve == existingNoResolve && rule < existing) {
+			uniqueRules[key] = rule
+		}
+	}
+	if collapsed > 0 {
+		log.Info().Msgf("规则集 '%s': %s 合并 %d 条仅 no-resolve 参数不同的重复规则", ruleSetName, ruleType, collapsed)
+	}
 
-			ruleSet.Rules[ruleType] = deduped
+	// 转回切片
+	deduped := make([]string, 0, len(uniqueRules))
+	for _, rule := range uniqueRules {
+		deduped = append(deduped, rule)
+	}
+
+	if o.mergeCIDRs && isMergeableCIDRType(ruleType) {
+		var reduced int
+		if deduped, reduced = mergeCIDRs(deduped); reduced > 0 {
+			log.Info().Msgf("规则集 '%s': %s 合并网段减少 %d 条规则", ruleSetName, ruleType, reduced)
+		}
+	}
+
+	if o.mergePorts && isPortRuleType(ruleType) {
+		var reduced int
+		if deduped, reduced = mergePorts(deduped); reduced > 0 {
+			log.Info().Msgf("规则集 '%s': %s 合并端口范围减少 %d 条规则", ruleSetName, ruleType, reduced)
 		}
 	}
+
+	// 按类型智能排序
+	o.sortRulesByType(ruleType, deduped)
+
+	return deduped
 }
 
 // sortRulesByType 根据规则类型进行智能排序
@@ -294,12 +647,8 @@ func (o *Optimizer) sortRulesByType(ruleType RuleType, rules []string) {
 		})
 
 	case RuleTypeIPCIDR, RuleTypeIPCIDR6, RuleTypeSrcIPCIDR, RuleTypeSrcIPCIDR6, RuleTypeIPSuffix, RuleTypeSrcIPSuffix:
-		// IP-CIDR: 规范化后按 CIDR 块大小排序（小块优先，更精确）
-		// 先规范化所有规则（添加缺失的掩码）
-		for i := range rules {
-			rules[i] = normalizeCIDR(rules[i])
-		}
-
+		// IP-CIDR: 按 CIDR 块大小排序（小块优先，更精确）
+		// 规则已在 Deduplicate 中规范化
 		sort.Slice(rules, func(i, j int) bool {
 			maskI := extractCIDRMask(rules[i])
 			maskJ := extractCIDRMask(rules[j])
@@ -323,12 +672,15 @@ func (o *Optimizer) sortRulesByType(ruleType RuleType, rules []string) {
 		})
 
 	case RuleTypeDstPort, RuleTypeSrcPort, RuleTypeInPort:
-		// 端口规则：按端口号排序
+		// 端口规则：按起始端口号（数值）排序，相同时按字典序，保证全序
 		sort.Slice(rules, func(i, j int) bool {
 			// 提取端口号（可能是范围如 "80-443"）
-			portI := strings.Split(rules[i], "-")[0]
-			portJ := strings.Split(rules[j], "-")[0]
-			return portI < portJ
+			portI := leadingNumber(strings.Split(rules[i], "-")[0])
+			portJ := leadingNumber(strings.Split(rules[j], "-")[0])
+			if portI != portJ {
+				return portI < portJ
+			}
+			return rules[i] < rules[j]
 		})
 
 	case RuleTypeGeoIP, RuleTypeSrcGeoIP, RuleTypeGeoSite:
@@ -336,12 +688,15 @@ func (o *Optimizer) sortRulesByType(ruleType RuleType, rules []string) {
 		sort.Strings(rules)
 
 	case RuleTypeIPASN, RuleTypeSrcIPASN:
-		// IP-ASN: 按 ASN 编号排序
+		// IP-ASN: 按 ASN 编号（数值）排序，相同时按字典序，保证全序
 		sort.Slice(rules, func(i, j int) bool {
 			// 提取 ASN 编号（格式如 "AS12345" 或 "12345"）
-			asnI := strings.TrimPrefix(rules[i], "AS")
-			asnJ := strings.TrimPrefix(rules[j], "AS")
-			return asnI < asnJ
+			asnI := leadingNumber(strings.TrimPrefix(rules[i], "AS"))
+			asnJ := leadingNumber(strings.TrimPrefix(rules[j], "AS"))
+			if asnI != asnJ {
+				return asnI < asnJ
+			}
+			return rules[i] < rules[j]
 		})
 
 	case RuleTypeNetwork:
@@ -378,6 +733,21 @@ func (o *Optimizer) sortRulesByType(ruleType RuleType, rules []string) {
 	}
 }
 
+// leadingNumber 解析字符串开头的十进制数字（如 "443,no-resolve" 得到 443），没有数字时返回 -1
+func leadingNumber(s string) int {
+	n := -1
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			break
+		}
+		if n < 0 {
+			n = 0
+		}
+		n = n*10 + int(c-'0')
+	}
+	return n
+}
+
 // extractCIDRMask 提取 CIDR 掩码长度
 func extractCIDRMask(cidr string) int {
 	// 处理可能的参数（如 "192.168.0.0/16,no-resolve"）
@@ -399,176 +769,464 @@ func extractCIDRMask(cidr string) int {
 	return 32
 }
 
-// normalizeCIDR 规范化 CIDR 格式，为没有掩码的 IP 地址添加默认掩码
-// 保留原有的参数（如 no-resolve）
-func normalizeCIDR(rule string) string {
+// isCIDRRuleType 是否为 CIDR 类规则（需要规范化）
+func isCIDRRuleType(ruleType RuleType) bool {
+	switch ruleType {
+	case RuleTypeIPCIDR, RuleTypeIPCIDR6, RuleTypeSrcIPCIDR, RuleTypeSrcIPCIDR6, RuleTypeIPSuffix, RuleTypeSrcIPSuffix:
+		return true
+	}
+	return false
+}
+
+// normalizeCIDR 规范化 CIDR 格式
+//   - 为没有掩码的 IP 地址添加默认掩码
+//   - 清除主机位，如 192.168.1.55/24 -> 192.168.1.0/24
+//   - IPv6 前缀转换为规范形式（小写、零压缩），如 2001:DB8:0:0::/32 -> 2001:db8::/32
+//
+// clearHostBits 为 false 时不清除主机位（用于 IP-SUFFIX）
+// 保留原有的参数（如 no-resolve），masked 表示是否清除了主机位
+func normalizeCIDR(rule string, clearHostBits bool) (normalized string, masked bool) {
 	// 分离 CIDR 和其他参数（如 "192.168.0.1,no-resolve"）
 	parts := strings.Split(rule, ",")
-	cidrPart := parts[0]
+	cidrPart := strings.TrimSpace(parts[0])
 
 	// 检查是否已经有掩码
-	if strings.Contains(cidrPart, "/") {
-		return rule // 已有掩码，直接返回
+	if !strings.Contains(cidrPart, "/") {
+		// 判断是 IPv4 还是 IPv6，添加默认掩码
+		if strings.Contains(cidrPart, ":") {
+			cidrPart += "/128" // IPv6 默认掩码
+		} else {
+			cidrPart += "/32" // IPv4 默认掩码
+		}
 	}
 
-	// 判断是 IPv4 还是 IPv6
-	var defaultMask string
-	if strings.Contains(cidrPart, ":") {
-		defaultMask = "/128" // IPv6 默认掩码
-	} else {
-		defaultMask = "/32" // IPv4 默认掩码
+	// 清除主机位（IPv6 同时得到规范化表示）
+	if prefix, err := netip.ParsePrefix(cidrPart); err == nil {
+		if clearHostBits {
+			maskedPrefix := prefix.Masked()
+			masked = maskedPrefix.Addr() != prefix.Addr()
+			prefix = maskedPrefix
+		}
+		cidrPart = prefix.String()
 	}
 
-	// 添加掩码
-	parts[0] = cidrPart + defaultMask
+	parts[0] = cidrPart
 
 	// 重新组合（保留其他参数）
-	return strings.Join(parts, ",")
+	return strings.Join(parts, ","), masked
+}
+
+// 导出类型（Mihomo behavior + 变体）
+const (
+	ExportKindDomain                = "domain"                   // domain behavior（DOMAIN/DOMAIN-SUFFIX）
+	ExportKindIPCIDR                = "ipcidr"                   // ipcidr behavior（IP-CIDR/IP-CIDR6，无 no-resolve）
+	ExportKindClassical             = "classical"                // 非 domain/ipcidr 规则，无 no-resolve
+	ExportKindClassicalNoResolve    = "classical_no_resolve"     // 非 domain 规则，IP-CIDR 带 no-resolve
+	ExportKindClassicalAll          = "classical_all"            // 所有规则，无 no-resolve
+	ExportKindClassicalAllNoResolve = "classical_all_no_resolve" // 所有规则，IP-CIDR 带 no-resolve
+)
+
+// ExportKinds 所有导出类型（按导出顺序）
+var ExportKinds = []string{
+	ExportKindDomain,
+	ExportKindIPCIDR,
+	ExportKindClassical,
+	ExportKindClassicalNoResolve,
+	ExportKindClassicalAll,
+	ExportKindClassicalAllNoResolve,
+}
+
+// ParseExportFormat 解析导出格式字符串
+// 格式：{kind}[.yaml|.list]，如 classical_all、domain.yaml；未指定扩展名时默认 list
+func ParseExportFormat(format string) (kind string, asYAML bool, err error) {
+	kind = strings.ToLower(strings.TrimSpace(format))
+	switch {
+	case strings.HasSuffix(kind, ".yaml"):
+		kind, asYAML = strings.TrimSuffix(kind, ".yaml"), true
+	case strings.HasSuffix(kind, ".list"):
+		kind = strings.TrimSuffix(kind, ".list")
+	}
+	for _, k := range ExportKinds {
+		if k == kind {
+			return kind, asYAML, nil
+		}
+	}
+	return "", false, fmt.Errorf("不支持的导出格式: %s（可选: %s，可加 .yaml/.list 后缀）", format, strings.Join(ExportKinds, ", "))
+}
+
+// classicalTypeOrder classical 格式中规则类型的输出顺序（同时也是规则集可包含的全部类型）
+var classicalTypeOrder = []RuleType{
+	RuleTypeDomain, RuleTypeDomainSuffix, RuleTypeDomainKeyword, RuleTypeDomainWildcard, RuleTypeDomainRegex,
+	RuleTypeIPCIDR, RuleTypeIPCIDR6, RuleTypeSrcIPCIDR, RuleTypeSrcIPCIDR6, RuleTypeIPSuffix, RuleTypeSrcIPSuffix, RuleTypeIPASN, RuleTypeSrcIPASN,
+	RuleTypeGeoIP, RuleTypeSrcGeoIP, RuleTypeGeoSite,
+	RuleTypeProcessName, RuleTypeProcessPath, RuleTypeProcessNameRegex, RuleTypeProcessPathRegex,
+	RuleTypeDstPort, RuleTypeSrcPort, RuleTypeInPort,
+	RuleTypeNetwork, RuleTypeUid, RuleTypeInType, RuleTypeInUser, RuleTypeInName, RuleTypeDSCP,
+	RuleTypeRuleSet, RuleTypeSubRules,
+}
+
+// classicalSection classical 格式中单个规则类型的分段
+type classicalSection struct {
+	ruleType RuleType
+	rules    []string // 已处理 no-resolve 的 payload
+}
+
+// SetFileExtensions 设置导出文件的扩展名（如 .txt、.yml），为空时使用默认的 .list/.yaml
+func (o *Optimizer) SetFileExtensions(listExt, yamlExt string) {
+	o.listExt = listExt
+	o.yamlExt = yamlExt
+}
+
+// fileExtensions 返回导出文件的扩展名（纯文本, YAML）
+func (o *Optimizer) fileExtensions() (string, string) {
+	listExt, yamlExt := o.listExt, o.yamlExt
+	if listExt == "" {
+		listExt = ".list"
+	}
+	if yamlExt == "" {
+		yamlExt = ".yaml"
+	}
+	return listExt, yamlExt
 }
 
 // Export 导出规则到文件
 // Mihomo 只支持三种 behavior: domain, ipcidr, classical
 // 文件命名格式：{ruleset_name}_{type}.{ext}
-// 始终输出两种格式：.yaml (YAML格式) 和 .list (纯文本格式)
+// 始终输出两种格式：.yaml (YAML格式) 和 .list (纯文本格式)，扩展名可通过 SetFileExtensions 修改
+// 规则集的 OutputFormats 或 SetSingboxExport 可额外输出 Surge（{ruleset_name}_surge.conf）、sing-box（{ruleset_name}_singbox.json）
+// 和 Quantumult X（{ruleset_name}_quanx.list）格式
+// SetLayout 设置为 by_behavior 时改为 {type}/{ruleset_name}.{ext}，且不生成各规则集的 README.txt
 func (o *Optimizer) Export(outputDir string) error {
-	for _, ruleSet := range o.ruleSets {
-		ruleSetDir := filepath.Join(outputDir, ruleSet.Name)
-		if err := os.MkdirAll(ruleSetDir, 0755); err != nil {
-			return err
+	for _, name := range o.RulesetNames() {
+		ruleSet := o.ruleSets[name]
+		counts := make(map[string]int, len(ExportKinds))
+		for _, kind := range ExportKinds {
+			count, err := o.exportKindFiles(ruleSet, outputDir, kind)
+			if err != nil {
+				return err
+			}
+			counts[kind] = count
 		}
-		// 始终输出两种格式
-		if err := o.exportDomain(ruleSet, ruleSetDir); err != nil {
+		if err := o.exportExtraFormats(ruleSet, outputDir); err != nil {
 			return err
 		}
-		if err := o.exportIPCIDR(ruleSet, ruleSetDir); err != nil {
-			return err
+		if o.invalidReport {
+			if err := o.writeInvalidReport(ruleSet, outputDir); err != nil {
+				return err
+			}
 		}
-		// classical (非 domain/ipcidr，无 no-resolve)
-		if err := o.exportClassical(ruleSet, ruleSetDir, false, false); err != nil {
+		if o.exportCounts == nil {
+			o.exportCounts = make(map[string]map[string]int)
+		}
+		o.exportCounts[name] = counts
+		if o.layout == config.LayoutByBehavior {
+			continue
+		}
+		if err := o.writeRulesetReadme(ruleSet, filepath.Join(outputDir, ruleSet.Name), counts); err != nil {
 			return err
 		}
-		// classical_no_resolve (非 domain/ipcidr，有 no-resolve)
-		if err := o.exportClassical(ruleSet, ruleSetDir, false, true); err != nil {
+	}
+	return nil
+}
+
+// SetRulesetOutputFormats 设置规则集额外导出的格式（mihomo 格式总会导出）
+func (o *Optimizer) SetRulesetOutputFormats(ruleSetName string, formats []string) error {
+	ruleSet, exists := o.ruleSets[ruleSetName]
+	if !exists {
+		return fmt.Errorf("规则集 '%s' 不存在", ruleSetName)
+	}
+	ruleSet.OutputFormats = formats
+	return nil
+}
+
+// exportExtraFormats 导出 mihomo 以外的格式：规则集配置了 OutputFormats 时按其导出，否则按全局设置（SetSingboxExport）
+func (o *Optimizer) exportExtraFormats(ruleSet *RuleSet, outputDir string) error {
+	formats := ruleSet.OutputFormats
+	if len(formats) == 0 && o.singboxExport {
+		formats = []string{config.OutputFormatSingbox}
+	}
+	for _, format := range formats {
+		var err error
+		switch format {
+		case config.OutputFormatMihomo:
+			// 总会导出，无需额外处理
+		case config.OutputFormatSurge:
+			_, err = o.exportSurge(ruleSet, outputDir)
+		case config.OutputFormatSingbox:
+			_, err = o.exportSingbox(ruleSet, outputDir)
+		case config.OutputFormatQuantumultX:
+			_, err = o.exportQuantumultX(ruleSet, outputDir)
+		default:
+			err = fmt.Errorf("规则集 '%s': 不支持的导出格式: %s", ruleSet.Name, format)
+		}
+		if err != nil {
 			return err
 		}
-		// classical_all (所有规则，无 no-resolve)
-		if err := o.exportClassical(ruleSet, ruleSetDir, true, false); err != nil {
+	}
+	return nil
+}
+
+// ExportCounts 返回 Export 写入的规则数量：规则集 -> 导出类型 -> 数量（必须在 Export 之后调用）
+func (o *Optimizer) ExportCounts() map[string]map[string]int {
+	return o.exportCounts
+}
+
+// RulesetNames 返回已加载的规则集名称（按名称排序）
+func (o *Optimizer) RulesetNames() []string {
+	names := make([]string, 0, len(o.ruleSets))
+	for name := range o.ruleSets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// sortedRuleTypes 按 classicalTypeOrder 返回规则集包含的类型（不在其中的类型按名称排在最后）
+func sortedRuleTypes(rules map[RuleType][]string) []RuleType {
+	present := make(map[RuleType]bool, len(rules))
+	for ruleType := range rules {
+		present[ruleType] = true
+	}
+	return orderedStatisticTypes(present)
+}
+
+// ExportTo 将所有规则集的单一格式写入 w（如 os.Stdout），不创建目录和文件
+// 规则集按名称排序输出；list 格式以注释行分隔规则集，YAML 格式以 "---" 分隔文档
+func (o *Optimizer) ExportTo(w io.Writer, kind string, asYAML bool) error {
+	for i, name := range o.RulesetNames() {
+		if asYAML && i > 0 {
+			if _, err := fmt.Fprintf(w, "---\n"); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "# ruleset: %s\n", name); err != nil {
 			return err
 		}
-		// classical_all_no_resolve (所有规则，有 no-resolve)
-		if err := o.exportClassical(ruleSet, ruleSetDir, true, true); err != nil {
+		if _, err := o.writeKind(w, o.ruleSets[name], kind, asYAML); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-// exportDomain 导出 {name}_domain 文件（包含所有 Domain 类型规则）
-// Domain behavior 只接受纯域名，支持的格式：
-// - example.com (精确匹配完整域名)
-// - .example.com (只匹配子域名，不匹配主域名，如匹配 www.example.com 但不匹配 example.com)
-// - +.example.com (匹配主域名和所有子域名，如匹配 example.com、www.example.com、a.b.example.com)
-func (o *Optimizer) exportDomain(ruleSet *RuleSet, ruleSetDir string) error {
-	// 输出 yaml
-	yamlPath := filepath.Join(ruleSetDir, fmt.Sprintf("%s_domain.yaml", ruleSet.Name))
+// WriteRuleset 将指定规则集的单一格式写入 w（如 os.Stdout）
+func (o *Optimizer) WriteRuleset(w io.Writer, ruleSetName string, kind string, asYAML bool) error {
+	ruleSet, exists := o.ruleSets[ruleSetName]
+	if !exists {
+		return fmt.Errorf("规则集 '%s' 不存在", ruleSetName)
+	}
+	_, err := o.writeKind(w, ruleSet, kind, asYAML)
+	return err
+}
+
+// exportKindFiles 导出单一类型的 yaml 和 list 文件，返回写入的规则数量
+func (o *Optimizer) exportKindFiles(ruleSet *RuleSet, outputDir string, kind string) (int, error) {
+	listExt, yamlExt := o.fileExtensions()
+	yamlPath, err := o.exportPath(outputDir, ruleSet.Name, kind, yamlExt)
+	if err != nil {
+		return 0, err
+	}
+	listPath, err := o.exportPath(outputDir, ruleSet.Name, kind, listExt)
+	if err != nil {
+		return 0, err
+	}
+
 	yamlFile, err := os.Create(yamlPath)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer yamlFile.Close()
-
-	// 输出 list
-	listPath := filepath.Join(ruleSetDir, fmt.Sprintf("%s_domain.list", ruleSet.Name))
 	listFile, err := os.Create(listPath)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer listFile.Close()
 
-	// 收集所有域名规则
+	totalRules, err := o.writeKind(yamlFile, ruleSet, kind, true)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := o.writeKind(listFile, ruleSet, kind, false); err != nil {
+		return 0, err
+	}
+	if err := validateExportedFiles(kind, yamlPath, listPath); err != nil {
+		return 0, err
+	}
+
+	if totalRules == 0 {
+		log.Info().Msgf("生成空文件: %s, %s (仅注释)", yamlPath, listPath)
+	} else {
+		log.Info().Msgf("生成文件: %s, %s (%d 条规则)", yamlPath, listPath, totalRules)
+	}
+	return totalRules, nil
+}
+
+// exportKindUsage 各导出类型的用途说明（README.txt 使用）
+var exportKindUsage = map[string]string{
+	ExportKindDomain:                "behavior: domain，只包含 DOMAIN/DOMAIN-SUFFIX（转换为 +. 前缀）",
+	ExportKindIPCIDR:                "behavior: ipcidr，只包含 IP-CIDR/IP-CIDR6",
+	ExportKindClassical:             "behavior: classical，只包含无法放入 domain/ipcidr 的其他规则",
+	ExportKindClassicalNoResolve:    "behavior: classical，包含除 domain 外的全部规则，IP 类规则追加 no-resolve（可替代 ipcidr + classical）",
+	ExportKindClassicalAll:          "behavior: classical，包含全部规则（与 domain/ipcidr/classical 重叠）",
+	ExportKindClassicalAllNoResolve: "behavior: classical，同 classical_all，但 IP 类规则追加 no-resolve",
+}
+
+// writeRulesetReadme 根据实际导出内容生成 README.txt，说明各文件的用途和推荐组合
+// counts: 各导出类型写入的规则数量
+func (o *Optimizer) writeRulesetReadme(ruleSet *RuleSet, ruleSetDir string, counts map[string]int) error {
+	readmePath := filepath.Join(ruleSetDir, "README.txt")
+	f, err := os.Create(readmePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	bw := bufio.NewWriter(f)
+	fmt.Fprintf(bw, "规则集: %s\n", ruleSet.Name)
+	fmt.Fprintf(bw, "本文件由 RuleRefinery 根据导出内容自动生成，请勿手动修改。\n\n")
+
+	// 规则类型统计
+	ruleTypes := make([]string, 0, len(ruleSet.Rules))
+	for ruleType, rules := range ruleSet.Rules {
+		if len(rules) > 0 {
+			ruleTypes = append(ruleTypes, string(ruleType))
+		}
+	}
+	sort.Strings(ruleTypes)
+	fmt.Fprintf(bw, "规则类型统计（去重后，过滤前）:\n")
+	if len(ruleTypes) == 0 {
+		fmt.Fprintf(bw, "  （无规则）\n")
+	}
+	for _, ruleType := range ruleTypes {
+		fmt.Fprintf(bw, "  %-20s %d\n", ruleType, len(ruleSet.Rules[RuleType(ruleType)]))
+	}
+
+	// 文件说明
+	listExt, yamlExt := o.fileExtensions()
+	fmt.Fprintf(bw, "\n文件说明（%s 与 %s 内容相同，仅格式不同）:\n", yamlExt, listExt)
+	for _, kind := range ExportKinds {
+		fmt.Fprintf(bw, "  %s_%s{%s,%s}  %d 条\n", ruleSet.Name, kind, yamlExt, listExt, counts[kind])
+		fmt.Fprintf(bw, "      %s\n", exportKindUsage[kind])
+	}
+
+	// 推荐组合
+	fmt.Fprintf(bw, "\n推荐用法（二选一，不要同时加载两组，否则规则会重复匹配）:\n")
+	var split []string
+	for _, kind := range []string{ExportKindDomain, ExportKindIPCIDR, ExportKindClassical} {
+		if counts[kind] > 0 {
+			split = append(split, fmt.Sprintf("%s_%s", ruleSet.Name, kind))
+		}
+	}
+	if len(split) > 0 {
+		fmt.Fprintf(bw, "  1. 性能优先：分别加载 %s\n", strings.Join(split, " + "))
+	} else {
+		fmt.Fprintf(bw, "  1. 性能优先：当前没有非空的 domain/ipcidr/classical 文件\n")
+	}
+	fmt.Fprintf(bw, "  2. 简单优先：只加载 %s_%s（单个文件包含全部规则）\n", ruleSet.Name, ExportKindClassicalAll)
+
+	if counts[ExportKindClassicalNoResolve] != counts[ExportKindClassical] {
+		fmt.Fprintf(bw, "\n如需避免匹配 IP 规则时触发 DNS 解析：\n")
+		fmt.Fprintf(bw, "  1. 性能优先：加载 %s_%s + %s_%s\n", ruleSet.Name, ExportKindDomain, ruleSet.Name, ExportKindClassicalNoResolve)
+		fmt.Fprintf(bw, "  2. 简单优先：只加载 %s_%s\n", ruleSet.Name, ExportKindClassicalAllNoResolve)
+	}
+
+	return bw.Flush()
+}
+
+// writeKind 按导出类型写入规则，返回写入的规则数量
+func (o *Optimizer) writeKind(w io.Writer, ruleSet *RuleSet, kind string, asYAML bool) (int, error) {
+	switch kind {
+	case ExportKindDomain:
+		return writePayload(w, o.collectDomainRules(ruleSet), asYAML)
+	case ExportKindIPCIDR:
+		return writePayload(w, o.collectIPCIDRRules(ruleSet), asYAML)
+	case ExportKindClassical:
+		return writeClassical(w, ruleSet.Name, o.collectClassicalSections(ruleSet, false, false), false, false, asYAML)
+	case ExportKindClassicalNoResolve:
+		return writeClassical(w, ruleSet.Name, o.collectClassicalSections(ruleSet, false, true), false, true, asYAML)
+	case ExportKindClassicalAll:
+		return writeClassical(w, ruleSet.Name, o.collectClassicalSections(ruleSet, true, false), true, false, asYAML)
+	case ExportKindClassicalAllNoResolve:
+		return writeClassical(w, ruleSet.Name, o.collectClassicalSections(ruleSet, true, true), true, true, asYAML)
+	default:
+		return 0, fmt.Errorf("不支持的导出类型: %s", kind)
+	}
+}
+
+// collectDomainRules 收集 {name}_domain 的规则（包含所有 Domain 类型规则）
+// Domain behavior 只接受纯域名，支持的格式：
+// - example.com (精确匹配完整域名)
+// - .example.com (只匹配子域名，不匹配主域名，如匹配 www.example.com 但不匹配 example.com)
+// - +.example.com (匹配主域名和所有子域名，如匹配 example.com、www.example.com、a.b.example.com)
+func (o *Optimizer) collectDomainRules(ruleSet *RuleSet) []string {
 	var domainRules []string
 
 	// DOMAIN: 直接添加
-	if rules, exists := ruleSet.Rules[RuleTypeDomain]; exists {
+	if _, exists := ruleSet.Rules[RuleTypeDomain]; exists {
 		log.Debug().Msgf("exportDomain - 处理 DOMAIN 规则，规则集='%s', excludes=%v", ruleSet.Name, ruleSet.Excludes)
-		filtered := o.applyRuleFilters(rules, RuleTypeDomain, ruleSet.Filters, ruleSet.Excludes)
-		domainRules = append(domainRules, filtered...)
+		filtered := o.filteredRules(ruleSet, RuleTypeDomain)
+		for _, rule := range filtered {
+			domainRules = append(domainRules, stripOptions(rule))
+		}
 	}
 
-	// DOMAIN-SUFFIX: 转换为 +.domain 格式（匹配主域名和所有子域名）
+	// DOMAIN-SUFFIX: 按 suffixMode 转换写法（默认 +.domain，匹配主域名和所有子域名）
 	// 注意：
 	//   +.baidu.com 匹配 baidu.com、tieba.baidu.com、123.tieba.baidu.com
 	//   .baidu.com  匹配 tieba.baidu.com、123.tieba.baidu.com，但不匹配 baidu.com
-	// DOMAIN-SUFFIX 类型必须使用 +. 前缀
-	if rules, exists := ruleSet.Rules[RuleTypeDomainSuffix]; exists {
+	if _, exists := ruleSet.Rules[RuleTypeDomainSuffix]; exists {
 		log.Debug().Msgf("exportDomain - 处理 DOMAIN-SUFFIX 规则，规则集='%s', excludes=%v", ruleSet.Name, ruleSet.Excludes)
-		filtered := o.applyRuleFilters(rules, RuleTypeDomainSuffix, ruleSet.Filters, ruleSet.Excludes)
+		filtered := o.filteredRules(ruleSet, RuleTypeDomainSuffix)
+		suffixRules := make([]string, 0, len(filtered))
 		for _, rule := range filtered {
-			// 如果已经有 +. 前缀，保持原样
-			if strings.HasPrefix(rule, "+.") {
-				domainRules = append(domainRules, rule)
-			} else if strings.HasPrefix(rule, ".") {
-				// 如果只有 . 前缀，需要改为 +. 前缀
-				domainRules = append(domainRules, "+"+rule)
-			} else {
-				// 没有前缀，添加 +. 前缀
-				domainRules = append(domainRules, "+."+rule)
-			}
+			suffixRules = append(suffixRules, o.domainSuffixPayload(stripOptions(rule)))
+		}
+		// 统一写法后 +.a.com、.a.com、a.com 可能变成同一条
+		domainRules = append(domainRules, mergeUniqueRules(suffixRules, nil)...)
+	}
+
+	// DOMAIN-WILDCARD: 启用 domain_include_wildcard 时转换可以表示的模式（如 *.example.com → .example.com），其余留在 classical
+	if o.domainIncludeWildcard {
+		if _, exists := ruleSet.Rules[RuleTypeDomainWildcard]; exists {
+			domainRules = append(domainRules, o.domainWildcardRules(ruleSet)...)
 		}
 	}
 
 	// DOMAIN-KEYWORD: Domain behavior 不支持 keyword，跳过
-	// DOMAIN-WILDCARD: Domain behavior 不支持通配符，跳过
 	// DOMAIN-REGEX: Domain behavior 不支持正则，跳过
 
-	totalRules := len(domainRules)
-
-	if totalRules == 0 {
-		fmt.Fprintf(yamlFile, "# 无规则内容，自动生成占位\npayload: []\n")
-		fmt.Fprintf(listFile, "# 无规则内容，自动生成占位\n")
-		log.Info().Msgf("生成空文件: %s, %s (仅注释)", yamlPath, listPath)
-		return nil
-	}
+	return domainRules
+}
 
-	// YAML 格式
-	fmt.Fprintf(yamlFile, "payload:\n")
-	for _, rule := range domainRules {
-		fmt.Fprintf(yamlFile, "  - '%s'\n", rule)
-	}
+// SetSuffixMode 设置导出 domain 格式时 DOMAIN-SUFFIX 的写法
+// plus（默认）统一为 +.domain；dot 统一为 .domain；preserve 保留输入中的 +. 或 . 前缀，没有前缀时使用 +.
+func (o *Optimizer) SetSuffixMode(mode string) {
+	o.suffixMode = mode
+}
 
-	// Text 格式
-	for _, rule := range domainRules {
-		fmt.Fprintf(listFile, "%s\n", rule)
+// domainSuffixPayload 按 suffixMode 返回 DOMAIN-SUFFIX 在 domain 格式中的写法
+func (o *Optimizer) domainSuffixPayload(rule string) string {
+	switch o.suffixMode {
+	case config.SuffixModeDot:
+		return "." + strings.TrimPrefix(strings.TrimPrefix(rule, "+"), ".")
+	case config.SuffixModePreserve:
+		if strings.HasPrefix(rule, "+.") || strings.HasPrefix(rule, ".") {
+			return rule
+		}
+		return "+." + rule
+	default:
+		return "+." + strings.TrimPrefix(strings.TrimPrefix(rule, "+"), ".")
 	}
-
-	log.Info().Msgf("生成文件: %s, %s (%d 条规则)", yamlPath, listPath, totalRules)
-	return nil
 }
 
-// exportIPCIDR 导出 {name}_ipcidr 文件（包含所有 IP 类型规则，移除 no-resolve 参数）
+// collectIPCIDRRules 收集 {name}_ipcidr 的规则（包含所有 IP 类型规则，移除所有参数）
 // IPCIDR behavior 只接受纯 CIDR 格式，如：192.168.0.0/16 或 2001:db8::/32
-// 注意：移除 no-resolve 参数，只保留纯 CIDR 地址
+// 注意：移除 no-resolve 等参数，只保留纯 CIDR 地址
 // 只支持 IP-CIDR 和 IP-CIDR6
 // 其他类型（SRC-IP-CIDR, IP-ASN 等）不被 ipcidr behavior 支持，需要使用 classical
-func (o *Optimizer) exportIPCIDR(ruleSet *RuleSet, ruleSetDir string) error {
-	// 输出 yaml
-	yamlPath := filepath.Join(ruleSetDir, fmt.Sprintf("%s_ipcidr.yaml", ruleSet.Name))
-	yamlFile, err := os.Create(yamlPath)
-	if err != nil {
-		return err
-	}
-	defer yamlFile.Close()
-
-	// 输出 list
-	listPath := filepath.Join(ruleSetDir, fmt.Sprintf("%s_ipcidr.list", ruleSet.Name))
-	listFile, err := os.Create(listPath)
-	if err != nil {
-		return err
-	}
-	defer listFile.Close()
-
-	// 收集所有 IP CIDR 规则并移除 no-resolve 参数
+func (o *Optimizer) collectIPCIDRRules(ruleSet *RuleSet) []string {
 	var ipcidrRules []string
+	seen := make(map[string]bool)
 	ipTypes := []RuleType{
 		RuleTypeIPCIDR,
 		RuleTypeIPCIDR6,
@@ -580,40 +1238,20 @@ func (o *Optimizer) exportIPCIDR(ruleSet *RuleSet, ruleSetDir string) error {
 		}
 
 		// 先应用过滤器
-		filtered := o.applyRuleFilters(rules, ruleType, ruleSet.Filters, ruleSet.Excludes)
+		filtered := o.filteredRules(ruleSet, ruleType)
 
 		for _, rule := range filtered {
-			// 移除 no-resolve 参数
-			parts := strings.Split(rule, ",")
-			cleanParts := []string{}
-			for _, part := range parts {
-				if strings.TrimSpace(part) != "no-resolve" {
-					cleanParts = append(cleanParts, part)
-				}
+			// 仅参数不同的规则（如 1.0.0.0/8 与 1.0.0.0/8,src）去掉参数后是同一条
+			if stripped := stripOptions(rule); !seen[stripped] {
+				seen[stripped] = true
+				ipcidrRules = append(ipcidrRules, stripped)
 			}
-			ipcidrRules = append(ipcidrRules, strings.Join(cleanParts, ","))
 		}
 	}
-	totalRules := len(ipcidrRules)
-
-	if totalRules == 0 {
-		fmt.Fprintf(yamlFile, "# 无规则内容，自动生成占位\npayload: []\n")
-		fmt.Fprintf(listFile, "# 无规则内容，自动生成占位\n")
-		log.Info().Msgf("生成空文件: %s, %s (仅注释)", yamlPath, listPath)
-		return nil
-	}
-	fmt.Fprintf(yamlFile, "payload:\n")
-	for _, rule := range ipcidrRules {
-		fmt.Fprintf(yamlFile, "  - '%s'\n", rule)
-	}
-	for _, rule := range ipcidrRules {
-		fmt.Fprintf(listFile, "%s\n", rule)
-	}
-	log.Info().Msgf("生成文件: %s, %s (%d 条规则)", yamlPath, listPath, totalRules)
-	return nil
+	return ipcidrRules
 }
 
-// exportClassical 导出 classical 格式
+// collectClassicalSections 收集 classical 格式的规则分段
 // includeAll: true 导出所有规则（{name}_classical_all），false 只导出非 domain 和非 ipcidr 的规则（{name}_classical）
 // withNoResolve: true IP-CIDR 规则保留/添加 no-resolve 参数，false 移除 no-resolve 参数
 // Classical behavior 支持所有规则类型，包括：
@@ -621,64 +1259,7 @@ func (o *Optimizer) exportIPCIDR(ruleSet *RuleSet, ruleSetDir string) error {
 // - IP 类型: IP-CIDR, IP-CIDR6, SRC-IP-CIDR, IP-ASN 等
 // - 进程类型: PROCESS-NAME, PROCESS-PATH 等
 // - 其他: GEOIP, GEOSITE, DST-PORT, RULE-SET 等
-func (o *Optimizer) exportClassical(ruleSet *RuleSet, ruleSetDir string, includeAll bool, withNoResolve bool) error {
-	// 输出 yaml
-	var yamlPath, listPath string
-	if includeAll {
-		if withNoResolve {
-			yamlPath = filepath.Join(ruleSetDir, fmt.Sprintf("%s_classical_all_no_resolve.yaml", ruleSet.Name))
-			listPath = filepath.Join(ruleSetDir, fmt.Sprintf("%s_classical_all_no_resolve.list", ruleSet.Name))
-		} else {
-			yamlPath = filepath.Join(ruleSetDir, fmt.Sprintf("%s_classical_all.yaml", ruleSet.Name))
-			listPath = filepath.Join(ruleSetDir, fmt.Sprintf("%s_classical_all.list", ruleSet.Name))
-		}
-	} else {
-		if withNoResolve {
-			yamlPath = filepath.Join(ruleSetDir, fmt.Sprintf("%s_classical_no_resolve.yaml", ruleSet.Name))
-			listPath = filepath.Join(ruleSetDir, fmt.Sprintf("%s_classical_no_resolve.list", ruleSet.Name))
-		} else {
-			yamlPath = filepath.Join(ruleSetDir, fmt.Sprintf("%s_classical.yaml", ruleSet.Name))
-			listPath = filepath.Join(ruleSetDir, fmt.Sprintf("%s_classical.list", ruleSet.Name))
-		}
-	}
-	yamlFile, err := os.Create(yamlPath)
-	if err != nil {
-		return err
-	}
-	defer yamlFile.Close()
-	listFile, err := os.Create(listPath)
-	if err != nil {
-		return err
-	}
-	defer listFile.Close()
-
-	// 写入文件头注释
-	if includeAll {
-		fmt.Fprintf(yamlFile, "# %s - Classical Format (All Rules)\n", ruleSet.Name)
-		fmt.Fprintf(yamlFile, "# Includes all rule types\n")
-		fmt.Fprintf(listFile, "# %s - Classical Format (All Rules)\n", ruleSet.Name)
-		fmt.Fprintf(listFile, "# Includes all rule types\n")
-	} else {
-		fmt.Fprintf(yamlFile, "# %s - Classical Format (Other Rules)\n", ruleSet.Name)
-		fmt.Fprintf(yamlFile, "# Excludes rules that can use domain.list (DOMAIN/DOMAIN-SUFFIX)\n")
-		fmt.Fprintf(yamlFile, "# and ipcidr.list (IP-CIDR/IP-CIDR6)\n")
-		fmt.Fprintf(listFile, "# %s - Classical Format (Other Rules)\n", ruleSet.Name)
-		fmt.Fprintf(listFile, "# Excludes rules that can use domain.list (DOMAIN/DOMAIN-SUFFIX)\n")
-		fmt.Fprintf(listFile, "# and ipcidr.list (IP-CIDR/IP-CIDR6)\n")
-	}
-	if withNoResolve {
-		fmt.Fprintf(yamlFile, "# IP-CIDR rules include 'no-resolve' parameter\n")
-		fmt.Fprintf(listFile, "# IP-CIDR rules include 'no-resolve' parameter\n")
-	} else {
-		fmt.Fprintf(yamlFile, "# IP-CIDR rules exclude 'no-resolve' parameter\n")
-		fmt.Fprintf(listFile, "# IP-CIDR rules exclude 'no-resolve' parameter\n")
-	}
-	fmt.Fprintf(yamlFile, "# Rules are optimized and sorted for best performance\n")
-	fmt.Fprintf(listFile, "# Rules are optimized and sorted for best performance\n")
-
-	// 输出 payload 头
-	fmt.Fprintf(yamlFile, "payload:\n")
-
+func (o *Optimizer) collectClassicalSections(ruleSet *RuleSet, includeAll bool, withNoResolve bool) []classicalSection {
 	// 定义可以被 domain.list 和 ipcidr.list 处理的规则类型
 	domainListTypes := map[RuleType]bool{
 		RuleTypeDomain:       true,
@@ -688,17 +1269,8 @@ func (o *Optimizer) exportClassical(ruleSet *RuleSet, ruleSetDir string, include
 		RuleTypeIPCIDR:  true,
 		RuleTypeIPCIDR6: true,
 	}
-	orderedTypes := []RuleType{
-		RuleTypeDomain, RuleTypeDomainSuffix, RuleTypeDomainKeyword, RuleTypeDomainWildcard, RuleTypeDomainRegex,
-		RuleTypeIPCIDR, RuleTypeIPCIDR6, RuleTypeSrcIPCIDR, RuleTypeSrcIPCIDR6, RuleTypeIPSuffix, RuleTypeSrcIPSuffix, RuleTypeIPASN, RuleTypeSrcIPASN,
-		RuleTypeGeoIP, RuleTypeSrcGeoIP, RuleTypeGeoSite,
-		RuleTypeProcessName, RuleTypeProcessPath, RuleTypeProcessNameRegex, RuleTypeProcessPathRegex,
-		RuleTypeDstPort, RuleTypeSrcPort, RuleTypeInPort,
-		RuleTypeNetwork, RuleTypeUid, RuleTypeInType, RuleTypeInUser, RuleTypeInName, RuleTypeDSCP,
-		RuleTypeRuleSet, RuleTypeSubRules,
-	}
-	totalRules := 0
-	for _, ruleType := range orderedTypes {
+	var sections []classicalSection
+	for _, ruleType := range classicalTypeOrder {
 		rules, exists := ruleSet.Rules[ruleType]
 		if !exists || len(rules) == 0 {
 			continue
@@ -717,79 +1289,204 @@ func (o *Optimizer) exportClassical(ruleSet *RuleSet, ruleSetDir string, include
 		}
 
 		// 先应用过滤器
-		filtered := o.applyRuleFilters(rules, ruleType, ruleSet.Filters, ruleSet.Excludes)
+		filtered := o.filteredRules(ruleSet, ruleType)
+		if ruleType == RuleTypeDomainWildcard && o.domainIncludeWildcard && !includeAll {
+			// 已导出到 domain.list 的通配符不再重复输出
+			filtered = inexpressibleWildcards(filtered)
+		}
 		if len(filtered) == 0 {
 			continue
 		}
 
-		// YAML 输出
-		fmt.Fprintf(yamlFile, "\n  # %s (%d rules)\n", ruleType, len(filtered))
+		// no-resolve 只对需要解析目标 IP 的规则有意义，其他类型上的 no-resolve 来自脏数据，导出时移除
+		if !supportsNoResolve(ruleType) {
+			filtered = o.stripInvalidNoResolve(ruleSet.Name, ruleType, filtered)
+		}
+
+		processed := make([]string, 0, len(filtered))
 		for _, rule := range filtered {
 			// 对于 IP-CIDR 和 IP-CIDR6 类型，根据 withNoResolve 参数处理 no-resolve
 			processedRule := rule
 			if ruleType == RuleTypeIPCIDR || ruleType == RuleTypeIPCIDR6 {
 				if withNoResolve {
 					// 确保有 no-resolve 参数
-					if !strings.Contains(rule, "no-resolve") {
+					if !hasOption(rule, "no-resolve") {
 						processedRule = rule + ",no-resolve"
 					}
 				} else {
 					// 移除 no-resolve 参数
-					parts := strings.Split(rule, ",")
-					cleanParts := []string{}
-					for _, part := range parts {
-						if strings.TrimSpace(part) != "no-resolve" {
-							cleanParts = append(cleanParts, part)
-						}
-					}
-					processedRule = strings.Join(cleanParts, ",")
+					processedRule = removeNoResolve(rule)
 				}
 			}
-			fmt.Fprintf(yamlFile, "  - '%s,%s'\n", ruleType, processedRule)
-			totalRules++
+			processed = append(processed, processedRule)
 		}
-		// list 输出
-		fmt.Fprintf(listFile, "\n# %s (%d rules)\n", ruleType, len(filtered))
-		for _, rule := range filtered {
-			// 对于 IP-CIDR 和 IP-CIDR6 类型，根据 withNoResolve 参数处理 no-resolve
-			processedRule := rule
-			if ruleType == RuleTypeIPCIDR || ruleType == RuleTypeIPCIDR6 {
-				if withNoResolve {
-					// 确保有 no-resolve 参数
-					if !strings.Contains(rule, "no-resolve") {
-						processedRule = rule + ",no-resolve"
-					}
-				} else {
-					// 移除 no-resolve 参数
-					parts := strings.Split(rule, ",")
-					cleanParts := []string{}
-					for _, part := range parts {
-						if strings.TrimSpace(part) != "no-resolve" {
-							cleanParts = append(cleanParts, part)
-						}
-					}
-					processedRule = strings.Join(cleanParts, ",")
-				}
+		sections = append(sections, classicalSection{ruleType: ruleType, rules: processed})
+	}
+
+	if o.wildcardAsRegex {
+		sections = o.convertWildcardSections(ruleSet.Name, sections)
+	}
+	return sections
+}
+
+// supportsNoResolve 规则类型是否支持 no-resolve 参数（需要解析目标 IP 的规则）
+func supportsNoResolve(ruleType RuleType) bool {
+	switch ruleType {
+	case RuleTypeIPCIDR, RuleTypeIPCIDR6, RuleTypeIPSuffix, RuleTypeIPASN, RuleTypeGeoIP, RuleTypeRuleSet:
+		return true
+	}
+	return false
+}
+
+// stripInvalidNoResolve 移除不支持 no-resolve 的规则上的 no-resolve 参数，并记录警告
+func (o *Optimizer) stripInvalidNoResolve(ruleSetName string, ruleType RuleType, rules []string) []string {
+	var result []string
+	stripped := 0
+	for i, rule := range rules {
+		if !hasOption(rule, "no-resolve") {
+			if result != nil {
+				result = append(result, rule)
 			}
-			fmt.Fprintf(listFile, "%s,%s\n", ruleType, processedRule)
+			continue
+		}
+		if result == nil {
+			result = append(make([]string, 0, len(rules)), rules[:i]...)
 		}
+		result = append(result, removeNoResolve(rule))
+		stripped++
 	}
-	if totalRules > 0 {
-		log.Info().Msgf("生成文件: %s, %s (%d 条规则)", yamlPath, listPath, totalRules)
+	if stripped == 0 {
+		return rules
+	}
+
+	if o.logOnce("no-resolve:" + ruleSetName + ":" + string(ruleType)) {
+		log.Warn().Msgf("规则集 '%s': %d 条 %s 规则带有无意义的 no-resolve 参数，导出时已移除", ruleSetName, stripped, ruleType)
+	}
+	return result
+}
+
+// stripOptions 移除规则的所有参数，只保留 payload（domain/ipcidr behavior 不支持参数）
+func stripOptions(rule string) string {
+	payload, _, _ := strings.Cut(rule, ",")
+	return payload
+}
+
+// hasOption 判断规则是否带有指定参数（不区分大小写，与 known_options 一致）
+func hasOption(rule string, option string) bool {
+	parts := strings.Split(rule, ",")
+	for _, part := range parts[1:] {
+		if strings.EqualFold(strings.TrimSpace(part), option) {
+			return true
+		}
+	}
+	return false
+}
+
+// lowercaseNoResolve 将规则中 no-resolve 参数的其他大小写写法（如 NO-RESOLVE）统一为 no-resolve
+func lowercaseNoResolve(rule string) string {
+	parts := strings.Split(rule, ",")
+	for i := 1; i < len(parts); i++ {
+		if strings.EqualFold(strings.TrimSpace(parts[i]), "no-resolve") {
+			parts[i] = "no-resolve"
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// removeNoResolve 移除规则中的 no-resolve 参数（不区分大小写），其他参数（如 src）保持原样
+func removeNoResolve(rule string) string {
+	parts := strings.Split(rule, ",")
+	cleanParts := []string{}
+	for i, part := range parts {
+		if i == 0 || !strings.EqualFold(strings.TrimSpace(part), "no-resolve") {
+			cleanParts = append(cleanParts, part)
+		}
+	}
+	return strings.Join(cleanParts, ",")
+}
+
+// writePayload 写入 domain/ipcidr behavior 的规则（YAML 或纯文本）
+func writePayload(w io.Writer, rules []string, asYAML bool) (int, error) {
+	if len(rules) == 0 {
+		if asYAML {
+			_, err := fmt.Fprintf(w, "# 无规则内容，自动生成占位\npayload: []\n")
+			return 0, err
+		}
+		_, err := fmt.Fprintf(w, "# 无规则内容，自动生成占位\n")
+		return 0, err
+	}
+
+	bw := bufio.NewWriter(w)
+	if asYAML {
+		fmt.Fprintf(bw, "payload:\n")
+		for _, rule := range rules {
+			fmt.Fprintf(bw, "  - '%s'\n", rule)
+		}
+	} else {
+		for _, rule := range rules {
+			fmt.Fprintf(bw, "%s\n", rule)
+		}
+	}
+	return len(rules), bw.Flush()
+}
+
+// writeClassical 写入 classical behavior 的规则（YAML 或纯文本）
+func writeClassical(w io.Writer, name string, sections []classicalSection, includeAll bool, withNoResolve bool, asYAML bool) (int, error) {
+	bw := bufio.NewWriter(w)
+
+	// 写入文件头注释
+	if includeAll {
+		fmt.Fprintf(bw, "# %s - Classical Format (All Rules)\n", name)
+		fmt.Fprintf(bw, "# Includes all rule types\n")
+	} else {
+		fmt.Fprintf(bw, "# %s - Classical Format (Other Rules)\n", name)
+		fmt.Fprintf(bw, "# Excludes rules that can use domain.list (DOMAIN/DOMAIN-SUFFIX)\n")
+		fmt.Fprintf(bw, "# and ipcidr.list (IP-CIDR/IP-CIDR6)\n")
+	}
+	if withNoResolve {
+		fmt.Fprintf(bw, "# IP-CIDR rules include 'no-resolve' parameter\n")
+	} else {
+		fmt.Fprintf(bw, "# IP-CIDR rules exclude 'no-resolve' parameter\n")
 	}
+	fmt.Fprintf(bw, "# Rules are optimized and sorted for best performance\n")
+
+	// 输出 payload 头
+	if asYAML {
+		fmt.Fprintf(bw, "payload:\n")
+	}
+
+	totalRules := 0
+	for _, section := range sections {
+		if asYAML {
+			fmt.Fprintf(bw, "\n  # %s (%d rules)\n", section.ruleType, len(section.rules))
+			for _, rule := range section.rules {
+				fmt.Fprintf(bw, "  - '%s,%s'\n", section.ruleType, rule)
+			}
+		} else {
+			fmt.Fprintf(bw, "\n# %s (%d rules)\n", section.ruleType, len(section.rules))
+			for _, rule := range section.rules {
+				fmt.Fprintf(bw, "%s,%s\n", section.ruleType, rule)
+			}
+		}
+		totalRules += len(section.rules)
+	}
+
 	if totalRules == 0 {
-		fmt.Fprintf(yamlFile, "  # 无规则内容，自动生成占位\n")
-		fmt.Fprintf(listFile, "# 无规则内容，自动生成占位\n")
-		log.Info().Msgf("生成空文件: %s, %s (仅注释)", yamlPath, listPath)
+		if asYAML {
+			fmt.Fprintf(bw, "  # 无规则内容，自动生成占位\n")
+		} else {
+			fmt.Fprintf(bw, "# 无规则内容，自动生成占位\n")
+		}
 	}
-	return nil
+	return totalRules, bw.Flush()
 }
 
 // GetStatistics 获取统计信息
 func (o *Optimizer) GetStatistics() map[string]map[RuleType]int {
 	stats := make(map[string]map[RuleType]int)
 
-	for name, ruleSet := range o.ruleSets {
+	for _, name := range o.RulesetNames() {
+		ruleSet := o.ruleSets[name]
 		stats[name] = make(map[RuleType]int)
 		for ruleType, rules := range ruleSet.Rules {
 			stats[name][ruleType] = len(rules)
@@ -799,12 +1496,44 @@ func (o *Optimizer) GetStatistics() map[string]map[RuleType]int {
 	return stats
 }
 
-// applyRuleFilters 应用规则过滤器和排除规则
+// FilteredStatistics 获取应用 allow_tlds、exclude_private_ips、filters/excludes 之后（即实际导出）的各类型规则数量
+func (o *Optimizer) FilteredStatistics() map[string]map[RuleType]int {
+	stats := make(map[string]map[RuleType]int)
+	for _, name := range o.RulesetNames() {
+		ruleSet := o.ruleSets[name]
+		stats[name] = make(map[RuleType]int)
+		for ruleType := range ruleSet.Rules {
+			stats[name][ruleType] = len(o.filteredRules(ruleSet, ruleType))
+		}
+	}
+	return stats
+}
+
+// filteredRules 返回规则集指定类型应用过滤器后的规则
+// 过滤结果只取决于规则和 Filters/Excludes，与导出格式无关，因此每个类型只过滤一次，
+// 所有导出格式复用（调用方不得修改返回的切片）；规则或过滤器变化时缓存失效
+func (o *Optimizer) filteredRules(ruleSet *RuleSet, ruleType RuleType) []string {
+	if cached, ok := ruleSet.filtered[ruleType]; ok {
+		return cached
+	}
+	result := o.applyRuleFilters(ruleSet.Rules[ruleType], ruleType, ruleSet)
+	if ruleSet.filtered == nil {
+		ruleSet.filtered = make(map[RuleType][]string)
+	}
+	ruleSet.filtered[ruleType] = result
+	return result
+}
+
+// applyRuleFilters 应用规则集的过滤器和排除规则
 // filters: 白名单模式，只保留匹配的规则（为空则保留所有）
 // excludes: 黑名单模式，排除匹配的规则
-// 处理顺序: 先应用 filters，再应用 excludes
-func (o *Optimizer) applyRuleFilters(rules []string, ruleType RuleType, filters []string, excludes []string) []string {
-	if len(rules) == 0 {
+// 处理顺序: 先应用 allow_tlds（只作用于域名类规则）和 exclude_private_ips（只作用于 IP-CIDR/IP-CIDR6），
+// 再应用 filters，最后应用 excludes；模式在规则集内预编译一次，所有导出格式复用
+func (o *Optimizer) applyRuleFilters(rules []string, ruleType RuleType, ruleSet *RuleSet) []string {
+	rules = o.applyAllowTLDs(rules, ruleType, ruleSet)
+	rules = o.applyExcludePrivateIPs(rules, ruleType, ruleSet)
+	filters, excludes := ruleSet.compiledFilters()
+	if len(rules) == 0 || (len(filters) == 0 && len(excludes) == 0) {
 		return rules
 	}
 
@@ -812,59 +1541,40 @@ func (o *Optimizer) applyRuleFilters(rules []string, ruleType RuleType, filters
 
 	// 打印调试信息
 	log.Debug().Msgf("规则过滤 ruleType=%s, filters=%v, excludes=%v, 输入规则数=%d",
-		ruleType, filters, excludes, len(rules))
+		ruleType, ruleSet.Filters, ruleSet.Excludes, len(rules))
 
 	// 打印前3条规则示例
-	if len(rules) > 0 {
-		sampleCount := 3
-		if len(rules) < sampleCount {
-			sampleCount = len(rules)
-		}
-		for i := 0; i < sampleCount; i++ {
-			fullRule := fmt.Sprintf("%s,%s", ruleType, rules[i])
-			log.Debug().Msgf("  规则示例[%d]: %s", i, fullRule)
-		}
+	sampleCount := 3
+	if len(rules) < sampleCount {
+		sampleCount = len(rules)
+	}
+	for i := 0; i < sampleCount; i++ {
+		log.Debug().Msgf("  规则示例[%d]: %s,%s", i, ruleType, rules[i])
 	}
 
 	result := rules // 初始赋值
+	prefix := string(ruleType) + ","
 
 	// 第一步: 应用 filters (白名单)
 	if len(filters) > 0 {
 		filtered := make([]string, 0, len(result))
-		matchedCount := 0
 		for _, rule := range result {
 			// 构造完整规则用于匹配 (格式: RULE-TYPE,payload)
-			fullRule := fmt.Sprintf("%s,%s", ruleType, rule)
-
-			matched := false
-			for _, filter := range filters {
-				if filter == "" {
-					continue
-				}
-				// 使用 glob 模式匹配
-				if m, err := doublestar.Match(filter, fullRule); err == nil && m {
-					matched = true
-					matchedCount++
-					// 打印前几条匹配的规则
-					if matchedCount <= 3 {
-						log.Debug().Msgf("  匹配成功: filter='%s', fullRule='%s'", filter, fullRule)
-					}
-					break
-				} else if err != nil {
-					log.Info().Msgf("过滤器匹配错误: filter='%s', fullRule='%s', err=%v", filter, fullRule, err)
-				} else {
-					// 打印前几条未匹配的规则
-					if len(filtered) == 0 && matchedCount == 0 {
-						log.Debug().Msgf("  匹配失败: filter='%s', fullRule='%s'", filter, fullRule)
-					}
-				}
+			fullRule := prefix + rule
+			if o.isTraced(rule) {
+				o.traceGlobs(ruleSet.Name, "filter", filters, fullRule)
 			}
-
-			if matched {
+			if kept, idx := matchFilters(filters, fullRule); kept {
 				filtered = append(filtered, rule)
+				// 打印前几条匹配的规则
+				if len(filtered) <= 3 && idx >= 0 {
+					log.Debug().Msgf("  匹配成功: filter='%s', fullRule='%s'", filters[idx], fullRule)
+				}
+			} else if len(filtered) == 0 {
+				log.Debug().Msgf("  匹配失败: fullRule='%s'", fullRule)
 			}
 		}
-		log.Info().Msgf("  过滤器匹配统计: 总规则数=%d, 匹配成功=%d", originalCount, matchedCount)
+		log.Info().Msgf("  过滤器匹配统计: 总规则数=%d, 匹配成功=%d", originalCount, len(filtered))
 		result = filtered
 	}
 
@@ -874,28 +1584,19 @@ func (o *Optimizer) applyRuleFilters(rules []string, ruleType RuleType, filters
 		excludedCount := 0
 		for _, rule := range result {
 			// 构造完整规则用于匹配
-			fullRule := fmt.Sprintf("%s,%s", ruleType, rule)
-
-			excluded := false
-			for _, exclude := range excludes {
-				if exclude == "" {
-					continue
-				}
-				// 使用 glob 模式匹配
-				if m, err := doublestar.Match(exclude, fullRule); err == nil && m {
-					excluded = true
-					excludedCount++
-					// 打印前几条被排除的规则
-					if excludedCount <= 3 {
-						log.Debug().Msgf("  规则被排除: exclude='%s', fullRule='%s'", exclude, fullRule)
-					}
-					break
-				}
+			fullRule := prefix + rule
+			if o.isTraced(rule) {
+				o.traceGlobs(ruleSet.Name, "exclude", excludes, fullRule)
 			}
-
-			if !excluded {
-				filtered = append(filtered, rule)
+			if idx := matchAnyGlob(excludes, fullRule); idx >= 0 {
+				excludedCount++
+				// 打印前几条被排除的规则
+				if excludedCount <= 3 {
+					log.Debug().Msgf("  规则被排除: exclude='%s', fullRule='%s'", excludes[idx].pattern, fullRule)
+				}
+				continue
 			}
+			filtered = append(filtered, rule)
 		}
 		if excludedCount > 0 {
 			log.Info().Msgf("  排除规则统计: 总规则数=%d, 被排除=%d, 保留=%d", len(result), excludedCount, len(filtered))
@@ -0,0 +1,208 @@
+package rules
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"rulerefinery/internal/config"
+)
+
+// quietLogs 在测试期间关闭日志（基准测试中逐条规则的调试日志会掩盖实际耗时）
+func quietLogs(tb testing.TB) {
+	tb.Helper()
+	level := zerolog.GlobalLevel()
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+	tb.Cleanup(func() { zerolog.SetGlobalLevel(level) })
+}
+
+// newTestOptimizer 从 规则集名称 -> 规则内容 创建优化器
+func newTestOptimizer(t *testing.T, rulesets map[string]string) *Optimizer {
+	t.Helper()
+	o := NewOptimizer()
+	for name, content := range rulesets {
+		if err := o.LoadRules(strings.NewReader(content), name, "memory"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return o
+}
+
+// readTree 读取目录中的全部文件（相对路径 -> 内容）
+func readTree(t *testing.T, dir string) map[string][]byte {
+	t.Helper()
+	files := make(map[string][]byte)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		files[rel] = data
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestExportIsDeterministic(t *testing.T) {
+	input := map[string]string{
+		"proxy": "DOMAIN-SUFFIX,google.com\nDOMAIN,www.youtube.com\nDOMAIN-KEYWORD,github\nIP-CIDR,8.8.8.0/24,no-resolve\n" +
+			"IP-CIDR6,2001:4860::/32\nDST-PORT,8443\nDST-PORT,443\nDST-PORT,80\nIP-ASN,15169\nIP-ASN,13335\nPROCESS-NAME,curl\n",
+		"direct": "DOMAIN-SUFFIX,baidu.com\nDOMAIN-SUFFIX,qq.com\nIP-CIDR,114.114.114.0/24\nDOMAIN,taobao.com\n",
+		"media":  "DOMAIN-SUFFIX,netflix.com\nDOMAIN-SUFFIX,nflxvideo.net\nIP-CIDR,23.246.0.0/18,no-resolve\n",
+	}
+
+	var outputs []map[string][]byte
+	for i := 0; i < 2; i++ {
+		o := newTestOptimizer(t, input)
+		o.Deduplicate()
+		dir := t.TempDir()
+		if err := o.Export(dir); err != nil {
+			t.Fatal(err)
+		}
+		outputs = append(outputs, readTree(t, dir))
+	}
+
+	first, second := outputs[0], outputs[1]
+	if len(first) == 0 || len(first) != len(second) {
+		t.Fatalf("exported %d and %d files", len(first), len(second))
+	}
+	for path, data := range first {
+		if !bytes.Equal(data, second[path]) {
+			t.Errorf("%s differs between runs:\n%s\n---\n%s", path, data, second[path])
+		}
+	}
+}
+
+// readRuleLines 读取导出的规则文件中的规则行（忽略注释和空行）
+func readRuleLines(t *testing.T, path string) []string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" && !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func TestRulesDifferingOnlyInOptions(t *testing.T) {
+	o := newTestOptimizer(t, map[string]string{
+		"test": "IP-CIDR,1.0.0.0/8\nIP-CIDR,1.0.0.0/8,src\nIP-CIDR6,2001:db8::/32,no-resolve,src\nDST-PORT,53\nDST-PORT,53,src\nDOMAIN,a.com,src\n",
+	})
+	o.Deduplicate()
+	dir := t.TempDir()
+	if err := o.Export(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		file string
+		want []string
+	}{
+		// 参数原样保留，仅参数不同的规则互不合并
+		{"test_classical_all.list", []string{
+			"DOMAIN,a.com,src",
+			"IP-CIDR,1.0.0.0/8",
+			"IP-CIDR,1.0.0.0/8,src",
+			"IP-CIDR6,2001:db8::/32,src",
+			"DST-PORT,53",
+			"DST-PORT,53,src",
+		}},
+		// 只有 no-resolve 被添加或移除，其他参数不变
+		{"test_classical_all_no_resolve.list", []string{
+			"DOMAIN,a.com,src",
+			"IP-CIDR,1.0.0.0/8,no-resolve",
+			"IP-CIDR,1.0.0.0/8,src,no-resolve",
+			"IP-CIDR6,2001:db8::/32,no-resolve,src",
+			"DST-PORT,53",
+			"DST-PORT,53,src",
+		}},
+		// ipcidr behavior 不带参数，去掉参数后重复的网段只保留一条
+		{"test_ipcidr.list", []string{"1.0.0.0/8", "2001:db8::/32"}},
+	}
+	for _, tt := range tests {
+		if got := readRuleLines(t, filepath.Join(dir, "test", tt.file)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s = %v, want %v", tt.file, got, tt.want)
+		}
+	}
+}
+
+func TestDedupCollapsesNoResolveVariants(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []string
+		want  []string
+	}{
+		{"bare then no-resolve", []string{"1.2.3.0/24", "1.2.3.0/24,no-resolve"}, []string{"1.2.3.0/24,no-resolve"}},
+		{"no-resolve then bare", []string{"1.2.3.0/24,no-resolve", "1.2.3.0/24"}, []string{"1.2.3.0/24,no-resolve"}},
+		{"uppercase spelling", []string{"1.2.3.0/24,NO-RESOLVE", "1.2.3.0/24", "1.2.3.0/24,no-resolve"}, []string{"1.2.3.0/24,no-resolve"}},
+		{"other options kept apart", []string{"1.2.3.0/24,src", "1.2.3.0/24,no-resolve,src", "1.2.3.0/24"},
+			[]string{"1.2.3.0/24", "1.2.3.0/24,no-resolve,src"}},
+		{"host bits", []string{"1.2.3.4/24", "1.2.3.0/24,no-resolve"}, []string{"1.2.3.0/24,no-resolve"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := NewOptimizer()
+			got := o.dedupRules("test", RuleTypeIPCIDR, append([]string(nil), tt.rules...))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("dedupRules(%v) = %v, want %v", tt.rules, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilteredStatistics(t *testing.T) {
+	o := newTestOptimizer(t, map[string]string{
+		"test": "DOMAIN-SUFFIX,google.com\nDOMAIN-SUFFIX,youtube.com\nDOMAIN-KEYWORD,ads\n",
+	})
+	if err := o.SetRulesetFilters("test", nil, []string{"DOMAIN-SUFFIX,youtube*"}); err != nil {
+		t.Fatal(err)
+	}
+	o.Deduplicate()
+
+	got := o.FilteredStatistics()["test"]
+	if got[RuleTypeDomainSuffix] != 1 || got[RuleTypeDomainKeyword] != 1 {
+		t.Errorf("FilteredStatistics() = %v, want 1 DOMAIN-SUFFIX and 1 DOMAIN-KEYWORD", got)
+	}
+	if all := o.GetStatistics()["test"]; all[RuleTypeDomainSuffix] != 2 {
+		t.Errorf("GetStatistics() = %v, want unfiltered count 2 for DOMAIN-SUFFIX", all)
+	}
+}
+
+func TestDomainSuffixPayload(t *testing.T) {
+	tests := []struct {
+		mode, rule, want string
+	}{
+		{config.SuffixModePlus, "example.com", "+.example.com"},
+		{config.SuffixModePlus, ".example.com", "+.example.com"},
+		{config.SuffixModeDot, "+.example.com", ".example.com"},
+		{config.SuffixModeDot, "example.com", ".example.com"},
+		{config.SuffixModePreserve, ".example.com", ".example.com"},
+		{config.SuffixModePreserve, "example.com", "+.example.com"},
+		{"", "example.com", "+.example.com"},
+	}
+	for _, tt := range tests {
+		o := NewOptimizer()
+		o.SetSuffixMode(tt.mode)
+		if got := o.domainSuffixPayload(tt.rule); got != tt.want {
+			t.Errorf("domainSuffixPayload(%q) with mode %q = %q, want %q", tt.rule, tt.mode, got, tt.want)
+		}
+	}
+}
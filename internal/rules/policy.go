@@ -0,0 +1,88 @@
+package rules
+
+import (
+	"strings"
+)
+
+// DefaultRuleOptions 默认识别为规则参数的字段（Mihomo 支持的规则参数）
+var DefaultRuleOptions = []string{"no-resolve", "src"}
+
+// defaultOptionSet DefaultRuleOptions 的查找表（ParseRule 使用）
+var defaultOptionSet = newOptionSet(nil)
+
+// newOptionSet 创建规则参数查找表（不区分大小写），names 为空时使用 DefaultRuleOptions
+func newOptionSet(names []string) map[string]bool {
+	set := make(map[string]bool)
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name != "" {
+			set[strings.ToLower(name)] = true
+		}
+	}
+	if len(set) == 0 {
+		for _, name := range DefaultRuleOptions {
+			set[name] = true
+		}
+	}
+	return set
+}
+
+// splitPolicy 将 payload 之后的字段分为策略和参数：属于 options 的字段保留为参数（按原顺序），
+// 其余字段视为策略（如 DOMAIN-SUFFIX,example.com,Proxy 中的 Proxy），多个时按原顺序以逗号连接
+// 完整规则行中的策略不是规则参数，不能当作 no-resolve 一样导出
+func splitPolicy(fields []string, options map[string]bool) (policy string, kept []string) {
+	var policies []string
+	for _, field := range fields {
+		if options[strings.ToLower(field)] {
+			kept = append(kept, field)
+		} else {
+			policies = append(policies, field)
+		}
+	}
+	return strings.Join(policies, ","), kept
+}
+
+// splitLogicPayload 处理逻辑规则（如 AND,((DOMAIN,a.com),(NETWORK,UDP)),REJECT）：
+// payload 以括号开头时，payload 为到匹配的右括号为止的全部内容，返回之后的字段；括号不匹配时 ok 为 false
+func splitLogicPayload(rest string) (payload string, fields []string, ok bool) {
+	if !strings.HasPrefix(rest, "(") {
+		return "", nil, false
+	}
+	depth := 0
+	for i, c := range rest {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		}
+		if depth == 0 {
+			payload, tail := rest[:i+1], strings.TrimSpace(rest[i+1:])
+			if tail == "" {
+				return payload, nil, true
+			}
+			if !strings.HasPrefix(tail, ",") {
+				return "", nil, false
+			}
+			return payload, strings.Split(tail[1:], ","), true
+		}
+	}
+	return "", nil, false
+}
+
+// SetKnownOptions 设置识别为规则参数的字段（默认 no-resolve、src），payload 之后的其他字段视为策略
+// 必须在 LoadRuleFile 之前设置
+func (o *Optimizer) SetKnownOptions(names []string) {
+	o.ruleOptions = newOptionSet(names)
+}
+
+// SetAppendPolicy 设置是否在 classical 输出中保留规则行中的策略（如 DOMAIN-SUFFIX,example.com,Proxy）
+// 默认移除策略：rule-provider 中的规则不能带策略。domain/ipcidr 输出总是不含策略
+// 必须在 LoadRuleFile 之前设置
+func (o *Optimizer) SetAppendPolicy(enabled bool) {
+	o.appendPolicy = enabled
+}
+
+// PolicyCount 返回加载时从规则行中识别出策略的规则数量
+func (o *Optimizer) PolicyCount() int {
+	return o.policyCount
+}
@@ -0,0 +1,96 @@
+package rules
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		fields  []string
+		options []string // known_options，为空时使用默认值
+		policy  string
+		kept    []string
+	}{
+		{"policy only", []string{"Proxy"}, nil, "Proxy", nil},
+		{"option only", []string{"no-resolve"}, nil, "", []string{"no-resolve"}},
+		{"policy then option", []string{"DIRECT", "no-resolve"}, nil, "DIRECT", []string{"no-resolve"}},
+		{"last field is option", []string{"Proxy", "src"}, nil, "Proxy", []string{"src"}},
+		{"option case-insensitive", []string{"No-Resolve"}, nil, "", []string{"No-Resolve"}},
+		{"multiple policy fields", []string{"Proxy", "extra", "no-resolve"}, nil, "Proxy,extra", []string{"no-resolve"}},
+		{"custom option not a policy", []string{"Proxy", "extra"}, []string{"no-resolve", "extra"}, "Proxy", []string{"extra"}},
+		{"custom options replace defaults", []string{"src"}, []string{"extra"}, "src", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, kept := splitPolicy(tt.fields, newOptionSet(tt.options))
+			if policy != tt.policy || !reflect.DeepEqual(kept, tt.kept) {
+				t.Errorf("splitPolicy(%v) = %q, %v, want %q, %v", tt.fields, policy, kept, tt.policy, tt.kept)
+			}
+		})
+	}
+}
+
+func TestSplitLogicPayload(t *testing.T) {
+	tests := []struct {
+		rest    string
+		payload string
+		fields  []string
+		ok      bool
+	}{
+		{"((DOMAIN,a.com),(NETWORK,UDP))", "((DOMAIN,a.com),(NETWORK,UDP))", nil, true},
+		{"((DOMAIN,a.com),(NETWORK,UDP)),REJECT", "((DOMAIN,a.com),(NETWORK,UDP))", []string{"REJECT"}, true},
+		{"((DOMAIN,a.com),(NETWORK,UDP)),REJECT,no-resolve", "((DOMAIN,a.com),(NETWORK,UDP))", []string{"REJECT", "no-resolve"}, true},
+		{"((IP-CIDR,1.0.0.0/8)),no-resolve", "((IP-CIDR,1.0.0.0/8))", []string{"no-resolve"}, true},
+		{"((DOMAIN,a.com)", "", nil, false},
+		{"((DOMAIN,a.com))x", "", nil, false},
+		{"DOMAIN,a.com", "", nil, false},
+	}
+	for _, tt := range tests {
+		payload, fields, ok := splitLogicPayload(tt.rest)
+		if payload != tt.payload || !reflect.DeepEqual(fields, tt.fields) || ok != tt.ok {
+			t.Errorf("splitLogicPayload(%q) = %q, %v, %v, want %q, %v, %v", tt.rest, payload, fields, ok, tt.payload, tt.fields, tt.ok)
+		}
+	}
+}
+
+func TestPolicySuffixedRules(t *testing.T) {
+	input := "DOMAIN-SUFFIX,example.com,Proxy\nIP-CIDR,1.0.0.0/8,DIRECT,no-resolve\nDOMAIN,b.com,extra\n"
+	tests := []struct {
+		name         string
+		knownOptions []string
+		want         []string
+	}{
+		{
+			name: "default options",
+			want: []string{"DOMAIN,b.com", "DOMAIN-SUFFIX,example.com", "IP-CIDR,1.0.0.0/8,no-resolve"},
+		},
+		{
+			name:         "extra as known option",
+			knownOptions: []string{"no-resolve", "src", "extra"},
+			want:         []string{"DOMAIN,b.com,extra", "DOMAIN-SUFFIX,example.com", "IP-CIDR,1.0.0.0/8,no-resolve"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := NewOptimizer()
+			if tt.knownOptions != nil {
+				o.SetKnownOptions(tt.knownOptions)
+			}
+			if err := o.LoadRules(strings.NewReader(input), "test", "memory"); err != nil {
+				t.Fatal(err)
+			}
+			o.Deduplicate()
+			dir := t.TempDir()
+			if err := o.Export(dir); err != nil {
+				t.Fatal(err)
+			}
+			if got := readRuleLines(t, filepath.Join(dir, "test", "test_classical_all_no_resolve.list")); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("test_classical_all_no_resolve.list = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
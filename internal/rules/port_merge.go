@@ -0,0 +1,106 @@
+package rules
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SetMergePorts 设置去重时是否合并端口规则（DST-PORT、SRC-PORT、IN-PORT）：
+// 连续或重叠的端口和端口范围合并为一个范围，如 80、81、82-90 合并为 80-90
+// 默认关闭；与网段合并一样，合并只发生在参数相同的规则之间
+func (o *Optimizer) SetMergePorts(enabled bool) {
+	o.mergePorts = enabled
+}
+
+// isPortRuleType 判断规则类型的 payload 是否为端口或端口范围
+func isPortRuleType(ruleType RuleType) bool {
+	switch ruleType {
+	case RuleTypeDstPort, RuleTypeSrcPort, RuleTypeInPort:
+		return true
+	}
+	return false
+}
+
+// portRange 闭区间端口范围
+type portRange struct {
+	start, end int
+}
+
+// String 返回端口规则的 payload：单个端口为 "80"，范围为 "80-90"
+func (r portRange) String() string {
+	if r.start == r.end {
+		return strconv.Itoa(r.start)
+	}
+	return strconv.Itoa(r.start) + "-" + strconv.Itoa(r.end)
+}
+
+// parsePortRange 解析 "80" 或 "80-90" 形式的 payload（端口 0-65535，起始不大于结束）
+func parsePortRange(payload string) (portRange, bool) {
+	startText, endText, isRange := strings.Cut(strings.TrimSpace(payload), "-")
+	if !isRange {
+		endText = startText
+	}
+	start, err := strconv.Atoi(strings.TrimSpace(startText))
+	if err != nil || start < 0 || start > 65535 {
+		return portRange{}, false
+	}
+	end, err := strconv.Atoi(strings.TrimSpace(endText))
+	if err != nil || end < start || end > 65535 {
+		return portRange{}, false
+	}
+	return portRange{start: start, end: end}, true
+}
+
+// mergePorts 合并端口规则，返回合并后的规则（未排序）和减少的规则数量
+// 参数不同的规则分别合并；无法解析的规则（如 Mihomo 的 80/443 多端口写法）原样保留
+func mergePorts(rules []string) ([]string, int) {
+	groups := make(map[string][]portRange) // 参数 -> 端口范围
+	var options []string
+	merged := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		payload, opts, _ := strings.Cut(rule, ",")
+		r, ok := parsePortRange(payload)
+		if !ok {
+			merged = append(merged, rule)
+			continue
+		}
+		if _, exists := groups[opts]; !exists {
+			options = append(options, opts)
+		}
+		groups[opts] = append(groups[opts], r)
+	}
+
+	for _, opts := range options {
+		for _, r := range mergePortRanges(groups[opts]) {
+			rule := r.String()
+			if opts != "" {
+				rule += "," + opts
+			}
+			merged = append(merged, rule)
+		}
+	}
+	return merged, len(rules) - len(merged)
+}
+
+// mergePortRanges 合并重叠或相邻（如 80-85 与 86）的端口范围，返回按起始端口排序的结果（会修改输入切片的顺序）
+func mergePortRanges(ranges []portRange) []portRange {
+	sort.Slice(ranges, func(i, j int) bool {
+		if ranges[i].start != ranges[j].start {
+			return ranges[i].start < ranges[j].start
+		}
+		return ranges[i].end < ranges[j].end
+	})
+
+	result := make([]portRange, 0, len(ranges))
+	for _, r := range ranges {
+		if n := len(result); n > 0 && r.start <= result[n-1].end+1 {
+			if r.end > result[n-1].end {
+				result[n-1].end = r.end
+			}
+			continue
+		}
+		result = append(result, r)
+	}
+	return result
+}
@@ -0,0 +1,107 @@
+package rules
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// privateIPTypes exclude_private_ips 作用的规则类型（目标地址；SRC-IP-CIDR 匹配的是局域网来源，不受影响）
+var privateIPTypes = map[RuleType]bool{
+	RuleTypeIPCIDR:  true,
+	RuleTypeIPCIDR6: true,
+}
+
+// privateIPRanges 私有和保留地址段（RFC 1918、回环、链路本地、CGNAT、文档、基准测试、组播等）
+var privateIPRanges = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("10.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("127.0.0.0/8"),
+	netip.MustParsePrefix("169.254.0.0/16"),
+	netip.MustParsePrefix("172.16.0.0/12"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("192.168.0.0/16"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+	netip.MustParsePrefix("224.0.0.0/4"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("::/128"),
+	netip.MustParsePrefix("::1/128"),
+	netip.MustParsePrefix("::ffff:0:0/96"),
+	netip.MustParsePrefix("2001:db8::/32"),
+	netip.MustParsePrefix("fc00::/7"),
+	netip.MustParsePrefix("fe80::/10"),
+	netip.MustParsePrefix("ff00::/8"),
+}
+
+// SetRulesetExcludePrivateIPs 设置导出时是否移除规则集中完全位于私有/保留地址段内的 IP-CIDR/IP-CIDR6 规则
+// （如代理规则集中的 192.168.0.0/16、127.0.0.1/32），与 allow_tlds 一样在 filters 之前应用
+func (o *Optimizer) SetRulesetExcludePrivateIPs(ruleSetName string, enabled bool) error {
+	ruleSet, exists := o.ruleSets[ruleSetName]
+	if !exists {
+		return fmt.Errorf("规则集 '%s' 不存在", ruleSetName)
+	}
+	ruleSet.ExcludePrivateIPs = enabled
+	ruleSet.filtered = nil
+	if enabled {
+		log.Info().Msgf("规则集 '%s': 导出时移除私有/保留地址段内的 IP 网段", ruleSetName)
+	}
+	return nil
+}
+
+// isPrivateCIDR 判断网段是否完全位于某个私有/保留地址段内（无法解析时返回 false，包含私有地址的更大网段如 0.0.0.0/0 不算）
+func isPrivateCIDR(payload string) bool {
+	payload = stripOptions(payload)
+	var prefix netip.Prefix
+	if strings.Contains(payload, "/") {
+		p, err := netip.ParsePrefix(payload)
+		if err != nil {
+			return false
+		}
+		prefix = p
+	} else {
+		addr, err := netip.ParseAddr(payload)
+		if err != nil {
+			return false
+		}
+		prefix = netip.PrefixFrom(addr, addr.BitLen())
+	}
+
+	for _, r := range privateIPRanges {
+		if r.Bits() <= prefix.Bits() && r.Contains(prefix.Addr()) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyExcludePrivateIPs 按规则集的 exclude_private_ips 移除私有/保留地址段内的网段，其他类型原样返回
+func (o *Optimizer) applyExcludePrivateIPs(rules []string, ruleType RuleType, ruleSet *RuleSet) []string {
+	if !ruleSet.ExcludePrivateIPs || !privateIPTypes[ruleType] || len(rules) == 0 {
+		return rules
+	}
+
+	kept := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		private := isPrivateCIDR(rule)
+		if o.isTraced(rule) {
+			result := "保留"
+			if private {
+				result = "被移除（私有/保留地址段，exclude_private_ips）"
+			}
+			log.Info().Msgf("[追踪] 规则集 '%s': %s,%s %s", ruleSet.Name, ruleType, rule, result)
+		}
+		if !private {
+			kept = append(kept, rule)
+		}
+	}
+	if removed := len(rules) - len(kept); removed > 0 {
+		log.Info().Msgf("规则集 '%s': exclude_private_ips 移除 %d 条私有/保留地址段内的 %s 规则", ruleSet.Name, removed, ruleType)
+	}
+	return kept
+}
@@ -0,0 +1,105 @@
+package rules
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// ProviderConfigFile 规则提供者配置片段的文件名（写入输出目录根部）
+const ProviderConfigFile = "rule-providers.yaml"
+
+// providerBehaviors 片段中声明的导出类型及对应的 behavior（性能优先组合）
+var providerBehaviors = []struct {
+	kind     string
+	behavior string
+}{
+	{ExportKindDomain, "domain"},
+	{ExportKindIPCIDR, "ipcidr"},
+	{ExportKindClassical, "classical"},
+}
+
+// ExportProviderConfig 根据 Export 实际生成的文件写入 Mihomo rule-providers 配置片段
+// 每个规则集只声明非空的 domain/ipcidr/classical 文件（type: file），
+// 可直接粘贴到 Clash/Mihomo 配置中；pathPrefix 为配置中引用规则文件使用的目录。
+// format 为 yaml 时引用 YAML 文件，为 text 时引用纯文本文件，并设置对应的 format 字段。
+// 必须在 Export 之后调用
+func (o *Optimizer) ExportProviderConfig(outputDir string, pathPrefix string, format string) (string, error) {
+	listExt, yamlExt := o.fileExtensions()
+	return WriteProviderConfig(outputDir, pathPrefix, format, listExt, yamlExt, o.layout, o.exportCounts)
+}
+
+// WriteProviderConfig 根据导出数量（规则集 -> 导出类型 -> 数量，见 Optimizer.ExportCounts）写入 rule-providers 配置片段
+// 用于多个优化器分别导出规则集的场景（如低内存模式），layout 为导出的目录结构，其余参数含义同 ExportProviderConfig
+func WriteProviderConfig(outputDir string, pathPrefix string, format string, listExt string, yamlExt string, layout string, exportCounts map[string]map[string]int) (string, error) {
+	ext := yamlExt
+	switch format {
+	case "", "yaml":
+		format = "yaml"
+	case "text":
+		ext = listExt
+	default:
+		return "", fmt.Errorf("不支持的 rule-provider 格式: %s（可选: yaml/text）", format)
+	}
+
+	snippetPath := filepath.Join(outputDir, ProviderConfigFile)
+
+	f, err := os.Create(snippetPath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	bw := bufio.NewWriter(f)
+	fmt.Fprintf(bw, "# Mihomo rule-providers 配置片段，由 RuleRefinery 根据导出的规则文件自动生成\n")
+	fmt.Fprintf(bw, "# path 相对于生成时的工作目录，请按 Mihomo 配置目录调整\n")
+	fmt.Fprintf(bw, "rule-providers:\n")
+
+	names := make([]string, 0, len(exportCounts))
+	for name := range exportCounts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var ruleRefs []string
+	for _, name := range names {
+		counts := exportCounts[name]
+
+		declared := 0
+		for _, pb := range providerBehaviors {
+			if counts[pb.kind] == 0 {
+				continue
+			}
+			providerName := fmt.Sprintf("%s_%s", name, pb.kind)
+			fmt.Fprintf(bw, "  %s:\n", strconv.Quote(providerName))
+			fmt.Fprintf(bw, "    type: file\n")
+			fmt.Fprintf(bw, "    behavior: %s\n", pb.behavior)
+			fmt.Fprintf(bw, "    format: %s\n", format)
+			fmt.Fprintf(bw, "    path: %s\n", strconv.Quote(path.Join(filepath.ToSlash(pathPrefix), ExportRelPath(layout, name, pb.kind, ext))))
+			ruleRefs = append(ruleRefs, providerName)
+			declared++
+		}
+		if declared == 0 {
+			fmt.Fprintf(bw, "  # %s: 没有非空的 domain/ipcidr/classical 规则文件\n", name)
+		}
+	}
+	if len(ruleRefs) == 0 {
+		fmt.Fprintf(bw, "  {}\n")
+	}
+
+	// rules 引用示例（策略名称需按实际配置修改）
+	fmt.Fprintf(bw, "\n# rules 引用示例（将 PROXY 替换为实际的策略组）:\n")
+	fmt.Fprintf(bw, "# rules:\n")
+	for _, ref := range ruleRefs {
+		fmt.Fprintf(bw, "#   - RULE-SET,%s,PROXY\n", ref)
+	}
+
+	if err := bw.Flush(); err != nil {
+		return "", err
+	}
+	return snippetPath, nil
+}
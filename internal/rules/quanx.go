@@ -0,0 +1,119 @@
+package rules
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"rulerefinery/internal/config"
+)
+
+// ruleTypeUserAgent Surge/Quantumult X 的 USER-AGENT 规则（Mihomo 不支持，来自 Surge 规则文件时原样保留类型）
+const ruleTypeUserAgent RuleType = "USER-AGENT"
+
+// quanxRuleTypes 规则类型到 Quantumult X 分流规则类型的映射，不在表中的类型 Quantumult X 无法表示，导出时跳过
+var quanxRuleTypes = map[RuleType]string{
+	RuleTypeDomain:         "host",
+	RuleTypeDomainSuffix:   "host-suffix",
+	RuleTypeDomainKeyword:  "host-keyword",
+	RuleTypeDomainWildcard: "host-wildcard",
+	RuleTypeIPCIDR:         "ip-cidr",
+	RuleTypeIPCIDR6:        "ip6-cidr",
+	RuleTypeGeoIP:          "geoip",
+	ruleTypeUserAgent:      "user-agent",
+}
+
+// SetRulesetPolicy 设置规则集在 Quantumult X 导出中使用的策略，为空时使用 PROXY
+func (o *Optimizer) SetRulesetPolicy(ruleSetName string, policy string) error {
+	ruleSet, exists := o.ruleSets[ruleSetName]
+	if !exists {
+		return fmt.Errorf("规则集 '%s' 不存在", ruleSetName)
+	}
+	ruleSet.Policy = policy
+	return nil
+}
+
+// quanxRule 将规则转换为 Quantumult X 语法（type, payload, policy[, no-resolve]），无法表示时返回 false
+// 带 src 参数的 IP-CIDR 匹配来源 IP，Quantumult X 没有对应写法
+func quanxRule(ruleType RuleType, rule string, policy string) (string, bool) {
+	quanxType, ok := quanxRuleTypes[ruleType]
+	if !ok || hasOption(rule, "src") {
+		return "", false
+	}
+	payload := stripOptions(rule)
+	if ruleType == RuleTypeDomainSuffix {
+		payload = strings.TrimPrefix(payload, "+.")
+	}
+	line := quanxType + ", " + payload + ", " + policy
+	if hasOption(rule, "no-resolve") {
+		switch ruleType {
+		case RuleTypeIPCIDR, RuleTypeIPCIDR6, RuleTypeGeoIP:
+			line += ", no-resolve"
+		}
+	}
+	return line, true
+}
+
+// exportQuantumultX 导出 Quantumult X 分流规则 {name}_quanx.list，返回写入的规则数量
+// 每行一条小写类型的规则，策略取自规则集的 Policy（默认 PROXY）；Quantumult X 无法表示的类型跳过并记录警告
+func (o *Optimizer) exportQuantumultX(ruleSet *RuleSet, outputDir string) (int, error) {
+	policy := ruleSet.Policy
+	if policy == "" {
+		policy = config.DefaultQuantumultXPolicy
+	}
+
+	ruleTypes := make([]RuleType, 0, len(ruleSet.Rules))
+	for ruleType := range ruleSet.Rules {
+		ruleTypes = append(ruleTypes, ruleType)
+	}
+	sort.Slice(ruleTypes, func(i, j int) bool { return ruleTypes[i] < ruleTypes[j] })
+
+	var lines []string
+	for _, ruleType := range ruleTypes {
+		rules := o.filteredRules(ruleSet, ruleType)
+		if len(rules) == 0 {
+			continue
+		}
+		skipped := 0
+		for _, rule := range rules {
+			line, ok := quanxRule(ruleType, rule, policy)
+			if !ok {
+				skipped++
+				continue
+			}
+			lines = append(lines, line)
+		}
+		if skipped > 0 {
+			log.Warn().Msgf("规则集 '%s': Quantumult X 无法表示 %d 条 %s 规则，已跳过", ruleSet.Name, skipped, ruleType)
+		}
+	}
+	// DOMAIN-SUFFIX 的不同写法（如 +.a.com 与 a.com）转换后可能重复
+	lines = mergeUniqueRules(lines, nil)
+
+	path, err := o.exportPath(outputDir, ruleSet.Name, exportGroupQuanX, ".list")
+	if err != nil {
+		return 0, err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	bw := bufio.NewWriter(f)
+	fmt.Fprintf(bw, "# NAME: %s\n", ruleSet.Name)
+	fmt.Fprintf(bw, "# TOTAL: %d\n", len(lines))
+	fmt.Fprintf(bw, "# 由 RuleRefinery 生成，Quantumult X 分流规则（filter_remote）\n")
+	for _, line := range lines {
+		fmt.Fprintln(bw, line)
+	}
+	if err := bw.Flush(); err != nil {
+		return 0, err
+	}
+	log.Info().Msgf("生成文件: %s (%d 条规则)", path, len(lines))
+	return len(lines), nil
+}
@@ -0,0 +1,144 @@
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/rs/zerolog/log"
+)
+
+// singboxRuleSetVersion sing-box source 格式规则集的版本
+const singboxRuleSetVersion = 2
+
+// singboxRuleSet sing-box source 格式规则集（{name}_singbox.json）
+type singboxRuleSet struct {
+	Version int                   `json:"version"`
+	Rules   []singboxHeadlessRule `json:"rules"`
+}
+
+// singboxHeadlessRule sing-box headless rule，字段顺序即输出顺序
+type singboxHeadlessRule struct {
+	Domain        []string `json:"domain,omitempty"`
+	DomainSuffix  []string `json:"domain_suffix,omitempty"`
+	DomainKeyword []string `json:"domain_keyword,omitempty"`
+	DomainRegex   []string `json:"domain_regex,omitempty"`
+	SourceIPCIDR  []string `json:"source_ip_cidr,omitempty"`
+	IPCIDR        []string `json:"ip_cidr,omitempty"`
+	ProcessName   []string `json:"process_name,omitempty"`
+	ProcessPath   []string `json:"process_path,omitempty"`
+}
+
+// SetSingboxExport 设置 Export 时是否额外导出 sing-box source 格式规则集（{name}_singbox.json）
+func (o *Optimizer) SetSingboxExport(enabled bool) {
+	o.singboxExport = enabled
+}
+
+// singboxField 返回规则类型在 sing-box headless rule 中对应的字段，不支持的类型返回 nil
+// DOMAIN-WILDCARD 转换为等价的 domain_regex（sing-box 没有通配符匹配）
+func (r *singboxHeadlessRule) singboxField(ruleType RuleType) *[]string {
+	switch ruleType {
+	case RuleTypeDomain:
+		return &r.Domain
+	case RuleTypeDomainSuffix:
+		return &r.DomainSuffix
+	case RuleTypeDomainKeyword:
+		return &r.DomainKeyword
+	case RuleTypeDomainRegex, RuleTypeDomainWildcard:
+		return &r.DomainRegex
+	case RuleTypeIPCIDR, RuleTypeIPCIDR6:
+		return &r.IPCIDR
+	case RuleTypeSrcIPCIDR, RuleTypeSrcIPCIDR6:
+		return &r.SourceIPCIDR
+	case RuleTypeProcessName:
+		return &r.ProcessName
+	case RuleTypeProcessPath:
+		return &r.ProcessPath
+	}
+	return nil
+}
+
+// collectSingboxRule 将规则集（应用过滤器后）的规则按 sing-box 字段收集，返回规则数量
+// 规则的参数（如 no-resolve、src）在 sing-box 中没有对应写法，被移除；不支持的类型（如 IN-USER、GEOSITE）跳过并记录调试日志
+func (o *Optimizer) collectSingboxRule(ruleSet *RuleSet) (singboxHeadlessRule, int) {
+	var rule singboxHeadlessRule
+	ruleTypes := make([]RuleType, 0, len(ruleSet.Rules))
+	for ruleType := range ruleSet.Rules {
+		ruleTypes = append(ruleTypes, ruleType)
+	}
+	sort.Slice(ruleTypes, func(i, j int) bool { return ruleTypes[i] < ruleTypes[j] })
+
+	count := 0
+	for _, ruleType := range ruleTypes {
+		rules := o.filteredRules(ruleSet, ruleType)
+		if len(rules) == 0 {
+			continue
+		}
+		field := rule.singboxField(ruleType)
+		if field == nil {
+			log.Debug().Msgf("规则集 '%s': sing-box 不支持 %s 规则，跳过 %d 条", ruleSet.Name, ruleType, len(rules))
+			continue
+		}
+		for _, r := range rules {
+			payload := stripOptions(r)
+			target := field
+			switch {
+			case ruleType == RuleTypeDomainWildcard:
+				payload = wildcardToRegex(payload)
+			case (ruleType == RuleTypeIPCIDR || ruleType == RuleTypeIPCIDR6) && hasOption(r, "src"):
+				target = &rule.SourceIPCIDR // 带 src 参数的 IP-CIDR 匹配来源 IP
+			}
+			*target = append(*target, payload)
+			count++
+		}
+	}
+	return rule, count
+}
+
+// splitSingboxRule 按 sing-box 的匹配语义拆分 headless rule：同一条规则中 domain*/ip_cidr 之间是“或”关系，
+// 但它们与 source_ip_cidr、process_name、process_path 之间是“与”关系，因此后者各自单独成为一条规则
+// （规则集中的多条规则之间是“或”关系）
+func splitSingboxRule(all singboxHeadlessRule) []singboxHeadlessRule {
+	rules := []singboxHeadlessRule{}
+	destination := singboxHeadlessRule{
+		Domain:        all.Domain,
+		DomainSuffix:  all.DomainSuffix,
+		DomainKeyword: all.DomainKeyword,
+		DomainRegex:   all.DomainRegex,
+		IPCIDR:        all.IPCIDR,
+	}
+	if len(destination.Domain)+len(destination.DomainSuffix)+len(destination.DomainKeyword)+len(destination.DomainRegex)+len(destination.IPCIDR) > 0 {
+		rules = append(rules, destination)
+	}
+	if len(all.SourceIPCIDR) > 0 {
+		rules = append(rules, singboxHeadlessRule{SourceIPCIDR: all.SourceIPCIDR})
+	}
+	if len(all.ProcessName) > 0 {
+		rules = append(rules, singboxHeadlessRule{ProcessName: all.ProcessName})
+	}
+	if len(all.ProcessPath) > 0 {
+		rules = append(rules, singboxHeadlessRule{ProcessPath: all.ProcessPath})
+	}
+	return rules
+}
+
+// exportSingbox 导出 sing-box source 格式规则集 {name}_singbox.json，返回写入的规则数量
+func (o *Optimizer) exportSingbox(ruleSet *RuleSet, outputDir string) (int, error) {
+	rule, count := o.collectSingboxRule(ruleSet)
+	ruleSetJSON := singboxRuleSet{Version: singboxRuleSetVersion, Rules: splitSingboxRule(rule)}
+
+	data, err := json.MarshalIndent(ruleSetJSON, "", "  ")
+	if err != nil {
+		return 0, fmt.Errorf("生成 sing-box 规则集失败: %w", err)
+	}
+	path, err := o.exportPath(outputDir, ruleSet.Name, exportGroupSingbox, ".json")
+	if err != nil {
+		return 0, err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return 0, err
+	}
+	log.Info().Msgf("生成文件: %s (%d 条规则)", path, count)
+	return count, nil
+}
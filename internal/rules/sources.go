@@ -0,0 +1,77 @@
+package rules
+
+import (
+	"sort"
+	"strings"
+)
+
+// SetTrackSources 设置是否在加载时记录每条规则来自哪个来源（用于生成来源许可证文件）
+// 必须在 LoadRuleFile 之前设置
+func (o *Optimizer) SetTrackSources(enabled bool) {
+	o.trackSources = enabled
+}
+
+// recordSource 记录规则来自的来源（rule 为不含类型的规则内容）
+func (rs *RuleSet) recordSource(source string, ruleType RuleType, rule string) {
+	index, ok := rs.sourceIndex[source]
+	if !ok {
+		if rs.sourceIndex == nil {
+			rs.sourceIndex = make(map[string]int)
+			rs.ruleSources = make(map[string][]int)
+			rs.typeSources = make(map[RuleType][]int)
+		}
+		index = len(rs.sources)
+		rs.sources = append(rs.sources, source)
+		rs.sourceIndex[source] = index
+	}
+
+	key := sourceKey(ruleType, rule)
+	rs.ruleSources[key] = appendSourceIndex(rs.ruleSources[key], index)
+	rs.typeSources[ruleType] = appendSourceIndex(rs.typeSources[ruleType], index)
+}
+
+// appendSourceIndex 将来源序号加入列表（已存在时不重复添加）
+func appendSourceIndex(indexes []int, index int) []int {
+	for _, existing := range indexes {
+		if existing == index {
+			return indexes
+		}
+	}
+	return append(indexes, index)
+}
+
+// sourceKey 规则来源索引的键（去重会统一域名和参数的大小写，因此不区分大小写）
+func sourceKey(ruleType RuleType, rule string) string {
+	return strings.ToLower(string(ruleType) + "," + rule)
+}
+
+// ContributingSources 返回为规则集导出结果提供了规则的来源（加载时的 source，已排序）
+// 只统计去重、跨规则集排除和过滤之后仍保留的规则；全部规则都被移除的来源不会返回。
+// 去重时合并产生的新规则（如合并后的网段）无法对应到单个来源，视为来自该类型的所有来源。
+// 需要在加载前调用 SetTrackSources(true)，否则返回 nil
+func (o *Optimizer) ContributingSources(name string) []string {
+	ruleSet, ok := o.ruleSets[name]
+	if !ok || len(ruleSet.sources) == 0 {
+		return nil
+	}
+
+	contributed := make(map[int]bool)
+	for ruleType := range ruleSet.Rules {
+		for _, rule := range o.filteredRules(ruleSet, ruleType) {
+			indexes, ok := ruleSet.ruleSources[sourceKey(ruleType, rule)]
+			if !ok {
+				indexes = ruleSet.typeSources[ruleType]
+			}
+			for _, index := range indexes {
+				contributed[index] = true
+			}
+		}
+	}
+
+	sources := make([]string, 0, len(contributed))
+	for index := range contributed {
+		sources = append(sources, ruleSet.sources[index])
+	}
+	sort.Strings(sources)
+	return sources
+}
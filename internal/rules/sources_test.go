@@ -0,0 +1,40 @@
+package rules
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestContributingSources(t *testing.T) {
+	o := NewOptimizer()
+	o.SetTrackSources(true)
+	sources := map[string]string{
+		"a.list": "DOMAIN-SUFFIX,google.com\nDOMAIN-SUFFIX,youtube.com\n",
+		"b.list": "DOMAIN-SUFFIX,Google.com\n",
+		"c.list": "DOMAIN-KEYWORD,ads\n",
+	}
+	for _, source := range []string{"a.list", "b.list", "c.list"} {
+		if err := o.LoadRules(strings.NewReader(sources[source]), "test", source); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := o.SetRulesetFilters("test", nil, []string{"DOMAIN-KEYWORD,*"}); err != nil {
+		t.Fatal(err)
+	}
+	o.Deduplicate()
+
+	// c.list 的规则全部被 excludes 移除，不计入来源
+	got := o.ContributingSources("test")
+	want := []string{"a.list", "b.list"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ContributingSources() = %v, want %v", got, want)
+	}
+}
+
+func TestContributingSourcesDisabled(t *testing.T) {
+	o := newTestOptimizer(t, map[string]string{"test": "DOMAIN,example.com\n"})
+	if got := o.ContributingSources("test"); got != nil {
+		t.Errorf("ContributingSources() without tracking = %v, want nil", got)
+	}
+}
@@ -0,0 +1,128 @@
+package rules
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// FormatStatistics 将 GetStatistics 的结果格式化为稳定的文本表格
+// 规则集按名称排序，类型列按 classicalTypeOrder 排列（只包含至少一个规则集中出现的类型），
+// 相同的统计数据总是得到相同的输出，便于比较不同运行的日志
+func FormatStatistics(stats map[string]map[RuleType]int) string {
+	if len(stats) == 0 {
+		return ""
+	}
+
+	names := make([]string, 0, len(stats))
+	present := make(map[RuleType]bool)
+	for name, types := range stats {
+		names = append(names, name)
+		for ruleType, count := range types {
+			if count > 0 {
+				present[ruleType] = true
+			}
+		}
+	}
+	sort.Strings(names)
+	columns := orderedStatisticTypes(present)
+
+	var sb strings.Builder
+	tw := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+	header := []string{"规则集"}
+	for _, ruleType := range columns {
+		header = append(header, string(ruleType))
+	}
+	header = append(header, "合计")
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+
+	totals := make(map[RuleType]int)
+	grandTotal := 0
+	for _, name := range names {
+		row := []string{name}
+		sum := 0
+		for _, ruleType := range columns {
+			count := stats[name][ruleType]
+			totals[ruleType] += count
+			sum += count
+			row = append(row, fmt.Sprint(count))
+		}
+		grandTotal += sum
+		row = append(row, fmt.Sprint(sum))
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+
+	footer := []string{"合计"}
+	for _, ruleType := range columns {
+		footer = append(footer, fmt.Sprint(totals[ruleType]))
+	}
+	footer = append(footer, fmt.Sprint(grandTotal))
+	fmt.Fprintln(tw, strings.Join(footer, "\t"))
+	tw.Flush()
+
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// orderedStatisticTypes 按 classicalTypeOrder 返回出现过的类型，不在其中的类型按名称排在最后
+func orderedStatisticTypes(present map[RuleType]bool) []RuleType {
+	columns := make([]RuleType, 0, len(present))
+	known := make(map[RuleType]bool, len(classicalTypeOrder))
+	for _, ruleType := range classicalTypeOrder {
+		known[ruleType] = true
+		if present[ruleType] {
+			columns = append(columns, ruleType)
+		}
+	}
+	var extra []RuleType
+	for ruleType := range present {
+		if !known[ruleType] {
+			extra = append(extra, ruleType)
+		}
+	}
+	sort.Slice(extra, func(i, j int) bool { return extra[i] < extra[j] })
+	return append(columns, extra...)
+}
+
+// RulesetStats 单个规则集的导出统计（写入输出目录的 statistics.json）
+type RulesetStats struct {
+	Types         map[RuleType]int `json:"types"`          // 各类型导出的规则数量（应用 allow_tlds/filters/excludes 之后）
+	Total         int              `json:"total"`          // 导出的规则总数
+	DedupRemoved  int              `json:"dedup_removed"`  // 去重（含 collapse_subdomains、merge_cidrs）移除的规则数量
+	FilterRemoved int              `json:"filter_removed"` // allow_tlds/exclude_private_ips/filters/excludes 移除的规则数量
+}
+
+// RulesetStats 返回各规则集的导出统计（去重之后调用）
+// 过滤结果与导出共用缓存，Export 之后调用不会重复过滤
+func (o *Optimizer) RulesetStats() map[string]RulesetStats {
+	stats := make(map[string]RulesetStats, len(o.ruleSets))
+	for name, ruleSet := range o.ruleSets {
+		s := RulesetStats{Types: make(map[RuleType]int), DedupRemoved: ruleSet.dedupRemoved}
+		for ruleType, rules := range ruleSet.Rules {
+			kept := len(o.filteredRules(ruleSet, ruleType))
+			s.FilterRemoved += len(rules) - kept
+			if kept > 0 {
+				s.Types[ruleType] = kept
+				s.Total += kept
+			}
+		}
+		stats[name] = s
+	}
+	return stats
+}
+
+// ExportedRules 返回规则集导出的规则（"类型,内容"，类型按 classicalTypeOrder，类型内按去重后的顺序），
+// 应用 allow_tlds/filters/excludes 之后，规则集不存在时返回 nil
+func (o *Optimizer) ExportedRules(name string) []string {
+	ruleSet, ok := o.ruleSets[name]
+	if !ok {
+		return nil
+	}
+	var lines []string
+	for _, ruleType := range sortedRuleTypes(ruleSet.Rules) {
+		for _, rule := range o.filteredRules(ruleSet, ruleType) {
+			lines = append(lines, string(ruleType)+","+rule)
+		}
+	}
+	return lines
+}
@@ -0,0 +1,210 @@
+package rules
+
+import (
+	"net/netip"
+	"sort"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// SubtractResult 跨规则集排除的结果
+type SubtractResult struct {
+	Ruleset string // 被移除规则的规则集
+	From    string // 用于排除的规则集
+	Removed int    // 移除的规则数量
+}
+
+// subtractIndex 用于排除的规则集的规则索引（按类型比较）
+type subtractIndex struct {
+	exact    map[string]bool       // "类型,内容"（去除参数，域名统一小写）
+	suffixes map[string]bool       // DOMAIN-SUFFIX 的域名，覆盖该域名及所有子域名
+	prefixes map[netip.Prefix]bool // IP-CIDR/IP-CIDR6 网段，覆盖其中的所有子网段
+}
+
+// SubtractRulesets 从规则集中移除已出现在其他规则集中的规则
+// subtractions 为 规则集 -> 用于排除的规则集列表，比较对象是其他规则集的导出内容（应用 filters/excludes 之后）。
+// 按类型比较，除完全相同的规则外：
+//   - DOMAIN/DOMAIN-SUFFIX 被其他规则集中相同或上级域名的 DOMAIN-SUFFIX 覆盖时移除
+//   - IP-CIDR/IP-CIDR6 被其他规则集中包含它的网段覆盖时移除
+//
+// 所有排除基于执行前的内容计算，结果与执行顺序无关（互相排除时重叠部分从双方移除）。
+// 必须在 Deduplicate 之后调用，返回的结果按规则集名称排序
+func (o *Optimizer) SubtractRulesets(subtractions map[string][]string) []SubtractResult {
+	results := o.subtract(subtractions, func(name, from string) {
+		log.Warn().Msgf("规则集 '%s' 的 subtract_rulesets 引用的规则集 '%s' 没有加载任何规则，跳过", name, from)
+	})
+	for _, result := range results {
+		log.Info().Msgf("规则集 '%s': 排除已在规则集 '%s' 中的规则 %d 条", result.Ruleset, result.From, result.Removed)
+	}
+	return results
+}
+
+// ResolvePriority 按优先级解决规则集之间的重叠：同一规则出现在多个规则集中时，只保留在优先级最高的规则集中
+// order 为从高到低的优先级（未列出或未加载的规则集不参与），规则的比较方式与 SubtractRulesets 相同，
+// 即每个规则集排除所有优先级更高的规则集。
+// 返回发生移动的规则集对（Ruleset 为移除规则的规则集，From 为保留规则的规则集），每条被移除的规则记录到 debug 日志
+func (o *Optimizer) ResolvePriority(order []string) []SubtractResult {
+	subtractions := make(map[string][]string)
+	var higher []string
+	for _, name := range order {
+		if _, exists := o.ruleSets[name]; !exists {
+			continue
+		}
+		if len(higher) > 0 {
+			subtractions[name] = append([]string(nil), higher...)
+		}
+		higher = append(higher, name)
+	}
+
+	var moves []SubtractResult
+	for _, result := range o.subtract(subtractions, nil) {
+		if result.Removed == 0 {
+			continue
+		}
+		moves = append(moves, result)
+		log.Info().Msgf("规则集优先级: %d 条规则只保留在 '%s'，已从 '%s' 移除", result.Removed, result.From, result.Ruleset)
+	}
+	return moves
+}
+
+// subtract 执行跨规则集排除，subtractions 中的规则集列表按顺序检查，规则归属于第一个覆盖它的规则集
+// missing 在引用的规则集未加载时调用（可为 nil）
+func (o *Optimizer) subtract(subtractions map[string][]string, missing func(name, from string)) []SubtractResult {
+	names := make([]string, 0, len(subtractions))
+	for name := range subtractions {
+		if _, exists := o.ruleSets[name]; exists && len(subtractions[name]) > 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	// 先为所有被引用的规则集建立索引，再统一修改
+	indexes := make(map[string]*subtractIndex)
+	for _, name := range names {
+		for _, from := range subtractions[name] {
+			if _, built := indexes[from]; built {
+				continue
+			}
+			ruleSet, exists := o.ruleSets[from]
+			if !exists {
+				if missing != nil {
+					missing(name, from)
+				}
+				indexes[from] = nil
+				continue
+			}
+			indexes[from] = o.buildSubtractIndex(ruleSet)
+		}
+	}
+
+	var results []SubtractResult
+	for _, name := range names {
+		ruleSet := o.ruleSets[name]
+		removed := make([]int, len(subtractions[name]))
+		for ruleType, rules := range ruleSet.Rules {
+			kept := make([]string, 0, len(rules))
+			for _, rule := range rules {
+				covered := -1
+				for i, from := range subtractions[name] {
+					if idx := indexes[from]; idx != nil && idx.covers(ruleType, rule) {
+						covered = i
+						break
+					}
+				}
+				if covered >= 0 {
+					removed[covered]++
+					log.Debug().Msgf("规则集 '%s': 移除 %s,%s（已在规则集 '%s' 中）", name, ruleType, rule, subtractions[name][covered])
+					continue
+				}
+				kept = append(kept, rule)
+			}
+			ruleSet.Rules[ruleType] = kept
+		}
+		ruleSet.filtered = nil
+
+		for i, from := range subtractions[name] {
+			if indexes[from] != nil {
+				results = append(results, SubtractResult{Ruleset: name, From: from, Removed: removed[i]})
+			}
+		}
+	}
+	return results
+}
+
+// RemoveRuleset 移除规则集（如只为跨规则集排除而加载的规则集）
+func (o *Optimizer) RemoveRuleset(name string) {
+	delete(o.ruleSets, name)
+}
+
+// buildSubtractIndex 为规则集的导出内容建立索引
+func (o *Optimizer) buildSubtractIndex(ruleSet *RuleSet) *subtractIndex {
+	idx := &subtractIndex{
+		exact:    make(map[string]bool),
+		suffixes: make(map[string]bool),
+		prefixes: make(map[netip.Prefix]bool),
+	}
+	for ruleType := range ruleSet.Rules {
+		for _, rule := range o.filteredRules(ruleSet, ruleType) {
+			payload := subtractPayload(ruleType, rule)
+			idx.exact[string(ruleType)+","+payload] = true
+			switch ruleType {
+			case RuleTypeDomainSuffix:
+				idx.suffixes[payload] = true
+			case RuleTypeIPCIDR, RuleTypeIPCIDR6:
+				if prefix, err := netip.ParsePrefix(payload); err == nil {
+					idx.prefixes[prefix.Masked()] = true
+				}
+			}
+		}
+	}
+	return idx
+}
+
+// covers 判断规则是否已被索引中的规则覆盖
+func (idx *subtractIndex) covers(ruleType RuleType, rule string) bool {
+	payload := subtractPayload(ruleType, rule)
+	if idx.exact[string(ruleType)+","+payload] {
+		return true
+	}
+
+	switch ruleType {
+	case RuleTypeDomain, RuleTypeDomainSuffix:
+		// 依次检查域名本身及各级上级域名
+		for domain := payload; domain != ""; {
+			if idx.suffixes[domain] {
+				return true
+			}
+			dot := strings.Index(domain, ".")
+			if dot < 0 {
+				break
+			}
+			domain = domain[dot+1:]
+		}
+	case RuleTypeIPCIDR, RuleTypeIPCIDR6:
+		prefix, err := netip.ParsePrefix(payload)
+		if err != nil {
+			return false
+		}
+		// 依次检查相同及更短掩码的网段
+		for bits := prefix.Bits(); bits >= 0; bits-- {
+			if parent, err := prefix.Addr().Prefix(bits); err == nil && idx.prefixes[parent] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// subtractPayload 返回用于比较的规则内容：去除参数，域名类规则统一小写并去除 +. 前缀
+func subtractPayload(ruleType RuleType, rule string) string {
+	payload := stripOptions(rule)
+	switch ruleType {
+	case RuleTypeDomain, RuleTypeDomainSuffix, RuleTypeDomainKeyword, RuleTypeDomainWildcard:
+		payload = strings.ToLower(payload)
+		if ruleType == RuleTypeDomainSuffix {
+			payload = strings.TrimPrefix(strings.TrimPrefix(payload, "+"), ".")
+		}
+	}
+	return payload
+}
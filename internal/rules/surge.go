@@ -0,0 +1,110 @@
+package rules
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// surgeRuleTypes Mihomo 规则类型到 Surge 规则类型的映射，不在表中的类型 Surge 不支持，导出时跳过
+var surgeRuleTypes = map[RuleType]string{
+	RuleTypeDomain:        "DOMAIN",
+	RuleTypeDomainSuffix:  "DOMAIN-SUFFIX",
+	RuleTypeDomainKeyword: "DOMAIN-KEYWORD",
+	RuleTypeIPCIDR:        "IP-CIDR",
+	RuleTypeIPCIDR6:       "IP-CIDR6",
+	RuleTypeSrcIPCIDR:     "SRC-IP",
+	RuleTypeSrcIPCIDR6:    "SRC-IP",
+	RuleTypeGeoIP:         "GEOIP",
+	RuleTypeIPASN:         "IP-ASN",
+	RuleTypeProcessName:   "PROCESS-NAME",
+	RuleTypeDstPort:       "DEST-PORT",
+	RuleTypeSrcPort:       "SRC-PORT",
+	RuleTypeInPort:        "IN-PORT",
+}
+
+// surgeNoResolveTypes Surge 中支持 no-resolve 参数的规则类型
+var surgeNoResolveTypes = map[RuleType]bool{
+	RuleTypeIPCIDR:  true,
+	RuleTypeIPCIDR6: true,
+	RuleTypeGeoIP:   true,
+	RuleTypeIPASN:   true,
+}
+
+// surgeRule 将规则转换为 Surge 语法（TYPE,payload[,no-resolve]），不支持的类型返回 false
+// 带 src 参数的 IP-CIDR 规则匹配来源 IP，转换为 SRC-IP
+func surgeRule(ruleType RuleType, rule string) (string, bool) {
+	surgeType, ok := surgeRuleTypes[ruleType]
+	if !ok {
+		return "", false
+	}
+	payload := stripOptions(rule)
+	switch ruleType {
+	case RuleTypeDomainSuffix:
+		payload = strings.TrimPrefix(payload, "+.")
+	case RuleTypeIPCIDR, RuleTypeIPCIDR6:
+		if hasOption(rule, "src") {
+			return "SRC-IP," + payload, true
+		}
+	}
+	line := surgeType + "," + payload
+	if surgeNoResolveTypes[ruleType] && hasOption(rule, "no-resolve") {
+		line += ",no-resolve"
+	}
+	return line, true
+}
+
+// exportSurge 导出 Surge 规则集 {name}_surge.conf，返回写入的规则数量
+// 每行一条 Surge 语法的规则，注释使用 //；Surge 不支持的类型（如 DOMAIN-WILDCARD、DOMAIN-REGEX、GEOSITE）跳过并记录警告
+func (o *Optimizer) exportSurge(ruleSet *RuleSet, outputDir string) (int, error) {
+	ruleTypes := make([]RuleType, 0, len(ruleSet.Rules))
+	for ruleType := range ruleSet.Rules {
+		ruleTypes = append(ruleTypes, ruleType)
+	}
+	sort.Slice(ruleTypes, func(i, j int) bool { return ruleTypes[i] < ruleTypes[j] })
+
+	var lines []string
+	for _, ruleType := range ruleTypes {
+		rules := o.filteredRules(ruleSet, ruleType)
+		if len(rules) == 0 {
+			continue
+		}
+		if _, ok := surgeRuleTypes[ruleType]; !ok {
+			log.Warn().Msgf("规则集 '%s': Surge 不支持 %s 规则，跳过 %d 条", ruleSet.Name, ruleType, len(rules))
+			continue
+		}
+		for _, rule := range rules {
+			line, _ := surgeRule(ruleType, rule)
+			lines = append(lines, line)
+		}
+	}
+	// 同一类型的不同写法（如 +.a.com 与 a.com）转换后可能重复
+	lines = mergeUniqueRules(lines, nil)
+
+	path, err := o.exportPath(outputDir, ruleSet.Name, exportGroupSurge, ".conf")
+	if err != nil {
+		return 0, err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	bw := bufio.NewWriter(f)
+	fmt.Fprintf(bw, "// NAME: %s\n", ruleSet.Name)
+	fmt.Fprintf(bw, "// TOTAL: %d\n", len(lines))
+	fmt.Fprintf(bw, "// 由 RuleRefinery 生成，Surge 规则集格式（RULE-SET）\n")
+	for _, line := range lines {
+		fmt.Fprintln(bw, line)
+	}
+	if err := bw.Flush(); err != nil {
+		return 0, err
+	}
+	log.Info().Msgf("生成文件: %s (%d 条规则)", path, len(lines))
+	return len(lines), nil
+}
@@ -0,0 +1,83 @@
+package rules
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// allowTLDTypes allow_tlds 作用的规则类型（payload 是域名或域名模式）
+// DOMAIN-KEYWORD、DOMAIN-REGEX 的 payload 不是域名，无法按后缀判断，不受影响
+var allowTLDTypes = map[RuleType]bool{
+	RuleTypeDomain:         true,
+	RuleTypeDomainSuffix:   true,
+	RuleTypeDomainWildcard: true,
+}
+
+// SetRulesetAllowTLDs 设置规则集的顶级域名/域名白名单（如 cn、com.cn）：
+// 域名类规则（DOMAIN、DOMAIN-SUFFIX、DOMAIN-WILDCARD）只保留以其中之一结尾（按 . 分隔的完整标签）的规则，在 filters 之前应用
+func (o *Optimizer) SetRulesetAllowTLDs(ruleSetName string, tlds []string) error {
+	ruleSet, exists := o.ruleSets[ruleSetName]
+	if !exists {
+		return fmt.Errorf("规则集 '%s' 不存在", ruleSetName)
+	}
+
+	ruleSet.AllowTLDs = nil
+	for _, tld := range tlds {
+		if tld = normalizeAllowTLD(tld); tld != "" {
+			ruleSet.AllowTLDs = append(ruleSet.AllowTLDs, tld)
+		}
+	}
+	ruleSet.filtered = nil
+
+	if len(ruleSet.AllowTLDs) > 0 {
+		log.Info().Msgf("规则集 '%s': 只保留以 %s 结尾的域名规则", ruleSetName, strings.Join(ruleSet.AllowTLDs, "、"))
+	}
+	return nil
+}
+
+// normalizeAllowTLD 统一 allow_tlds 的写法：去掉空白、前导的 . 或 +.，转为小写
+func normalizeAllowTLD(tld string) string {
+	tld = strings.ToLower(strings.TrimSpace(tld))
+	tld = strings.TrimPrefix(tld, "+")
+	return strings.Trim(tld, ".")
+}
+
+// matchAllowTLD 判断域名（或域名模式）是否以任一 tld 结尾，必须在 . 边界上匹配：
+// cn 匹配 example.cn、cn，不匹配 example.acn
+func matchAllowTLD(tlds []string, payload string) bool {
+	domain := strings.ToLower(strings.Trim(strings.TrimPrefix(stripOptions(payload), "+."), "."))
+	for _, tld := range tlds {
+		if domain == tld || strings.HasSuffix(domain, "."+tld) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyAllowTLDs 按规则集的 allow_tlds 过滤域名类规则，其他类型原样返回
+func (o *Optimizer) applyAllowTLDs(rules []string, ruleType RuleType, ruleSet *RuleSet) []string {
+	if len(ruleSet.AllowTLDs) == 0 || !allowTLDTypes[ruleType] || len(rules) == 0 {
+		return rules
+	}
+
+	kept := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		allowed := matchAllowTLD(ruleSet.AllowTLDs, rule)
+		if o.isTraced(rule) {
+			result := "被移除（不在 allow_tlds 中）"
+			if allowed {
+				result = "保留（匹配 allow_tlds）"
+			}
+			log.Info().Msgf("[追踪] 规则集 '%s': %s,%s %s", ruleSet.Name, ruleType, rule, result)
+		}
+		if allowed {
+			kept = append(kept, rule)
+		}
+	}
+	if len(kept) != len(rules) {
+		log.Info().Msgf("  allow_tlds 统计: %s 总规则数=%d, 保留=%d", ruleType, len(rules), len(kept))
+	}
+	return kept
+}
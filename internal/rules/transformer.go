@@ -0,0 +1,49 @@
+package rules
+
+import "strings"
+
+// RuleTransformer 规则转换器
+// 返回空切片表示丢弃该规则，返回多条规则表示展开
+// 执行顺序：ParseRule 解析之后、Deduplicate 去重之前
+type RuleTransformer func(Rule) []Rule
+
+// AddTransformer 注册规则转换器
+// 多个转换器按注册顺序串联执行，前一个转换器的输出作为后一个的输入
+// 必须在 LoadRuleFile 之前注册，已加载的规则不会被重新转换
+func (o *Optimizer) AddTransformer(transformer RuleTransformer) {
+	if transformer == nil {
+		return
+	}
+	o.transformers = append(o.transformers, transformer)
+}
+
+// applyTransformers 依次应用所有转换器
+func (o *Optimizer) applyTransformers(rule Rule) []Rule {
+	current := []Rule{rule}
+	for _, transformer := range o.transformers {
+		var next []Rule
+		for _, r := range current {
+			next = append(next, transformer(r)...)
+		}
+		current = next
+		if len(current) == 0 {
+			break
+		}
+	}
+	return current
+}
+
+// NormalizeDomainTransformer 内置示例转换器：规范化域名类规则
+// - DOMAIN/DOMAIN-SUFFIX/DOMAIN-KEYWORD/DOMAIN-WILDCARD 的 payload 转小写
+// - 去除域名末尾的 "."（FQDN 写法）
+// - 丢弃规范化后为空的规则
+func NormalizeDomainTransformer(rule Rule) []Rule {
+	switch rule.Type {
+	case RuleTypeDomain, RuleTypeDomainSuffix, RuleTypeDomainKeyword, RuleTypeDomainWildcard:
+		rule.Payload = strings.TrimSuffix(strings.ToLower(rule.Payload), ".")
+		if rule.Payload == "" {
+			return nil
+		}
+	}
+	return []Rule{rule}
+}
@@ -0,0 +1,140 @@
+package rules
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// SetWildcardAsRegex 设置导出 classical 格式时是否将 DOMAIN-WILDCARD 转换为等价的 DOMAIN-REGEX
+// 用于不支持 DOMAIN-WILDCARD 的客户端（如旧版 sing-box）
+func (o *Optimizer) SetWildcardAsRegex(enabled bool) {
+	o.wildcardAsRegex = enabled
+}
+
+// SetDomainIncludeWildcard 设置导出 domain 格式时是否包含 DOMAIN-WILDCARD
+// 只有能用 domain behavior 语法等价表示的模式会被导出（依赖较新版本的 Mihomo），其余仍保留在 classical 中
+func (o *Optimizer) SetDomainIncludeWildcard(enabled bool) {
+	o.domainIncludeWildcard = enabled
+}
+
+// wildcardToDomain 将 DOMAIN-WILDCARD 模式转换为 domain behavior 的等价写法
+// DOMAIN-WILDCARD 中 * 匹配任意数量的字符（包括 .），而 domain behavior 中只有 .example.com（任意子域名）与之等价：
+// - *.example.com → .example.com（匹配所有子域名，不匹配 example.com 本身）
+// - 不含通配符的模式 → 原样作为精确域名
+// 其他模式（含 ?、* 不是单独的首个标签、多个 *）无法表示，返回 false
+func wildcardToDomain(pattern string) (string, bool) {
+	if !strings.ContainsAny(pattern, "*?") {
+		return pattern, true
+	}
+	rest, ok := strings.CutPrefix(pattern, "*.")
+	if !ok || rest == "" || strings.ContainsAny(rest, "*?") {
+		return "", false
+	}
+	return "." + rest, true
+}
+
+// domainWildcardRules 返回规则集中可以导出到 domain 格式的 DOMAIN-WILDCARD 规则（已转换）
+// 无法表示的模式只在每个规则集首次导出时记录日志
+func (o *Optimizer) domainWildcardRules(ruleSet *RuleSet) []string {
+	logSkipped := o.logOnce("domain-wildcard:" + ruleSet.Name)
+	var result []string
+	for _, rule := range o.filteredRules(ruleSet, RuleTypeDomainWildcard) {
+		pattern := stripOptions(rule)
+		if domain, ok := wildcardToDomain(pattern); ok {
+			result = append(result, domain)
+		} else if logSkipped {
+			log.Info().Msgf("规则集 '%s': DOMAIN-WILDCARD,%s 无法用 domain 格式表示，保留在 classical 中", ruleSet.Name, pattern)
+		}
+	}
+	return result
+}
+
+// inexpressibleWildcards 返回无法转换为 domain 格式的 DOMAIN-WILDCARD 规则（不修改传入的切片）
+func inexpressibleWildcards(rules []string) []string {
+	var result []string
+	for _, rule := range rules {
+		if _, ok := wildcardToDomain(stripOptions(rule)); !ok {
+			result = append(result, rule)
+		}
+	}
+	return result
+}
+
+// wildcardToRegex 将 DOMAIN-WILDCARD 模式转换为等价的正则表达式
+// 通配符语义与 Mihomo 一致：* 匹配任意数量的字符（包括 .），? 匹配单个字符，整个域名完整匹配
+// 例如 *.example.* → ^.*\.example\..*$
+func wildcardToRegex(pattern string) string {
+	var sb strings.Builder
+	sb.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			sb.WriteString(".*")
+		case '?':
+			sb.WriteString(".")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	sb.WriteString("$")
+	return sb.String()
+}
+
+// convertWildcardSections 将 DOMAIN-WILDCARD 分段转换后合并到 DOMAIN-REGEX 分段
+// 每个规则集的转换只在首次导出时记录日志
+func (o *Optimizer) convertWildcardSections(ruleSetName string, sections []classicalSection) []classicalSection {
+	wildcardIdx, regexIdx := -1, -1
+	for i, section := range sections {
+		switch section.ruleType {
+		case RuleTypeDomainWildcard:
+			wildcardIdx = i
+		case RuleTypeDomainRegex:
+			regexIdx = i
+		}
+	}
+	if wildcardIdx == -1 {
+		return sections
+	}
+
+	logConversions := o.logOnce("wildcard:" + ruleSetName)
+	converted := make([]string, 0, len(sections[wildcardIdx].rules))
+	for _, rule := range sections[wildcardIdx].rules {
+		payload, options, _ := strings.Cut(rule, ",")
+		regex := wildcardToRegex(payload)
+		if options != "" {
+			regex += "," + options
+		}
+		converted = append(converted, regex)
+		if logConversions {
+			log.Info().Msgf("规则集 '%s': DOMAIN-WILDCARD,%s 转换为 DOMAIN-REGEX,%s", ruleSetName, rule, regex)
+		}
+	}
+
+	// 合并到已有的 DOMAIN-REGEX 分段（去重排序），否则在原位置替换为 DOMAIN-REGEX 分段
+	if regexIdx == -1 {
+		sections[wildcardIdx] = classicalSection{ruleType: RuleTypeDomainRegex, rules: converted}
+		return sections
+	}
+
+	merged := mergeUniqueRules(sections[regexIdx].rules, converted)
+	o.sortRulesByType(RuleTypeDomainRegex, merged)
+	sections[regexIdx].rules = merged
+	return append(sections[:wildcardIdx], sections[wildcardIdx+1:]...)
+}
+
+// mergeUniqueRules 合并规则列表并去重
+func mergeUniqueRules(a, b []string) []string {
+	seen := make(map[string]bool, len(a)+len(b))
+	result := make([]string, 0, len(a)+len(b))
+	for _, list := range [][]string{a, b} {
+		for _, rule := range list {
+			if !seen[rule] {
+				seen[rule] = true
+				result = append(result, rule)
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,105 @@
+// Package scaffold 生成带注释的初始配置文件和规则分类文件（rulerefinery --init）
+package scaffold
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+//go:embed templates/*.tmpl
+var templateFS embed.FS
+
+var templates = template.Must(template.ParseFS(templateFS, "templates/*.tmpl"))
+
+// Options 初始化参数
+type Options struct {
+	ConfigPath string // 配置文件路径（默认 config.yaml），规则分类文件等路径相对于其所在目录生成
+	Force      bool   // 覆盖已存在的文件
+	Version    string // 写入配置文件头部的版本号
+}
+
+// templateData 模板参数（路径均为以 / 分隔的相对或绝对路径）
+type templateData struct {
+	Version             string
+	LogDir              string
+	DownloadPath        string
+	ClassifiedRulesFile string
+	AIGeneratedFile     string
+	OutputRulesPath     string
+}
+
+// Init 生成初始配置文件和规则分类文件，返回写入的文件路径
+// 任意一个文件已存在且未设置 Force 时不写入任何文件并返回错误
+func Init(opts Options) ([]string, error) {
+	configPath := opts.ConfigPath
+	if configPath == "" {
+		configPath = "config.yaml"
+	}
+	dir := filepath.Dir(configPath)
+
+	data := templateData{
+		Version:             opts.Version,
+		LogDir:              slashPath(dir, "log"),
+		DownloadPath:        slashPath(dir, "rule_sources", "github", "rules"),
+		ClassifiedRulesFile: slashPath(dir, "rule_config", "classified_rules.yaml"),
+		AIGeneratedFile:     slashPath(dir, "rule_config", "ai_generated_classified_rules.yaml"),
+		OutputRulesPath:     slashPath(dir, "rules", "clash") + "/",
+	}
+	if data.Version == "" {
+		data.Version = "dev"
+	}
+
+	files := []struct {
+		path     string
+		template string
+	}{
+		{configPath, "config.yaml.tmpl"},
+		{filepath.FromSlash(data.ClassifiedRulesFile), "classified_rules.yaml.tmpl"},
+	}
+
+	// 先检查全部文件，避免只写入一部分
+	if !opts.Force {
+		var existing []string
+		for _, f := range files {
+			if _, err := os.Stat(f.path); err == nil {
+				existing = append(existing, f.path)
+			} else if !errors.Is(err, os.ErrNotExist) {
+				return nil, fmt.Errorf("检查文件失败: %w", err)
+			}
+		}
+		if len(existing) > 0 {
+			return nil, fmt.Errorf("文件已存在: %s（使用 --force 覆盖）", strings.Join(existing, ", "))
+		}
+	}
+
+	written := make([]string, 0, len(files))
+	for _, f := range files {
+		var buf bytes.Buffer
+		if err := templates.ExecuteTemplate(&buf, f.template, data); err != nil {
+			return written, fmt.Errorf("生成 %s 失败: %w", f.path, err)
+		}
+		if err := os.MkdirAll(filepath.Dir(f.path), 0755); err != nil {
+			return written, fmt.Errorf("创建目录失败: %w", err)
+		}
+		if err := os.WriteFile(f.path, buf.Bytes(), 0644); err != nil {
+			return written, fmt.Errorf("写入 %s 失败: %w", f.path, err)
+		}
+		written = append(written, f.path)
+	}
+	return written, nil
+}
+
+// slashPath 拼接路径并转换为以 / 分隔的形式，相对路径以 ./ 开头
+func slashPath(elem ...string) string {
+	p := filepath.ToSlash(filepath.Join(elem...))
+	if !filepath.IsAbs(p) && !strings.HasPrefix(p, "./") && !strings.HasPrefix(p, "../") {
+		p = "./" + p
+	}
+	return p
+}
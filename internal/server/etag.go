@@ -0,0 +1,98 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"rulerefinery/internal/workflow"
+)
+
+// fileHash 按修改时间和大小缓存的文件哈希
+type fileHash struct {
+	modTime time.Time
+	size    int64
+	hash    string
+}
+
+// etagCache 规则文件的 ETag 来源
+// 优先使用导出时写入输出清单的哈希（文件在清单之后未被修改时），否则计算文件哈希并缓存
+type etagCache struct {
+	dir string
+
+	mu           sync.Mutex
+	manifestMod  time.Time         // 已加载清单的修改时间
+	manifestHash map[string]string // 清单中的文件哈希（相对路径 -> SHA-256）
+	computed     map[string]fileHash
+}
+
+// newETagCache 创建 ETag 缓存
+func newETagCache(dir string) *etagCache {
+	return &etagCache{
+		dir:      dir,
+		computed: make(map[string]fileHash),
+	}
+}
+
+// etag 返回文件的强 ETag（带引号），无法计算时返回空字符串
+// relPath 为以 / 分隔、不以 / 开头的相对路径
+func (c *etagCache) etag(relPath string, filePath string, info os.FileInfo) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if hash := c.manifestETag(relPath, info); hash != "" {
+		return quoteETag(hash)
+	}
+
+	if cached, ok := c.computed[relPath]; ok && cached.modTime.Equal(info.ModTime()) && cached.size == info.Size() {
+		return quoteETag(cached.hash)
+	}
+	hash, err := workflow.HashFile(filePath)
+	if err != nil {
+		log.Warn().Msgf("计算 ETag 失败: %v", err)
+		return ""
+	}
+	c.computed[relPath] = fileHash{modTime: info.ModTime(), size: info.Size(), hash: hash}
+	return quoteETag(hash)
+}
+
+// manifestETag 从输出清单中查找文件哈希；清单更新时重新加载
+// 文件修改时间晚于清单时（导出后被手动修改），清单中的哈希已失效，返回空字符串
+func (c *etagCache) manifestETag(relPath string, info os.FileInfo) string {
+	manifestInfo, err := os.Stat(workflow.OutputManifestFile(c.dir))
+	if err != nil {
+		c.manifestHash = nil
+		return ""
+	}
+	if !manifestInfo.ModTime().Equal(c.manifestMod) {
+		c.manifestMod = manifestInfo.ModTime()
+		c.manifestHash = nil
+		manifest, err := workflow.ReadOutputManifest(c.dir)
+		if err != nil {
+			log.Warn().Msgf("读取输出清单失败: %v", err)
+		} else if manifest != nil {
+			c.manifestHash = manifest.Files
+		}
+	}
+	if info.ModTime().After(c.manifestMod) {
+		return ""
+	}
+	return c.manifestHash[relPath]
+}
+
+// quoteETag 将哈希转换为 ETag（取前 32 位十六进制，已足够区分）
+func quoteETag(hash string) string {
+	if len(hash) > 32 {
+		hash = hash[:32]
+	}
+	return `"` + hash + `"`
+}
+
+// relativePath 将请求路径转换为清单中使用的相对路径
+func relativePath(urlPath string) string {
+	return filepath.ToSlash(strings.TrimPrefix(urlPath, "/"))
+}
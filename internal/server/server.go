@@ -0,0 +1,331 @@
+// Package server 通过 HTTP 提供生成的规则集文件（自托管 rule-provider）
+package server
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"rulerefinery/internal/workflow"
+)
+
+// Options 服务参数
+type Options struct {
+	Addr    string // 监听地址（如 :8080）
+	Dir     string // 规则集输出目录
+	Gzip    bool   // 客户端支持时使用 gzip 压缩响应
+	ListExt string // 纯文本格式文件扩展名（默认 .list）
+	YAMLExt string // YAML 格式文件扩展名（默认 .yaml）
+}
+
+// Server 规则集 HTTP 服务
+type Server struct {
+	opts  Options
+	etags *etagCache
+}
+
+// New 创建规则集 HTTP 服务
+func New(opts Options) (*Server, error) {
+	if opts.Dir == "" {
+		return nil, errors.New("规则集目录为空")
+	}
+	info, err := os.Stat(opts.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("访问规则集目录失败: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s 不是目录", opts.Dir)
+	}
+	if opts.Addr == "" {
+		opts.Addr = ":8080"
+	}
+	if opts.ListExt == "" {
+		opts.ListExt = ".list"
+	}
+	if opts.YAMLExt == "" {
+		opts.YAMLExt = ".yaml"
+	}
+	return &Server{opts: opts, etags: newETagCache(opts.Dir)}, nil
+}
+
+// ListenAndServe 启动服务，ctx 取消时优雅关闭
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	srv := &http.Server{
+		Addr:              s.opts.Addr,
+		Handler:           s,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- srv.ListenAndServe()
+	}()
+	log.Info().Msgf("规则集服务已启动: http://%s/ (目录: %s, gzip: %v)", displayAddr(s.opts.Addr), s.opts.Dir, s.opts.Gzip)
+
+	select {
+	case err := <-errChan:
+		return fmt.Errorf("HTTP 服务异常退出: %w", err)
+	case <-ctx.Done():
+	}
+
+	log.Info().Msg("正在关闭规则集服务...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return srv.Shutdown(shutdownCtx)
+}
+
+// ServeHTTP 处理请求：目录返回索引页，规则文件按扩展名设置 Content-Type
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	urlPath := path.Clean("/" + r.URL.Path)
+	// 隐藏点文件（如输出清单）
+	for _, part := range strings.Split(urlPath, "/") {
+		if strings.HasPrefix(part, ".") {
+			http.NotFound(w, r)
+			return
+		}
+	}
+
+	filePath := filepath.Join(s.opts.Dir, filepath.FromSlash(urlPath))
+	info, err := os.Stat(filePath)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	if info.IsDir() {
+		// 目录统一以 / 结尾，保证索引页中的相对链接正确
+		if !strings.HasSuffix(r.URL.Path, "/") {
+			http.Redirect(w, r, urlPath+"/", http.StatusMovedPermanently)
+			return
+		}
+		s.serveIndex(w, r, urlPath, filePath)
+		return
+	}
+
+	s.serveFile(w, r, urlPath, filePath, info)
+}
+
+// serveFile 返回规则文件
+// 响应带 ETag（内容哈希）和 Last-Modified，客户端条件请求命中时返回 304
+func (s *Server) serveFile(w http.ResponseWriter, r *http.Request, urlPath string, filePath string, info os.FileInfo) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", s.contentType(filePath))
+	etag := s.etags.etag(relativePath(urlPath), filePath, info)
+
+	if s.opts.Gzip {
+		w.Header().Add("Vary", "Accept-Encoding")
+	}
+	if s.opts.Gzip && r.Method == http.MethodGet && acceptsGzip(r) {
+		// 压缩后长度未知，不支持 Range 请求；压缩内容与原始内容使用不同的 ETag
+		r.Header.Del("Range")
+		if etag != "" {
+			w.Header().Set("ETag", strings.TrimSuffix(etag, `"`)+`-gzip"`)
+		}
+		gw := &gzipResponseWriter{ResponseWriter: w}
+		defer gw.Close()
+		http.ServeContent(gw, r, info.Name(), info.ModTime(), f)
+		return
+	}
+
+	if etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
+
+// contentType 根据扩展名返回 Content-Type
+func (s *Server) contentType(filePath string) string {
+	switch ext := strings.ToLower(filepath.Ext(filePath)); ext {
+	case s.opts.YAMLExt, ".yaml", ".yml":
+		return "application/yaml; charset=utf-8"
+	case s.opts.ListExt, ".list", ".txt":
+		return "text/plain; charset=utf-8"
+	case ".json":
+		return "application/json; charset=utf-8"
+	case ".mrs":
+		return "application/octet-stream"
+	default:
+		return "text/plain; charset=utf-8"
+	}
+}
+
+// indexEntry 索引页条目
+type indexEntry struct {
+	Name  string
+	Href  string
+	IsDir bool
+	Size  int64
+}
+
+// indexTemplate 索引页模板
+var indexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>RuleRefinery - {{.Title}}</title>
+<style>
+body { font-family: -apple-system, sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+td { padding: 2px 16px 2px 0; }
+.size { color: #888; text-align: right; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+{{if .GeneratedAt}}<p>生成时间: {{.GeneratedAt}}</p>{{end}}
+<table>
+{{if .Parent}}<tr><td><a href="../">../</a></td><td></td></tr>{{end}}
+{{range .Entries}}<tr><td><a href="{{.Href}}">{{.Name}}{{if .IsDir}}/{{end}}</a></td><td class="size">{{if not .IsDir}}{{.Size}}{{end}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// serveIndex 返回目录索引页
+// 根目录优先使用输出清单中记录的规则集（只列出本工具生成的目录），没有清单时列出全部子目录
+func (s *Server) serveIndex(w http.ResponseWriter, r *http.Request, urlPath string, dirPath string) {
+	data := struct {
+		Title       string
+		GeneratedAt string
+		Parent      bool
+		Entries     []indexEntry
+	}{
+		Title:  urlPath,
+		Parent: urlPath != "/",
+	}
+
+	var names []string
+	if urlPath == "/" {
+		manifest, err := workflow.ReadOutputManifest(dirPath)
+		if err != nil {
+			log.Warn().Msgf("读取输出清单失败: %v", err)
+		}
+		if manifest != nil {
+			data.Title = "规则集"
+			data.GeneratedAt = manifest.GeneratedAt
+			for _, name := range manifest.Rulesets {
+				if info, err := os.Stat(filepath.Join(dirPath, name)); err == nil && info.IsDir() {
+					data.Entries = append(data.Entries, indexEntry{Name: name, Href: name + "/", IsDir: true})
+				}
+			}
+		}
+	}
+
+	if data.Entries == nil {
+		entries, err := os.ReadDir(dirPath)
+		if err != nil {
+			http.Error(w, "读取目录失败", http.StatusInternalServerError)
+			return
+		}
+		for _, entry := range entries {
+			if !strings.HasPrefix(entry.Name(), ".") {
+				names = append(names, entry.Name())
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			info, err := os.Stat(filepath.Join(dirPath, name))
+			if err != nil {
+				continue
+			}
+			href := name
+			if info.IsDir() {
+				href += "/"
+			}
+			data.Entries = append(data.Entries, indexEntry{Name: name, Href: href, IsDir: info.IsDir(), Size: info.Size()})
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if r.Method == http.MethodHead {
+		return
+	}
+	if err := indexTemplate.Execute(w, data); err != nil {
+		log.Warn().Msgf("生成索引页失败: %v", err)
+	}
+}
+
+// acceptsGzip 判断客户端是否接受 gzip 编码
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		encoding, _, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.EqualFold(encoding, "gzip") {
+			return true
+		}
+	}
+	return false
+}
+
+// gzipResponseWriter 对 200 响应使用 gzip 压缩
+// ServeContent 会设置未压缩的 Content-Length，写入响应头前需要移除；
+// 304 等没有响应体的状态码保持原样，不输出 gzip 数据
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	gz          *gzip.Writer
+	wroteHeader bool
+}
+
+// WriteHeader 状态码为 200 时开启压缩
+func (g *gzipResponseWriter) WriteHeader(statusCode int) {
+	if g.wroteHeader {
+		return
+	}
+	g.wroteHeader = true
+	if statusCode == http.StatusOK {
+		g.ResponseWriter.Header().Del("Content-Length")
+		g.ResponseWriter.Header().Del("Accept-Ranges")
+		g.ResponseWriter.Header().Set("Content-Encoding", "gzip")
+		g.gz = gzip.NewWriter(g.ResponseWriter)
+	}
+	g.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write 写入响应体（开启压缩时写入 gzip 数据）
+func (g *gzipResponseWriter) Write(p []byte) (int, error) {
+	if !g.wroteHeader {
+		g.WriteHeader(http.StatusOK)
+	}
+	if g.gz != nil {
+		return g.gz.Write(p)
+	}
+	return g.ResponseWriter.Write(p)
+}
+
+// Close 结束 gzip 数据流
+func (g *gzipResponseWriter) Close() error {
+	if g.gz == nil {
+		return nil
+	}
+	return g.gz.Close()
+}
+
+// displayAddr 将 ":8080" 形式的监听地址转换为可访问的地址
+func displayAddr(addr string) string {
+	if strings.HasPrefix(addr, ":") {
+		return "localhost" + addr
+	}
+	return addr
+}
@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"net/url"
+	"strings"
+)
+
+// CanonicalGitHubURL 将同一 GitHub 文件的不同 URL 写法统一为 Raw URL，用于比较是否为同一来源
+// 支持的写法（owner/repo 不区分大小写，统一为小写；查询参数和锚点被忽略）：
+// - https://raw.githubusercontent.com/owner/repo/branch/path
+// - https://raw.githubusercontent.com/owner/repo/refs/heads/branch/path
+// - https://github.com/owner/repo/blob/branch/path（以及 /raw/、/blob/refs/heads/）
+// - https://api.github.com/repos/owner/repo/contents/path?ref=branch
+// 统一为 https://raw.githubusercontent.com/owner/repo/branch/path；非 GitHub 文件 URL 原样返回
+func CanonicalGitHubURL(rawURL string) string {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return rawURL
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+
+	var owner, repo, branch string
+	var filePath []string
+	switch strings.ToLower(u.Hostname()) {
+	case "raw.githubusercontent.com":
+		// owner/repo/branch/path...
+		if len(parts) < 4 {
+			return rawURL
+		}
+		owner, repo = parts[0], parts[1]
+		branch, filePath = splitRef(parts[2:])
+	case "github.com", "www.github.com":
+		// owner/repo/blob|raw/branch/path...
+		if len(parts) < 5 || (parts[2] != "blob" && parts[2] != "raw") {
+			return rawURL
+		}
+		owner, repo = parts[0], parts[1]
+		branch, filePath = splitRef(parts[3:])
+	case "api.github.com":
+		// repos/owner/repo/contents/path...?ref=branch（没有 ref 时为默认分支，无法确定）
+		branch = u.Query().Get("ref")
+		if len(parts) < 5 || parts[0] != "repos" || parts[3] != "contents" || branch == "" {
+			return rawURL
+		}
+		owner, repo = parts[1], parts[2]
+		filePath = parts[4:]
+	default:
+		return rawURL
+	}
+	if branch == "" || len(filePath) == 0 {
+		return rawURL
+	}
+
+	return "https://raw.githubusercontent.com/" + strings.ToLower(owner) + "/" + strings.ToLower(repo) + "/" +
+		branch + "/" + strings.Join(filePath, "/")
+}
+
+// splitRef 从 URL 路径中拆出分支名和文件路径，去除 refs/heads/ 前缀
+func splitRef(parts []string) (string, []string) {
+	if len(parts) >= 3 && parts[0] == "refs" && parts[1] == "heads" {
+		parts = parts[2:]
+	}
+	if len(parts) < 2 {
+		return "", nil
+	}
+	return parts[0], parts[1:]
+}
+
+// GitHubRepoFromURL 返回 GitHub 文件 URL（Raw、blob 或 contents API 形式）所属的仓库（owner 和 repo 均为小写）
+// 不是可识别的 GitHub 文件 URL 时返回 false
+func GitHubRepoFromURL(rawURL string) (owner, repo string, ok bool) {
+	rest, found := strings.CutPrefix(CanonicalGitHubURL(rawURL), "https://raw.githubusercontent.com/")
+	if !found {
+		return "", "", false
+	}
+	parts := strings.SplitN(rest, "/", 3)
+	if len(parts) < 3 {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
@@ -0,0 +1,37 @@
+package utils
+
+import "testing"
+
+func TestCanonicalGitHubURL(t *testing.T) {
+	const want = "https://raw.githubusercontent.com/owner/repo/master/rule/Clash/Google.list"
+	tests := []struct {
+		name string
+		url  string
+		want string
+	}{
+		{"raw", "https://raw.githubusercontent.com/owner/repo/master/rule/Clash/Google.list", want},
+		{"raw refs/heads", "https://raw.githubusercontent.com/owner/repo/refs/heads/master/rule/Clash/Google.list", want},
+		{"blob", "https://github.com/owner/repo/blob/master/rule/Clash/Google.list", want},
+		{"blob refs/heads", "https://github.com/owner/repo/blob/refs/heads/master/rule/Clash/Google.list", want},
+		{"raw path on github.com", "https://github.com/owner/repo/raw/master/rule/Clash/Google.list", want},
+		{"contents API", "https://api.github.com/repos/owner/repo/contents/rule/Clash/Google.list?ref=master", want},
+		{"mixed-case owner and repo", "https://raw.githubusercontent.com/Owner/REPO/master/rule/Clash/Google.list", want},
+		{"mixed-case host", "https://GitHub.com/Owner/Repo/blob/master/rule/Clash/Google.list", want},
+		{"query and fragment", "https://github.com/owner/repo/blob/master/rule/Clash/Google.list?raw=true#L1", want},
+		{"surrounding spaces", "  https://raw.githubusercontent.com/owner/repo/master/rule/Clash/Google.list ", want},
+		{"file path case kept", "https://raw.githubusercontent.com/owner/repo/master/rule/clash/google.list",
+			"https://raw.githubusercontent.com/owner/repo/master/rule/clash/google.list"},
+		{"contents API without ref", "https://api.github.com/repos/owner/repo/contents/Google.list",
+			"https://api.github.com/repos/owner/repo/contents/Google.list"},
+		{"repository page", "https://github.com/owner/repo", "https://github.com/owner/repo"},
+		{"other host", "https://example.com/owner/repo/master/Google.list", "https://example.com/owner/repo/master/Google.list"},
+		{"local path", "./rules/Google.list", "./rules/Google.list"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CanonicalGitHubURL(tt.url); got != tt.want {
+				t.Errorf("CanonicalGitHubURL(%q) = %q, want %q", tt.url, got, tt.want)
+			}
+		})
+	}
+}
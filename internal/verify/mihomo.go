@@ -0,0 +1,196 @@
+package verify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"rulerefinery/internal/config"
+)
+
+// emptyPlaceholder 空规则文件的占位注释（与 Optimizer 导出保持一致）
+const emptyPlaceholder = "无规则内容，自动生成占位"
+
+// Result 单个文件的校验结果
+type Result struct {
+	File    string // 规则文件路径
+	OK      bool   // 是否加载成功
+	Skipped bool   // 是否跳过（如 classical 不支持转换、空规则文件）
+	Stderr  string // 校验工具的标准错误输出
+	Err     error  // 执行错误
+}
+
+// Summary 校验汇总
+type Summary struct {
+	Results []Result
+	Passed  int
+	Failed  int
+	Skipped int
+}
+
+// FailedFiles 返回校验失败的文件列表
+func (s *Summary) FailedFiles() []string {
+	var files []string
+	for _, r := range s.Results {
+		if !r.OK && !r.Skipped {
+			files = append(files, r.File)
+		}
+	}
+	return files
+}
+
+// MihomoVerifier 使用 mihomo 二进制校验导出的规则文件
+// 通过 mihomo convert-ruleset 将 domain/ipcidr 规则转换为 mrs 格式来检查能否正确加载
+// classical behavior 不支持 convert-ruleset，跳过校验
+type MihomoVerifier struct {
+	binary  string // mihomo 可执行文件路径
+	listExt string // 纯文本格式文件扩展名（默认 .list）
+	yamlExt string // YAML 格式文件扩展名（默认 .yaml）
+	layout  string // 输出目录结构（config.LayoutByRuleset/LayoutByBehavior）
+}
+
+// NewMihomoVerifier 创建校验器，binary 可以是命令名（从 PATH 查找）或路径
+// 找不到可执行文件时返回错误
+func NewMihomoVerifier(binary string) (*MihomoVerifier, error) {
+	if binary == "" {
+		binary = "mihomo"
+	}
+	path, err := exec.LookPath(binary)
+	if err != nil {
+		return nil, fmt.Errorf("未找到校验工具 '%s'（请确认已安装并在 PATH 中）: %w", binary, err)
+	}
+	return &MihomoVerifier{binary: path, listExt: ".list", yamlExt: ".yaml"}, nil
+}
+
+// SetFileExtensions 设置导出文件的扩展名（与 generate_rules.list_extension/yaml_extension 一致）
+func (v *MihomoVerifier) SetFileExtensions(listExt, yamlExt string) {
+	if listExt != "" {
+		v.listExt = listExt
+	}
+	if yamlExt != "" {
+		v.yamlExt = yamlExt
+	}
+}
+
+// SetLayout 设置输出目录结构（与 generate_rules.layout 一致），by_behavior 布局下按所在目录判断 behavior
+func (v *MihomoVerifier) SetLayout(layout string) {
+	v.layout = layout
+}
+
+// VerifyDir 校验目录下所有导出的规则文件
+func (v *MihomoVerifier) VerifyDir(ctx context.Context, outputDir string) (*Summary, error) {
+	var files []string
+	err := filepath.WalkDir(outputDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		ext := filepath.Ext(path)
+		if ext == v.yamlExt || ext == v.listExt {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("遍历输出目录失败: %w", err)
+	}
+	sort.Strings(files)
+
+	tmpDir, err := os.MkdirTemp("", "rulerefinery-verify-*")
+	if err != nil {
+		return nil, fmt.Errorf("创建临时目录失败: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	summary := &Summary{}
+	for i, file := range files {
+		result := v.verifyFile(ctx, file, filepath.Join(tmpDir, fmt.Sprintf("%d.mrs", i)))
+		switch {
+		case result.Skipped:
+			summary.Skipped++
+		case result.OK:
+			summary.Passed++
+		default:
+			summary.Failed++
+			log.Warn().Msgf("校验失败: %s\n%s", file, result.Stderr)
+		}
+		summary.Results = append(summary.Results, result)
+	}
+	return summary, nil
+}
+
+// verifyFile 校验单个规则文件
+func (v *MihomoVerifier) verifyFile(ctx context.Context, file string, target string) Result {
+	result := Result{File: file}
+
+	behavior := behaviorOf(file)
+	if v.layout == config.LayoutByBehavior {
+		behavior = behaviorOfDir(file)
+	}
+	if behavior == "" {
+		// classical 不支持 convert-ruleset
+		result.Skipped = true
+		return result
+	}
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	if strings.Contains(string(content), emptyPlaceholder) {
+		result.Skipped = true
+		return result
+	}
+
+	format := "text"
+	if filepath.Ext(file) == v.yamlExt {
+		format = "yaml"
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, v.binary, "convert-ruleset", behavior, format, file, target)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		result.Err = err
+		result.Stderr = strings.TrimSpace(stderr.String())
+		return result
+	}
+
+	result.OK = true
+	result.Stderr = strings.TrimSpace(stderr.String())
+	return result
+}
+
+// behaviorOf 根据导出文件名判断 behavior（{name}_domain.* / {name}_ipcidr.*）
+func behaviorOf(file string) string {
+	base := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	switch {
+	case strings.HasSuffix(base, "_domain"):
+		return "domain"
+	case strings.HasSuffix(base, "_ipcidr"):
+		return "ipcidr"
+	}
+	return ""
+}
+
+// behaviorOfDir by_behavior 布局下根据文件所在目录（{type}/{name}.{ext}）判断 behavior，classical 返回空
+func behaviorOfDir(file string) string {
+	switch filepath.Base(filepath.Dir(file)) {
+	case "domain":
+		return "domain"
+	case "ipcidr":
+		return "ipcidr"
+	}
+	return ""
+}
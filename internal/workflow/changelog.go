@@ -0,0 +1,238 @@
+package workflow
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ChangelogFile 输出目录中的变更日志文件名（每次运行有变化时在顶部追加一节）
+const ChangelogFile = "CHANGELOG.md"
+
+// changelogSnapshotDir 保存各规则集上次导出规则的目录（位于输出目录，serve 模式不提供以 . 开头的路径）
+const changelogSnapshotDir = ".rulerefinery-snapshots"
+
+// changelogHeader 变更日志的标题行
+const changelogHeader = "# 规则集变更日志\n"
+
+// changelogNotableDomains 每个规则集在变更日志中列出的新增域名数量上限
+const changelogNotableDomains = 10
+
+// RulesetChange 规则集相对上次运行的变更
+type RulesetChange struct {
+	Name       string
+	Added      int      // 新增的规则数量
+	Removed    int      // 移除的规则数量
+	NewDomains []string // 新增的 DOMAIN/DOMAIN-SUFFIX 域名（最多 changelogNotableDomains 个）
+	New        bool     // 上次运行没有该规则集
+	Deleted    bool     // 规则集已从规则分类文件中移除
+}
+
+// Changed 是否有变化
+func (c RulesetChange) Changed() bool {
+	return c.New || c.Deleted || c.Added > 0 || c.Removed > 0
+}
+
+// stagedSnapshotSuffix 本次运行新快照的后缀：导出时先写入 {name}.list.new，
+// finishOutput 的所有步骤成功后才由 commitSnapshots 替换上次的快照，失败的运行不会吞掉变更
+const stagedSnapshotSuffix = ".new"
+
+// snapshotPath 返回规则集快照文件路径
+func snapshotPath(outputDir, name string) string {
+	return filepath.Join(outputDir, changelogSnapshotDir, name+".list")
+}
+
+// readSnapshot 读取规则集上次导出的规则，快照不存在时返回 nil, false
+func readSnapshot(outputDir, name string) ([]string, bool, error) {
+	data, err := os.ReadFile(snapshotPath(outputDir, name))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("读取规则集快照失败: %w", err)
+	}
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, true, nil
+}
+
+// diffRulesetSnapshot 将规则集本次导出的规则（"类型,内容"）与上次的快照比较，并将本次的规则写入待提交的新快照
+// （由 commitSnapshots 在输出全部完成后替换上次的快照）
+func diffRulesetSnapshot(outputDir, name string, current []string) (RulesetChange, error) {
+	change := RulesetChange{Name: name}
+
+	previous, ok, err := readSnapshot(outputDir, name)
+	if err != nil {
+		return change, err
+	}
+	change.New = !ok
+
+	prevSet := make(map[string]bool, len(previous))
+	for _, rule := range previous {
+		prevSet[rule] = true
+	}
+	curSet := make(map[string]bool, len(current))
+	for _, rule := range current {
+		curSet[rule] = true
+		if prevSet[rule] {
+			continue
+		}
+		change.Added++
+		if len(change.NewDomains) < changelogNotableDomains {
+			if domain, ok := changelogDomain(rule); ok {
+				change.NewDomains = append(change.NewDomains, domain)
+			}
+		}
+	}
+	for _, rule := range previous {
+		if !curSet[rule] {
+			change.Removed++
+		}
+	}
+
+	path := snapshotPath(outputDir, name) + stagedSnapshotSuffix
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return change, fmt.Errorf("创建快照目录失败: %w", err)
+	}
+	var sb strings.Builder
+	for _, rule := range current {
+		sb.WriteString(rule)
+		sb.WriteByte('\n')
+	}
+	if err := os.WriteFile(path, []byte(sb.String()), 0644); err != nil {
+		return change, fmt.Errorf("写入规则集快照失败: %w", err)
+	}
+	return change, nil
+}
+
+// changelogDomain 返回 DOMAIN/DOMAIN-SUFFIX 规则的域名（不含参数和策略）
+func changelogDomain(rule string) (string, bool) {
+	parts := strings.SplitN(rule, ",", 3)
+	if len(parts) < 2 || (parts[0] != "DOMAIN" && parts[0] != "DOMAIN-SUFFIX") {
+		return "", false
+	}
+	return parts[1], true
+}
+
+// deletedRulesetChanges 返回快照目录中有、但已不在 current 中的规则集（快照由 commitSnapshots 删除）
+func deletedRulesetChanges(outputDir string, current []string) ([]RulesetChange, error) {
+	entries, err := os.ReadDir(filepath.Join(outputDir, changelogSnapshotDir))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("读取快照目录失败: %w", err)
+	}
+
+	keep := make(map[string]bool, len(current))
+	for _, name := range current {
+		keep[name] = true
+	}
+	var changes []RulesetChange
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".list")
+		if entry.IsDir() || !ok || keep[name] {
+			continue
+		}
+		previous, _, err := readSnapshot(outputDir, name)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, RulesetChange{Name: name, Removed: len(previous), Deleted: true})
+	}
+	return changes, nil
+}
+
+// commitSnapshots 用本次运行写入的新快照替换上次的快照，并删除已移除规则集的快照
+// 在变更日志写入后作为输出的最后一步调用：之前的步骤失败时保留上次的快照，下次运行仍会报告这些变更
+func commitSnapshots(outputDir string, changes []RulesetChange) error {
+	for _, change := range changes {
+		path := snapshotPath(outputDir, change.Name)
+		if change.Deleted {
+			if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("删除规则集快照失败: %w", err)
+			}
+			continue
+		}
+		if err := os.Rename(path+stagedSnapshotSuffix, path); err != nil {
+			return fmt.Errorf("更新规则集快照失败: %w", err)
+		}
+	}
+	return nil
+}
+
+// writeChangelog 在输出目录的 CHANGELOG.md 顶部（标题之后）追加本次运行的变更（按规则集名称排序），没有变化时不写入
+// 返回是否写入
+func writeChangelog(outputDir, version string, changes []RulesetChange) (bool, error) {
+	var changed []RulesetChange
+	for _, change := range changes {
+		if change.Changed() {
+			changed = append(changed, change)
+		}
+	}
+	if len(changed) == 0 {
+		return false, nil
+	}
+	sort.Slice(changed, func(i, j int) bool { return changed[i].Name < changed[j].Name })
+	if version == "" {
+		version = "dev"
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "\n## %s（%s）\n\n", time.Now().UTC().Format("2006-01-02 15:04:05 UTC"), version)
+	for _, change := range changed {
+		switch {
+		case change.Deleted:
+			fmt.Fprintf(&sb, "- **%s**: 规则集已移除（-%d）\n", change.Name, change.Removed)
+		case change.New:
+			fmt.Fprintf(&sb, "- **%s**: 新规则集（+%d）\n", change.Name, change.Added)
+		default:
+			fmt.Fprintf(&sb, "- **%s**: +%d / -%d\n", change.Name, change.Added, change.Removed)
+		}
+		if len(change.NewDomains) > 0 {
+			domains := make([]string, len(change.NewDomains))
+			for i, domain := range change.NewDomains {
+				domains[i] = "`" + domain + "`"
+			}
+			fmt.Fprintf(&sb, "  - 新增域名: %s", strings.Join(domains, ", "))
+			if change.Added > len(change.NewDomains) {
+				fmt.Fprintf(&sb, " 等")
+			}
+			sb.WriteByte('\n')
+		}
+	}
+
+	path := filepath.Join(outputDir, ChangelogFile)
+	existing, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return false, fmt.Errorf("读取变更日志失败: %w", err)
+	}
+	rest := strings.TrimPrefix(string(existing), changelogHeader)
+
+	f, err := os.Create(path)
+	if err != nil {
+		return false, fmt.Errorf("写入变更日志失败: %w", err)
+	}
+	defer f.Close()
+
+	bw := bufio.NewWriter(f)
+	bw.WriteString(changelogHeader)
+	bw.WriteString(sb.String())
+	bw.WriteString(rest)
+	if err := bw.Flush(); err != nil {
+		return false, fmt.Errorf("写入变更日志失败: %w", err)
+	}
+	log.Info().Msgf("变更日志已更新: %s（%d 个规则集有变化）", path, len(changed))
+	return true, nil
+}
@@ -0,0 +1,63 @@
+package workflow
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSnapshotCommittedOnlyAfterOutput(t *testing.T) {
+	dir := t.TempDir()
+
+	first, err := diffRulesetSnapshot(dir, "google", []string{"DOMAIN,google.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !first.New || first.Added != 1 {
+		t.Fatalf("first diff = %+v, want new ruleset with 1 added", first)
+	}
+
+	// 输出没有完成（没有提交快照）：下次运行仍然报告同样的变更
+	retry, err := diffRulesetSnapshot(dir, "google", []string{"DOMAIN,google.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(retry, first) {
+		t.Errorf("diff after failed run = %+v, want %+v", retry, first)
+	}
+
+	if err := commitSnapshots(dir, []RulesetChange{retry}); err != nil {
+		t.Fatal(err)
+	}
+	next, err := diffRulesetSnapshot(dir, "google", []string{"DOMAIN,google.com", "DOMAIN-SUFFIX,youtube.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.New || next.Added != 1 || next.Removed != 0 {
+		t.Errorf("diff after commit = %+v, want 1 added to existing ruleset", next)
+	}
+}
+
+func TestCommitSnapshotsRemovesDeleted(t *testing.T) {
+	dir := t.TempDir()
+	change, err := diffRulesetSnapshot(dir, "old", []string{"DOMAIN,old.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := commitSnapshots(dir, []RulesetChange{change}); err != nil {
+		t.Fatal(err)
+	}
+
+	deleted, err := deletedRulesetChanges(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted) != 1 || !deleted[0].Deleted || deleted[0].Removed != 1 {
+		t.Fatalf("deletedRulesetChanges() = %+v, want old deleted", deleted)
+	}
+	if err := commitSnapshots(dir, deleted); err != nil {
+		t.Fatal(err)
+	}
+	if again, err := deletedRulesetChanges(dir, nil); err != nil || len(again) != 0 {
+		t.Errorf("deletedRulesetChanges() after commit = %+v, %v, want none", again, err)
+	}
+}
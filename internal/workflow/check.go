@@ -0,0 +1,155 @@
+package workflow
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// FileDiff 两个输出目录中内容不同的文件
+type FileDiff struct {
+	Path    string // 以 / 分隔的相对路径
+	Added   int    // 只在重新生成的文件中出现的行数
+	Removed int    // 只在已有文件中出现的行数
+}
+
+// OutputDiff 已有输出目录与重新生成的输出目录的差异（路径均按名称排序）
+type OutputDiff struct {
+	Missing []string   // 重新生成了、但已有输出中没有的文件
+	Stale   []string   // 已有输出中有、但不再生成的文件
+	Changed []FileDiff // 内容不同的文件
+}
+
+// UpToDate 已有输出是否与重新生成的结果一致
+func (d *OutputDiff) UpToDate() bool {
+	return len(d.Missing) == 0 && len(d.Stale) == 0 && len(d.Changed) == 0
+}
+
+// WriteReport 输出差异摘要
+func (d *OutputDiff) WriteReport(w io.Writer) error {
+	var sb strings.Builder
+	if d.UpToDate() {
+		sb.WriteString("规则集输出已是最新\n")
+	} else {
+		fmt.Fprintf(&sb, "规则集输出已过期: %d 个文件缺失，%d 个文件多余，%d 个文件内容不同\n", len(d.Missing), len(d.Stale), len(d.Changed))
+		for _, path := range d.Missing {
+			fmt.Fprintf(&sb, "  缺失  %s\n", path)
+		}
+		for _, path := range d.Stale {
+			fmt.Fprintf(&sb, "  多余  %s\n", path)
+		}
+		for _, diff := range d.Changed {
+			fmt.Fprintf(&sb, "  变化  %s (+%d -%d 行)\n", diff.Path, diff.Added, diff.Removed)
+		}
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// CompareOutputDirs 比较已有输出目录和重新生成的输出目录
+// 以 . 开头的文件和目录（输出清单、变更日志快照等工具内部状态）以及 ignore 中的顶层文件名（如包含生成时间的文件）不参与比较
+func CompareOutputDirs(existingDir, generatedDir string, ignore []string) (*OutputDiff, error) {
+	skip := make(map[string]bool, len(ignore))
+	for _, name := range ignore {
+		skip[name] = true
+	}
+
+	existing, err := listOutputFiles(existingDir, skip)
+	if err != nil {
+		return nil, err
+	}
+	generated, err := listOutputFiles(generatedDir, skip)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := &OutputDiff{}
+	for path := range generated {
+		if !existing[path] {
+			diff.Missing = append(diff.Missing, path)
+		}
+	}
+	for path := range existing {
+		if !generated[path] {
+			diff.Stale = append(diff.Stale, path)
+			continue
+		}
+		a, err := os.ReadFile(filepath.Join(existingDir, filepath.FromSlash(path)))
+		if err != nil {
+			return nil, err
+		}
+		b, err := os.ReadFile(filepath.Join(generatedDir, filepath.FromSlash(path)))
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(a, b) {
+			added, removed := countLineChanges(string(a), string(b))
+			diff.Changed = append(diff.Changed, FileDiff{Path: path, Added: added, Removed: removed})
+		}
+	}
+
+	sort.Strings(diff.Missing)
+	sort.Strings(diff.Stale)
+	sort.Slice(diff.Changed, func(i, j int) bool { return diff.Changed[i].Path < diff.Changed[j].Path })
+	return diff, nil
+}
+
+// listOutputFiles 返回目录中参与比较的文件（以 / 分隔的相对路径），目录不存在时返回空集合
+func listOutputFiles(dir string, skip map[string]bool) (map[string]bool, error) {
+	files := make(map[string]bool)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == dir && errors.Is(err, fs.ErrNotExist) {
+				return filepath.SkipAll
+			}
+			return err
+		}
+		if path == dir {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if strings.HasPrefix(d.Name(), ".") || skip[rel] {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.IsDir() {
+			files[rel] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("读取输出目录失败: %w", err)
+	}
+	return files, nil
+}
+
+// countLineChanges 统计只在 b 中出现的行数和只在 a 中出现的行数（按行计数比较，不考虑顺序）
+func countLineChanges(a, b string) (added, removed int) {
+	counts := make(map[string]int)
+	for _, line := range strings.Split(a, "\n") {
+		counts[line]++
+	}
+	for _, line := range strings.Split(b, "\n") {
+		counts[line]--
+	}
+	for _, n := range counts {
+		if n > 0 {
+			removed += n
+		} else {
+			added -= n
+		}
+	}
+	return added, removed
+}
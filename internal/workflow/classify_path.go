@@ -0,0 +1,93 @@
+package workflow
+
+import (
+	"sort"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/rs/zerolog/log"
+
+	"rulerefinery/internal/config"
+	"rulerefinery/internal/rules"
+)
+
+// pathClassifier path_classifiers 中的一项
+type pathClassifier struct {
+	pattern string
+	ruleset string
+}
+
+// sortedPathClassifiers 按模式长度从长到短排序（更具体的模式优先），长度相同时按模式排序
+func sortedPathClassifiers(classifiers map[string]string) []pathClassifier {
+	sorted := make([]pathClassifier, 0, len(classifiers))
+	for pattern, name := range classifiers {
+		sorted = append(sorted, pathClassifier{pattern: pattern, ruleset: config.NormalizeRulesetName(name)})
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if len(sorted[i].pattern) != len(sorted[j].pattern) {
+			return len(sorted[i].pattern) > len(sorted[j].pattern)
+		}
+		return sorted[i].pattern < sorted[j].pattern
+	})
+	return sorted
+}
+
+// classifyByPath 按 path_classifiers 将路径明确体现分类的规则文件直接归入规则集（写入 categories），不再交给 AI
+// GitHub 文件匹配 owner/repo/路径，本地文件匹配文件路径；多个模式匹配时最长的模式优先，
+// 同样长度的模式指向不同规则集时视为有歧义，交给 AI。返回需要交给 AI 分类的文件和归入的文件数
+func classifyByPath(ruleFiles []rules.RuleFileInfo, classifiers map[string]string, existing *config.RuleSetsConfig, categories map[string]*rules.RuleCategory) ([]rules.RuleFileInfo, int) {
+	sorted := sortedPathClassifiers(classifiers)
+
+	var remaining []rules.RuleFileInfo
+	matched := 0
+	for _, file := range ruleFiles {
+		subject := file.RepoPath
+		if subject == "" {
+			subject = file.FilePath
+		}
+
+		var hit *pathClassifier
+		ambiguous := false
+		for i := range sorted {
+			if ok, _ := doublestar.Match(sorted[i].pattern, subject); !ok {
+				continue
+			}
+			if hit == nil {
+				hit = &sorted[i]
+				continue
+			}
+			if len(sorted[i].pattern) < len(hit.pattern) {
+				break
+			}
+			if sorted[i].ruleset != hit.ruleset {
+				ambiguous = true
+				break
+			}
+		}
+		if hit == nil || ambiguous {
+			if ambiguous {
+				log.Debug().Msgf("路径同时匹配多个规则集的模式，交给 AI 分类: %s", subject)
+			}
+			remaining = append(remaining, file)
+			continue
+		}
+
+		category, ok := categories[hit.ruleset]
+		if !ok {
+			category = &rules.RuleCategory{Name: hit.ruleset}
+			if existing != nil {
+				category.Description = existing.ClassifiedRules[hit.ruleset].Description
+			}
+			categories[hit.ruleset] = category
+		}
+		if file.GitHubURL != "" {
+			category.URLs = append(category.URLs, file.GitHubURL)
+		} else {
+			category.Files = append(category.Files, file.FilePath)
+		}
+		matched++
+		log.Info().Msgf("按路径归入规则集 '%s'（模式 %s）: %s", hit.ruleset, hit.pattern, subject)
+	}
+
+	log.Info().Msgf("路径预分类完成: %d 个规则文件归入规则集，%d 个交给后续分类", matched, len(remaining))
+	return remaining, matched
+}
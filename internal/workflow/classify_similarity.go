@@ -0,0 +1,57 @@
+package workflow
+
+import (
+	"os"
+
+	"github.com/rs/zerolog/log"
+
+	"rulerefinery/internal/config"
+	"rulerefinery/internal/rules"
+	"rulerefinery/internal/utils"
+)
+
+// classifyBySimilarity 将新规则文件与已有规则集的规则内容比较 Jaccard 相似度，达到阈值的文件直接归入相似度最高的规则集
+// 已有规则集的内容来自其本地文件、本次下载的 GitHub 文件（localPaths）和手工规则；无法在本地找到的 URL 来源不参与比较
+// 返回需要交给 AI 分类的文件、归入已有规则集的分类结果和归入的文件数
+func classifyBySimilarity(ruleFiles []rules.RuleFileInfo, existing *config.RuleSetsConfig, localPaths map[string]string, threshold float64) ([]rules.RuleFileInfo, map[string]*rules.RuleCategory, int) {
+	rulesets := make(map[string]map[string]bool, len(existing.ClassifiedRules))
+	for name, ruleset := range existing.ClassifiedRules {
+		var files []string
+		for _, file := range ruleset.Files {
+			if _, err := os.Stat(file); err == nil {
+				files = append(files, file)
+			}
+		}
+		for _, url := range ruleset.URLs {
+			if path, ok := localPaths[utils.CanonicalGitHubURL(url)]; ok {
+				files = append(files, path)
+			}
+		}
+		rulesets[name] = rules.RulesetPayloads(files, existing.ExpandedRules(ruleset))
+	}
+
+	matches, remaining := rules.MatchRulesetsBySimilarity(ruleFiles, rulesets, threshold)
+	categories := make(map[string]*rules.RuleCategory)
+	for _, match := range matches {
+		category, ok := categories[match.Ruleset]
+		if !ok {
+			category = &rules.RuleCategory{
+				Name:        match.Ruleset,
+				Description: existing.ClassifiedRules[match.Ruleset].Description,
+			}
+			categories[match.Ruleset] = category
+		}
+		source := match.File.GitHubURL
+		if source != "" {
+			category.URLs = append(category.URLs, source)
+		} else {
+			source = match.File.FilePath
+			category.Files = append(category.Files, source)
+		}
+		log.Info().Msgf("按相似度归入规则集 '%s'（相似度 %.2f）: %s", match.Ruleset, match.Similarity, source)
+	}
+
+	log.Info().Msgf("相似度预分类完成: %d 个规则文件归入已有规则集，%d 个交给 AI 分类（阈值 %.2f）",
+		len(matches), len(remaining), threshold)
+	return remaining, categories, len(matches)
+}
@@ -0,0 +1,71 @@
+package workflow
+
+import (
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+
+	"rulerefinery/internal/config"
+	"rulerefinery/internal/rules"
+	"rulerefinery/internal/utils"
+)
+
+// domainListFiles 返回按纯域名列表解析的本地文件：来源 URL 所在仓库的 filters 中，
+// 第一个匹配文件路径的 filter 的 type 为 clash-domain（与下载时确定文件类型的规则相同）
+// fileSources 为加载的本地文件路径 -> 来源（只有 GitHub URL 来源可能匹配）
+func domainListFiles(repos []config.RepositoryConfig, fileSources map[string]string) map[string]bool {
+	files := make(map[string]bool)
+	for filePath, url := range fileSources {
+		if repoFilterType(repos, url) == rules.DomainListType {
+			files[filePath] = true
+		}
+	}
+	return files
+}
+
+// repoFilterType 返回 GitHub 文件 URL 在仓库配置中匹配的 filter type，不属于任何配置的仓库或没有匹配时返回空
+func repoFilterType(repos []config.RepositoryConfig, url string) string {
+	canonical := utils.CanonicalGitHubURL(url)
+	rest, ok := strings.CutPrefix(canonical, "https://raw.githubusercontent.com/")
+	if !ok {
+		return ""
+	}
+
+	for _, repo := range repos {
+		prefix := strings.ToLower(repo.Owner) + "/" + strings.ToLower(repo.Repo) + "/"
+		refPath, ok := strings.CutPrefix(rest, prefix)
+		if !ok {
+			continue
+		}
+		filePath := repoFilePath(refPath, repo.BranchList())
+		if filePath == "" {
+			continue
+		}
+		for _, filter := range repo.Filters {
+			if filter.Pattern == "" {
+				continue
+			}
+			if matched, _ := doublestar.Match(filter.Pattern, filePath); matched {
+				return filter.Type
+			}
+		}
+	}
+	return ""
+}
+
+// repoFilePath 从 "branch/path" 中去除分支名（分支名可能包含 /），返回仓库内的文件路径
+// 配置的分支为空（默认分支）时，第一段视为分支名
+func repoFilePath(refPath string, branches []string) string {
+	for _, branch := range branches {
+		if branch == "" {
+			if _, filePath, ok := strings.Cut(refPath, "/"); ok {
+				return filePath
+			}
+			continue
+		}
+		if filePath, ok := strings.CutPrefix(refPath, branch+"/"); ok {
+			return filePath
+		}
+	}
+	return ""
+}
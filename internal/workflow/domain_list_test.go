@@ -0,0 +1,42 @@
+package workflow
+
+import (
+	"reflect"
+	"testing"
+
+	"rulerefinery/internal/config"
+)
+
+func TestDomainListFiles(t *testing.T) {
+	repos := []config.RepositoryConfig{
+		{
+			Owner:  "blackmatrix7",
+			Repo:   "ios_rule_script",
+			Branch: "master",
+			Filters: []config.FilterRule{
+				{Pattern: "rule/Clash/**/*_Domain.list", Type: "clash-domain"},
+				{Pattern: "rule/Clash/**/*.list", Type: "clash-classic"},
+			},
+		},
+		{
+			Owner:    "Loyalsoldier",
+			Repo:     "clash-rules",
+			Branches: []string{"release/v2"},
+			Filters:  []config.FilterRule{{Pattern: "*.txt", Type: "clash-domain"}},
+		},
+	}
+	fileSources := map[string]string{
+		"dl/google_domain.list": "https://raw.githubusercontent.com/blackmatrix7/ios_rule_script/master/rule/Clash/Google/Google_Domain.list",
+		"dl/google.list":        "https://github.com/Blackmatrix7/IOS_rule_script/blob/master/rule/Clash/Google/Google.list",
+		"dl/proxy.txt":          "https://raw.githubusercontent.com/Loyalsoldier/clash-rules/release/v2/proxy.txt",
+		"dl/other_branch.txt":   "https://raw.githubusercontent.com/Loyalsoldier/clash-rules/dev/proxy.txt",
+		"dl/unknown.list":       "https://raw.githubusercontent.com/someone/else/master/x_Domain.list",
+		"dl/plain.list":         "https://example.com/google_domain.list",
+	}
+
+	got := domainListFiles(repos, fileSources)
+	want := map[string]bool{"dl/google_domain.list": true, "dl/proxy.txt": true}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("domainListFiles() = %v, want %v", got, want)
+	}
+}
@@ -2,61 +2,95 @@ package workflow
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/bmatcuk/doublestar/v4"
 	"github.com/rs/zerolog/log"
 
 	"rulerefinery/internal/ai"
 	"rulerefinery/internal/config"
 	"rulerefinery/internal/github"
+	"rulerefinery/internal/loader"
 	"rulerefinery/internal/proxy"
 	"rulerefinery/internal/rules"
+	"rulerefinery/internal/utils"
 )
 
+// ClassifyOptions AI 规则分类参数
+type ClassifyOptions struct {
+	ClassifiedRulesFile        string   // 现有规则分类文件路径（AI结果会自动合并到此文件）
+	AIGeneratedClassifiedRules string   // AI 生成的新规则分类文件输出路径（仅包含本次新增）
+	SkipSources                []string // 本次运行跳过分类的来源 glob 模式（匹配本地路径或 GitHub Raw URL，不修改配置）
+	ForceRefresh               bool     // 忽略所有缓存：重新下载已有的规则文件，重新分类已在配置中的规则文件
+
+	GitHub github.RepoFetcher // 仓库规则文件获取（可选，默认使用 GitHub API 客户端）
+}
+
+// ClassifyReport AI 规则分类统计
+type ClassifyReport struct {
+	NewRuleFiles      int      // 本次待分类的新规则文件数
+	SkippedExisting   int      // 已在配置中而跳过的规则文件数
+	SkippedBySource   int      // 匹配 SkipSources 而跳过的规则文件数
+	Categories        int      // 本次生成的分类数
+	ClassifiedSources int      // 本次分类的来源数（URLs + Files + Rules）
+	Unmatched         []string // 未分类的规则文件（GitHub URL 或本地路径）
+	TokenUsage        ai.Usage // AI token 使用情况
+
+	TotalBatches     int // AI 分类批次总数
+	SucceededBatches int // 分类成功的批次数（超时或出错时用于说明进度）
+	FailedBatches    int // 分类失败的批次数（不含因熔断或运行取消而中止的批次）
+
+	SimilarityMatched int // 按内容相似度直接归入已有规则集的规则文件数（未交给 AI）
+	PathMatched       int // 按 path_classifiers 直接归入规则集的规则文件数（未交给 AI）
+
+	Downloads loader.DownloadCounts // GitHub 规则文件的下载统计
+	Phases    []PhaseTiming         // 各阶段耗时
+}
+
+// PhaseTiming 运行阶段及其耗时（运行汇总报告使用）
+type PhaseTiming struct {
+	Name     string
+	Duration time.Duration
+}
+
 // HandleAIClassifyRules 处理 AI 生成规则集配置的完整流程
 // 功能说明：
 //  1. 从 GitHub 下载规则文件
 //  2. 使用 AI 分析规则内容并分类（可加载现有 classified_rules_file 做增量生成）
-//  3. 生成新分类到 aiGeneratedClassifiedRules（仅包含本次新增的分类）
-//  4. 将新分类自动合并到 classifiedRulesFile（去重，保留现有配置）
-//
-// 参数：
-//   - configFile: config.yaml 路径
-//   - classifiedRulesFile: 现有规则分类文件路径（AI结果会自动合并到此文件）
-//   - aiGeneratedClassifiedRules: AI 生成的新规则分类文件输出路径（仅包含本次新增）
-func HandleAIClassifyRules(configFile, classifiedRulesFile, aiGeneratedClassifiedRules string) {
+//  3. 生成新分类到 AIGeneratedClassifiedRules（仅包含本次新增的分类）
+//  4. 将新分类自动合并到 ClassifiedRulesFile（去重，保留现有配置）
+func HandleAIClassifyRules(ctx context.Context, cfg *config.Config, opts ClassifyOptions) (*ClassifyReport, error) {
+	classifiedRulesFile := opts.ClassifiedRulesFile
+	aiGeneratedClassifiedRules := opts.AIGeneratedClassifiedRules
+	skipSources := opts.SkipSources
+	report := &ClassifyReport{}
+
 	log.Info().Msgf("=== AI 规则集自动分类模式 ===")
 	log.Info().Msgf("规则分类文件: %s", classifiedRulesFile)
 	log.Info().Msgf("AI 输出文件: %s", aiGeneratedClassifiedRules)
 
 	// 验证输出路径不为空
 	if aiGeneratedClassifiedRules == "" {
-		log.Fatal().Msg("错误: AI 输出文件路径为空，请在 config.yaml 中配置 rulesets.ai_generated_classified_rules")
-	}
-
-	// 加载配置文件
-	cfg, err := config.LoadConfig(configFile)
-	if err != nil {
-		log.Fatal().Msgf("加载配置文件失败: %v", err)
+		return nil, fmt.Errorf("AI 输出文件路径为空，请在 config.yaml 中配置 ai_classify_rules.ai_generated_classified_rules")
 	}
 
 	// 检查 AI 配置
 	if !cfg.AI.IsAIEnabled() {
-		log.Fatal().Msg("错误: AI 未配置，无法生成规则分类。请在 config.yaml 中配置 AI 相关设置")
+		return nil, fmt.Errorf("AI 未配置，无法生成规则分类。请在 config.yaml 中配置 AI 相关设置")
 	}
 
-	ctx := context.Background()
-
 	// 初始化代理池
-	proxyPool, err := proxy.NewPool(cfg.Proxy.URLs, cfg.Proxy.Enabled)
+	proxyPool, err := proxy.NewPoolFromConfig(cfg.Proxy, cfg.HTTP)
 	if err != nil {
-		log.Fatal().Msgf("初始化代理池失败: %v", err)
+		return nil, fmt.Errorf("初始化代理池失败: %w", err)
 	}
 	if proxyPool.IsEnabled() {
 		log.Info().Msgf("代理已启用: %s", proxyPool.GetCurrentProxy())
@@ -65,7 +99,7 @@ func HandleAIClassifyRules(configFile, classifiedRulesFile, aiGeneratedClassifie
 	// === 步骤 1: 加载现有规则集配置 ===
 	var existingRuleSets *config.RuleSetsConfig
 	existingFiles := make(map[string]bool) // 已有的本地规则文件路径
-	existingURLs := make(map[string]bool)  // 已有的 URL（包括 GitHub Raw URL）
+	existingURLs := make(map[string]bool)  // 已有的 URL（GitHub URL 统一为 Raw URL 形式）
 
 	// 使用 classifiedRulesFile 加载现有配置（如果指定且文件存在）
 	if classifiedRulesFile != "" {
@@ -84,9 +118,9 @@ func HandleAIClassifyRules(configFile, classifiedRulesFile, aiGeneratedClassifie
 					for _, file := range ruleset.Files {
 						existingFiles[file] = true
 					}
-					// URL（包括 GitHub Raw URL）
+					// URL（GitHub 的 blob/raw/api 写法统一后比较）
 					for _, url := range ruleset.URLs {
-						existingURLs[url] = true
+						existingURLs[utils.CanonicalGitHubURL(url)] = true
 					}
 				}
 				log.Info().Msgf("已有规则数量: %d 个 URL，%d 个本地文件", len(existingURLs), len(existingFiles))
@@ -106,19 +140,33 @@ func HandleAIClassifyRules(configFile, classifiedRulesFile, aiGeneratedClassifie
 	// 使用配置的下载路径
 	downloadPath := cfg.RuleSources.GitHub.DownloadPath
 	if err := os.MkdirAll(downloadPath, 0755); err != nil {
-		log.Fatal().Msgf("创建下载目录失败: %v", err)
+		return nil, fmt.Errorf("创建下载目录失败: %w", err)
 	}
 
-	ghClient, err := github.NewClient(
-		cfg.RuleSources.GitHub.Token,
-		proxyPool,
-		downloadPath,
-		cfg.RuleSources.GitHub.OrganizeByRepo,
-		cfg.RuleSources.GitHub.DownloadThreads,
-		cfg.RuleSources.GitHub.OverwriteRuleFile,
-	)
-	if err != nil {
-		log.Fatal().Msgf("创建 GitHub 客户端失败: %v", err)
+	ghClient := opts.GitHub
+	if ghClient == nil {
+		client, err := github.NewClient(
+			cfg.RuleSources.GitHub.Token,
+			proxyPool,
+			downloadPath,
+			cfg.RuleSources.GitHub.OrganizeByRepo,
+			cfg.RuleSources.GitHub.DownloadThreads,
+			cfg.RuleSources.GitHub.OverwriteRuleFile,
+			cfg.RuleSources.APITimeout,
+			cfg.RuleSources.DownloadTimeout,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("创建 GitHub 客户端失败: %w", err)
+		}
+		ignorePatterns, err := loadIgnorePatterns(cfg.RuleSources.GitHub.IgnoreFile)
+		if err != nil {
+			return nil, err
+		}
+		client.SetIgnorePatterns(ignorePatterns)
+		client.SetForceRefresh(opts.ForceRefresh)
+		client.SetMaxConcurrentRepos(cfg.RuleSources.GitHub.MaxConcurrentRepos)
+		client.SetRateLimitMaxWait(time.Duration(cfg.RuleSources.GitHub.RateLimitMaxWaitSeconds) * time.Second)
+		ghClient = client
 	}
 
 	// 转换仓库配置
@@ -135,17 +183,22 @@ func HandleAIClassifyRules(configFile, classifiedRulesFile, aiGeneratedClassifie
 		repos[i] = github.RepoConfig{
 			Owner:    repo.Owner,
 			Repo:     repo.Repo,
-			Branch:   repo.Branch,
-			Path:     repo.Path,
+			Branches: repo.BranchList(),
+			Paths:    repo.PathList(),
 			Filters:  filters,
 			Excludes: repo.Excludes, // 使用 glob 模式排除文件
 		}
 	}
 
 	// 获取规则文件
+	downloadStart := time.Now()
 	results, err := ghClient.FetchMultipleRepos(ctx, repos)
 	if err != nil {
-		log.Fatal().Msgf("获取 GitHub 规则集失败: %v", err)
+		return nil, fmt.Errorf("获取 GitHub 规则集失败: %w", err)
+	}
+	report.Phases = append(report.Phases, PhaseTiming{Name: "下载 GitHub 规则文件", Duration: time.Since(downloadStart)})
+	if reporter, ok := ghClient.(github.DownloadReporter); ok {
+		report.Downloads = reporter.DownloadCounts()
 	}
 
 	// 收集下载的规则文件
@@ -153,6 +206,8 @@ func HandleAIClassifyRules(configFile, classifiedRulesFile, aiGeneratedClassifie
 	var githubRuleFileMap = make(map[string]*github.RuleFile)
 	totalDownloaded := 0
 	skippedCount := 0
+	skippedBySourceCount := 0
+	localPaths := make(map[string]string) // GitHub URL（统一为 Raw URL 形式）-> 下载的本地文件（包括已分类的文件）
 
 	for repoKey, ruleFiles := range results {
 		if len(ruleFiles) > 0 {
@@ -168,13 +223,21 @@ func HandleAIClassifyRules(configFile, classifiedRulesFile, aiGeneratedClassifie
 			// 构建 GitHub Raw URL
 			rawURL := fmt.Sprintf("https://raw.githubusercontent.com/%s/%s/%s/%s",
 				ruleFiles[i].Owner, ruleFiles[i].Repo, ruleFiles[i].Branch, ruleFiles[i].Path)
+			localPaths[utils.CanonicalGitHubURL(rawURL)] = ruleFiles[i].URL
 
 			// 检查是否已在现有配置中
-			if existingURLs[rawURL] {
+			if existingURLs[utils.CanonicalGitHubURL(rawURL)] && !opts.ForceRefresh {
 				skippedCount++
 				continue
 			}
 
+			// 检查是否匹配 --skip-sources
+			if pattern, ok := matchSkipSources(skipSources, ruleFiles[i].URL, rawURL); ok {
+				log.Debug().Msgf("跳过来源: %s (匹配模式: %s)", rawURL, pattern)
+				skippedBySourceCount++
+				continue
+			}
+
 			downloadedRuleFiles = append(downloadedRuleFiles, ruleFiles[i].URL)
 			githubRuleFileMap[ruleFiles[i].URL] = &ruleFiles[i]
 			totalDownloaded++
@@ -184,6 +247,12 @@ func HandleAIClassifyRules(configFile, classifiedRulesFile, aiGeneratedClassifie
 	if skippedCount > 0 {
 		log.Info().Msgf("跳过已分类的规则: %d 个", skippedCount)
 	}
+	if skippedBySourceCount > 0 {
+		log.Info().Msgf("跳过匹配 --skip-sources 的规则: %d 个", skippedBySourceCount)
+	}
+	report.SkippedExisting = skippedCount
+	report.SkippedBySource = skippedBySourceCount
+	report.NewRuleFiles = totalDownloaded
 
 	if totalDownloaded == 0 {
 		log.Info().Msg("所有规则都已在配置中，无需处理新文件")
@@ -191,7 +260,7 @@ func HandleAIClassifyRules(configFile, classifiedRulesFile, aiGeneratedClassifie
 			log.Info().Msgf("当前配置: %d 个规则集",
 				len(existingRuleSets.ClassifiedRules))
 		}
-		return
+		return report, nil
 	}
 
 	log.Info().Msgf("新规则文件总数: %d", totalDownloaded)
@@ -200,16 +269,16 @@ func HandleAIClassifyRules(configFile, classifiedRulesFile, aiGeneratedClassifie
 	// AI 日志保存到 logging.output_dir/ai 目录下
 	logDir := filepath.Join(cfg.Logging.OutputDir, "ai")
 	if err := os.MkdirAll(logDir, 0755); err != nil {
-		log.Fatal().Msgf("创建日志目录失败: %v", err)
+		return nil, fmt.Errorf("创建日志目录失败: %w", err)
 	}
 	log.Info().Msgf("AI 提示词将保存到: %s/ai_rule_classification_batch_*.log", logDir)
 
 	// === 步骤 4: 分析下载的规则文件 ===
 	log.Info().Msgf("开始分析 %d 个新下载的规则文件...", len(downloadedRuleFiles))
 
-	ruleFileInfos, err := rules.AnalyzeRuleFiles(downloadedRuleFiles, 5)
+	ruleFileInfos, err := rules.AnalyzeRuleFiles(downloadedRuleFiles, 5, cfg.AI.ExampleStrategy)
 	if err != nil {
-		log.Fatal().Msgf("分析规则文件失败: %v", err)
+		return nil, fmt.Errorf("分析规则文件失败: %w", err)
 	}
 
 	log.Info().Msgf("规则文件分析完成: %d 个文件", len(ruleFileInfos))
@@ -221,6 +290,28 @@ func HandleAIClassifyRules(configFile, classifiedRulesFile, aiGeneratedClassifie
 			rawURL := fmt.Sprintf("https://raw.githubusercontent.com/%s/%s/%s/%s",
 				ghRuleFile.Owner, ghRuleFile.Repo, ghRuleFile.Branch, ghRuleFile.Path)
 			ruleFileInfos[i].GitHubURL = rawURL
+			ruleFileInfos[i].RepoPath = fmt.Sprintf("%s/%s/%s", ghRuleFile.Owner, ghRuleFile.Repo, ghRuleFile.Path)
+		}
+	}
+
+	// 按路径和内容相似度直接归入规则集，只有无法归类的文件交给 AI
+	preCategories := make(map[string]*rules.RuleCategory)
+	if len(cfg.AIClassifyRules.PathClassifiers) > 0 {
+		var matched int
+		ruleFileInfos, matched = classifyByPath(ruleFileInfos, cfg.AIClassifyRules.PathClassifiers, existingRuleSets, preCategories)
+		report.PathMatched = matched
+	}
+	if threshold := cfg.AIClassifyRules.SimilarityThreshold; threshold > 0 && existingRuleSets != nil {
+		var similarityCategories map[string]*rules.RuleCategory
+		var matched int
+		ruleFileInfos, similarityCategories, matched = classifyBySimilarity(ruleFileInfos, existingRuleSets, localPaths, threshold)
+		report.SimilarityMatched = matched
+		for name, category := range similarityCategories {
+			if pathCategory, ok := preCategories[name]; ok {
+				category.URLs = append(pathCategory.URLs, category.URLs...)
+				category.Files = append(pathCategory.Files, category.Files...)
+			}
+			preCategories[name] = category
 		}
 	}
 
@@ -234,33 +325,41 @@ func HandleAIClassifyRules(configFile, classifiedRulesFile, aiGeneratedClassifie
 	log.Info().Msg(cfg.AI.Prompts.RuleClassification)
 	log.Info().Msg("========================================")
 
-	// 创建 AI 客户端
-	var httpClient *http.Client
-	if proxyPool.IsEnabled() {
-		httpClient, _ = proxyPool.GetHTTPClient(120)
-	}
-	if httpClient == nil {
-		timeout := cfg.AI.AIRequestTimeout
-		if timeout <= 0 {
-			timeout = 120 // 默认 120 秒
-		}
-		httpClient = &http.Client{Timeout: time.Duration(timeout) * time.Second}
-	}
-
-	aiClient, err := ai.NewClient(cfg.AI, httpClient)
+	// 创建 AI 客户端（配置了 ai.fallback 时同时创建备用客户端）
+	aiClient, fallbackClient, err := ai.NewClients(cfg.AI, func(aiCfg config.AIConfig) *http.Client {
+		return newAIHTTPClient(proxyPool, aiCfg.AIRequestTimeout)
+	})
 	if err != nil {
-		log.Fatal().Msgf("创建 AI 客户端失败: %v", err)
+		return nil, fmt.Errorf("创建 AI 客户端失败: %w", err)
+	}
+	if fallbackClient != nil {
+		log.Info().Msgf("AI 提供商: %s，备用提供商: %s", aiClient.GetProviderName(), fallbackClient.GetProviderName())
 	}
 
 	// 分批处理
-	batchSize := 20 // 每批 20 个文件
-	totalBatches := (len(ruleFileInfos) + batchSize - 1) / batchSize
+	batchSize := cfg.AI.RuleBatchSize
+	if batchSize <= 0 {
+		batchSize = defaultRuleBatchSize
+	}
+	batches := splitBatches(ruleFileInfos, batchSize)
+	totalBatches := len(batches)
 	concurrency := cfg.AI.BatchConcurrency
 	if concurrency <= 0 {
 		concurrency = 3 // 默认并发数
 	}
 
-	log.Info().Msgf("将分 %d 批处理，每批 %d 个文件，并发数 %d", totalBatches, batchSize, concurrency)
+	log.Info().Msgf("将分 %d 批处理，每批 %d 个文件（ai.rule_batch_size），并发数 %d", totalBatches, batchSize, concurrency)
+
+	// 分类任务使用专用温度参数
+	classifyOpts := ai.ChatOptions{Temperature: cfg.AI.ClassificationTemperature}
+	log.Info().Msgf("分类温度参数: %.2f", *cfg.AI.ClassificationTemperature)
+	if cfg.AI.LogRequests {
+		// 请求日志按请求追加写入（保留重试前失败的请求），先清理上次运行的文件
+		if err := removeRequestLogs(logDir); err != nil {
+			log.Warn().Msgf("清理上次的 AI 请求日志失败: %v", err)
+		}
+		log.Info().Msgf("AI 请求日志已启用: 每个批次的完整请求和原始响应保存到 %s（API 密钥已脱敏）", logDir)
+	}
 
 	// 定义批次任务结构
 	type batchTask struct {
@@ -279,9 +378,16 @@ func HandleAIClassifyRules(configFile, classifiedRulesFile, aiGeneratedClassifie
 	}
 
 	// 创建任务和结果通道
+	classifyStart := time.Now()
 	tasks := make(chan batchTask, totalBatches)
 	batchResults := make(chan batchResult, totalBatches)
 
+	// 熔断：连续多个批次失败时取消剩余批次（通常是 API 密钥错误或服务不可用）
+	batchCtx, abortBatches := context.WithCancel(ctx)
+	defer abortBatches()
+	breaker := newBatchBreaker(cfg.AI.MaxConsecutiveFailures)
+	var breakerErr error
+
 	// 启动并发 worker
 	var wg sync.WaitGroup
 	for i := 0; i < concurrency; i++ {
@@ -289,29 +395,58 @@ func HandleAIClassifyRules(configFile, classifiedRulesFile, aiGeneratedClassifie
 		go func(workerID int) {
 			defer wg.Done()
 			for task := range tasks {
+				// 已熔断或运行被取消：剩余批次直接计入未分类
+				if err := batchCtx.Err(); err != nil {
+					batchResults <- batchResult{idx: task.idx, err: err, unmatched: task.batch}
+					continue
+				}
+
 				log.Info().Msgf("[Worker %d] 处理批次 %d/%d: 规则文件 %d-%d",
 					workerID, task.idx+1, totalBatches, task.start+1, task.end)
 
-				// 为每批创建独立的超时上下文
-				classifyCtx, cancel := context.WithTimeout(context.Background(), 3*time.Minute)
-
-				// AI 分类
-				batchRes, err := rules.ClassifyRulesWithAI(
-					classifyCtx, task.batch, aiClient, nil,
-					cfg.AI.Prompts.RuleClassification, task.promptFile)
-				cancel()
+				// AI 分类（每次请求使用独立的超时上下文），响应无法解析时拆分批次重试
+				classify := func(client ai.Client, batch []rules.RuleFileInfo, promptFile string) (*rules.RuleClassificationResult, []rules.RuleFileInfo, error) {
+					return classifyWithSplit(batch, promptFile, 0, func(batch []rules.RuleFileInfo, promptFile string) (*rules.RuleClassificationResult, error) {
+						classifyCtx, cancel := context.WithTimeout(batchCtx, classifyTimeout(cfg.AI.AIRequestTimeout))
+						defer cancel()
+						chatOpts := classifyOpts
+						if cfg.AI.LogRequests {
+							chatOpts.RequestLogFile = strings.TrimSuffix(promptFile, ".log") + "_request.log"
+						}
+						return rules.ClassifyRulesWithAI(
+							classifyCtx, batch, client, nil,
+							cfg.AI.Prompts.RuleClassification, chatOpts, cfg.AI.MaxTotalExamples, promptFile)
+					})
+				}
+				provider := aiClient.GetProviderName()
+				batchRes, failed, err := classify(aiClient, task.batch, task.promptFile)
+
+				// 主提供商失败时使用备用提供商重试失败的部分一次（熔断或运行取消时不再重试）
+				if err != nil && fallbackClient != nil && batchCtx.Err() == nil {
+					log.Warn().Msgf("[Worker %d] 批次 %d/%d 中 %d 个规则文件在 %s 上失败: %v，改用备用提供商 %s 重试",
+						workerID, task.idx+1, totalBatches, len(failed), provider, err, fallbackClient.GetProviderName())
+					provider = fallbackClient.GetProviderName()
+					var retryRes *rules.RuleClassificationResult
+					retryRes, failed, err = classify(fallbackClient, failed, strings.TrimSuffix(task.promptFile, ".log")+"_fallback.log")
+					if batchRes == nil {
+						batchRes = retryRes
+					} else {
+						mergeClassificationResult(batchRes, retryRes)
+					}
+				}
 
 				if err != nil {
-					log.Info().Msgf("[Worker %d] 批次 %d/%d 分类失败: %v",
-						workerID, task.idx+1, totalBatches, err)
+					log.Info().Msgf("[Worker %d] 批次 %d/%d 中 %d/%d 个规则文件分类失败（提供商: %s）: %v",
+						workerID, task.idx+1, totalBatches, len(failed), len(task.batch), provider, err)
 					batchResults <- batchResult{
 						idx:       task.idx,
+						result:    batchRes,
 						err:       err,
-						unmatched: task.batch,
+						unmatched: failed,
 					}
 				} else {
-					log.Info().Msgf("[Worker %d] 批次 %d/%d 完成: 生成 %d 个分类，%d 个未分类",
-						workerID, task.idx+1, totalBatches,
+					log.Info().Msgf("[Worker %d] 批次 %d/%d 完成（提供商: %s）: 生成 %d 个分类，%d 个未分类",
+						workerID, task.idx+1, totalBatches, provider,
 						len(batchRes.Categories), len(batchRes.Unmatched))
 					batchResults <- batchResult{
 						idx:    task.idx,
@@ -323,14 +458,9 @@ func HandleAIClassifyRules(configFile, classifiedRulesFile, aiGeneratedClassifie
 	}
 
 	// 发送所有任务
-	for batchIdx := 0; batchIdx < totalBatches; batchIdx++ {
+	for batchIdx, batch := range batches {
 		start := batchIdx * batchSize
-		end := start + batchSize
-		if end > len(ruleFileInfos) {
-			end = len(ruleFileInfos)
-		}
-
-		batch := ruleFileInfos[start:end]
+		end := start + len(batch)
 		promptFile := filepath.Join(logDir, fmt.Sprintf("ai_rule_classification_batch_%d.log", batchIdx+1))
 
 		tasks <- batchTask{
@@ -351,18 +481,30 @@ func HandleAIClassifyRules(configFile, classifiedRulesFile, aiGeneratedClassifie
 
 	// 收集所有结果
 	allCategories := make(map[string]*rules.RuleCategory)
+	for name, category := range preCategories {
+		allCategories[name] = category
+	}
 	var allUnmatched []rules.RuleFileInfo
 	completedBatches := 0
 
+	report.TotalBatches = totalBatches
 	for result := range batchResults {
 		completedBatches++
+		if breaker.record(result.idx, result.err) {
+			breakerErr = fmt.Errorf("AI 提供商连续 %d 个批次失败，已中止剩余批次（ai.max_consecutive_failures），最后一次错误: %w", breaker.consecutive, breaker.lastErr)
+			log.Error().Msgf("%v", breakerErr)
+			abortBatches()
+		}
 		if result.err != nil {
-			// 失败的批次加入未分类列表
+			// 失败的部分加入未分类列表
 			allUnmatched = append(allUnmatched, result.unmatched...)
 		} else {
-			// 合并分类结果
+			report.SucceededBatches++
+		}
+		if result.result != nil {
+			// 合并分类结果（部分失败的批次保留已成功部分的结果）
 			for name, category := range result.result.Categories {
-				nameLower := strings.ToLower(name)
+				nameLower := config.NormalizeRulesetName(name)
 				if existing, ok := allCategories[nameLower]; ok {
 					// 合并到已有分类
 					existing.URLs = append(existing.URLs, category.URLs...)
@@ -380,7 +522,15 @@ func HandleAIClassifyRules(configFile, classifiedRulesFile, aiGeneratedClassifie
 		log.Info().Msgf("进度: %d/%d 批次已完成", completedBatches, totalBatches)
 	}
 
+	report.FailedBatches = breaker.failed
 	log.Info().Msgf("所有批次处理完成")
+	report.Phases = append(report.Phases, PhaseTiming{Name: "AI 分类", Duration: time.Since(classifyStart)})
+	// 运行超时、被取消或熔断：已完成批次的分类结果照常保存，未完成的批次计入未分类
+	if breakerErr != nil {
+		log.Warn().Msgf("AI 分类已熔断，成功分类 %d/%d 个批次（失败 %d 个），保存已完成批次的结果", report.SucceededBatches, totalBatches, report.FailedBatches)
+	} else if ctx.Err() != nil {
+		log.Warn().Msgf("运行已取消（%v），成功分类 %d/%d 个批次，保存已完成批次的结果", ctx.Err(), report.SucceededBatches, totalBatches)
+	}
 	log.Info().Msgf("  - 总分类数: %d", len(allCategories))
 	log.Info().Msgf("  - 未分类数: %d", len(allUnmatched))
 
@@ -427,7 +577,7 @@ func HandleAIClassifyRules(configFile, classifiedRulesFile, aiGeneratedClassifie
 	}
 
 	for name, category := range allCategories {
-		nameLower := strings.ToLower(name)
+		nameLower := config.NormalizeRulesetName(name)
 		finalResult.Categories[nameLower] = *category
 	}
 
@@ -436,7 +586,7 @@ func HandleAIClassifyRules(configFile, classifiedRulesFile, aiGeneratedClassifie
 	classifiedFiles := make(map[string]bool)
 	for _, category := range finalResult.Categories {
 		for _, url := range category.URLs {
-			classifiedURLs[url] = true
+			classifiedURLs[utils.CanonicalGitHubURL(url)] = true
 		}
 		for _, file := range category.Files {
 			classifiedFiles[file] = true
@@ -450,7 +600,7 @@ func HandleAIClassifyRules(configFile, classifiedRulesFile, aiGeneratedClassifie
 		isClassified := false
 
 		// 检查 GitHubURL（如果存在）
-		if file.GitHubURL != "" && classifiedURLs[file.GitHubURL] {
+		if file.GitHubURL != "" && classifiedURLs[utils.CanonicalGitHubURL(file.GitHubURL)] {
 			isClassified = true
 		}
 
@@ -493,7 +643,7 @@ func HandleAIClassifyRules(configFile, classifiedRulesFile, aiGeneratedClassifie
 	// 导出到 AI 生成的输出文件
 	log.Info().Msgf("导出新规则集分类到: %s", aiGeneratedClassifiedRules)
 	if err := rules.ExportToClassifiedRulesYAML(finalResult, aiGeneratedClassifiedRules); err != nil {
-		log.Fatal().Msgf("导出规则配置失败: %v", err)
+		return nil, fmt.Errorf("导出规则配置失败: %w", err)
 	}
 
 	// === 新增功能：合并到 classified_rules_file ===
@@ -512,68 +662,28 @@ func HandleAIClassifyRules(configFile, classifiedRulesFile, aiGeneratedClassifie
 			}
 		}
 
+		// 重新分类（--force-refresh）到其他规则集的来源先从原规则集中移除，避免同一来源同时进入两个规则集
+		if moved, dropped := removeReclassifiedSources(targetRuleSets, finalResult.Categories); moved > 0 {
+			log.Info().Msgf("重新分类: 从原规则集中移除 %d 个来源", moved)
+			for _, name := range dropped {
+				log.Warn().Msgf("规则集 '%s' 的来源均已重新分类到其他规则集，已从 %s 中移除", name, classifiedRulesFile)
+			}
+		}
+
 		// 合并新分类到目标配置
 		mergedCount := 0
 		updatedCount := 0
 		for name, category := range finalResult.Categories {
-			nameLower := strings.ToLower(name)
+			nameLower := config.NormalizeRulesetName(name)
 
 			if existingConfig, exists := targetRuleSets.ClassifiedRules[nameLower]; exists {
-				// 已存在的分类，合并 URLs、Files 和 Rules
-				// 使用 map 去重
-				urlSet := make(map[string]bool)
-				for _, url := range existingConfig.URLs {
-					urlSet[url] = true
-				}
-				for _, url := range category.URLs {
-					urlSet[url] = true
-				}
-
-				fileSet := make(map[string]bool)
-				for _, file := range existingConfig.Files {
-					fileSet[file] = true
-				}
-				for _, file := range category.Files {
-					fileSet[file] = true
-				}
-
-				ruleSet := make(map[string]bool)
-				for _, rule := range existingConfig.Rules {
-					ruleSet[rule] = true
-				}
-				for _, rule := range category.Rules {
-					ruleSet[rule] = true
-				}
-
-				// 转换为切片
-				mergedURLs := make([]string, 0, len(urlSet))
-				for url := range urlSet {
-					mergedURLs = append(mergedURLs, url)
-				}
-				mergedFiles := make([]string, 0, len(fileSet))
-				for file := range fileSet {
-					mergedFiles = append(mergedFiles, file)
-				}
-				mergedRules := make([]string, 0, len(ruleSet))
-				for rule := range ruleSet {
-					mergedRules = append(mergedRules, rule)
-				}
-
-				// 更新配置（保留原有的 description 和其他字段）
-				description := existingConfig.Description
-				if description == "" && category.Description != "" {
-					description = category.Description
-				}
-
-				targetRuleSets.ClassifiedRules[nameLower] = config.RulesetConfig{
-					Description:    description,
-					URLs:           mergedURLs,
-					Files:          mergedFiles,
-					Rules:          mergedRules,
-					ExcludeSources: existingConfig.ExcludeSources,
-					Filters:        existingConfig.Filters,
-					Excludes:       existingConfig.Excludes,
-				}
+				// 已存在的分类，合并 URLs、Files 和 Rules（去重，保留原有的 description 和其他字段）
+				targetRuleSets.ClassifiedRules[nameLower] = config.MergeRulesetConfig(existingConfig, config.RulesetConfig{
+					Description: category.Description,
+					URLs:        category.URLs,
+					Files:       category.Files,
+					Rules:       category.Rules,
+				})
 				updatedCount++
 			} else {
 				// 新分类，直接添加
@@ -605,6 +715,21 @@ func HandleAIClassifyRules(configFile, classifiedRulesFile, aiGeneratedClassifie
 		totalRules += len(category.URLs) + len(category.Files) + len(category.Rules)
 	}
 
+	report.Categories = totalCategories
+	report.ClassifiedSources = totalRules
+	report.TokenUsage = aiClient.GetUsage()
+	if fallbackClient != nil {
+		report.TokenUsage.Add(fallbackClient.GetUsage())
+	}
+	for _, file := range finalResult.Unmatched {
+		source := file.GitHubURL
+		if source == "" {
+			source = file.FilePath
+		}
+		report.Unmatched = append(report.Unmatched, source)
+	}
+	sort.Strings(report.Unmatched)
+
 	log.Info().Msg("规则集分类完成!")
 	log.Info().Msgf("  - 规则集文件: %s", aiGeneratedClassifiedRules)
 	log.Info().Msgf("  - 新增分类: %d 个", totalCategories)
@@ -613,8 +738,8 @@ func HandleAIClassifyRules(configFile, classifiedRulesFile, aiGeneratedClassifie
 	log.Info().Msgf("  - AI提示词文件: %s/ai_rule_classification_batch_*.log", logDir)
 
 	// 导出未分类列表
+	unmatchedPath := strings.TrimSuffix(aiGeneratedClassifiedRules, filepath.Ext(aiGeneratedClassifiedRules)) + "_unmatched.txt"
 	if len(finalResult.Unmatched) > 0 {
-		unmatchedPath := strings.TrimSuffix(aiGeneratedClassifiedRules, filepath.Ext(aiGeneratedClassifiedRules)) + "_unmatched.txt"
 		f, err := os.Create(unmatchedPath)
 		if err == nil {
 			for _, rule := range finalResult.Unmatched {
@@ -625,6 +750,18 @@ func HandleAIClassifyRules(configFile, classifiedRulesFile, aiGeneratedClassifie
 		}
 	}
 
+	if breakerErr != nil {
+		return report, fmt.Errorf("AI 分类未全部完成（成功 %d/%d 个批次）: %w", report.SucceededBatches, totalBatches, breakerErr)
+	}
+	if ctx.Err() != nil {
+		return report, fmt.Errorf("AI 分类未全部完成（成功 %d/%d 个批次）: %w", report.SucceededBatches, totalBatches, ctx.Err())
+	}
+
+	// fail_on_unmatched: 仍有未分类规则时返回错误
+	if cfg.AI.FailOnUnmatched && len(finalResult.Unmatched) > 0 {
+		return report, fmt.Errorf("仍有 %d 个规则文件未分类（ai.fail_on_unmatched 已启用），详见: %s", len(finalResult.Unmatched), unmatchedPath)
+	}
+
 	// 提示用户下一步操作
 	log.Info().Msgf("\n下一步操作:")
 	if existingRuleSets != nil {
@@ -636,4 +773,270 @@ func HandleAIClassifyRules(configFile, classifiedRulesFile, aiGeneratedClassifie
 		log.Info().Msgf("2. 配置已保存，可直接使用")
 		log.Info().Msgf("3. 再次运行命令继续处理剩余规则（如有）")
 	}
+
+	return report, nil
+}
+
+// newAIHTTPClient 创建 AI 请求使用的 HTTP 客户端：启用代理时通过代理池，否则直接连接
+// timeoutSeconds 为 0 时使用默认的 120 秒
+func newAIHTTPClient(proxyPool *proxy.Pool, timeoutSeconds int) *http.Client {
+	timeoutSeconds = aiRequestTimeout(timeoutSeconds)
+	var httpClient *http.Client
+	if proxyPool.IsEnabled() {
+		httpClient, _ = proxyPool.GetHTTPClient(timeoutSeconds)
+	}
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: time.Duration(timeoutSeconds) * time.Second}
+	}
+	return httpClient
+}
+
+// defaultAIRequestTimeout AI 请求的默认超时时间（秒），可通过 ai.ai_request_timeout 修改
+const defaultAIRequestTimeout = 120
+
+// minClassifyTimeout 单次 AI 分类（含响应解析）的最短超时时间，ai_request_timeout 更长时以其为准
+const minClassifyTimeout = 3 * time.Minute
+
+// aiRequestTimeout 返回 AI 请求的超时时间（秒），未配置时使用默认值
+func aiRequestTimeout(timeoutSeconds int) int {
+	if timeoutSeconds <= 0 {
+		return defaultAIRequestTimeout
+	}
+	return timeoutSeconds
+}
+
+// classifyTimeout 单次 AI 分类的超时时间：不短于 minClassifyTimeout，也不短于 HTTP 请求本身的超时时间
+func classifyTimeout(timeoutSeconds int) time.Duration {
+	if d := time.Duration(aiRequestTimeout(timeoutSeconds)) * time.Second; d > minClassifyTimeout {
+		return d
+	}
+	return minClassifyTimeout
+}
+
+// matchSkipSources 检查来源是否匹配任意跳过模式（本地路径或 URL 任一匹配即可）
+// 返回匹配的模式
+func matchSkipSources(patterns []string, sources ...string) (string, bool) {
+	for _, pattern := range patterns {
+		for _, source := range sources {
+			if source == "" {
+				continue
+			}
+			matched, err := doublestar.Match(pattern, source)
+			if err != nil {
+				log.Warn().Msgf("跳过模式匹配失败: %v (pattern: %s)", err, pattern)
+				break
+			}
+			if matched {
+				return pattern, true
+			}
+		}
+	}
+	return "", false
+}
+
+// defaultRuleBatchSize 每批提交给 AI 的默认文件数量，可通过 ai.rule_batch_size 修改
+const defaultRuleBatchSize = 20
+
+// splitBatches 将规则文件按 batchSize 个一批拆分（最后一批可能不足 batchSize 个）
+func splitBatches(files []rules.RuleFileInfo, batchSize int) [][]rules.RuleFileInfo {
+	batches := make([][]rules.RuleFileInfo, 0, (len(files)+batchSize-1)/batchSize)
+	for start := 0; start < len(files); start += batchSize {
+		end := min(start+batchSize, len(files))
+		batches = append(batches, files[start:end])
+	}
+	return batches
+}
+
+// removeReclassifiedSources 从目标配置中移除本次被分类到其他规则集的 URL 和本地文件，返回移除的来源数量
+// 以及因此变为空（没有 URL、本地文件、手工规则和规则块）而被删除的规则集名称（按名称排序）
+func removeReclassifiedSources(target *config.RuleSetsConfig, categories map[string]rules.RuleCategory) (int, []string) {
+	urlOwner := make(map[string]string)  // 统一为 Raw URL 形式的 URL -> 新规则集
+	fileOwner := make(map[string]string) // 标准化的本地路径 -> 新规则集
+	for name, category := range categories {
+		nameLower := config.NormalizeRulesetName(name)
+		for _, url := range category.URLs {
+			urlOwner[utils.CanonicalGitHubURL(url)] = nameLower
+		}
+		for _, file := range category.Files {
+			fileOwner[utils.NormalizeLocalPath(file)] = nameLower
+		}
+	}
+	if len(urlOwner) == 0 && len(fileOwner) == 0 {
+		return 0, nil
+	}
+
+	moved := 0
+	var dropped []string
+	for name, ruleset := range target.ClassifiedRules {
+		keptURLs := make([]string, 0, len(ruleset.URLs))
+		for _, url := range ruleset.URLs {
+			if owner, ok := urlOwner[utils.CanonicalGitHubURL(url)]; ok && owner != name {
+				log.Info().Msgf("重新分类: %s 从规则集 '%s' 移至 '%s'", url, name, owner)
+				continue
+			}
+			keptURLs = append(keptURLs, url)
+		}
+		keptFiles := make([]string, 0, len(ruleset.Files))
+		for _, file := range ruleset.Files {
+			if owner, ok := fileOwner[utils.NormalizeLocalPath(file)]; ok && owner != name {
+				log.Info().Msgf("重新分类: %s 从规则集 '%s' 移至 '%s'", file, name, owner)
+				continue
+			}
+			keptFiles = append(keptFiles, file)
+		}
+
+		removed := len(ruleset.URLs) - len(keptURLs) + len(ruleset.Files) - len(keptFiles)
+		if removed == 0 {
+			continue
+		}
+		moved += removed
+		if len(keptURLs) == 0 && len(keptFiles) == 0 && len(ruleset.Rules) == 0 && len(ruleset.IncludeBlocks) == 0 {
+			delete(target.ClassifiedRules, name)
+			dropped = append(dropped, name)
+			continue
+		}
+		ruleset.URLs = keptURLs
+		ruleset.Files = keptFiles
+		target.ClassifiedRules[name] = ruleset
+	}
+	sort.Strings(dropped)
+	return moved, dropped
+}
+
+// batchBreaker AI 分类熔断器：按批次提交顺序（而非完成顺序）统计连续失败的批次数，
+// 因熔断或运行取消而中止的批次（context.Canceled）既不计入连续失败，也不计入失败总数
+type batchBreaker struct {
+	max         int           // 连续失败上限（<= 0 不熔断）
+	next        int           // 下一个按提交顺序计数的批次
+	pending     map[int]error // 已完成、但前面还有未完成批次的结果
+	consecutive int           // 当前连续失败的批次数
+	failed      int           // 失败的批次总数
+	lastErr     error         // 最近一次计数的失败
+	tripped     bool
+}
+
+func newBatchBreaker(max int) *batchBreaker {
+	return &batchBreaker{max: max, pending: make(map[int]error)}
+}
+
+// record 记录批次 idx 的结果（err 为 nil 表示成功），返回本次是否触发熔断（只触发一次）
+func (b *batchBreaker) record(idx int, err error) bool {
+	b.pending[idx] = err
+	trip := false
+	for {
+		err, ok := b.pending[b.next]
+		if !ok {
+			return trip
+		}
+		delete(b.pending, b.next)
+		b.next++
+		switch {
+		case err == nil:
+			b.consecutive = 0
+		case errors.Is(err, context.Canceled):
+		default:
+			b.consecutive++
+			b.failed++
+			b.lastErr = err
+			if b.max > 0 && b.consecutive >= b.max && !b.tripped {
+				b.tripped = true
+				trip = true
+			}
+		}
+	}
+}
+
+// classifyWithSplit 分类一个批次，响应无法解析（如被截断、YAML 格式错误）时将批次拆为两半分别重新分类，
+// 递归直到单个文件（n 个文件的批次最多拆分 bits.Len(n) 层，与批次大小无关地总能定位到有问题的文件），
+// 避免一个有问题的文件拖累整个批次。
+// 拆分后仍无法解析的部分计入未分类；请求失败等其他错误返回失败部分的规则文件和错误（由调用方决定是否改用备用提供商），
+// 拆分后另一半已成功的分类结果照常返回。
+// 拆分出的请求的提示词文件在原文件名后追加 _split1/_split2
+func classifyWithSplit(batch []rules.RuleFileInfo, promptFile string, depth int,
+	classify func(batch []rules.RuleFileInfo, promptFile string) (*rules.RuleClassificationResult, error)) (*rules.RuleClassificationResult, []rules.RuleFileInfo, error) {
+	result, err := classify(batch, promptFile)
+	if err == nil {
+		return result, nil, nil
+	}
+	if !errors.Is(err, rules.ErrParseResponse) {
+		return nil, batch, err
+	}
+	if len(batch) <= 1 {
+		if depth == 0 {
+			return nil, batch, err
+		}
+		log.Warn().Msgf("拆分后的批次（%d 个规则文件）响应仍无法解析，计入未分类: %v", len(batch), err)
+		return &rules.RuleClassificationResult{Categories: make(map[string]rules.RuleCategory), Unmatched: batch}, nil, nil
+	}
+
+	mid := len(batch) / 2
+	log.Warn().Msgf("批次（%d 个规则文件）响应无法解析，拆分为 %d + %d 个文件重新分类: %v", len(batch), mid, len(batch)-mid, err)
+	merged := &rules.RuleClassificationResult{Categories: make(map[string]rules.RuleCategory)}
+	var failed []rules.RuleFileInfo
+	var firstErr error
+	base := strings.TrimSuffix(promptFile, ".log")
+	for i, half := range [][]rules.RuleFileInfo{batch[:mid], batch[mid:]} {
+		halfResult, halfFailed, err := classifyWithSplit(half, fmt.Sprintf("%s_split%d.log", base, i+1), depth+1, classify)
+		if err != nil {
+			failed = append(failed, halfFailed...)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+		mergeClassificationResult(merged, halfResult)
+	}
+	return merged, failed, firstErr
+}
+
+// mergeClassificationResult 将 result 的分类和未分类文件合并到 merged（result 为 nil 时不做处理）
+func mergeClassificationResult(merged, result *rules.RuleClassificationResult) {
+	if result == nil {
+		return
+	}
+	for name, category := range result.Categories {
+		if existing, ok := merged.Categories[name]; ok {
+			existing.URLs = append(existing.URLs, category.URLs...)
+			existing.Files = append(existing.Files, category.Files...)
+			existing.Rules = append(existing.Rules, category.Rules...)
+			category = existing
+		}
+		merged.Categories[name] = category
+	}
+	merged.Unmatched = append(merged.Unmatched, result.Unmatched...)
+}
+
+// removeRequestLogs 删除日志目录中上次运行的 AI 请求日志（ai_rule_classification_batch_*_request.log）
+func removeRequestLogs(logDir string) error {
+	paths, err := filepath.Glob(filepath.Join(logDir, "ai_rule_classification_batch_*_request.log"))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadIgnorePatterns 加载全局忽略文件中的排除模式
+// 未配置路径时尝试默认的 .refineryignore（不存在时跳过）；显式配置的文件必须存在
+func loadIgnorePatterns(path string) ([]string, error) {
+	optional := path == ""
+	if optional {
+		path = github.DefaultIgnoreFile
+	}
+	if _, err := os.Stat(path); err != nil {
+		if optional && os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("加载忽略文件失败: %w", err)
+	}
+
+	patterns, err := github.LoadIgnoreFile(path)
+	if err != nil {
+		return nil, err
+	}
+	log.Info().Msgf("已加载忽略文件 %s: %d 个排除模式（应用于所有仓库）", path, len(patterns))
+	return patterns, nil
 }
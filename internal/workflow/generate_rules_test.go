@@ -0,0 +1,266 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"rulerefinery/internal/config"
+	"rulerefinery/internal/rules"
+)
+
+func TestRemoveReclassifiedSources(t *testing.T) {
+	target := &config.RuleSetsConfig{ClassifiedRules: map[string]config.RulesetConfig{
+		"google": {
+			URLs:  []string{"https://github.com/Owner/Repo/blob/master/Google.list", "https://raw.githubusercontent.com/owner/repo/master/YouTube.list"},
+			Files: []string{"./rules/google.list"},
+		},
+		"media": {URLs: []string{"https://raw.githubusercontent.com/owner/repo/master/Netflix.list"}},
+		"manual": {
+			URLs:  []string{"https://raw.githubusercontent.com/owner/repo/master/Apple.list"},
+			Rules: []string{"DOMAIN,apple.com"},
+		},
+	}}
+	categories := map[string]rules.RuleCategory{
+		"YouTube": {URLs: []string{"https://raw.githubusercontent.com/owner/repo/master/YouTube.list"}},
+		"netflix": {URLs: []string{"https://raw.githubusercontent.com/owner/repo/master/Netflix.list"}},
+		"apple":   {URLs: []string{"https://raw.githubusercontent.com/owner/repo/master/Apple.list"}},
+		"google":  {URLs: []string{"https://raw.githubusercontent.com/owner/repo/master/Google.list"}, Files: []string{"rules/google.list"}},
+	}
+
+	moved, dropped := removeReclassifiedSources(target, categories)
+	if moved != 3 {
+		t.Errorf("moved = %d, want 3", moved)
+	}
+	if want := []string{"media"}; !reflect.DeepEqual(dropped, want) {
+		t.Errorf("dropped = %v, want %v", dropped, want)
+	}
+
+	google := target.ClassifiedRules["google"]
+	if want := []string{"https://github.com/Owner/Repo/blob/master/Google.list"}; !reflect.DeepEqual(google.URLs, want) {
+		t.Errorf("google URLs = %v, want %v", google.URLs, want)
+	}
+	if want := []string{"./rules/google.list"}; !reflect.DeepEqual(google.Files, want) {
+		t.Errorf("google Files = %v, want %v", google.Files, want)
+	}
+	manual, ok := target.ClassifiedRules["manual"]
+	if !ok {
+		t.Fatal("ruleset with manual rules should be kept")
+	}
+	if len(manual.URLs) != 0 {
+		t.Errorf("manual URLs = %v, want none", manual.URLs)
+	}
+}
+
+func TestSplitBatches(t *testing.T) {
+	tests := []struct {
+		files     int
+		batchSize int
+		want      []int // 每批的文件数量
+	}{
+		{files: 0, batchSize: 5, want: []int{}},
+		{files: 3, batchSize: 5, want: []int{3}},
+		{files: 5, batchSize: 5, want: []int{5}},
+		{files: 12, batchSize: 5, want: []int{5, 5, 2}},
+		{files: 20, batchSize: 5, want: []int{5, 5, 5, 5}},
+		{files: 41, batchSize: defaultRuleBatchSize, want: []int{20, 20, 1}},
+		{files: 3, batchSize: 1, want: []int{1, 1, 1}},
+	}
+	for _, tt := range tests {
+		files := make([]rules.RuleFileInfo, tt.files)
+		for i := range files {
+			files[i].FilePath = fmt.Sprintf("rules/%d.list", i)
+		}
+
+		batches := splitBatches(files, tt.batchSize)
+		sizes := make([]int, len(batches))
+		next := 0
+		for i, batch := range batches {
+			sizes[i] = len(batch)
+			for _, file := range batch {
+				if file.FilePath != files[next].FilePath {
+					t.Errorf("splitBatches(%d, %d): file %s out of order", tt.files, tt.batchSize, file.FilePath)
+				}
+				next++
+			}
+		}
+		if !reflect.DeepEqual(sizes, tt.want) {
+			t.Errorf("splitBatches(%d files, %d) batch sizes = %v, want %v", tt.files, tt.batchSize, sizes, tt.want)
+		}
+	}
+}
+
+func TestClassifyWithSplitIsolatesBadFile(t *testing.T) {
+	batch := make([]rules.RuleFileInfo, defaultRuleBatchSize)
+	for i := range batch {
+		batch[i].FilePath = fmt.Sprintf("rules/%d.list", i)
+	}
+	bad := batch[13].FilePath
+
+	calls := 0
+	classify := func(batch []rules.RuleFileInfo, promptFile string) (*rules.RuleClassificationResult, error) {
+		calls++
+		category := rules.RuleCategory{Name: "test"}
+		for _, file := range batch {
+			if file.FilePath == bad {
+				return nil, fmt.Errorf("%w: truncated", rules.ErrParseResponse)
+			}
+			category.Files = append(category.Files, file.FilePath)
+		}
+		return &rules.RuleClassificationResult{Categories: map[string]rules.RuleCategory{"test": category}}, nil
+	}
+
+	result, failed, err := classifyWithSplit(batch, "batch_1.log", 0, classify)
+	if err != nil || len(failed) != 0 {
+		t.Fatalf("classifyWithSplit() failed = %v, err = %v", failed, err)
+	}
+	if len(result.Unmatched) != 1 || result.Unmatched[0].FilePath != bad {
+		t.Errorf("Unmatched = %v, want only %s", result.Unmatched, bad)
+	}
+	if got := len(result.Categories["test"].Files); got != len(batch)-1 {
+		t.Errorf("classified %d files, want %d", got, len(batch)-1)
+	}
+	if calls > 2*len(batch) {
+		t.Errorf("classify called %d times for %d files", calls, len(batch))
+	}
+}
+
+func TestClassifyWithSplitKeepsSucceededHalf(t *testing.T) {
+	batch := make([]rules.RuleFileInfo, 4)
+	for i := range batch {
+		batch[i].FilePath = fmt.Sprintf("rules/%d.list", i)
+	}
+	errUnavailable := errors.New("service unavailable")
+
+	// 整个批次响应无法解析；拆分后前一半请求失败，后一半分类成功
+	classify := func(files []rules.RuleFileInfo, promptFile string) (*rules.RuleClassificationResult, error) {
+		switch {
+		case len(files) == len(batch):
+			return nil, fmt.Errorf("%w: truncated", rules.ErrParseResponse)
+		case files[0].FilePath == batch[0].FilePath:
+			return nil, errUnavailable
+		}
+		category := rules.RuleCategory{Name: "test"}
+		for _, file := range files {
+			category.Files = append(category.Files, file.FilePath)
+		}
+		return &rules.RuleClassificationResult{Categories: map[string]rules.RuleCategory{"test": category}}, nil
+	}
+
+	result, failed, err := classifyWithSplit(batch, "batch_1.log", 0, classify)
+	if !errors.Is(err, errUnavailable) {
+		t.Fatalf("err = %v, want %v", err, errUnavailable)
+	}
+	if !reflect.DeepEqual(failed, batch[:2]) {
+		t.Errorf("failed = %v, want %v", failed, batch[:2])
+	}
+	if result == nil {
+		t.Fatal("result = nil, want the succeeded half")
+	}
+	if want := []string{"rules/2.list", "rules/3.list"}; !reflect.DeepEqual(result.Categories["test"].Files, want) {
+		t.Errorf("classified files = %v, want %v", result.Categories["test"].Files, want)
+	}
+	if len(result.Unmatched) != 0 {
+		t.Errorf("Unmatched = %v, want none", result.Unmatched)
+	}
+}
+
+func TestBatchBreaker(t *testing.T) {
+	errFailed := errors.New("service unavailable")
+	type outcome struct {
+		idx int
+		err error
+	}
+	tests := []struct {
+		name     string
+		max      int
+		outcomes []outcome // 完成顺序
+		tripAt   int       // 触发熔断的 outcome 下标，-1 表示不熔断
+		failed   int
+	}{
+		{
+			// 提交顺序为 失败、成功、失败：按完成顺序会连续两次失败，按提交顺序不连续
+			name:     "submission order",
+			max:      2,
+			outcomes: []outcome{{0, errFailed}, {2, errFailed}, {1, nil}},
+			tripAt:   -1,
+			failed:   2,
+		},
+		{
+			name:     "waits for earlier batches",
+			max:      2,
+			outcomes: []outcome{{1, errFailed}, {2, nil}, {0, errFailed}},
+			tripAt:   2,
+			failed:   2,
+		},
+		{
+			name:     "canceled not counted",
+			max:      2,
+			outcomes: []outcome{{0, errFailed}, {1, context.Canceled}, {2, fmt.Errorf("request: %w", context.Canceled)}},
+			tripAt:   -1,
+			failed:   1,
+		},
+		{
+			name:     "canceled does not reset",
+			max:      2,
+			outcomes: []outcome{{0, errFailed}, {1, context.Canceled}, {2, errFailed}},
+			tripAt:   2,
+			failed:   2,
+		},
+		{
+			name:     "disabled",
+			max:      0,
+			outcomes: []outcome{{0, errFailed}, {1, errFailed}, {2, errFailed}},
+			tripAt:   -1,
+			failed:   3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			breaker := newBatchBreaker(tt.max)
+			tripAt := -1
+			for i, o := range tt.outcomes {
+				if breaker.record(o.idx, o.err) {
+					if tripAt >= 0 {
+						t.Fatalf("breaker tripped twice (outcomes %d and %d)", tripAt, i)
+					}
+					tripAt = i
+				}
+			}
+			if tripAt != tt.tripAt {
+				t.Errorf("tripped at outcome %d, want %d", tripAt, tt.tripAt)
+			}
+			if breaker.failed != tt.failed {
+				t.Errorf("failed = %d, want %d", breaker.failed, tt.failed)
+			}
+		})
+	}
+}
+
+func TestRemoveRequestLogs(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"ai_rule_classification_batch_1.log",
+		"ai_rule_classification_batch_1_request.log",
+		"ai_rule_classification_batch_2_split1_request.log",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("old"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := removeRequestLogs(dir); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "ai_rule_classification_batch_1.log" {
+		t.Errorf("remaining files = %v, want only the prompt log", entries)
+	}
+}
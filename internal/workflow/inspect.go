@@ -0,0 +1,64 @@
+package workflow
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"rulerefinery/internal/config"
+	"rulerefinery/internal/loader"
+	"rulerefinery/internal/proxy"
+	"rulerefinery/internal/rules"
+)
+
+// inspectExampleCount 诊断报告中首尾示例规则的数量
+const inspectExampleCount = 5
+
+// HandleInspect 诊断单个规则文件或 URL：URL 先下载到临时文件，再复用 AI 分类的文件分析和规则解析
+// cfg 可为 nil（此时不使用代理），否则使用其中的代理配置下载
+func HandleInspect(ctx context.Context, cfg *config.Config, source string) (*rules.Inspection, error) {
+	filePath := source
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		proxyPool, err := inspectProxyPool(cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		log.Info().Msgf("下载: %s", source)
+		content, err := loader.NewLoader(proxyPool, 1).Load(ctx, source)
+		if err != nil {
+			return nil, fmt.Errorf("下载失败: %w", err)
+		}
+
+		tmp, err := os.CreateTemp("", "rulerefinery-inspect-*")
+		if err != nil {
+			return nil, fmt.Errorf("创建临时文件失败: %w", err)
+		}
+		defer os.Remove(tmp.Name())
+		_, err = tmp.Write(content)
+		if closeErr := tmp.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return nil, fmt.Errorf("保存临时文件失败: %w", err)
+		}
+		filePath = tmp.Name()
+	}
+
+	return rules.InspectRuleFile(filePath, source, inspectExampleCount)
+}
+
+// inspectProxyPool 创建下载使用的代理池，没有配置时直接连接
+func inspectProxyPool(cfg *config.Config) (*proxy.Pool, error) {
+	if cfg == nil {
+		return proxy.NewPool(nil, false)
+	}
+	proxyPool, err := proxy.NewPoolFromConfig(cfg.Proxy, cfg.HTTP)
+	if err != nil {
+		return nil, fmt.Errorf("创建代理池失败: %w", err)
+	}
+	return proxyPool, nil
+}
@@ -0,0 +1,173 @@
+package workflow
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"rulerefinery/internal/config"
+	"rulerefinery/internal/rules"
+	"rulerefinery/internal/utils"
+)
+
+// licenseUnknown 仓库没有配置 license 时在许可证文件中显示的内容
+const licenseUnknown = "未声明"
+
+// sourceRepo 为规则集提供规则的 GitHub 仓库
+type sourceRepo struct {
+	Owner   string
+	Repo    string
+	License string
+}
+
+// repositoryLicenses 返回 rule-sources.github.repositories 中配置了许可证的仓库（键为小写的 owner/repo），没有仓库配置 license 时返回 nil
+func repositoryLicenses(cfg *config.Config) map[string]sourceRepo {
+	var licenses map[string]sourceRepo
+	for _, repo := range cfg.RuleSources.GitHub.Repositories {
+		license := strings.TrimSpace(repo.License)
+		if license == "" {
+			continue
+		}
+		if licenses == nil {
+			licenses = make(map[string]sourceRepo)
+		}
+		licenses[strings.ToLower(repo.Owner+"/"+repo.Repo)] = sourceRepo{Owner: repo.Owner, Repo: repo.Repo, License: license}
+	}
+	return licenses
+}
+
+// addSourceRepo 将仓库加入 repos（键为小写的 owner/repo），配置了许可证的仓库使用配置中的名称和许可证
+func addSourceRepo(repos map[string]sourceRepo, licenses map[string]sourceRepo, owner, repo string) {
+	key := strings.ToLower(owner + "/" + repo)
+	if known, ok := licenses[key]; ok {
+		repos[key] = known
+	} else {
+		repos[key] = sourceRepo{Owner: owner, Repo: repo, License: licenseUnknown}
+	}
+}
+
+// downloadedFileRepo 返回 rule-sources.github 下载目录中的本地文件所属的仓库
+// organize_by_repo 时路径为 {download_path}/{owner}/{repo}/{branch}/...，
+// 否则文件名为 {repo}_{branch}_{name}，按配置的仓库和分支匹配
+func downloadedFileRepo(github config.GitHubConfig, filePath string) (owner, repo string, ok bool) {
+	root, err := filepath.Abs(github.DownloadPath)
+	if err != nil {
+		return "", "", false
+	}
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return "", "", false
+	}
+	rel, err := filepath.Rel(root, absPath)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return "", "", false
+	}
+
+	if github.OrganizeByRepo {
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		if len(parts) < 4 {
+			return "", "", false
+		}
+		return parts[0], parts[1], true
+	}
+	for _, configured := range github.Repositories {
+		for _, branch := range configured.BranchList() {
+			prefix := configured.Repo + "_" + strings.ReplaceAll(branch, "/", "_") + "_"
+			if strings.HasPrefix(rel, prefix) {
+				return configured.Owner, configured.Repo, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// rulesetSourceRepos 按规则集导出结果中的规则来自的文件返回提供规则的 GitHub 仓库和其他来源（均已排序去重）
+// files 为 rules.Optimizer.ContributingSources 返回的文件，fileSources 为文件对应的 URL 或配置中的本地路径；
+// GitHub URL 和 GitHub 下载目录中的文件归入对应仓库，其他 URL 和本地文件列为其他来源，手工规则不列出
+func rulesetSourceRepos(cfg *config.Config, licenses map[string]sourceRepo, fileSources map[string]string, files []string) ([]sourceRepo, []string) {
+	repos := make(map[string]sourceRepo)
+	others := make(map[string]bool)
+	for _, file := range files {
+		source, ok := fileSources[file]
+		if !ok {
+			continue
+		}
+		if owner, repo, ok := utils.GitHubRepoFromURL(source); ok {
+			addSourceRepo(repos, licenses, owner, repo)
+		} else if owner, repo, ok := downloadedFileRepo(cfg.RuleSources.GitHub, source); ok {
+			addSourceRepo(repos, licenses, owner, repo)
+		} else {
+			others[source] = true
+		}
+	}
+
+	sortedRepos := make([]sourceRepo, 0, len(repos))
+	for _, repo := range repos {
+		sortedRepos = append(sortedRepos, repo)
+	}
+	sort.Slice(sortedRepos, func(i, j int) bool {
+		return strings.ToLower(sortedRepos[i].Owner+"/"+sortedRepos[i].Repo) < strings.ToLower(sortedRepos[j].Owner+"/"+sortedRepos[j].Repo)
+	})
+	sortedOthers := make([]string, 0, len(others))
+	for source := range others {
+		sortedOthers = append(sortedOthers, source)
+	}
+	sort.Strings(sortedOthers)
+	return sortedRepos, sortedOthers
+}
+
+// writeLicenseFiles 为每个导出的规则集写入来源许可证文件（by_ruleset: {name}/LICENSES.txt，by_behavior: licenses/{name}.txt），
+// 列出导出结果中的规则实际来自的仓库及其许可证（sources 为各规则集的规则来自的文件，见 rulesetSourceRepos）。
+// 只在至少一个仓库配置了 license 时生成；没有配置 license 或规则集没有上游来源时删除上次的许可证文件。
+// 文件内容不包含生成时间，便于 --check 比较
+func writeLicenseFiles(cfg *config.Config, fileSources map[string]string, sources map[string][]string, outputDir string, names []string) error {
+	licenses := repositoryLicenses(cfg)
+
+	written := 0
+	for _, name := range names {
+		path := filepath.Join(outputDir, filepath.FromSlash(rules.LicensesRelPath(cfg.GenerateRules.Layout, name)))
+		var repos []sourceRepo
+		var others []string
+		if licenses != nil {
+			repos, others = rulesetSourceRepos(cfg, licenses, fileSources, sources[name])
+		}
+		if len(repos) == 0 && len(others) == 0 {
+			if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("删除过期许可证文件失败: %w", err)
+			}
+			continue
+		}
+
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "# 规则集 %s 的上游来源\n", name)
+		sb.WriteString("# 以下仓库为该规则集提供了规则，再分发时请遵守其许可证并注明出处\n")
+		for _, repo := range repos {
+			fmt.Fprintf(&sb, "\n%s/%s\n", repo.Owner, repo.Repo)
+			fmt.Fprintf(&sb, "  许可证: %s\n", repo.License)
+			fmt.Fprintf(&sb, "  地址: https://github.com/%s/%s\n", repo.Owner, repo.Repo)
+		}
+		if len(others) > 0 {
+			fmt.Fprintf(&sb, "\n其他来源（许可证%s）:\n", licenseUnknown)
+			for _, source := range others {
+				fmt.Fprintf(&sb, "  %s\n", source)
+			}
+		}
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("创建许可证文件目录失败: %w", err)
+		}
+		if err := os.WriteFile(path, []byte(sb.String()), 0644); err != nil {
+			return fmt.Errorf("写入许可证文件失败: %w", err)
+		}
+		written++
+	}
+	if written > 0 {
+		log.Info().Msgf("已生成 %d 个规则集的来源许可证文件", written)
+	}
+	return nil
+}
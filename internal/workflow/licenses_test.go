@@ -0,0 +1,75 @@
+package workflow
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"rulerefinery/internal/config"
+)
+
+func TestRulesetSourceRepos(t *testing.T) {
+	downloadDir := t.TempDir()
+	cfg := &config.Config{}
+	cfg.RuleSources.GitHub = config.GitHubConfig{
+		DownloadPath: downloadDir,
+		Repositories: []config.RepositoryConfig{
+			{Owner: "blackmatrix7", Repo: "ios_rule_script", Branch: "master", License: "GPL-2.0"},
+			{Owner: "Loyalsoldier", Repo: "clash-rules", Branches: []string{"release/v2"}},
+		},
+	}
+	licenses := repositoryLicenses(cfg)
+	downloaded := filepath.Join(downloadDir, "clash-rules_release_v2_proxy.txt")
+	fileSources := map[string]string{
+		"tmp/google.list": "https://raw.githubusercontent.com/blackmatrix7/ios_rule_script/master/rule/Clash/Google/Google.list",
+		"tmp/other.list":  "https://example.com/other.list",
+		"/abs/proxy.txt":  downloaded,
+		"/abs/local.list": "rules/local.list",
+	}
+	files := []string{"tmp/google.list", "tmp/other.list", "/abs/proxy.txt", "/abs/local.list", "tmp/test/manual_rules.list"}
+
+	repos, others := rulesetSourceRepos(cfg, licenses, fileSources, files)
+	wantRepos := []sourceRepo{
+		{Owner: "blackmatrix7", Repo: "ios_rule_script", License: "GPL-2.0"},
+		{Owner: "Loyalsoldier", Repo: "clash-rules", License: licenseUnknown},
+	}
+	if !reflect.DeepEqual(repos, wantRepos) {
+		t.Errorf("rulesetSourceRepos() repos = %v, want %v", repos, wantRepos)
+	}
+	wantOthers := []string{"https://example.com/other.list", "rules/local.list"}
+	if !reflect.DeepEqual(others, wantOthers) {
+		t.Errorf("rulesetSourceRepos() others = %v, want %v", others, wantOthers)
+	}
+}
+
+func TestDownloadedFileRepoOrganizeByRepo(t *testing.T) {
+	downloadDir := t.TempDir()
+	github := config.GitHubConfig{DownloadPath: downloadDir, OrganizeByRepo: true}
+
+	owner, repo, ok := downloadedFileRepo(github, filepath.Join(downloadDir, "owner", "repo", "main", "rules", "a.list"))
+	if !ok || owner != "owner" || repo != "repo" {
+		t.Errorf("downloadedFileRepo() = %q, %q, %v, want owner, repo, true", owner, repo, ok)
+	}
+	if _, _, ok := downloadedFileRepo(github, filepath.Join(t.TempDir(), "owner", "repo", "main", "a.list")); ok {
+		t.Error("downloadedFileRepo() outside download_path = true, want false")
+	}
+}
+
+func TestWriteLicenseFilesRemovesStaleWithoutLicenses(t *testing.T) {
+	outputDir := t.TempDir()
+	stale := filepath.Join(outputDir, "test", "LICENSES.txt")
+	if err := os.MkdirAll(filepath.Dir(stale), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(stale, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeLicenseFiles(&config.Config{}, nil, nil, outputDir, []string{"test"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("stale license file still exists (err = %v)", err)
+	}
+}
@@ -0,0 +1,313 @@
+package workflow
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/rs/zerolog/log"
+
+	"rulerefinery/internal/config"
+	"rulerefinery/internal/rules"
+)
+
+// rulesetResult 低内存模式下单个规则集的处理结果
+type rulesetResult struct {
+	loadedFiles        int
+	autofixCount       int
+	lintIssues         []rules.LintIssue
+	invalidRules       []rules.InvalidRule
+	fileMetadata       int
+	metadataMismatches []rules.MetadataMismatch
+	filterIssues       []rules.FilterIssue
+	subtractions       []rules.SubtractResult
+
+	before   map[rules.RuleType]int // 去重前各类型的规则数量
+	deduped  map[rules.RuleType]int // 去重后各类型的规则数量
+	after    map[rules.RuleType]int // 跨规则集排除后各类型的规则数量
+	filtered map[rules.RuleType]int // 应用过滤器后各类型的规则数量（最终导出的规则）
+
+	exportCounts map[string]int     // 各导出类型写入的规则数量（未导出时为 nil）
+	stats        rules.RulesetStats // 写入 statistics.json 的统计（导出后填充）
+	sources      []string           // 导出结果中的规则来自的文件（导出后填充）
+	change       *RulesetChange     // emit_changelog: 相对上次运行的变更（导出后填充）
+	err          error
+}
+
+// processRulesetsLowMemory 低内存模式：每个规则集使用独立的优化器完成加载→去重→导出，
+// 处理完成后释放，同时处理的规则集数量由 low_memory_concurrency 限制。
+// 内存峰值取决于同时处理的几个规则集，而不是全部规则。
+// 统计和检查结果与普通模式一致，但 guardrail_mode: fail / strict_filters 只能跳过未通过检查的规则集，
+// 其他规则集在发现问题前可能已经导出
+func processRulesetsLowMemory(cfg *config.Config, rulesetFiles map[string][]string, ruleSetsConfig *config.RuleSetsConfig, transformers []rules.RuleTransformer, opts GenerateOptions, report *GenerateReport) error {
+	names := make([]string, 0, len(rulesetFiles))
+	for name := range rulesetFiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	concurrency := cfg.GenerateRules.LowMemoryConcurrency
+	if opts.Stdout != nil {
+		// 标准输出需要按规则集名称顺序写入
+		concurrency = 1
+	}
+	if concurrency > len(names) {
+		concurrency = len(names)
+	}
+	log.Info().Msgf("低内存模式: 逐个处理 %d 个规则集，并发数 %d", len(names), concurrency)
+
+	// 标准输出模式只有一个 worker，按顺序写入
+	var out *stdoutWriter
+	if opts.Stdout != nil {
+		kind, asYAML, err := rules.ParseExportFormat(opts.Format)
+		if err != nil {
+			return err
+		}
+		out = &stdoutWriter{opts: opts, kind: kind, asYAML: asYAML}
+	}
+
+	results := make([]rulesetResult, len(names))
+	var failed atomic.Bool
+	tasks := make(chan int, len(names))
+	for i := range names {
+		tasks <- i
+	}
+	close(tasks)
+
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range tasks {
+				// 出错后不再处理剩余的规则集
+				if failed.Load() {
+					continue
+				}
+				name := names[i]
+				results[i] = processSingleRuleset(cfg, name, rulesetFiles, ruleSetsConfig, transformers, opts, out)
+				if results[i].err != nil {
+					failed.Store(true)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// 按规则集名称顺序汇总结果
+	beforeStats := make(map[string]map[rules.RuleType]int)
+	dedupedStats := make(map[string]map[rules.RuleType]int)
+	filteredStats := make(map[string]map[rules.RuleType]int)
+	report.Statistics = make(map[string]map[rules.RuleType]int)
+	exportCounts := make(map[string]map[string]int)
+	exportStats := make(map[string]rules.RulesetStats)
+	exportSources := make(map[string][]string)
+	fileMetadata := 0
+	var exported []string
+	for i, name := range names {
+		result := results[i]
+		if result.err != nil {
+			return fmt.Errorf("处理规则集 '%s' 失败: %w", name, result.err)
+		}
+		report.LoadedFiles += result.loadedFiles
+		report.AutofixCount += result.autofixCount
+		report.LintIssues = append(report.LintIssues, result.lintIssues...)
+		report.InvalidRules = append(report.InvalidRules, result.invalidRules...)
+		report.MetadataMismatches = append(report.MetadataMismatches, result.metadataMismatches...)
+		report.FilterIssues = append(report.FilterIssues, result.filterIssues...)
+		report.Subtractions = append(report.Subtractions, result.subtractions...)
+		fileMetadata += result.fileMetadata
+		if result.before != nil {
+			beforeStats[name] = result.before
+		}
+		if result.deduped != nil {
+			dedupedStats[name] = result.deduped
+		}
+		if result.after != nil {
+			report.Statistics[name] = result.after
+		}
+		if result.filtered != nil {
+			filteredStats[name] = result.filtered
+		}
+		if result.exportCounts != nil {
+			exportCounts[name] = result.exportCounts
+			exportStats[name] = result.stats
+			exportSources[name] = result.sources
+			exported = append(exported, name)
+		}
+		if result.change != nil {
+			report.Changes = append(report.Changes, *result.change)
+		}
+	}
+
+	log.Info().Msgf("已加载 %d 个规则文件到优化器", report.LoadedFiles)
+	if cfg.GenerateRules.Autofix {
+		log.Info().Msgf("自动修正规则: %d 条", report.AutofixCount)
+	}
+	rules.LogLintIssues(report.LintIssues)
+	rules.LogInvalidRules(report.InvalidRules)
+	if cfg.GenerateRules.CheckMetadata {
+		log.Info().Msgf("已解析 %d 个文件的元数据注释", fileMetadata)
+		rules.LogMetadataMismatches(report.MetadataMismatches)
+	}
+	report.RulesBeforeDedup, report.RulesAfterDedup = logDedupSummary(beforeStats, dedupedStats)
+	logStatistics(report.Statistics)
+
+	if err := checkFilterIssues(report.FilterIssues, cfg.GenerateRules.StrictFilters); err != nil {
+		return err
+	}
+	if violations := checkRuleCountGuardrails(filteredStats, ruleSetsConfig, cfg.GenerateRules.GuardrailMode); len(violations) > 0 {
+		report.GuardrailViolations = violations
+		if cfg.GenerateRules.GuardrailMode == config.GuardrailModeFail {
+			return fmt.Errorf("%d 个规则集的规则数量超出预期范围（未通过检查的规则集未导出）: %s", len(violations), strings.Join(violations, "; "))
+		}
+	}
+
+	if opts.Stdout != nil {
+		return nil
+	}
+	log.Info().Msgf("规则集已导出到: %s (%d 个)", opts.OutputRulesPath, len(exported))
+
+	return finishOutput(cfg, ruleSetsConfig, opts, report, exported, exportCounts, exportStats, exportSources)
+}
+
+// processSingleRuleset 使用独立的优化器处理单个规则集，返回后优化器即可被回收
+// 配置了 subtract_rulesets 时，被引用的规则集也会加载到同一个优化器（只用于排除，不导出）。
+// 未通过 strict_filters 或 guardrail_mode: fail 检查的规则集不导出
+func processSingleRuleset(cfg *config.Config, name string, rulesetFiles map[string][]string, ruleSetsConfig *config.RuleSetsConfig, transformers []rules.RuleTransformer, opts GenerateOptions, out *stdoutWriter) rulesetResult {
+	var result rulesetResult
+	rulesetConfig := ruleSetsConfig.ClassifiedRules[name]
+	optimizer := newOptimizer(cfg, opts, transformers)
+
+	result.loadedFiles = loadRulesetFiles(optimizer, name, rulesetFiles[name])
+	result.autofixCount = optimizer.AutofixCount()
+	result.lintIssues = optimizer.LintIssues()
+	result.invalidRules = optimizer.InvalidRules()
+	if cfg.GenerateRules.CheckMetadata {
+		result.fileMetadata = len(optimizer.FileMetadata())
+		result.metadataMismatches = optimizer.MetadataMismatches()
+	}
+
+	if len(rulesetConfig.Filters) > 0 || len(rulesetConfig.Excludes) > 0 {
+		log.Info().Msgf("配置规则集 '%s': filters=%d, excludes=%d", name, len(rulesetConfig.Filters), len(rulesetConfig.Excludes))
+	}
+	if err := optimizer.SetRulesetFilters(name, rulesetConfig.Filters, rulesetConfig.Excludes); err != nil {
+		log.Warn().Msgf("设置规则集 '%s' 过滤器失败: %v", name, err)
+	}
+	if err := optimizer.SetRulesetOutputFormats(name, rulesetConfig.OutputFormats); err != nil {
+		log.Warn().Msgf("设置规则集 '%s' 导出格式失败: %v", name, err)
+	}
+	if err := optimizer.SetRulesetPolicy(name, rulesetConfig.Policy); err != nil {
+		log.Warn().Msgf("设置规则集 '%s' 策略失败: %v", name, err)
+	}
+	if err := optimizer.SetRulesetAllowTLDs(name, rulesetConfig.AllowTLDs); err != nil {
+		log.Warn().Msgf("设置规则集 '%s' allow_tlds 失败: %v", name, err)
+	}
+	if err := optimizer.SetRulesetExcludePrivateIPs(name, rulesetConfig.ExcludesPrivateIPs(cfg.GenerateRules.ExcludePrivateIPs)); err != nil {
+		log.Warn().Msgf("设置规则集 '%s' exclude_private_ips 失败: %v", name, err)
+	}
+
+	// 加载用于排除的规则集（统计和检查只针对当前规则集，已在上面记录）
+	for _, other := range rulesetConfig.SubtractRulesets {
+		loadRulesetFiles(optimizer, other, rulesetFiles[other])
+		otherConfig := ruleSetsConfig.ClassifiedRules[other]
+		if err := optimizer.SetRulesetFilters(other, otherConfig.Filters, otherConfig.Excludes); err != nil {
+			log.Warn().Msgf("设置规则集 '%s' 过滤器失败: %v", other, err)
+		}
+		if err := optimizer.SetRulesetAllowTLDs(other, otherConfig.AllowTLDs); err != nil {
+			log.Warn().Msgf("设置规则集 '%s' allow_tlds 失败: %v", other, err)
+		}
+		if err := optimizer.SetRulesetExcludePrivateIPs(other, otherConfig.ExcludesPrivateIPs(cfg.GenerateRules.ExcludePrivateIPs)); err != nil {
+			log.Warn().Msgf("设置规则集 '%s' exclude_private_ips 失败: %v", other, err)
+		}
+	}
+
+	result.before = optimizer.GetStatistics()[name]
+	optimizer.Deduplicate()
+	result.deduped = optimizer.GetStatistics()[name]
+	if len(rulesetConfig.SubtractRulesets) > 0 {
+		result.subtractions = optimizer.SubtractRulesets(map[string][]string{name: rulesetConfig.SubtractRulesets})
+		for _, other := range rulesetConfig.SubtractRulesets {
+			optimizer.RemoveRuleset(other)
+		}
+	}
+	result.after = optimizer.GetStatistics()[name]
+	result.filtered = optimizer.FilteredStatistics()[name]
+	result.filterIssues = optimizer.CheckRulesetFilters()
+
+	// 未通过检查的规则集不导出（汇总时统一输出检查结果）
+	if cfg.GenerateRules.StrictFilters && len(result.filterIssues) > 0 {
+		log.Warn().Msgf("规则集 '%s' 未通过过滤器检查，跳过导出", name)
+		return result
+	}
+	if cfg.GenerateRules.GuardrailMode == config.GuardrailModeFail && rulesetGuardrailViolation(name, rulesetConfig, result.filtered) != "" {
+		log.Warn().Msgf("规则集 '%s' 未通过规则数量检查，跳过导出", name)
+		return result
+	}
+
+	if out != nil {
+		result.err = out.write(optimizer)
+		return result
+	}
+
+	if err := optimizer.Export(opts.OutputRulesPath); err != nil {
+		result.err = fmt.Errorf("导出规则集失败: %w", err)
+		return result
+	}
+	if counts, ok := optimizer.ExportCounts()[name]; ok {
+		result.exportCounts = counts
+		result.stats = optimizer.RulesetStats()[name]
+		result.sources = optimizer.ContributingSources(name)
+		if cfg.GenerateRules.EmitChangelog {
+			change, err := diffRulesetSnapshot(opts.OutputRulesPath, name, optimizer.ExportedRules(name))
+			if err != nil {
+				result.err = err
+				return result
+			}
+			result.change = &change
+		}
+	}
+	log.Info().Msgf("规则集 '%s' 处理完成: 去重后 %d 条规则", name, countRules(result.after))
+	return result
+}
+
+// loadRulesetFiles 将规则集的文件加载到优化器，返回成功加载的文件数量
+func loadRulesetFiles(optimizer *rules.Optimizer, name string, files []string) int {
+	loaded := 0
+	for _, filePath := range files {
+		if err := optimizer.LoadRuleFile(filePath, name); err != nil {
+			log.Warn().Msgf("加载规则文件失败 %s: %v", filePath, err)
+			continue
+		}
+		loaded++
+	}
+	return loaded
+}
+
+// stdoutWriter 低内存模式下按顺序将各规则集写入标准输出
+// 与 Optimizer.ExportTo 的输出格式一致：YAML 格式以 "---" 分隔文档
+type stdoutWriter struct {
+	opts   GenerateOptions
+	kind   string
+	asYAML bool
+	wrote  bool // 是否已写入规则集
+}
+
+// write 写入优化器中的规则集
+func (s *stdoutWriter) write(optimizer *rules.Optimizer) error {
+	if len(optimizer.RulesetNames()) == 0 {
+		return nil
+	}
+	if s.asYAML && s.wrote {
+		if _, err := fmt.Fprintf(s.opts.Stdout, "---\n"); err != nil {
+			return fmt.Errorf("输出规则集失败: %w", err)
+		}
+	}
+	s.wrote = true
+	if err := optimizer.ExportTo(s.opts.Stdout, s.kind, s.asYAML); err != nil {
+		return fmt.Errorf("输出规则集失败: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+package workflow
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"rulerefinery/internal/config"
+	"rulerefinery/internal/rules"
+)
+
+// outputManifestFile 输出目录清单文件名，记录由本工具生成的规则集目录
+const outputManifestFile = ".rulerefinery-manifest.json"
+
+// OutputManifest 输出目录清单
+type OutputManifest struct {
+	GeneratedAt string            `json:"generated_at"`
+	Layout      string            `json:"layout,omitempty"` // 输出目录结构（by_ruleset/by_behavior，为空表示 by_ruleset）
+	Rulesets    []string          `json:"rulesets"`         // 本工具生成的规则集（by_ruleset 布局下即规则集子目录，按名称排序）
+	Files       map[string]string `json:"files,omitempty"`  // 规则集导出文件的 SHA-256（key 为以 / 分隔的相对路径），供 serve 模式作为 ETag
+}
+
+// OutputManifestFile 返回输出目录清单文件路径
+func OutputManifestFile(outputDir string) string {
+	return filepath.Join(outputDir, outputManifestFile)
+}
+
+// ReadOutputManifest 读取输出目录清单，清单不存在时返回 nil
+func ReadOutputManifest(outputDir string) (*OutputManifest, error) {
+	data, err := os.ReadFile(OutputManifestFile(outputDir))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("读取输出清单失败: %w", err)
+	}
+
+	var manifest OutputManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("解析输出清单失败: %w", err)
+	}
+	return &manifest, nil
+}
+
+// writeOutputManifest 写入输出目录清单
+func writeOutputManifest(outputDir string, rulesets []string, layout string) error {
+	names := append([]string(nil), rulesets...)
+	sort.Strings(names)
+
+	files, err := hashOutputFiles(outputDir, names, layout)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(OutputManifest{
+		GeneratedAt: time.Now().UTC().Format(time.RFC3339),
+		Layout:      layout,
+		Rulesets:    names,
+		Files:       files,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	if err := os.WriteFile(OutputManifestFile(outputDir), data, 0644); err != nil {
+		return fmt.Errorf("写入输出清单失败: %w", err)
+	}
+	return nil
+}
+
+// hashOutputFiles 计算规则集导出文件的 SHA-256
+// by_ruleset 布局下为规则集目录内的所有文件，by_behavior 布局下为各导出类型目录中属于这些规则集的文件
+func hashOutputFiles(outputDir string, rulesets []string, layout string) (map[string]string, error) {
+	files := make(map[string]string)
+	if layout == config.LayoutByBehavior {
+		for _, group := range rules.ExportGroups() {
+			for _, name := range rulesetFilesInGroup(outputDir, group, rulesets) {
+				hash, err := HashFile(filepath.Join(outputDir, group, name))
+				if err != nil {
+					return nil, err
+				}
+				files[group+"/"+name] = hash
+			}
+		}
+		return files, nil
+	}
+
+	for _, name := range rulesets {
+		dir := filepath.Join(outputDir, name)
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, fmt.Errorf("读取规则集目录失败: %w", err)
+		}
+		for _, entry := range entries {
+			if entry.IsDir() {
+				continue
+			}
+			hash, err := HashFile(filepath.Join(dir, entry.Name()))
+			if err != nil {
+				return nil, err
+			}
+			files[name+"/"+entry.Name()] = hash
+		}
+	}
+	return files, nil
+}
+
+// rulesetFilesInGroup 返回 by_behavior 布局下导出类型目录 group 中属于指定规则集的文件名（{name}.{ext}）
+func rulesetFilesInGroup(outputDir, group string, rulesets []string) []string {
+	entries, err := os.ReadDir(filepath.Join(outputDir, group))
+	if err != nil {
+		return nil
+	}
+	wanted := make(map[string]bool, len(rulesets))
+	for _, name := range rulesets {
+		wanted[name] = true
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if base := strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name())); wanted[base] {
+			names = append(names, entry.Name())
+		}
+	}
+	return names
+}
+
+// HashFile 计算文件内容的 SHA-256（十六进制）
+func HashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("读取文件失败: %w", err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("读取文件失败: %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// pruneStaleOutputDirs 删除上次清单中记录、但已不属于当前规则集的输出子目录
+// 只处理清单中记录的目录，不会触碰用户手动放置的文件或目录；返回已删除的目录
+// by_behavior 布局下删除各导出类型目录中这些规则集的文件；上次的布局与本次不同时不清理
+func pruneStaleOutputDirs(outputDir string, current []string, layout string) ([]string, error) {
+	manifest, err := ReadOutputManifest(outputDir)
+	if err != nil {
+		return nil, err
+	}
+	if manifest == nil {
+		log.Info().Msgf("输出目录中没有清单文件 %s，跳过清理过期规则集目录", outputManifestFile)
+		return nil, nil
+	}
+	previousLayout := manifest.Layout
+	if previousLayout == "" {
+		previousLayout = config.LayoutByRuleset
+	}
+	if previousLayout != layout {
+		log.Warn().Msgf("输出目录结构已从 %s 改为 %s，跳过清理过期规则集，旧结构的文件请手动删除", previousLayout, layout)
+		return nil, nil
+	}
+
+	currentSet := make(map[string]bool, len(current))
+	for _, name := range current {
+		currentSet[name] = true
+	}
+
+	var pruned []string
+	for _, name := range manifest.Rulesets {
+		if currentSet[name] {
+			continue
+		}
+		// 防止清单被篡改后删除输出目录以外的路径
+		if name == "" || name == "." || name == ".." || filepath.Base(name) != name {
+			log.Warn().Msgf("忽略清单中的非法规则集目录: %q", name)
+			continue
+		}
+
+		if layout == config.LayoutByBehavior {
+			removed, err := pruneRulesetFiles(outputDir, name)
+			if err != nil {
+				return pruned, err
+			}
+			if removed {
+				pruned = append(pruned, name)
+			}
+			continue
+		}
+
+		dir := filepath.Join(outputDir, name)
+		info, err := os.Stat(dir)
+		if err != nil || !info.IsDir() {
+			continue
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			return pruned, fmt.Errorf("删除过期规则集目录 %s 失败: %w", dir, err)
+		}
+		log.Info().Msgf("已删除过期规则集目录: %s", dir)
+		pruned = append(pruned, name)
+	}
+
+	return pruned, nil
+}
+
+// pruneRulesetFiles 删除 by_behavior 布局下各导出类型目录中指定规则集的文件，返回是否删除了文件
+func pruneRulesetFiles(outputDir, name string) (bool, error) {
+	removed := false
+	for _, group := range rules.ExportGroups() {
+		for _, fileName := range rulesetFilesInGroup(outputDir, group, []string{name}) {
+			filePath := filepath.Join(outputDir, group, fileName)
+			if err := os.Remove(filePath); err != nil {
+				return removed, fmt.Errorf("删除过期规则集文件 %s 失败: %w", filePath, err)
+			}
+			log.Info().Msgf("已删除过期规则集文件: %s", filePath)
+			removed = true
+		}
+	}
+	return removed, nil
+}
@@ -0,0 +1,57 @@
+package workflow
+
+import (
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+
+	"rulerefinery/internal/config"
+	"rulerefinery/internal/rules"
+)
+
+// MergeReport 规则分类文件合并统计
+type MergeReport struct {
+	Rulesets  int                    // 合并后的规则集数量
+	Conflicts []config.MergeConflict // 冲突列表（按发现顺序）
+}
+
+// HandleMergeClassifiedRules 合并两个规则分类文件并写入 outputPath
+// 冲突时以 primaryPath 为准，所有冲突都会记录到日志和返回的统计中
+func HandleMergeClassifiedRules(primaryPath, secondaryPath, outputPath string) (*MergeReport, error) {
+	log.Info().Msgf("=== 合并规则分类文件 ===")
+	log.Info().Msgf("主配置: %s", primaryPath)
+	log.Info().Msgf("次配置: %s", secondaryPath)
+
+	primary, err := config.LoadRuleSetsConfig(primaryPath)
+	if err != nil {
+		return nil, fmt.Errorf("加载 %s 失败: %w", primaryPath, err)
+	}
+	secondary, err := config.LoadRuleSetsConfig(secondaryPath)
+	if err != nil {
+		return nil, fmt.Errorf("加载 %s 失败: %w", secondaryPath, err)
+	}
+
+	merged, conflicts := config.MergeRuleSetsConfigs(primary, secondary)
+	for _, conflict := range conflicts {
+		switch {
+		case conflict.Source != "":
+			log.Warn().Msgf("合并冲突: 来源 %s %s", conflict.Source, conflict.Detail)
+		case conflict.Ruleset != "":
+			log.Warn().Msgf("合并冲突: 规则集 '%s' %s", conflict.Ruleset, conflict.Detail)
+		default:
+			log.Warn().Msgf("合并冲突: %s", conflict.Detail)
+		}
+	}
+
+	if err := rules.ExportClassifiedRulesConfig(merged, outputPath); err != nil {
+		return nil, fmt.Errorf("导出合并后的配置失败: %w", err)
+	}
+
+	report := &MergeReport{
+		Rulesets:  len(merged.ClassifiedRules),
+		Conflicts: conflicts,
+	}
+	log.Info().Msgf("合并完成: %d 个规则集（主配置 %d 个，次配置 %d 个），冲突 %d 个",
+		report.Rulesets, len(primary.ClassifiedRules), len(secondary.ClassifiedRules), len(conflicts))
+	return report, nil
+}
@@ -0,0 +1,54 @@
+package workflow
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"rulerefinery/internal/config"
+)
+
+// MigrateReport 配置迁移结果
+type MigrateReport struct {
+	Changes    []config.MigrationChange // 执行的变更（按迁移顺序）
+	BackupPath string                   // 原配置文件的备份路径（没有变更时为空）
+}
+
+// HandleMigrateConfig 对配置文件执行已知的字段迁移，备份原文件后写回迁移结果
+// 没有需要迁移的字段时不修改文件
+func HandleMigrateConfig(configPath string) (*MigrateReport, error) {
+	log.Info().Msgf("=== 迁移配置文件 ===")
+	log.Info().Msgf("配置文件: %s", configPath)
+
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("读取配置文件失败: %w", err)
+	}
+
+	migrated, changes, err := config.MigrateConfigData(data)
+	if err != nil {
+		return nil, err
+	}
+	report := &MigrateReport{Changes: changes}
+	if len(changes) == 0 {
+		log.Info().Msg("配置文件已是最新格式，无需迁移")
+		return report, nil
+	}
+
+	for _, change := range changes {
+		log.Info().Msgf("迁移 [%s]: %s", change.Migration, change.Detail)
+	}
+
+	report.BackupPath = fmt.Sprintf("%s.%s.bak", configPath, time.Now().Format("20060102-150405"))
+	if err := os.WriteFile(report.BackupPath, data, 0644); err != nil {
+		return nil, fmt.Errorf("备份配置文件失败: %w", err)
+	}
+	if err := os.WriteFile(configPath, migrated, 0644); err != nil {
+		return nil, fmt.Errorf("写入迁移后的配置文件失败: %w", err)
+	}
+
+	log.Info().Msgf("迁移完成: %d 项变更，原配置已备份到 %s", len(changes), report.BackupPath)
+	return report, nil
+}
@@ -0,0 +1,78 @@
+package workflow
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"rulerefinery/internal/config"
+	"rulerefinery/internal/loader"
+	"rulerefinery/internal/rules"
+)
+
+// readExportLines 读取导出文件中的规则行（忽略注释和空行）
+func readExportLines(t *testing.T, path string) []string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// TestPipelineWithMemoryLoader 通过 MemoryLoader 注入固定内容，完整运行 加载 → 去重 → 导出
+func TestPipelineWithMemoryLoader(t *testing.T) {
+	ruleSetsConfig := &config.RuleSetsConfig{ClassifiedRules: map[string]config.RulesetConfig{
+		"google": {
+			URLs: []string{
+				"https://example.com/google.list",
+				"https://example.com/youtube.list",
+			},
+			Rules: []string{"DOMAIN,google.com"},
+		},
+	}}
+	mem := loader.NewMemoryLoader(map[string][]byte{
+		"https://example.com/google.list":  []byte("DOMAIN-SUFFIX,google.com\nDOMAIN,google.com\nIP-CIDR,8.8.8.0/24,no-resolve\n"),
+		"https://example.com/youtube.list": []byte("# comment\nDOMAIN-SUFFIX,youtube.com\nDOMAIN-SUFFIX,google.com\n"),
+	})
+
+	rulesLoader := loader.NewRulesLoaderWithLoader(ruleSetsConfig, mem, t.TempDir())
+	files, err := rulesLoader.LoadAllRules(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mem.Loaded()) != 2 {
+		t.Fatalf("MemoryLoader loaded %v, want both URLs", mem.Loaded())
+	}
+
+	optimizer := rules.NewOptimizer()
+	for _, file := range files["google"] {
+		if err := optimizer.LoadRuleFile(file, "google"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	optimizer.Deduplicate()
+
+	outputDir := t.TempDir()
+	if err := optimizer.Export(outputDir); err != nil {
+		t.Fatal(err)
+	}
+
+	domains := readExportLines(t, filepath.Join(outputDir, "google", "google_domain.list"))
+	if want := []string{"google.com", "+.google.com", "+.youtube.com"}; !reflect.DeepEqual(domains, want) {
+		t.Errorf("google_domain.list = %v, want %v", domains, want)
+	}
+	cidrs := readExportLines(t, filepath.Join(outputDir, "google", "google_ipcidr.list"))
+	if want := []string{"8.8.8.0/24"}; !reflect.DeepEqual(cidrs, want) {
+		t.Errorf("google_ipcidr.list = %v, want %v", cidrs, want)
+	}
+}
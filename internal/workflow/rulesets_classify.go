@@ -3,7 +3,11 @@ package workflow
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/rs/zerolog/log"
 
@@ -13,16 +17,74 @@ import (
 	"rulerefinery/internal/rules"
 )
 
+// GenerateOptions 规则集生成参数
+type GenerateOptions struct {
+	ClassifiedRulesFile string    // 规则分类文件路径
+	OutputRulesPath     string    // 规则集输出目录
+	Stdout              io.Writer // 非 nil 时只将 Format 格式写入该 Writer，不生成目录和文件
+	Format              string    // Stdout 模式的输出格式：{kind}[.yaml|.list]
+	TraceRule           string    // 追踪的规则内容（不含类型），记录其与每个 filter/exclude 的匹配结果（可选）
+	ForceRefresh        bool      // 忽略所有缓存，重新下载所有 URL 来源
+	Version             string    // 工具版本（写入 statistics.json）
+	ProviderPathPrefix  string    // rule-providers.yaml 中 path 的前缀（默认为 OutputRulesPath，生成到临时目录校验时为实际输出目录）
+
+	Loader loader.ContentLoader // URL 来源的内容加载器（可选，默认通过代理池下载）
+
+	domainListFiles map[string]bool   // 按纯域名列表解析的本地文件（下载后根据仓库 filters 的 type 确定）
+	fileSources     map[string]string // 加载的本地文件路径 -> 来源（URL 或配置中的本地文件路径），用于生成来源许可证文件
+}
+
+// GenerateReport 规则集生成统计
+type GenerateReport struct {
+	Rulesets    int                               // 成功加载的规则集数量
+	LoadedFiles int                               // 加载到优化器的规则文件数量
+	Statistics  map[string]map[rules.RuleType]int // 每个规则集各类型的规则数量（去重后）
+
+	GuardrailViolations []string            // 规则数量超出 min_rules/max_rules 的规则集说明
+	PrunedDirs          []string            // prune_stale 删除的过期规则集目录
+	LintIssues          []rules.LintIssue   // 可疑规则（如 DOMAIN 包含通配符、路径或端口）
+	InvalidRules        []rules.InvalidRule // 加载时丢弃的无效规则（如掩码超出范围或地址族与类型不符的网段）
+	AutofixCount        int                 // autofix 自动修正的规则数量
+
+	MetadataMismatches []rules.MetadataMismatch // check_metadata: 实际解析数量与文件元数据声明不一致的项
+	FilterIssues       []rules.FilterIssue      // 没有匹配任何规则的过滤模式、被过滤清空的规则集
+	Subtractions       []rules.SubtractResult   // subtract_rulesets: 各规则集排除的规则数量
+	PriorityMoves      []rules.SubtractResult   // ruleset_priority: 只保留在优先级更高的规则集中而被移除的规则数量
+	Conflicts          map[string][]string      // conflict_mode: 同时出现在多个规则集中的规则内容 -> 规则集名称
+	InvalidRulesets    []config.InvalidRuleset  // skip_invalid_rulesets: 未通过验证而被跳过的规则集
+	Changes            []RulesetChange          // emit_changelog: 各规则集相对上次运行的变更（包括没有变化的规则集）
+
+	RulesBeforeDedup int // 去重前的规则总数
+	RulesAfterDedup  int // 去重后的规则总数
+
+	Downloads loader.DownloadCounts // URL 来源的下载统计
+	Phases    []PhaseTiming         // 各阶段耗时
+}
+
 // HandleGenerateRuleSets 处理规则集分类、下载和优化
-func HandleGenerateRuleSets(configFile, ruleSetsConfigPath, outputRulesetsPath string) {
+func HandleGenerateRuleSets(ctx context.Context, cfg *config.Config, opts GenerateOptions) (*GenerateReport, error) {
+	ruleSetsConfigPath := opts.ClassifiedRulesFile
+	outputRulesetsPath := opts.OutputRulesPath
+	report := &GenerateReport{}
+
 	log.Info().Msgf("=== 规则集分类处理模式 ===")
 	log.Info().Msgf("规则集配置文件: %s", ruleSetsConfigPath)
-	log.Info().Msgf("输出目录: %s", outputRulesetsPath)
+	if opts.Stdout != nil {
+		log.Info().Msgf("输出到标准输出: 格式 %s", opts.Format)
+	} else {
+		log.Info().Msgf("输出目录: %s", outputRulesetsPath)
+	}
 
 	// 创建临时下载目录
 	tmpDownloadPath := "./tmp/rulesets_download"
+	if opts.ForceRefresh {
+		// 清除上次异常退出时残留的下载文件
+		if err := os.RemoveAll(tmpDownloadPath); err != nil {
+			return nil, fmt.Errorf("清理临时下载目录失败: %w", err)
+		}
+	}
 	if err := os.MkdirAll(tmpDownloadPath, 0755); err != nil {
-		log.Fatal().Msgf("创建临时下载目录失败: %v", err)
+		return nil, fmt.Errorf("创建临时下载目录失败: %w", err)
 	}
 
 	// 确保临时目录被清理（即使发生 panic）
@@ -34,18 +96,10 @@ func HandleGenerateRuleSets(configFile, ruleSetsConfigPath, outputRulesetsPath s
 		}
 	}()
 
-	// 加载主配置文件
-	cfg, err := config.LoadConfig(configFile)
-	if err != nil {
-		log.Fatal().Msgf("加载配置文件失败: %v", err)
-	}
-
-	ctx := context.Background()
-
 	// 初始化代理池
-	proxyPool, err := proxy.NewPool(cfg.Proxy.URLs, cfg.Proxy.Enabled)
+	proxyPool, err := proxy.NewPoolFromConfig(cfg.Proxy, cfg.HTTP)
 	if err != nil {
-		log.Fatal().Msgf("初始化代理池失败: %v", err)
+		return nil, fmt.Errorf("初始化代理池失败: %w", err)
 	}
 	if proxyPool.IsEnabled() {
 		log.Info().Msgf("代理已启用: %s", proxyPool.GetCurrentProxy())
@@ -53,9 +107,21 @@ func HandleGenerateRuleSets(configFile, ruleSetsConfigPath, outputRulesetsPath s
 
 	// 加载规则集配置文件
 	log.Info().Msgf("加载规则集配置文件: %s", ruleSetsConfigPath)
-	ruleSetsConfigData, err := config.LoadRuleSetsConfig(ruleSetsConfigPath)
+	var ruleSetsConfigData *config.RuleSetsConfig
+	if cfg.GenerateRules.SkipInvalidRulesets {
+		ruleSetsConfigData, report.InvalidRulesets, err = config.LoadRuleSetsConfigLenient(ruleSetsConfigPath)
+	} else {
+		ruleSetsConfigData, err = config.LoadRuleSetsConfig(ruleSetsConfigPath)
+	}
 	if err != nil {
-		log.Fatal().Msgf("加载规则配置文件失败: %v", err)
+		return nil, fmt.Errorf("加载规则配置文件失败: %w", err)
+	}
+	if len(report.InvalidRulesets) > 0 {
+		for _, invalid := range report.InvalidRulesets {
+			log.Warn().Msgf("跳过未通过验证的规则集 '%s': %v", invalid.Name, invalid.Err)
+		}
+		// 结束时（无论成功与否）汇总列出所有被跳过的规则集，便于修正
+		defer logInvalidRulesets(report.InvalidRulesets)
 	}
 
 	// 显示规则集配置统计
@@ -65,42 +131,81 @@ func HandleGenerateRuleSets(configFile, ruleSetsConfigPath, outputRulesetsPath s
 	for _, ruleset := range ruleSetsConfigData.ClassifiedRules {
 		totalURLs += len(ruleset.URLs)
 		totalFiles += len(ruleset.Files)
-		totalRules += len(ruleset.Rules)
+		totalRules += len(ruleSetsConfigData.ExpandedRules(ruleset))
 	}
 	log.Info().Msgf("规则集配置加载成功: %d 个规则集, %d 个 URL 来源, %d 个本地文件, %d 条手工规则",
 		len(ruleSetsConfigData.ClassifiedRules), totalURLs, totalFiles, totalRules)
 
 	// 创建规则加载器
-	rulesLoader := loader.NewRulesLoader(ruleSetsConfigData, proxyPool, tmpDownloadPath)
+	var rulesLoader *loader.RulesLoader
+	if opts.Loader != nil {
+		rulesLoader = loader.NewRulesLoaderWithLoader(ruleSetsConfigData, opts.Loader, tmpDownloadPath)
+	} else {
+		rulesLoader = loader.NewRulesLoader(ruleSetsConfigData, proxyPool, tmpDownloadPath, cfg.RuleSources.DownloadTimeout)
+	}
+	rulesLoader.SetForceRefresh(opts.ForceRefresh)
+	rulesLoader.SetRevalidate(cfg.RuleSources.RevalidateEnabled())
 
 	// 加载所有规则
 	log.Info().Msg("开始下载和加载规则文件...")
+	downloadStart := time.Now()
 	rulesetFiles, err := rulesLoader.LoadAllRules(ctx)
 	if err != nil {
 		log.Warn().Msgf("部分规则加载失败: %v", err)
 	}
+	report.Phases = append(report.Phases, PhaseTiming{Name: "下载规则文件", Duration: time.Since(downloadStart)})
+	report.Downloads = rulesLoader.DownloadStats().Counts()
+	opts.fileSources = rulesLoader.FileSources()
+	opts.domainListFiles = domainListFiles(cfg.RuleSources.GitHub.Repositories, opts.fileSources)
+	// 运行超时或被取消时下载结果不完整，不导出规则集（避免用残缺的规则覆盖上次的输出）
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("下载规则文件时运行已取消，未导出规则集: %w", ctx.Err())
+	}
 
 	if len(rulesetFiles) == 0 {
 		log.Info().Msg("没有需要处理的规则文件")
-		return
+		return report, nil
 	}
 
 	log.Info().Msgf("规则加载完成: 成功加载 %d 个规则集", len(rulesetFiles))
 
 	// 合并和优化规则集（始终自动去重和智能排序）
 	log.Info().Msg("开始合并和优化规则集...")
-	if err := processRulesets(rulesetFiles, ruleSetsConfigData, outputRulesetsPath); err != nil {
-		log.Fatal().Msgf("规则优化失败: %v", err)
+	report.Rulesets = len(rulesetFiles)
+	processStart := time.Now()
+	if err := processRulesets(cfg, rulesetFiles, ruleSetsConfigData, opts, report); err != nil {
+		return nil, fmt.Errorf("规则优化失败: %w", err)
 	}
+	report.Phases = append(report.Phases, PhaseTiming{Name: "合并、去重与导出", Duration: time.Since(processStart)})
 
 	log.Info().Msg("规则集处理完成！")
-	log.Info().Msgf("规则集已保存到: %s", outputRulesetsPath)
+	if opts.Stdout == nil {
+		log.Info().Msgf("规则集已保存到: %s", outputRulesetsPath)
+	}
+	return report, nil
 }
 
-// processRulesets 处理规则集：去重、排序、导出
-func processRulesets(rulesetFiles map[string][]string, ruleSetsConfig *config.RuleSetsConfig, outputRulesetsPath string) error {
+// processRulesets 处理规则集：去重、排序、导出，并将统计信息写入 report
+func processRulesets(cfg *config.Config, rulesetFiles map[string][]string, ruleSetsConfig *config.RuleSetsConfig, opts GenerateOptions, report *GenerateReport) error {
+	transformers, err := loadTransformers(cfg)
+	if err != nil {
+		return err
+	}
+
+	// 低内存模式：逐个规则集完成加载、去重、导出
+	// 规则集优先级需要同时比较所有规则集，无法逐个处理
+	if cfg.GenerateRules.LowMemory {
+		if len(cfg.GenerateRules.RulesetPriority) == 0 {
+			if cfg.GenerateRules.ConflictMode != config.ConflictModeOff {
+				log.Info().Msg("低内存模式下规则集逐个处理，不检测跨规则集冲突（conflict_mode）")
+			}
+			return processRulesetsLowMemory(cfg, rulesetFiles, ruleSetsConfig, transformers, opts, report)
+		}
+		log.Warn().Msg("已配置 ruleset_priority，需要同时加载所有规则集，忽略 low_memory")
+	}
+
 	// 创建优化器
-	optimizer := rules.NewOptimizer()
+	optimizer := newOptimizer(cfg, opts, transformers)
 
 	// 加载所有规则文件
 	totalFiles := 0
@@ -115,6 +220,25 @@ func processRulesets(rulesetFiles map[string][]string, ruleSetsConfig *config.Ru
 	}
 
 	log.Info().Msgf("已加载 %d 个规则文件到优化器", totalFiles)
+	report.LoadedFiles = totalFiles
+
+	if cfg.GenerateRules.Autofix {
+		report.AutofixCount = optimizer.AutofixCount()
+		log.Info().Msgf("自动修正规则: %d 条", report.AutofixCount)
+	}
+
+	// 输出规则检查结果
+	report.LintIssues = optimizer.LintIssues()
+	rules.LogLintIssues(report.LintIssues)
+	report.InvalidRules = optimizer.InvalidRules()
+	rules.LogInvalidRules(report.InvalidRules)
+
+	// 对比文件元数据声明的数量（发现被截断的下载）
+	if cfg.GenerateRules.CheckMetadata {
+		report.MetadataMismatches = optimizer.MetadataMismatches()
+		log.Info().Msgf("已解析 %d 个文件的元数据注释", len(optimizer.FileMetadata()))
+		rules.LogMetadataMismatches(report.MetadataMismatches)
+	}
 
 	// 设置每个规则集的过滤器配置
 	log.Info().Msg("开始配置规则集过滤器...")
@@ -125,18 +249,430 @@ func processRulesets(rulesetFiles map[string][]string, ruleSetsConfig *config.Ru
 		if err := optimizer.SetRulesetFilters(rulesetName, rulesetConfig.Filters, rulesetConfig.Excludes); err != nil {
 			log.Warn().Msgf("设置规则集 '%s' 过滤器失败: %v", rulesetName, err)
 		}
+		if err := optimizer.SetRulesetOutputFormats(rulesetName, rulesetConfig.OutputFormats); err != nil {
+			log.Warn().Msgf("设置规则集 '%s' 导出格式失败: %v", rulesetName, err)
+		}
+		if err := optimizer.SetRulesetPolicy(rulesetName, rulesetConfig.Policy); err != nil {
+			log.Warn().Msgf("设置规则集 '%s' 策略失败: %v", rulesetName, err)
+		}
+		if err := optimizer.SetRulesetAllowTLDs(rulesetName, rulesetConfig.AllowTLDs); err != nil {
+			log.Warn().Msgf("设置规则集 '%s' allow_tlds 失败: %v", rulesetName, err)
+		}
+		if err := optimizer.SetRulesetExcludePrivateIPs(rulesetName, rulesetConfig.ExcludesPrivateIPs(cfg.GenerateRules.ExcludePrivateIPs)); err != nil {
+			log.Warn().Msgf("设置规则集 '%s' exclude_private_ips 失败: %v", rulesetName, err)
+		}
 	}
 
 	// 去重
 	log.Info().Msg("开始去重规则...")
+	beforeStats := optimizer.GetStatistics()
 	optimizer.Deduplicate()
-	log.Info().Msg("规则去重完成")
+	report.Statistics = optimizer.GetStatistics()
+	report.RulesBeforeDedup, report.RulesAfterDedup = logDedupSummary(beforeStats, report.Statistics)
+
+	// 跨规则集排除（如 proxy 排除已在 direct 中的规则）
+	if subtractions := rulesetSubtractions(ruleSetsConfig); len(subtractions) > 0 {
+		report.Subtractions = optimizer.SubtractRulesets(subtractions)
+		report.Statistics = optimizer.GetStatistics()
+	}
+
+	// 按规则集优先级解决重叠（每条规则只保留在优先级最高的规则集中）
+	if len(cfg.GenerateRules.RulesetPriority) > 0 {
+		report.PriorityMoves = optimizer.ResolvePriority(rulesetPriorityOrder(cfg.GenerateRules.RulesetPriority, ruleSetsConfig))
+		log.Info().Msgf("规则集优先级处理完成: %d 组规则集之间存在重叠", len(report.PriorityMoves))
+		report.Statistics = optimizer.GetStatistics()
+	}
+
+	logStatistics(report.Statistics)
+
+	// 检查过滤器是否配置错误（如模式写错导致规则集被清空）
+	report.FilterIssues = optimizer.CheckRulesetFilters()
+	if err := checkFilterIssues(report.FilterIssues, cfg.GenerateRules.StrictFilters); err != nil {
+		return err
+	}
+
+	// 检查规则数量范围（防止上游规则被清空后静默发布）
+	if violations := checkRuleCountGuardrails(optimizer.FilteredStatistics(), ruleSetsConfig, cfg.GenerateRules.GuardrailMode); len(violations) > 0 {
+		report.GuardrailViolations = violations
+		if cfg.GenerateRules.GuardrailMode == config.GuardrailModeFail {
+			return fmt.Errorf("%d 个规则集的规则数量超出预期范围: %s", len(violations), strings.Join(violations, "; "))
+		}
+	}
+
+	// 检测跨规则集冲突（同一规则内容出现在多个规则集中时路由取决于 RULE-SET 的顺序）
+	if cfg.GenerateRules.ConflictMode != config.ConflictModeOff {
+		if err := checkConflicts(optimizer, cfg.GenerateRules.ConflictMode, opts, report); err != nil {
+			return err
+		}
+	}
+
+	// 标准输出模式：只输出单一格式
+	if opts.Stdout != nil {
+		kind, asYAML, err := rules.ParseExportFormat(opts.Format)
+		if err != nil {
+			return err
+		}
+		if err := optimizer.ExportTo(opts.Stdout, kind, asYAML); err != nil {
+			return fmt.Errorf("输出规则集失败: %w", err)
+		}
+		return nil
+	}
 
 	// 导出优化后的规则
-	log.Info().Msgf("开始导出规则集到: %s", outputRulesetsPath)
-	if err := optimizer.Export(outputRulesetsPath); err != nil {
+	log.Info().Msgf("开始导出规则集到: %s", opts.OutputRulesPath)
+	if err := optimizer.Export(opts.OutputRulesPath); err != nil {
 		return fmt.Errorf("导出规则集失败: %w", err)
 	}
 
+	exportCounts := optimizer.ExportCounts()
+	sources := make(map[string][]string)
+	for _, name := range optimizer.RulesetNames() {
+		if _, ok := exportCounts[name]; !ok {
+			continue
+		}
+		sources[name] = optimizer.ContributingSources(name)
+		if cfg.GenerateRules.EmitChangelog {
+			change, err := diffRulesetSnapshot(opts.OutputRulesPath, name, optimizer.ExportedRules(name))
+			if err != nil {
+				return err
+			}
+			report.Changes = append(report.Changes, change)
+		}
+	}
+
+	return finishOutput(cfg, ruleSetsConfig, opts, report, optimizer.RulesetNames(), exportCounts, optimizer.RulesetStats(), sources)
+}
+
+// checkConflicts 检测跨规则集冲突，记录警告并写入输出目录的 conflicts.txt（标准输出模式不写入）
+// mode 为 fail 且存在冲突时返回错误（报告照常写入）
+func checkConflicts(optimizer *rules.Optimizer, mode string, opts GenerateOptions, report *GenerateReport) error {
+	report.Conflicts = optimizer.DetectConflicts()
+	rules.LogConflicts(report.Conflicts)
+
+	if opts.Stdout == nil {
+		if err := os.MkdirAll(opts.OutputRulesPath, 0755); err != nil {
+			return fmt.Errorf("创建输出目录失败: %w", err)
+		}
+		reportPath, err := rules.WriteConflictReport(opts.OutputRulesPath, report.Conflicts)
+		if err != nil {
+			return fmt.Errorf("写入冲突报告失败: %w", err)
+		}
+		log.Info().Msgf("跨规则集冲突报告已写入: %s（%d 条）", reportPath, len(report.Conflicts))
+	}
+
+	if mode == config.ConflictModeFail && len(report.Conflicts) > 0 {
+		return fmt.Errorf("%d 条规则内容同时出现在多个规则集中（conflict_mode: fail），详见 %s", len(report.Conflicts), rules.ConflictReportFile)
+	}
+	return nil
+}
+
+// newOptimizer 按配置和运行参数创建优化器
+func newOptimizer(cfg *config.Config, opts GenerateOptions, transformers []rules.RuleTransformer) *rules.Optimizer {
+	optimizer := rules.NewOptimizer()
+	optimizer.SetAutofix(cfg.GenerateRules.Autofix)
+	optimizer.SetWildcardAsRegex(cfg.GenerateRules.WildcardAsRegex)
+	optimizer.SetDomainIncludeWildcard(cfg.GenerateRules.DomainIncludeWildcard)
+	optimizer.SetSuffixMode(cfg.GenerateRules.SuffixMode)
+	optimizer.SetCollapseSubdomains(cfg.GenerateRules.CollapseSubdomains)
+	optimizer.SetMergeCIDRs(cfg.GenerateRules.MergeCIDRsEnabled())
+	optimizer.SetMergePorts(cfg.GenerateRules.MergePorts)
+	optimizer.SetTraceRule(opts.TraceRule)
+	optimizer.SetFileExtensions(cfg.GenerateRules.ListExtension, cfg.GenerateRules.YAMLExtension)
+	optimizer.SetMetadataCheck(cfg.GenerateRules.CheckMetadata)
+	optimizer.SetTrackSources(repositoryLicenses(cfg) != nil)
+	optimizer.SetKnownOptions(cfg.GenerateRules.KnownOptions)
+	optimizer.SetAppendPolicy(cfg.GenerateRules.AppendPolicy)
+	optimizer.SetDomainListFiles(opts.domainListFiles)
+	optimizer.SetSingboxExport(cfg.GenerateRules.EmitSingbox)
+	optimizer.SetInvalidReport(cfg.GenerateRules.EmitInvalidReport)
+	optimizer.SetLayout(cfg.GenerateRules.Layout)
+	for _, transformer := range transformers {
+		optimizer.AddTransformer(transformer)
+	}
+	return optimizer
+}
+
+// loadTransformers 按配置创建规则转换器（可在多个优化器之间共享）
+func loadTransformers(cfg *config.Config) ([]rules.RuleTransformer, error) {
+	var transformers []rules.RuleTransformer
+
+	// 展开 GEOSITE 引用（生成不依赖客户端 geosite 数据库的规则集）
+	if cfg.GenerateRules.GeoSiteDB != "" {
+		db, err := rules.LoadGeoSiteDB(cfg.GenerateRules.GeoSiteDB)
+		if err != nil {
+			return nil, err
+		}
+		log.Info().Msgf("已加载 geosite 数据库: %s (%d 个分类)", cfg.GenerateRules.GeoSiteDB, len(db))
+		transformers = append(transformers, rules.NewGeoSiteTransformer(db))
+	}
+
+	return transformers, nil
+}
+
+// rulesetSubtractions 返回配置了 subtract_rulesets 的规则集：规则集 -> 用于排除的规则集
+func rulesetSubtractions(ruleSetsConfig *config.RuleSetsConfig) map[string][]string {
+	subtractions := make(map[string][]string)
+	for name, rulesetConfig := range ruleSetsConfig.ClassifiedRules {
+		if len(rulesetConfig.SubtractRulesets) > 0 {
+			subtractions[name] = rulesetConfig.SubtractRulesets
+		}
+	}
+	return subtractions
+}
+
+// rulesetPriorityOrder 返回从高到低的完整规则集优先级：先是 ruleset_priority 中列出的规则集，
+// 其余规则集按规则分类文件中的顺序排在后面
+func rulesetPriorityOrder(priority []string, ruleSetsConfig *config.RuleSetsConfig) []string {
+	order := make([]string, 0, len(ruleSetsConfig.ClassifiedRules))
+	listed := make(map[string]bool, len(priority))
+	for _, name := range priority {
+		if _, exists := ruleSetsConfig.ClassifiedRules[name]; !exists {
+			log.Warn().Msgf("ruleset_priority 中的规则集 '%s' 不存在，忽略", name)
+			continue
+		}
+		if !listed[name] {
+			listed[name] = true
+			order = append(order, name)
+		}
+	}
+	for _, name := range ruleSetsConfig.OrderedRulesets() {
+		if !listed[name] {
+			order = append(order, name)
+		}
+	}
+	return order
+}
+
+// checkFilterIssues 输出过滤器检查结果，strict 为 true 且存在问题时返回错误
+func checkFilterIssues(filterIssues []rules.FilterIssue, strict bool) error {
+	if len(filterIssues) == 0 {
+		return nil
+	}
+	issues := make([]string, len(filterIssues))
+	for i, issue := range filterIssues {
+		issues[i] = issue.String()
+		log.Warn().Msgf("过滤器检查: %s", issue)
+	}
+	if strict {
+		return fmt.Errorf("%d 个过滤器问题（strict_filters 已启用）: %s", len(issues), strings.Join(issues, "; "))
+	}
 	return nil
 }
+
+// finishOutput 导出后的收尾工作：生成 rule-providers 配置片段、清理过期目录、写入输出清单、更新变更日志
+// names 为本次导出的规则集，exportCounts 为各规则集各导出类型写入的规则数量，stats 为写入 statistics.json 的各规则集统计，
+// sources 为各规则集导出结果中的规则来自的文件（rules.Optimizer.ContributingSources）
+func finishOutput(cfg *config.Config, ruleSetsConfig *config.RuleSetsConfig, opts GenerateOptions, report *GenerateReport, names []string, exportCounts map[string]map[string]int, stats map[string]rules.RulesetStats, sources map[string][]string) error {
+	// 生成 rule-providers 配置片段
+	if cfg.GenerateRules.EmitProviderConfig {
+		pathPrefix := opts.ProviderPathPrefix
+		if pathPrefix == "" {
+			pathPrefix = opts.OutputRulesPath
+		}
+		snippetPath, err := rules.WriteProviderConfig(opts.OutputRulesPath, pathPrefix, cfg.GenerateRules.ProviderFormat,
+			cfg.GenerateRules.ListExtension, cfg.GenerateRules.YAMLExtension, cfg.GenerateRules.Layout, exportCounts)
+		if err != nil {
+			return fmt.Errorf("生成 rule-providers 配置片段失败: %w", err)
+		}
+		log.Info().Msgf("已生成 rule-providers 配置片段: %s", snippetPath)
+	}
+
+	if err := writeOutputStatistics(opts.OutputRulesPath, opts.Version, stats); err != nil {
+		return err
+	}
+
+	// 各规则集的来源许可证（需在写入输出清单之前生成，以便计入清单）
+	if err := writeLicenseFiles(cfg, opts.fileSources, sources, opts.OutputRulesPath, names); err != nil {
+		return err
+	}
+
+	// 被跳过的无效规则集保留上次的输出：不清理，并继续记录在清单中
+	kept, err := keptInvalidRulesets(opts.OutputRulesPath, report.InvalidRulesets)
+	if err != nil {
+		return err
+	}
+	names = append(names, kept...)
+
+	// 清理已从配置中移除的规则集目录（只处理清单中记录的目录）
+	if cfg.GenerateRules.PruneStale {
+		current := ruleSetsConfig.GetAllRulesets()
+		for _, invalid := range report.InvalidRulesets {
+			current = append(current, invalid.Name)
+		}
+		pruned, err := pruneStaleOutputDirs(opts.OutputRulesPath, current, cfg.GenerateRules.Layout)
+		report.PrunedDirs = pruned
+		if err != nil {
+			return err
+		}
+		log.Info().Msgf("清理过期规则集目录完成: 删除 %d 个", len(pruned))
+	}
+
+	// 记录本次生成的规则集目录，供下次清理使用
+	if err := writeOutputManifest(opts.OutputRulesPath, names, cfg.GenerateRules.Layout); err != nil {
+		return err
+	}
+
+	// 变更日志：已从规则分类文件中移除的规则集也记录一次（被跳过的无效规则集保留快照）
+	// 最后写入并提交快照，之前的步骤失败时下次运行仍会报告本次的变更
+	if cfg.GenerateRules.EmitChangelog {
+		current := ruleSetsConfig.GetAllRulesets()
+		for _, invalid := range report.InvalidRulesets {
+			current = append(current, invalid.Name)
+		}
+		deleted, err := deletedRulesetChanges(opts.OutputRulesPath, current)
+		if err != nil {
+			return err
+		}
+		report.Changes = append(report.Changes, deleted...)
+		written, err := writeChangelog(opts.OutputRulesPath, opts.Version, report.Changes)
+		if err != nil {
+			return err
+		}
+		if !written {
+			log.Info().Msgf("规则集与上次运行相比没有变化，不更新 %s", ChangelogFile)
+		}
+		if err := commitSnapshots(opts.OutputRulesPath, report.Changes); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// keptInvalidRulesets 返回上次输出清单中记录的、本次因未通过验证而被跳过的规则集
+func keptInvalidRulesets(outputDir string, invalid []config.InvalidRuleset) ([]string, error) {
+	if len(invalid) == 0 {
+		return nil, nil
+	}
+	manifest, err := ReadOutputManifest(outputDir)
+	if err != nil || manifest == nil {
+		return nil, err
+	}
+
+	skipped := make(map[string]bool, len(invalid))
+	for _, r := range invalid {
+		skipped[r.Name] = true
+	}
+	var kept []string
+	for _, name := range manifest.Rulesets {
+		if skipped[name] {
+			kept = append(kept, name)
+		}
+	}
+	return kept, nil
+}
+
+// logInvalidRulesets 汇总列出被跳过的无效规则集
+func logInvalidRulesets(invalid []config.InvalidRuleset) {
+	errs := make([]string, len(invalid))
+	for i, r := range invalid {
+		errs[i] = r.Err.Error()
+	}
+	log.Warn().Msgf("skip_invalid_rulesets: 跳过了 %d 个未通过验证的规则集，请修正规则分类文件: %s", len(invalid), strings.Join(errs, "; "))
+}
+
+// logDedupSummary 输出去重统计：总数变化、减少比例和减少最多的规则类型
+// 返回去重前后的规则总数
+func logDedupSummary(before, after map[string]map[rules.RuleType]int) (int, int) {
+	reduction := make(map[rules.RuleType]int)
+	totalBefore, totalAfter := 0, 0
+	for name, types := range before {
+		for ruleType, count := range types {
+			totalBefore += count
+			reduction[ruleType] += count - after[name][ruleType]
+		}
+	}
+	for _, types := range after {
+		for _, count := range types {
+			totalAfter += count
+		}
+	}
+
+	percent := 0.0
+	if totalBefore > 0 {
+		percent = float64(totalBefore-totalAfter) * 100 / float64(totalBefore)
+	}
+	log.Info().Msgf("规则去重完成: 去重前 %d 条，去重后 %d 条，减少 %d 条 (%.1f%%)",
+		totalBefore, totalAfter, totalBefore-totalAfter, percent)
+
+	// 按减少数量排序（相同时按类型名称），只显示前 5 个
+	types := make([]rules.RuleType, 0, len(reduction))
+	for ruleType, count := range reduction {
+		if count > 0 {
+			types = append(types, ruleType)
+		}
+	}
+	sort.Slice(types, func(i, j int) bool {
+		if reduction[types[i]] != reduction[types[j]] {
+			return reduction[types[i]] > reduction[types[j]]
+		}
+		return types[i] < types[j]
+	})
+	if len(types) > 5 {
+		types = types[:5]
+	}
+	for _, ruleType := range types {
+		log.Info().Msgf("  %s: 减少 %d 条", ruleType, reduction[ruleType])
+	}
+
+	return totalBefore, totalAfter
+}
+
+// logStatistics 输出各规则集的规则数量表（顺序稳定，便于比较不同运行的日志）
+func logStatistics(stats map[string]map[rules.RuleType]int) {
+	if table := rules.FormatStatistics(stats); table != "" {
+		log.Info().Msgf("规则集统计:\n%s", table)
+	}
+}
+
+// checkRuleCountGuardrails 检查过滤后（即实际导出）的规则数量是否在 min_rules/max_rules 范围内
+// 返回违规说明（按规则集名称排序），mode 为 off 时不检查
+func checkRuleCountGuardrails(stats map[string]map[rules.RuleType]int, ruleSetsConfig *config.RuleSetsConfig, mode string) []string {
+	if mode == config.GuardrailModeOff {
+		return nil
+	}
+
+	names := ruleSetsConfig.GetAllRulesets()
+	sort.Strings(names)
+
+	var violations []string
+	for _, name := range names {
+		if violation := rulesetGuardrailViolation(name, ruleSetsConfig.ClassifiedRules[name], stats[name]); violation != "" {
+			violations = append(violations, violation)
+			log.Warn().Msgf("规则数量检查未通过: %s", violation)
+		}
+	}
+	return violations
+}
+
+// rulesetGuardrailViolation 检查单个规则集的规则数量，超出 min_rules/max_rules 范围时返回违规说明
+func rulesetGuardrailViolation(name string, rulesetConfig config.RulesetConfig, stats map[rules.RuleType]int) string {
+	if rulesetConfig.MinRules == 0 && rulesetConfig.MaxRules == 0 {
+		return ""
+	}
+
+	total := countRules(stats)
+	if (rulesetConfig.MinRules > 0 && total < rulesetConfig.MinRules) ||
+		(rulesetConfig.MaxRules > 0 && total > rulesetConfig.MaxRules) {
+		return fmt.Sprintf("规则集 '%s': 实际 %d 条，预期范围 [%s, %s]",
+			name, total, formatBound(rulesetConfig.MinRules), formatBound(rulesetConfig.MaxRules))
+	}
+	return ""
+}
+
+// countRules 统计各类型规则数量之和
+func countRules(stats map[rules.RuleType]int) int {
+	total := 0
+	for _, count := range stats {
+		total += count
+	}
+	return total
+}
+
+// formatBound 格式化数量边界（0 表示不限）
+func formatBound(bound int) string {
+	if bound == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%d", bound)
+}
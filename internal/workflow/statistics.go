@@ -0,0 +1,46 @@
+package workflow
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"rulerefinery/internal/rules"
+)
+
+// StatisticsFile 输出目录中的规则集统计文件名（机器可读，便于比较不同运行的结果）
+const StatisticsFile = "statistics.json"
+
+// OutputStatistics 输出目录统计文件
+type OutputStatistics struct {
+	GeneratedAt string                        `json:"generated_at"`
+	Version     string                        `json:"version"`  // 生成时的工具版本
+	Rulesets    map[string]rules.RulesetStats `json:"rulesets"` // 本次导出的规则集（key 为规则集名称）
+}
+
+// writeOutputStatistics 将本次导出的规则集统计写入输出目录的 statistics.json
+func writeOutputStatistics(outputDir, version string, stats map[string]rules.RulesetStats) error {
+	if version == "" {
+		version = "dev"
+	}
+	if stats == nil {
+		stats = make(map[string]rules.RulesetStats)
+	}
+
+	data, err := json.MarshalIndent(OutputStatistics{
+		GeneratedAt: time.Now().UTC().Format(time.RFC3339),
+		Version:     version,
+		Rulesets:    stats,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	if err := os.WriteFile(filepath.Join(outputDir, StatisticsFile), data, 0644); err != nil {
+		return fmt.Errorf("写入统计文件失败: %w", err)
+	}
+	return nil
+}
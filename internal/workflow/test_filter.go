@@ -0,0 +1,79 @@
+package workflow
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/rs/zerolog/log"
+
+	"rulerefinery/internal/config"
+	"rulerefinery/internal/loader"
+	"rulerefinery/internal/proxy"
+	"rulerefinery/internal/rules"
+)
+
+// testFilterSampleSize --test-filter 每个规则类型输出的保留/移除示例数量
+const testFilterSampleSize = 10
+
+// HandleTestFilter 预览单个规则集 filters/excludes 的效果（--test-filter）：
+// 只加载该规则集的来源，去重后应用其 allow_tlds/filters/excludes，返回各类型前后的数量和保留/移除的规则示例，不导出任何文件
+func HandleTestFilter(ctx context.Context, cfg *config.Config, name string) (*rules.FilterPreview, error) {
+	ruleSetsConfig, err := config.LoadRuleSetsConfig(cfg.AIClassifyRules.ClassifiedRulesFile)
+	if err != nil {
+		return nil, fmt.Errorf("加载规则配置文件失败: %w", err)
+	}
+	name = config.NormalizeRulesetName(name)
+	rulesetConfig, exists := ruleSetsConfig.ClassifiedRules[name]
+	if !exists {
+		return nil, fmt.Errorf("规则集 '%s' 不存在于 %s", name, cfg.AIClassifyRules.ClassifiedRulesFile)
+	}
+
+	// 只加载指定的规则集（保留 rule_blocks 以展开 include_blocks）
+	single := &config.RuleSetsConfig{
+		ClassifiedRules: map[string]config.RulesetConfig{name: rulesetConfig},
+		RuleBlocks:      ruleSetsConfig.RuleBlocks,
+	}
+
+	tmpDownloadPath, err := os.MkdirTemp("", "rulerefinery-test-filter-*")
+	if err != nil {
+		return nil, fmt.Errorf("创建临时下载目录失败: %w", err)
+	}
+	defer os.RemoveAll(tmpDownloadPath)
+
+	proxyPool, err := proxy.NewPoolFromConfig(cfg.Proxy, cfg.HTTP)
+	if err != nil {
+		return nil, fmt.Errorf("初始化代理池失败: %w", err)
+	}
+	rulesLoader := loader.NewRulesLoader(single, proxyPool, tmpDownloadPath, cfg.RuleSources.DownloadTimeout)
+	rulesLoader.SetRevalidate(cfg.RuleSources.RevalidateEnabled())
+	rulesetFiles, err := rulesLoader.LoadAllRules(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("加载规则失败: %w", err)
+	}
+
+	transformers, err := loadTransformers(cfg)
+	if err != nil {
+		return nil, err
+	}
+	opts := GenerateOptions{
+		domainListFiles: domainListFiles(cfg.RuleSources.GitHub.Repositories, rulesLoader.FileSources()),
+	}
+	optimizer := newOptimizer(cfg, opts, transformers)
+	if loadRulesetFiles(optimizer, name, rulesetFiles[name]) == 0 {
+		return nil, fmt.Errorf("规则集 '%s' 没有加载到任何规则文件", name)
+	}
+	if err := optimizer.SetRulesetFilters(name, rulesetConfig.Filters, rulesetConfig.Excludes); err != nil {
+		return nil, err
+	}
+	if err := optimizer.SetRulesetAllowTLDs(name, rulesetConfig.AllowTLDs); err != nil {
+		return nil, err
+	}
+	if err := optimizer.SetRulesetExcludePrivateIPs(name, rulesetConfig.ExcludesPrivateIPs(cfg.GenerateRules.ExcludePrivateIPs)); err != nil {
+		return nil, err
+	}
+	optimizer.Deduplicate()
+	log.Info().Msgf("规则集 '%s': 去重完成，开始应用 filters/excludes", name)
+
+	return optimizer.PreviewFilters(name, testFilterSampleSize)
+}
@@ -1,32 +1,58 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"io"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 
 	"rulerefinery/internal/config"
-	"rulerefinery/internal/workflow"
+	"rulerefinery/refinery"
 )
 
 var (
-	configFile = flag.String("config", "config.yaml", "配置文件路径")
-	help       = flag.Bool("help", false, "显示帮助信息")
+	configFile  = flag.String("config", "config.yaml", "配置文件路径")
+	help        = flag.Bool("help", false, "显示帮助信息")
+	skipSources = flag.String("skip-sources", "", "跳过分类的规则来源 glob 模式（匹配本地路径或 URL，多个用逗号分隔）")
+	stdinMode   = flag.Bool("stdin", false, "从标准输入读取规则，优化后输出到标准输出（无需配置文件）")
+	rulesetName = flag.String("ruleset", "stdin", "标准输入模式下的规则集名称")
+	stdoutMode  = flag.Bool("stdout", false, "规则集生成结果以 --format 指定的单一格式输出到标准输出，不生成目录")
+	traceRule   = flag.String("trace-rule", "", "追踪指定规则内容（如 www.example.com）经过每个 filter/exclude 的匹配结果")
+	refresh     = flag.Bool("force-refresh", false, "忽略所有缓存：重新下载已有的规则文件，重新分类已在规则分类文件中的规则文件")
+	verifyWith  = flag.String("verify-with", "", "规则集生成后使用指定客户端二进制校验导出文件（如 mihomo）")
+	checkMode   = flag.Bool("check", false, "只读校验：重新生成规则集到临时目录并与 output_rules_path 比较，不一致时输出差异并以状态 1 退出（用于 CI）")
+	initMode    = flag.Bool("init", false, "生成带注释的初始配置文件（--config 指定的路径）和规则分类文件")
+	force       = flag.Bool("force", false, "--init 时覆盖已存在的文件")
+	migrateMode = flag.Bool("migrate-config", false, "迁移 --config 指定的配置文件中已重命名的字段（原文件备份为 .bak）")
+	inspect     = flag.String("inspect", "", "诊断单个规则文件或 URL：输出规则数量、类型分布、首尾示例和解析警告")
+	testFilter  = flag.String("test-filter", "", "预览指定规则集的 filters/excludes 效果：各类型过滤前后的数量和保留/移除的规则示例，不导出文件")
+	mergeMode   = flag.Bool("merge-configs", false, "合并两个规则分类文件：--merge-configs a.yaml b.yaml -o out.yaml（冲突时以 a.yaml 为准）")
+	outputFile  = flag.String("o", "", "--merge-configs 的输出文件路径")
+	serveAddr   = flag.String("addr", ":8080", "serve 模式的监听地址")
+	serveDir    = flag.String("dir", "", "serve 模式提供的规则集目录（默认使用配置文件中的 generate_rules.output_rules_path）")
+	serveGzip   = flag.Bool("gzip", false, "serve 模式下对支持 gzip 的客户端压缩响应")
+	runTimeout  = flag.Duration("run-timeout", 0, "整个运行的超时时间（如 30m），覆盖配置文件中的 run_timeout")
+	format      = flag.String("format", "classical_all", "标准输出格式：domain/ipcidr/classical/classical_no_resolve/classical_all/classical_all_no_resolve，可加 .yaml/.list 后缀")
 )
 
+// runTimeoutGrace 运行超时后等待各步骤收尾的时间，超过后强制退出
+const runTimeoutGrace = 30 * time.Second
+
 var (
 	Version = "dev" // 版本号，编译时通过 -ldflags 注入
 )
 
 func main() {
-	flag.Parse()
+	args := parseFlags()
 
 	// 显示帮助信息
 	if *help {
@@ -34,6 +60,115 @@ func main() {
 		os.Exit(0)
 	}
 
+	// 标准输入模式：不加载配置文件，日志只输出警告到标准错误
+	if *stdinMode {
+		zerolog.SetGlobalLevel(zerolog.WarnLevel)
+		log.Logger = zerolog.New(zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.Kitchen}).With().Timestamp().Logger()
+		if err := refinery.RefineStream(os.Stdin, os.Stdout, refinery.StreamOptions{
+			Ruleset: *rulesetName,
+			Format:  *format,
+		}); err != nil {
+			fmt.Fprintf(os.Stderr, "处理标准输入失败: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// 初始化模式：生成配置文件和规则分类文件
+	if *initMode {
+		files, err := refinery.Init(refinery.InitOptions{
+			ConfigPath: *configFile,
+			Force:      *force,
+			Version:    Version,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "初始化失败: %v\n", err)
+			os.Exit(1)
+		}
+		for _, file := range files {
+			fmt.Printf("已生成: %s\n", file)
+		}
+		fmt.Printf("编辑配置文件后运行: %s --config %s\n", os.Args[0], *configFile)
+		return
+	}
+
+	// 配置迁移模式：不校验配置（旧配置可能无法通过校验），日志输出到标准错误
+	if *migrateMode {
+		log.Logger = zerolog.New(zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.Kitchen}).With().Timestamp().Logger()
+		changes, backupPath, err := refinery.MigrateConfig(*configFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "迁移配置文件失败: %v\n", err)
+			os.Exit(1)
+		}
+		if len(changes) > 0 {
+			fmt.Printf("已迁移 %s（%d 项变更），原配置备份: %s\n", *configFile, len(changes), backupPath)
+		}
+		return
+	}
+
+	// 诊断模式：报告输出到标准输出，日志输出到标准错误；配置文件可选，仅用于下载时的代理设置
+	if *inspect != "" {
+		log.Logger = zerolog.New(zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.Kitchen}).With().Timestamp().Logger()
+		cfg, err := config.LoadConfig(*configFile)
+		if err != nil {
+			cfg = nil
+		}
+		inspection, err := refinery.Inspect(context.Background(), cfg, *inspect)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "诊断失败: %v\n", err)
+			os.Exit(1)
+		}
+		if err := inspection.WriteReport(os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "输出诊断报告失败: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// 过滤器预览模式：报告输出到标准输出，日志输出到标准错误
+	if *testFilter != "" {
+		log.Logger = zerolog.New(zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.Kitchen}).With().Timestamp().Logger()
+		cfg, err := config.LoadConfig(*configFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "加载配置文件失败: %v\n", err)
+			os.Exit(1)
+		}
+		preview, err := refinery.TestFilter(context.Background(), cfg, *testFilter)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "预览过滤器失败: %v\n", err)
+			os.Exit(1)
+		}
+		if err := preview.WriteReport(os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "输出预览报告失败: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// 合并规则分类文件模式：不加载配置文件，日志输出到标准错误
+	if *mergeMode {
+		if len(args) != 2 || *outputFile == "" {
+			fmt.Fprintln(os.Stderr, "用法: --merge-configs a.yaml b.yaml -o out.yaml")
+			os.Exit(2)
+		}
+		log.Logger = zerolog.New(zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.Kitchen}).With().Timestamp().Logger()
+		conflicts, err := refinery.MergeClassifiedRules(args[0], args[1], *outputFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "合并规则分类文件失败: %v\n", err)
+			os.Exit(1)
+		}
+		if len(conflicts) > 0 {
+			fmt.Fprintf(os.Stderr, "合并完成，发现 %d 个冲突（已按 %s 处理），请检查 %s\n", len(conflicts), args[0], *outputFile)
+		}
+		return
+	}
+
+	// HTTP 服务模式：rulerefinery serve --addr :8080 --dir <output>
+	if len(args) > 0 && args[0] == "serve" {
+		runServe()
+		return
+	}
+
 	// 加载配置文件并初始化日志
 	cfg, err := config.LoadConfig(*configFile)
 	if err != nil {
@@ -41,54 +176,106 @@ func main() {
 		os.Exit(1)
 	}
 
-	// 初始化日志系统
-	if err := initLogger(cfg.Logging); err != nil {
+	// 初始化日志系统（标准输出模式下控制台日志改为输出到标准错误）
+	consoleOut := io.Writer(os.Stdout)
+	if *stdoutMode {
+		consoleOut = os.Stderr
+	}
+	if err := initLogger(cfg.Logging, consoleOut); err != nil {
 		fmt.Fprintf(os.Stderr, "初始化日志系统失败: %v\n", err)
 		os.Exit(1)
 	}
 
 	log.Info().Msgf("程序启动 version=%s config=%s ai_classify=%v generate_rules=%v", Version, *configFile, cfg.AIClassifyRules.Enabled, cfg.GenerateRules.Enabled)
 
-	// 检查是否至少启用了一个功能
-	if !cfg.AIClassifyRules.Enabled && !cfg.GenerateRules.Enabled {
-		log.Fatal().Msg("错误: 必须至少启用一个功能（ai_classify_rules.enabled 或 generate_rules.enabled）")
+	runOpts := refinery.RunOptions{
+		SkipSources: parseListFlag(*skipSources),
+		Format:      *format,
+		VerifyWith:  *verifyWith,
+		TraceRule:   *traceRule,
+		Timeout:     *runTimeout,
+		Version:     Version,
+
+		ForceRefresh: *refresh,
+	}
+	if *stdoutMode {
+		runOpts.Stdout = os.Stdout
 	}
 
-	// 执行 AI 规则分类
-	if cfg.AIClassifyRules.Enabled {
-		log.Info().Msg("开始执行 AI 规则分类...")
-		// 验证必填参数
-		if cfg.GenerateRules.OutputRulesPath == "" {
-			log.Fatal().Msg("错误: 缺少必填参数 generate_rules.output_rules_path，请在 config.yaml 中配置规则集输出目录")
+	// 只读校验模式：不执行 AI 分类，不修改输出目录
+	if *checkMode {
+		diff, err := refinery.Check(cfg, runOpts)
+		if err != nil {
+			log.Fatal().Msgf("错误: %v", err)
 		}
-		if cfg.AIClassifyRules.AIGeneratedClassifiedRules == "" {
-			log.Fatal().Msg("错误: 缺少必填参数 ai_classify_rules.ai_generated_classified_rules，请在 config.yaml 中配置 AI 生成规则分类文件输出路径")
+		if err := diff.WriteReport(os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "输出校验结果失败: %v\n", err)
+			os.Exit(1)
 		}
-		// 使用 classified_rules_file 加载现有配置，ai_generated_classified_rules 保存新配置
-		workflow.HandleAIClassifyRules(*configFile, cfg.AIClassifyRules.ClassifiedRulesFile, cfg.AIClassifyRules.AIGeneratedClassifiedRules)
-		log.Info().Msg("AI 规则分类完成")
+		if !diff.UpToDate() {
+			os.Exit(1)
+		}
+		return
 	}
 
-	// 执行规则集生成
-	if cfg.GenerateRules.Enabled {
-		log.Info().Msg("开始执行规则集生成...")
-		// 验证必填参数
-		if cfg.GenerateRules.OutputRulesPath == "" {
-			log.Fatal().Msg("错误: 缺少必填参数 generate_rules.output_rules_path，请在 config.yaml 中配置规则集输出目录")
-		}
-		if cfg.AIClassifyRules.ClassifiedRulesFile == "" {
-			log.Fatal().Msg("错误: 缺少必填参数 ai_classify_rules.classified_rules_file，请在 config.yaml 中配置规则分类文件路径")
-		}
-		// 执行规则集生成处理
-		workflow.HandleGenerateRuleSets(*configFile, cfg.AIClassifyRules.ClassifiedRulesFile, cfg.GenerateRules.OutputRulesPath)
-		log.Info().Msg("规则集生成完成")
+	// 超时后正常情况下各步骤会随 context 取消而返回；留出收尾时间后仍未结束则强制退出，保证进程一定终止
+	timeout := runOpts.Timeout
+	if timeout == 0 {
+		timeout = cfg.RunTimeout
+	}
+	if timeout > 0 {
+		time.AfterFunc(timeout+runTimeoutGrace, func() {
+			log.Error().Msgf("运行超时（%s）后 %s 仍未结束，强制退出", timeout, runTimeoutGrace)
+			os.Exit(1)
+		})
+	}
+
+	report, err := refinery.Run(cfg, runOpts)
+	if err != nil {
+		log.Fatal().Msgf("错误: %v", err)
+	}
+
+	if report.TokenUsage.TotalTokens > 0 {
+		log.Info().Msgf("AI token 使用: prompt=%d completion=%d total=%d",
+			report.TokenUsage.PromptTokens, report.TokenUsage.CompletionTokens, report.TokenUsage.TotalTokens)
 	}
 
 	log.Info().Msg("所有任务执行完成")
 }
 
+// runServe 启动规则集 HTTP 服务，收到 SIGINT/SIGTERM 时优雅关闭
+// 未指定 --dir 时从配置文件读取输出目录和文件扩展名
+func runServe() {
+	log.Logger = zerolog.New(zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.Kitchen}).With().Timestamp().Logger()
+
+	opts := refinery.ServeOptions{
+		Addr: *serveAddr,
+		Dir:  *serveDir,
+		Gzip: *serveGzip,
+	}
+	if opts.Dir == "" {
+		cfg, err := config.LoadConfig(*configFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "加载配置文件失败（或使用 --dir 指定规则集目录）: %v\n", err)
+			os.Exit(1)
+		}
+		opts.Dir = cfg.GenerateRules.OutputRulesPath
+		opts.ListExt = cfg.GenerateRules.ListExtension
+		opts.YAMLExt = cfg.GenerateRules.YAMLExtension
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := refinery.Serve(ctx, opts); err != nil {
+		fmt.Fprintf(os.Stderr, "规则集服务失败: %v\n", err)
+		os.Exit(1)
+	}
+}
+
 // initLogger 初始化日志系统
-func initLogger(cfg config.LoggingConfig) error {
+// consoleOut: 控制台日志输出目标（console_output 启用时生效）
+func initLogger(cfg config.LoggingConfig, consoleOut io.Writer) error {
 	// 解析日志级别
 	var level zerolog.Level
 	switch strings.ToLower(cfg.Level) {
@@ -124,7 +311,7 @@ func initLogger(cfg config.LoggingConfig) error {
 	if cfg.Format == "json" {
 		// JSON 格式
 		if cfg.ConsoleOutput {
-			writer = io.MultiWriter(file, os.Stdout)
+			writer = io.MultiWriter(file, consoleOut)
 		} else {
 			writer = file
 		}
@@ -154,13 +341,13 @@ func initLogger(cfg config.LoggingConfig) error {
 
 		if cfg.ConsoleOutput {
 			// 控制台使用带颜色的格式
-			consoleOut := zerolog.ConsoleWriter{
-				Out:        os.Stdout,
+			consoleWriterOut := zerolog.ConsoleWriter{
+				Out:        consoleOut,
 				TimeFormat: time.Kitchen,
 			}
 			writer = io.MultiWriter(
 				consoleWriter,
-				consoleOut,
+				consoleWriterOut,
 			)
 			log.Logger = zerolog.New(writer).With().Timestamp().Logger()
 		} else {
@@ -177,10 +364,67 @@ func printHelp() {
 	fmt.Println("AI-powered proxy rule aggregation, deduplication, classification, and multi-client export.")
 	fmt.Println()
 	fmt.Println("Usage:")
-	fmt.Printf("  %s [--config <configuration file>] [--help]\n\n", os.Args[0])
+	fmt.Printf("  %s [--config <configuration file>] [--skip-sources <glob>] [--stdout --format <format>] [--help]\n", os.Args[0])
+	fmt.Printf("  cat rules.list | %s --stdin [--ruleset <name>] [--format <format>]\n", os.Args[0])
+	fmt.Printf("  %s --check [--config <configuration file>]\n", os.Args[0])
+	fmt.Printf("  %s --init [--config <configuration file>] [--force]\n", os.Args[0])
+	fmt.Printf("  %s --migrate-config [--config <configuration file>]\n", os.Args[0])
+	fmt.Printf("  %s --inspect <file_or_url> [--config <configuration file>]\n", os.Args[0])
+	fmt.Printf("  %s --test-filter <ruleset> [--config <configuration file>]\n", os.Args[0])
+	fmt.Printf("  %s --merge-configs <a.yaml> <b.yaml> -o <out.yaml>\n", os.Args[0])
+	fmt.Printf("  %s serve [--addr :8080] [--dir <output>] [--gzip]\n\n", os.Args[0])
 
 	fmt.Println("Options:")
 	fmt.Println("  --config <file>         Path to configuration file (default: config.yaml)")
+	fmt.Println("  --skip-sources <glob>   Skip classifying downloaded files matching glob (path or URL, comma-separated)")
+	fmt.Println("  --stdout                Write generated rulesets in a single --format to stdout instead of files")
+	fmt.Println("  --run-timeout <dur>     Cancel the whole run after the duration, e.g. 30m (overrides run_timeout)")
+	fmt.Println("  --trace-rule <payload>  Log every filter/exclude evaluation for rules with this payload (e.g. www.example.com)")
+	fmt.Println("  --force-refresh         Ignore all caches: re-download existing rule files and re-classify already classified files")
+	fmt.Println("  --verify-with <binary>  Verify exported rulesets by loading them with a client binary (e.g. mihomo)")
+	fmt.Println("  --check                 Regenerate into a temp dir and compare with output_rules_path; exit 1 if stale")
+	fmt.Println("  --stdin                 Read rules from stdin and print the optimized result to stdout")
+	fmt.Println("  --ruleset <name>        Ruleset name used in stdin mode (default: stdin)")
+	fmt.Println("  --init                  Write a commented starter config.yaml and rule_config/classified_rules.yaml")
+	fmt.Println("  --force                 Overwrite existing files with --init")
+	fmt.Println("  --migrate-config        Rewrite renamed/deprecated fields in --config (original backed up as .bak)")
+	fmt.Println("  --inspect <src>         Print rule count, type histogram, first/last rules and parse warnings of one file or URL")
+	fmt.Println("  --test-filter <name>    Preview a ruleset's filters/excludes: per-type counts and kept/removed samples, no export")
+	fmt.Println("  --merge-configs         Merge two classified rules files; conflicts resolved in favor of the first")
+	fmt.Println("  -o <file>               Output file for --merge-configs")
+	fmt.Println("  --addr <addr>           Listen address for serve (default: :8080)")
+	fmt.Println("  --dir <dir>             Directory served by serve (default: generate_rules.output_rules_path)")
+	fmt.Println("  --gzip                  Compress serve responses for clients that accept gzip")
+	fmt.Println("  --format <format>       Output format: domain, ipcidr, classical, classical_no_resolve,")
+	fmt.Println("                          classical_all, classical_all_no_resolve; append .yaml/.list (default: classical_all)")
 	fmt.Println("  --help                  Show help information")
 	fmt.Println()
 }
+
+// parseFlags 解析命令行参数，允许位置参数与选项交替出现（如 a.yaml b.yaml -o out.yaml）
+// 返回所有位置参数
+func parseFlags() []string {
+	flag.Parse()
+
+	var positional []string
+	args := flag.Args()
+	for len(args) > 0 {
+		positional = append(positional, args[0])
+		if err := flag.CommandLine.Parse(args[1:]); err != nil {
+			os.Exit(2)
+		}
+		args = flag.Args()
+	}
+	return positional
+}
+
+// parseListFlag 解析逗号分隔的命令行参数
+func parseListFlag(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,86 @@
+package refinery
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"rulerefinery/internal/workflow"
+)
+
+// OutputDiff 已有输出目录与重新生成结果的差异
+type OutputDiff = workflow.OutputDiff
+
+// checkIgnoredFiles 校验时不比较的输出文件（内容包含生成时间或依赖上次运行的结果）
+var checkIgnoredFiles = []string{
+	RunSummaryFile,
+	workflow.StatisticsFile,
+	workflow.ChangelogFile,
+}
+
+// Check 只读校验：将规则集重新生成到临时目录，与 generate_rules.output_rules_path 中已有的输出比较
+// 不执行 AI 分类，不修改输出目录（包括运行汇总、变更日志和清理过期目录）；差异为空表示已有输出是最新的。
+// 输出中包含生成时间的文件（run_summary.md、statistics.json、CHANGELOG.md）和以 . 开头的内部状态文件不参与比较
+func Check(cfg *Config, opts RunOptions) (*OutputDiff, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("配置为空")
+	}
+	if !cfg.GenerateRules.Enabled {
+		return nil, fmt.Errorf("校验需要启用规则集生成（generate_rules.enabled）")
+	}
+	if cfg.GenerateRules.OutputRulesPath == "" {
+		return nil, fmt.Errorf("缺少必填参数 generate_rules.output_rules_path，请在 config.yaml 中配置规则集输出目录")
+	}
+	if cfg.AIClassifyRules.ClassifiedRulesFile == "" {
+		return nil, fmt.Errorf("缺少必填参数 ai_classify_rules.classified_rules_file，请在 config.yaml 中配置规则分类文件路径")
+	}
+
+	ctx := opts.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = cfg.RunTimeout
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	tmpDir, err := os.MkdirTemp("", "rulerefinery-check-*")
+	if err != nil {
+		return nil, fmt.Errorf("创建临时目录失败: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// 临时目录中没有上次的结果：不生成变更日志，也无需清理过期目录
+	checkCfg := *cfg
+	checkCfg.GenerateRules.EmitChangelog = false
+	checkCfg.GenerateRules.PruneStale = false
+
+	start := time.Now()
+	log.Info().Msgf("开始校验规则集输出: 重新生成到 %s 后与 %s 比较", tmpDir, cfg.GenerateRules.OutputRulesPath)
+	if _, err := workflow.HandleGenerateRuleSets(ctx, &checkCfg, workflow.GenerateOptions{
+		ClassifiedRulesFile: cfg.AIClassifyRules.ClassifiedRulesFile,
+		OutputRulesPath:     tmpDir,
+		ProviderPathPrefix:  cfg.GenerateRules.OutputRulesPath,
+		TraceRule:           opts.TraceRule,
+		ForceRefresh:        opts.ForceRefresh,
+		Version:             opts.Version,
+	}); err != nil {
+		return nil, fmt.Errorf("规则集生成失败: %w", err)
+	}
+
+	diff, err := workflow.CompareOutputDirs(cfg.GenerateRules.OutputRulesPath, tmpDir, checkIgnoredFiles)
+	if err != nil {
+		return nil, err
+	}
+	log.Info().Msgf("规则集输出校验完成（耗时 %s）: 缺失 %d，多余 %d，内容不同 %d",
+		formatDuration(time.Since(start)), len(diff.Missing), len(diff.Stale), len(diff.Changed))
+	return diff, nil
+}
@@ -0,0 +1,14 @@
+package refinery
+
+import (
+	"rulerefinery/internal/scaffold"
+)
+
+// InitOptions 初始化配置文件参数
+type InitOptions = scaffold.Options
+
+// Init 生成带注释的初始配置文件和规则分类文件，返回写入的文件路径
+// 文件已存在且未设置 Force 时不写入任何文件并返回错误
+func Init(opts InitOptions) ([]string, error) {
+	return scaffold.Init(opts)
+}
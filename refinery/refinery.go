@@ -0,0 +1,291 @@
+// Package refinery 提供 RuleRefinery 的库调用入口
+// 其他 Go 程序可以直接嵌入规则分类与规则集生成流程，无需通过命令行
+package refinery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"rulerefinery/internal/ai"
+	"rulerefinery/internal/config"
+	"rulerefinery/internal/rules"
+	"rulerefinery/internal/verify"
+	"rulerefinery/internal/workflow"
+)
+
+// Config 主配置（导出别名，便于外部程序构造配置）
+type Config = config.Config
+
+// TokenUsage AI token 使用情况
+type TokenUsage = ai.Usage
+
+// RuleType 规则类型
+type RuleType = rules.RuleType
+
+// LoadConfig 从文件加载主配置（并填充默认值）
+func LoadConfig(path string) (*Config, error) {
+	return config.LoadConfig(path)
+}
+
+// RunOptions 运行参数
+type RunOptions struct {
+	Context     context.Context // 运行上下文（可选，默认 context.Background()）
+	SkipSources []string        // AI 分类时跳过的来源 glob 模式（匹配本地路径或 URL）
+	Stdout      io.Writer       // 非 nil 时规则集生成只将 Format 格式写入该 Writer，不生成目录
+	Format      string          // Stdout 模式的输出格式：{kind}[.yaml|.list]，默认 classical_all
+	VerifyWith  string          // 规则集生成后使用该客户端二进制（如 mihomo）校验导出文件（可选）
+	Timeout     time.Duration   // 整个运行的超时时间（可选，0 时使用配置中的 run_timeout）
+	TraceRule   string          // 追踪的规则内容（如 www.example.com），记录其与每个 filter/exclude 的匹配结果（可选）
+	Version     string          // 工具版本（写入输出目录的 statistics.json，默认 dev）
+
+	// ForceRefresh 忽略所有缓存：重新下载已有的规则文件，重新分类已在规则分类文件中的 GitHub 规则文件
+	ForceRefresh bool
+}
+
+// Report 运行结果汇总
+type Report struct {
+	Classify *ClassifyReport // AI 分类统计（未启用时为 nil）
+	Generate *GenerateReport // 规则集生成统计（未启用时为 nil）
+
+	Unmatched  []string                    // 未分类的规则文件（GitHub URL 或本地路径）
+	TokenUsage TokenUsage                  // AI token 使用情况
+	Statistics map[string]map[RuleType]int // 每个规则集各类型的规则数量
+
+	Verification *VerifySummary // 客户端二进制校验结果（未启用或跳过时为 nil）
+
+	Completed []string // 已完成的步骤（超时或出错时说明运行到了哪一步）
+
+	Phases   []PhaseTiming // 各步骤耗时（AI 规则分类、规则集生成、规则集校验）
+	Duration time.Duration // 整个运行的耗时
+}
+
+// PhaseTiming 运行阶段及其耗时
+type PhaseTiming = workflow.PhaseTiming
+
+// Run 按配置执行 AI 规则分类和/或规则集生成
+func Run(cfg *Config, opts RunOptions) (*Report, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("配置为空")
+	}
+
+	ctx := opts.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	// 检查是否至少启用了一个功能
+	if !cfg.AIClassifyRules.Enabled && !cfg.GenerateRules.Enabled {
+		return nil, fmt.Errorf("必须至少启用一个功能（ai_classify_rules.enabled 或 generate_rules.enabled）")
+	}
+
+	format := opts.Format
+	if format == "" {
+		format = rules.ExportKindClassicalAll
+	}
+
+	// 整个运行的超时：到期后取消所有下载和 AI 请求
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = cfg.RunTimeout
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+		log.Info().Msgf("运行超时时间: %s", timeout)
+	}
+	if opts.ForceRefresh {
+		log.Info().Msg("强制刷新: 忽略所有缓存，重新下载和分类全部规则文件")
+	}
+
+	start := time.Now()
+	report, err := run(ctx, cfg, opts, format)
+	report.Duration = time.Since(start)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		completed := "无"
+		if len(report.Completed) > 0 {
+			completed = strings.Join(report.Completed, "；")
+		}
+		log.Error().Msgf("运行超时（run_timeout %s），已完成的步骤: %s", timeout, completed)
+		err = fmt.Errorf("运行超时（run_timeout %s）: %w", timeout, err)
+	}
+
+	// 运行汇总报告写入输出目录（失败时同样写入，便于在 CI 中查看运行到了哪一步）
+	if opts.Stdout == nil && cfg.GenerateRules.OutputRulesPath != "" {
+		summaryPath := filepath.Join(cfg.GenerateRules.OutputRulesPath, RunSummaryFile)
+		if writeErr := WriteRunSummary(summaryPath, report, err); writeErr != nil {
+			log.Warn().Msgf("写入运行汇总报告失败: %v", writeErr)
+		} else {
+			log.Info().Msgf("运行汇总报告已保存到: %s", summaryPath)
+		}
+	}
+	return report, err
+}
+
+// run 依次执行 AI 规则分类、规则集生成和校验，每完成一步记录到 report.Completed
+func run(ctx context.Context, cfg *Config, opts RunOptions, format string) (*Report, error) {
+	report := &Report{}
+
+	// 执行 AI 规则分类
+	if cfg.AIClassifyRules.Enabled {
+		log.Info().Msg("开始执行 AI 规则分类...")
+		// 验证必填参数
+		if cfg.GenerateRules.OutputRulesPath == "" {
+			return report, fmt.Errorf("缺少必填参数 generate_rules.output_rules_path，请在 config.yaml 中配置规则集输出目录")
+		}
+		if cfg.AIClassifyRules.AIGeneratedClassifiedRules == "" {
+			return report, fmt.Errorf("缺少必填参数 ai_classify_rules.ai_generated_classified_rules，请在 config.yaml 中配置 AI 生成规则分类文件输出路径")
+		}
+
+		// 使用 classified_rules_file 加载现有配置，ai_generated_classified_rules 保存新配置
+		classifyStart := time.Now()
+		classifyReport, err := workflow.HandleAIClassifyRules(ctx, cfg, workflow.ClassifyOptions{
+			ClassifiedRulesFile:        cfg.AIClassifyRules.ClassifiedRulesFile,
+			AIGeneratedClassifiedRules: cfg.AIClassifyRules.AIGeneratedClassifiedRules,
+			SkipSources:                opts.SkipSources,
+			ForceRefresh:               opts.ForceRefresh,
+		})
+		report.Phases = append(report.Phases, PhaseTiming{Name: "AI 规则分类", Duration: time.Since(classifyStart)})
+		if classifyReport != nil {
+			report.Classify = newClassifyReport(classifyReport)
+			report.Unmatched = classifyReport.Unmatched
+			report.TokenUsage = classifyReport.TokenUsage
+		}
+		if err != nil {
+			if classifyReport != nil && classifyReport.SucceededBatches > 0 {
+				report.Completed = append(report.Completed, fmt.Sprintf("AI 规则分类（部分完成: %d/%d 个批次，结果已保存）",
+					classifyReport.SucceededBatches, classifyReport.TotalBatches))
+			}
+			return report, fmt.Errorf("AI 规则分类失败: %w", err)
+		}
+		log.Info().Msg("AI 规则分类完成")
+		report.Completed = append(report.Completed, fmt.Sprintf("AI 规则分类（%d 个新分类）", report.Classify.Categories))
+	}
+
+	// 执行规则集生成
+	if cfg.GenerateRules.Enabled {
+		log.Info().Msg("开始执行规则集生成...")
+		// 验证必填参数（标准输出模式不需要输出目录）
+		if cfg.GenerateRules.OutputRulesPath == "" && opts.Stdout == nil {
+			return report, fmt.Errorf("缺少必填参数 generate_rules.output_rules_path，请在 config.yaml 中配置规则集输出目录")
+		}
+		if cfg.AIClassifyRules.ClassifiedRulesFile == "" {
+			return report, fmt.Errorf("缺少必填参数 ai_classify_rules.classified_rules_file，请在 config.yaml 中配置规则分类文件路径")
+		}
+
+		generateStart := time.Now()
+		generateReport, err := workflow.HandleGenerateRuleSets(ctx, cfg, workflow.GenerateOptions{
+			ClassifiedRulesFile: cfg.AIClassifyRules.ClassifiedRulesFile,
+			OutputRulesPath:     cfg.GenerateRules.OutputRulesPath,
+			Stdout:              opts.Stdout,
+			Format:              format,
+			TraceRule:           opts.TraceRule,
+			ForceRefresh:        opts.ForceRefresh,
+			Version:             opts.Version,
+		})
+		report.Phases = append(report.Phases, PhaseTiming{Name: "规则集生成", Duration: time.Since(generateStart)})
+		if err != nil {
+			return report, fmt.Errorf("规则集生成失败: %w", err)
+		}
+		report.Generate = newGenerateReport(generateReport)
+		report.Statistics = generateReport.Statistics
+		log.Info().Msg("规则集生成完成")
+		report.Completed = append(report.Completed, fmt.Sprintf("规则集生成（%d 个规则集）", generateReport.Rulesets))
+
+		// 使用客户端二进制校验导出文件
+		if opts.VerifyWith != "" && opts.Stdout == nil {
+			verifyStart := time.Now()
+			summary, err := verifyOutput(ctx, opts.VerifyWith, cfg)
+			report.Phases = append(report.Phases, PhaseTiming{Name: "规则集校验", Duration: time.Since(verifyStart)})
+			if err != nil {
+				return report, err
+			}
+			report.Verification = summary
+			if summary != nil {
+				report.Completed = append(report.Completed, "规则集校验")
+			}
+		}
+	}
+
+	return report, nil
+}
+
+// verifyOutput 使用客户端二进制校验导出目录，找不到二进制时跳过校验
+func verifyOutput(ctx context.Context, binary string, cfg *Config) (*VerifySummary, error) {
+	verifier, err := verify.NewMihomoVerifier(binary)
+	if err != nil {
+		log.Warn().Msgf("跳过规则集校验: %v", err)
+		return nil, nil
+	}
+	verifier.SetFileExtensions(cfg.GenerateRules.ListExtension, cfg.GenerateRules.YAMLExtension)
+	verifier.SetLayout(cfg.GenerateRules.Layout)
+	outputDir := cfg.GenerateRules.OutputRulesPath
+
+	log.Info().Msgf("开始使用 %s 校验导出的规则集...", binary)
+	summary, err := verifier.VerifyDir(ctx, outputDir)
+	if err != nil {
+		return nil, fmt.Errorf("规则集校验失败: %w", err)
+	}
+
+	log.Info().Msgf("规则集校验完成: 通过 %d，失败 %d，跳过 %d", summary.Passed, summary.Failed, summary.Skipped)
+	if summary.Failed > 0 {
+		return summary, fmt.Errorf("%d 个规则文件无法被 %s 加载: %s", summary.Failed, binary, strings.Join(summary.FailedFiles(), ", "))
+	}
+	return summary, nil
+}
+
+// MigrationChange 配置迁移中的一项变更
+type MigrationChange = config.MigrationChange
+
+// MigrateConfig 对配置文件执行已知的字段迁移（如重命名的字段），备份原文件后写回
+// 返回执行的变更和备份路径，没有需要迁移的字段时不修改文件
+func MigrateConfig(configPath string) ([]MigrationChange, string, error) {
+	report, err := workflow.HandleMigrateConfig(configPath)
+	if err != nil {
+		return nil, "", err
+	}
+	return report.Changes, report.BackupPath, nil
+}
+
+// Inspection 单个规则文件的诊断结果
+type Inspection = rules.Inspection
+
+// Inspect 诊断单个规则文件或 URL（规则数量、类型分布、首尾示例、无法解析的行）
+// cfg 可为 nil，此时下载 URL 不使用代理
+func Inspect(ctx context.Context, cfg *Config, source string) (*Inspection, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return workflow.HandleInspect(ctx, cfg, source)
+}
+
+// FilterPreview 规则集 filters/excludes 的效果预览
+type FilterPreview = rules.FilterPreview
+
+// TestFilter 预览规则集 filters/excludes 的效果：只加载该规则集，去重后应用过滤，
+// 返回各类型过滤前后的数量和保留/移除的规则示例，不导出任何文件
+func TestFilter(ctx context.Context, cfg *Config, ruleset string) (*FilterPreview, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return workflow.HandleTestFilter(ctx, cfg, ruleset)
+}
+
+// MergeConflict 合并规则分类文件时发现的冲突
+type MergeConflict = config.MergeConflict
+
+// MergeClassifiedRules 合并两个规则分类文件并写入 outputPath，冲突时以 primaryPath 为准
+func MergeClassifiedRules(primaryPath, secondaryPath, outputPath string) ([]MergeConflict, error) {
+	report, err := workflow.HandleMergeClassifiedRules(primaryPath, secondaryPath, outputPath)
+	if err != nil {
+		return nil, err
+	}
+	return report.Conflicts, nil
+}
@@ -0,0 +1,152 @@
+package refinery
+
+import (
+	"rulerefinery/internal/config"
+	"rulerefinery/internal/loader"
+	"rulerefinery/internal/rules"
+	"rulerefinery/internal/verify"
+	"rulerefinery/internal/workflow"
+)
+
+// DownloadCounts 下载统计（下载、复用缓存、失败的数量和字节数）
+type DownloadCounts = loader.DownloadCounts
+
+// LintIssue 加载时发现的可疑规则
+type LintIssue = rules.LintIssue
+
+// InvalidRule 加载时丢弃的无效规则
+type InvalidRule = rules.InvalidRule
+
+// MetadataMismatch 实际解析数量与文件元数据声明不一致的项
+type MetadataMismatch = rules.MetadataMismatch
+
+// FilterIssue 过滤器检查发现的问题
+type FilterIssue = rules.FilterIssue
+
+// SubtractResult 规则集因跨规则集排除或优先级移除的规则数量
+type SubtractResult = rules.SubtractResult
+
+// InvalidRuleset 未通过验证而被跳过的规则集
+type InvalidRuleset = config.InvalidRuleset
+
+// VerifySummary 客户端二进制校验汇总
+type VerifySummary = verify.Summary
+
+// ClassifyReport AI 规则分类统计
+type ClassifyReport struct {
+	NewRuleFiles      int        // 本次待分类的新规则文件数
+	SkippedExisting   int        // 已在配置中而跳过的规则文件数
+	SkippedBySource   int        // 匹配 SkipSources 而跳过的规则文件数
+	Categories        int        // 本次生成的分类数
+	ClassifiedSources int        // 本次分类的来源数（URLs + Files + Rules）
+	Unmatched         []string   // 未分类的规则文件（GitHub URL 或本地路径）
+	TokenUsage        TokenUsage // AI token 使用情况
+
+	TotalBatches     int // AI 分类批次总数
+	SucceededBatches int // 分类成功的批次数（超时或出错时用于说明进度）
+	FailedBatches    int // 分类失败的批次数（不含因熔断或运行取消而中止的批次）
+
+	SimilarityMatched int // 按内容相似度直接归入已有规则集的规则文件数（未交给 AI）
+	PathMatched       int // 按 path_classifiers 直接归入规则集的规则文件数（未交给 AI）
+
+	Downloads DownloadCounts // GitHub 规则文件的下载统计
+	Phases    []PhaseTiming  // 各阶段耗时
+}
+
+// GenerateReport 规则集生成统计
+type GenerateReport struct {
+	Rulesets    int                         // 成功加载的规则集数量
+	LoadedFiles int                         // 加载到优化器的规则文件数量
+	Statistics  map[string]map[RuleType]int // 每个规则集各类型的规则数量（去重后）
+
+	GuardrailViolations []string      // 规则数量超出 min_rules/max_rules 的规则集说明
+	PrunedDirs          []string      // prune_stale 删除的过期规则集目录
+	LintIssues          []LintIssue   // 可疑规则（如 DOMAIN 包含通配符、路径或端口）
+	InvalidRules        []InvalidRule // 加载时丢弃的无效规则
+	AutofixCount        int           // autofix 自动修正的规则数量
+
+	MetadataMismatches []MetadataMismatch  // check_metadata: 实际解析数量与文件元数据声明不一致的项
+	FilterIssues       []FilterIssue       // 没有匹配任何规则的过滤模式、被过滤清空的规则集或规则类型
+	Subtractions       []SubtractResult    // subtract_rulesets: 各规则集排除的规则数量
+	PriorityMoves      []SubtractResult    // ruleset_priority: 只保留在优先级更高的规则集中而被移除的规则数量
+	Conflicts          map[string][]string // conflict_mode: 同时出现在多个规则集中的规则内容 -> 规则集名称
+	InvalidRulesets    []InvalidRuleset    // skip_invalid_rulesets: 未通过验证而被跳过的规则集
+	Changes            []RulesetChange     // emit_changelog: 各规则集相对上次运行的变更（包括没有变化的规则集）
+
+	RulesBeforeDedup int // 去重前的规则总数
+	RulesAfterDedup  int // 去重后的规则总数
+
+	Downloads DownloadCounts // URL 来源的下载统计
+	Phases    []PhaseTiming  // 各阶段耗时
+}
+
+// RulesetChange 规则集相对上次运行的变更
+type RulesetChange struct {
+	Name       string
+	Added      int      // 新增的规则数量
+	Removed    int      // 移除的规则数量
+	NewDomains []string // 新增的 DOMAIN/DOMAIN-SUFFIX 域名（只列出前几个）
+	New        bool     // 上次运行没有该规则集
+	Deleted    bool     // 规则集已从规则分类文件中移除
+}
+
+// Changed 是否有变化
+func (c RulesetChange) Changed() bool {
+	return c.New || c.Deleted || c.Added > 0 || c.Removed > 0
+}
+
+// newClassifyReport 复制 workflow 的 AI 分类统计
+func newClassifyReport(r *workflow.ClassifyReport) *ClassifyReport {
+	return &ClassifyReport{
+		NewRuleFiles:      r.NewRuleFiles,
+		SkippedExisting:   r.SkippedExisting,
+		SkippedBySource:   r.SkippedBySource,
+		Categories:        r.Categories,
+		ClassifiedSources: r.ClassifiedSources,
+		Unmatched:         r.Unmatched,
+		TokenUsage:        r.TokenUsage,
+		TotalBatches:      r.TotalBatches,
+		SucceededBatches:  r.SucceededBatches,
+		FailedBatches:     r.FailedBatches,
+		SimilarityMatched: r.SimilarityMatched,
+		PathMatched:       r.PathMatched,
+		Downloads:         r.Downloads,
+		Phases:            r.Phases,
+	}
+}
+
+// newGenerateReport 复制 workflow 的规则集生成统计
+func newGenerateReport(r *workflow.GenerateReport) *GenerateReport {
+	changes := make([]RulesetChange, len(r.Changes))
+	for i, change := range r.Changes {
+		changes[i] = RulesetChange{
+			Name:       change.Name,
+			Added:      change.Added,
+			Removed:    change.Removed,
+			NewDomains: change.NewDomains,
+			New:        change.New,
+			Deleted:    change.Deleted,
+		}
+	}
+	return &GenerateReport{
+		Rulesets:            r.Rulesets,
+		LoadedFiles:         r.LoadedFiles,
+		Statistics:          r.Statistics,
+		GuardrailViolations: r.GuardrailViolations,
+		PrunedDirs:          r.PrunedDirs,
+		LintIssues:          r.LintIssues,
+		InvalidRules:        r.InvalidRules,
+		AutofixCount:        r.AutofixCount,
+		MetadataMismatches:  r.MetadataMismatches,
+		FilterIssues:        r.FilterIssues,
+		Subtractions:        r.Subtractions,
+		PriorityMoves:       r.PriorityMoves,
+		Conflicts:           r.Conflicts,
+		InvalidRulesets:     r.InvalidRulesets,
+		Changes:             changes,
+		RulesBeforeDedup:    r.RulesBeforeDedup,
+		RulesAfterDedup:     r.RulesAfterDedup,
+		Downloads:           r.Downloads,
+		Phases:              r.Phases,
+	}
+}
@@ -0,0 +1,43 @@
+package refinery
+
+import (
+	"reflect"
+	"testing"
+
+	"rulerefinery/internal/workflow"
+)
+
+// TestReportFieldsMatchWorkflow 导出的报告类型需要包含 workflow 报告的全部字段（新增字段时同步复制）
+func TestReportFieldsMatchWorkflow(t *testing.T) {
+	pairs := []struct {
+		internal, exported reflect.Type
+	}{
+		{reflect.TypeOf(workflow.ClassifyReport{}), reflect.TypeOf(ClassifyReport{})},
+		{reflect.TypeOf(workflow.GenerateReport{}), reflect.TypeOf(GenerateReport{})},
+		{reflect.TypeOf(workflow.RulesetChange{}), reflect.TypeOf(RulesetChange{})},
+	}
+	for _, pair := range pairs {
+		for i := 0; i < pair.internal.NumField(); i++ {
+			field := pair.internal.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			if _, ok := pair.exported.FieldByName(field.Name); !ok {
+				t.Errorf("%s is missing field %s", pair.exported.Name(), field.Name)
+			}
+		}
+	}
+}
+
+func TestNewGenerateReportCopiesChanges(t *testing.T) {
+	report := newGenerateReport(&workflow.GenerateReport{
+		Rulesets: 2,
+		Changes:  []workflow.RulesetChange{{Name: "google", Added: 3}, {Name: "apple"}},
+	})
+	if report.Rulesets != 2 || len(report.Changes) != 2 {
+		t.Fatalf("newGenerateReport() = %+v", report)
+	}
+	if got := countChangedRulesets(report.Changes); got != 1 {
+		t.Errorf("countChangedRulesets() = %d, want 1", got)
+	}
+}
@@ -0,0 +1,19 @@
+package refinery
+
+import (
+	"context"
+
+	"rulerefinery/internal/server"
+)
+
+// ServeOptions 规则集 HTTP 服务参数
+type ServeOptions = server.Options
+
+// Serve 通过 HTTP 提供规则集输出目录中的文件（带索引页），ctx 取消时优雅关闭
+func Serve(ctx context.Context, opts ServeOptions) error {
+	srv, err := server.New(opts)
+	if err != nil {
+		return err
+	}
+	return srv.ListenAndServe(ctx)
+}
@@ -0,0 +1,41 @@
+package refinery
+
+import (
+	"fmt"
+	"io"
+
+	"rulerefinery/internal/rules"
+)
+
+// StreamOptions 流式处理参数
+type StreamOptions struct {
+	Ruleset string // 规则集名称（用于 classical 文件头注释，默认 stdin）
+	Format  string // 输出格式：{kind}[.yaml|.list]，默认 classical_all
+}
+
+// RefineStream 从 r 读取规则，去重排序后以指定格式写入 w
+// 与规则集生成使用相同的 ParseRule / Optimizer 流程，无需配置文件
+func RefineStream(r io.Reader, w io.Writer, opts StreamOptions) error {
+	name := opts.Ruleset
+	if name == "" {
+		name = "stdin"
+	}
+	format := opts.Format
+	if format == "" {
+		format = rules.ExportKindClassicalAll
+	}
+
+	kind, asYAML, err := rules.ParseExportFormat(format)
+	if err != nil {
+		return err
+	}
+
+	optimizer := rules.NewOptimizer()
+	if err := optimizer.LoadRules(r, name, "stdin"); err != nil {
+		return fmt.Errorf("读取规则失败: %w", err)
+	}
+	rules.LogLintIssues(optimizer.LintIssues())
+	optimizer.Deduplicate()
+
+	return optimizer.WriteRuleset(w, name, kind, asYAML)
+}
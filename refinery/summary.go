@@ -0,0 +1,175 @@
+package refinery
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"rulerefinery/internal/loader"
+	"rulerefinery/internal/rules"
+	"rulerefinery/internal/workflow"
+)
+
+// RunSummaryFile 运行汇总报告的文件名（写入规则集输出目录）
+const RunSummaryFile = "run_summary.md"
+
+// WriteRunSummary 将运行结果汇总为 Markdown 写入 path：各步骤耗时、下载统计、AI 分类批次和 token 使用、
+// 去重前后的规则数量和各规则集统计。runErr 为运行返回的错误（成功时为 nil），便于在 CI 中一眼看出运行状况
+func WriteRunSummary(path string, report *Report, runErr error) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("创建目录失败: %w", err)
+	}
+	return os.WriteFile(path, FormatRunSummary(report, runErr), 0644)
+}
+
+// FormatRunSummary 生成运行汇总报告（Markdown）
+func FormatRunSummary(report *Report, runErr error) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("# RuleRefinery 运行汇总\n\n")
+	fmt.Fprintf(&buf, "- 生成时间: %s\n", time.Now().Format("2006-01-02 15:04:05"))
+	if runErr != nil {
+		fmt.Fprintf(&buf, "- 结果: **失败** — %v\n", runErr)
+	} else {
+		buf.WriteString("- 结果: 成功\n")
+	}
+	fmt.Fprintf(&buf, "- 总耗时: %s\n", formatDuration(report.Duration))
+	if len(report.Completed) > 0 {
+		buf.WriteString("- 已完成的步骤:\n")
+		for _, step := range report.Completed {
+			fmt.Fprintf(&buf, "  - %s\n", step)
+		}
+	}
+
+	writePhaseSummary(&buf, report)
+	writeDownloadSummary(&buf, report)
+	if report.Classify != nil {
+		writeClassifySummary(&buf, report)
+	}
+	if report.Generate != nil {
+		writeGenerateSummary(&buf, report)
+	}
+	if v := report.Verification; v != nil {
+		buf.WriteString("\n## 规则集校验\n\n")
+		fmt.Fprintf(&buf, "- 通过 %d，失败 %d，跳过 %d\n", v.Passed, v.Failed, v.Skipped)
+	}
+	return buf.Bytes()
+}
+
+// writePhaseSummary 各步骤耗时，步骤内的阶段缩进显示在步骤之后
+func writePhaseSummary(buf *bytes.Buffer, report *Report) {
+	if len(report.Phases) == 0 {
+		return
+	}
+	buf.WriteString("\n## 耗时\n\n| 阶段 | 耗时 |\n| --- | ---: |\n")
+	for _, phase := range report.Phases {
+		fmt.Fprintf(buf, "| %s | %s |\n", phase.Name, formatDuration(phase.Duration))
+		var subPhases []PhaseTiming
+		switch {
+		case phase.Name == "AI 规则分类" && report.Classify != nil:
+			subPhases = report.Classify.Phases
+		case phase.Name == "规则集生成" && report.Generate != nil:
+			subPhases = report.Generate.Phases
+		}
+		for _, sub := range subPhases {
+			fmt.Fprintf(buf, "| └ %s | %s |\n", sub.Name, formatDuration(sub.Duration))
+		}
+	}
+}
+
+// writeDownloadSummary 下载统计（成功下载、复用缓存、失败）
+func writeDownloadSummary(buf *bytes.Buffer, report *Report) {
+	var rows []string
+	if report.Classify != nil {
+		rows = append(rows, downloadRow("GitHub 仓库（AI 分类）", report.Classify.Downloads))
+	}
+	if report.Generate != nil {
+		rows = append(rows, downloadRow("规则集 URL 来源", report.Generate.Downloads))
+	}
+	if len(rows) == 0 {
+		return
+	}
+	buf.WriteString("\n## 下载\n\n| 来源 | 下载 | 复用缓存 | 失败 |\n| --- | ---: | ---: | ---: |\n")
+	for _, row := range rows {
+		buf.WriteString(row)
+	}
+}
+
+// downloadRow 下载统计表格中的一行
+func downloadRow(name string, counts DownloadCounts) string {
+	return fmt.Sprintf("| %s | %d 个（%s） | %d 个（%s） | %d 个 |\n", name,
+		counts.DownloadedFiles, loader.FormatBytes(counts.DownloadedBytes),
+		counts.CachedFiles, loader.FormatBytes(counts.CachedBytes),
+		counts.FailedFiles)
+}
+
+// writeClassifySummary AI 分类统计
+func writeClassifySummary(buf *bytes.Buffer, report *Report) {
+	c := report.Classify
+	buf.WriteString("\n## AI 分类\n\n")
+	fmt.Fprintf(buf, "- 新规则文件: %d（跳过已分类 %d，跳过 skip_sources %d）\n", c.NewRuleFiles, c.SkippedExisting, c.SkippedBySource)
+	if c.PathMatched > 0 {
+		fmt.Fprintf(buf, "- 按路径归入规则集: %d\n", c.PathMatched)
+	}
+	if c.SimilarityMatched > 0 {
+		fmt.Fprintf(buf, "- 按相似度归入已有规则集: %d\n", c.SimilarityMatched)
+	}
+	fmt.Fprintf(buf, "- 批次: 成功 %d/%d，失败 %d\n", c.SucceededBatches, c.TotalBatches, c.FailedBatches)
+	fmt.Fprintf(buf, "- 新分类: %d（%d 个来源）\n", c.Categories, c.ClassifiedSources)
+	fmt.Fprintf(buf, "- 未分类: %d\n", len(report.Unmatched))
+	fmt.Fprintf(buf, "- Token: 输入 %d，输出 %d，合计 %d\n",
+		report.TokenUsage.PromptTokens, report.TokenUsage.CompletionTokens, report.TokenUsage.TotalTokens)
+}
+
+// writeGenerateSummary 规则集生成统计
+func writeGenerateSummary(buf *bytes.Buffer, report *Report) {
+	g := report.Generate
+	buf.WriteString("\n## 规则集生成\n\n")
+	fmt.Fprintf(buf, "- 规则集: %d（加载 %d 个规则文件）\n", g.Rulesets, g.LoadedFiles)
+	if g.RulesBeforeDedup > 0 {
+		removed := g.RulesBeforeDedup - g.RulesAfterDedup
+		fmt.Fprintf(buf, "- 规则数: 去重前 %d，去重后 %d（减少 %d，%.1f%%）\n", g.RulesBeforeDedup, g.RulesAfterDedup,
+			removed, float64(removed)*100/float64(g.RulesBeforeDedup))
+	}
+	if g.AutofixCount > 0 {
+		fmt.Fprintf(buf, "- 自动修正: %d 条\n", g.AutofixCount)
+	}
+	if len(g.LintIssues) > 0 {
+		fmt.Fprintf(buf, "- 可疑规则: %d 条\n", len(g.LintIssues))
+	}
+	if len(g.InvalidRules) > 0 {
+		fmt.Fprintf(buf, "- 无效规则（已丢弃）: %d 条\n", len(g.InvalidRules))
+	}
+	if len(g.InvalidRulesets) > 0 {
+		fmt.Fprintf(buf, "- 跳过未通过验证的规则集: %d\n", len(g.InvalidRulesets))
+	}
+	if len(g.Conflicts) > 0 {
+		fmt.Fprintf(buf, "- 跨规则集冲突: %d 条规则内容同时出现在多个规则集中（见 %s）\n", len(g.Conflicts), rules.ConflictReportFile)
+	}
+	if changed := countChangedRulesets(g.Changes); changed > 0 {
+		fmt.Fprintf(buf, "- 相对上次运行有变化的规则集: %d（见 %s）\n", changed, workflow.ChangelogFile)
+	}
+	for _, violation := range g.GuardrailViolations {
+		fmt.Fprintf(buf, "- 规则数量超出范围: %s\n", violation)
+	}
+	if table := rules.FormatStatistics(report.Statistics); table != "" {
+		fmt.Fprintf(buf, "\n```\n%s\n```\n", table)
+	}
+}
+
+// countChangedRulesets 统计有变化的规则集数量
+func countChangedRulesets(changes []RulesetChange) int {
+	changed := 0
+	for _, change := range changes {
+		if change.Changed() {
+			changed++
+		}
+	}
+	return changed
+}
+
+// formatDuration 耗时保留到毫秒
+func formatDuration(d time.Duration) string {
+	return d.Round(time.Millisecond).String()
+}